@@ -0,0 +1,346 @@
+// Copyright 2017, 2018 Paul C. Brown. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	mapset "github.com/deckarep/golang-set"
+	"github.com/pkg/errors"
+)
+
+// JournalEntry is the serialized record of a single committed change. Added concepts have only an AfterState;
+// removed concepts have only a BeforeState.
+type JournalEntry struct {
+	Timestamp      time.Time
+	NatureOfChange string
+	ConceptID      string
+	BeforeState    *ConceptState `json:",omitempty"`
+	AfterState     *ConceptState `json:",omitempty"`
+}
+
+// newJournalEntry creates the JournalEntry recording the ChangeEvent
+func newJournalEntry(event *ChangeEvent) *JournalEntry {
+	var entry JournalEntry
+	entry.Timestamp = event.Timestamp
+	entry.NatureOfChange = event.NatureOfChange.String()
+	entry.ConceptID = event.ConceptID
+	entry.BeforeState = event.BeforeState
+	entry.AfterState = event.AfterState
+	return &entry
+}
+
+// ChangeJournal is an append-only file of JournalEntries, one JSON object per line. Entries are written when the
+// transaction making the changes releases its locks; changes that are rolled back are never written. Neither are
+// changes to concepts that are not saved with the workspace: those whose root is a core concept, the Transient
+// concept, or a root excluded with ExcludeRoot. They are rebuilt, with new IDs, each session, so their entries could
+// not be replayed.
+type ChangeJournal struct {
+	sync.Mutex
+	path          string
+	file          *os.File
+	encoder       *json.Encoder
+	excludedRoots map[string]bool
+}
+
+// OpenChangeJournal opens the journal at the given path for appending, creating the file if it does not exist
+func OpenChangeJournal(path string) (*ChangeJournal, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "OpenChangeJournal failed")
+	}
+	var journal ChangeJournal
+	journal.path = path
+	journal.file = file
+	journal.encoder = json.NewEncoder(file)
+	journal.excludedRoots = make(map[string]bool)
+	return &journal, nil
+}
+
+// ExcludeRoot excludes the changes to the root concept with the given ID and to the concepts it owns from the journal
+func (cjPtr *ChangeJournal) ExcludeRoot(rootID string) {
+	cjPtr.Lock()
+	defer cjPtr.Unlock()
+	cjPtr.excludedRoots[rootID] = true
+}
+
+// isExcludedRoot returns true if the changes to the root concept with the given ID are excluded from the journal
+func (cjPtr *ChangeJournal) isExcludedRoot(rootID string) bool {
+	cjPtr.Lock()
+	defer cjPtr.Unlock()
+	return cjPtr.excludedRoots[rootID]
+}
+
+// appendEvents writes entries for the events to the journal and flushes them to stable storage
+func (cjPtr *ChangeJournal) appendEvents(events []*ChangeEvent) error {
+	cjPtr.Lock()
+	defer cjPtr.Unlock()
+	if cjPtr.file == nil {
+		return errors.New("ChangeJournal.appendEvents called on closed journal: " + cjPtr.path)
+	}
+	for _, event := range events {
+		err := cjPtr.encoder.Encode(newJournalEntry(event))
+		if err != nil {
+			return errors.Wrap(err, "ChangeJournal.appendEvents failed")
+		}
+	}
+	err := cjPtr.file.Sync()
+	if err != nil {
+		return errors.Wrap(err, "ChangeJournal.appendEvents failed")
+	}
+	return nil
+}
+
+// Close closes the journal file
+func (cjPtr *ChangeJournal) Close() error {
+	cjPtr.Lock()
+	defer cjPtr.Unlock()
+	if cjPtr.file == nil {
+		return nil
+	}
+	err := cjPtr.file.Close()
+	cjPtr.file = nil
+	cjPtr.encoder = nil
+	if err != nil {
+		return errors.Wrap(err, "ChangeJournal.Close failed")
+	}
+	return nil
+}
+
+// GetPath returns the path of the journal file
+func (cjPtr *ChangeJournal) GetPath() string {
+	return cjPtr.path
+}
+
+// Truncate discards all of the entries in the journal. It is intended to be called once the changes have been
+// captured in a saved snapshot.
+func (cjPtr *ChangeJournal) Truncate() error {
+	cjPtr.Lock()
+	defer cjPtr.Unlock()
+	if cjPtr.file == nil {
+		return errors.New("ChangeJournal.Truncate called on closed journal: " + cjPtr.path)
+	}
+	err := cjPtr.file.Truncate(0)
+	if err != nil {
+		return errors.Wrap(err, "ChangeJournal.Truncate failed")
+	}
+	return nil
+}
+
+// ReadJournal reads all of the entries in the journal
+func ReadJournal(reader io.Reader) ([]*JournalEntry, error) {
+	var entries []*JournalEntry
+	decoder := json.NewDecoder(reader)
+	for {
+		var entry JournalEntry
+		err := decoder.Decode(&entry)
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, errors.Wrap(err, "ReadJournal failed")
+		}
+		entries = append(entries, &entry)
+	}
+}
+
+// GetChangeJournal returns the journal to which committed changes are written, if any
+func (uOfDPtr *UniverseOfDiscourse) GetChangeJournal() *ChangeJournal {
+	return uOfDPtr.journal
+}
+
+// SetChangeJournal sets the journal to which committed changes are written. A nil journal turns journaling off.
+func (uOfDPtr *UniverseOfDiscourse) SetChangeJournal(journal *ChangeJournal) {
+	uOfDPtr.journal = journal
+}
+
+// recordChange records the change in the transaction if the uOfD is journaling or has subscriptions
+func (uOfDPtr *UniverseOfDiscourse) recordChange(natureOfChange NatureOfChange, beforeState *ConceptState, afterState *ConceptState, trans *Transaction) {
+	if trans == nil || !uOfDPtr.isRecordingChanges() {
+		return
+	}
+	trans.Lock()
+	defer trans.Unlock()
+	trans.changeEvents = append(trans.changeEvents, newChangeEvent(natureOfChange, beforeState, afterState))
+}
+
+// recordOwnedConceptChange records the change to the owner's version resulting from the addition or removal of an
+// owned concept. It is called after the version has been incremented.
+func (uOfDPtr *UniverseOfDiscourse) recordOwnedConceptChange(owner Concept, trans *Transaction) {
+	if trans == nil || !uOfDPtr.isRecordingChanges() {
+		return
+	}
+	afterState, err := NewConceptState(owner)
+	if err != nil {
+		log.Printf("UniverseOfDiscourse.recordOwnedConceptChange failed: %s", err.Error())
+		return
+	}
+	beforeState := *afterState
+	beforeState.Version = strconv.Itoa(owner.getVersionNoLock() - 1)
+	uOfDPtr.recordChange(OwnedConceptChanged, &beforeState, afterState, trans)
+}
+
+// journaledEvents returns the events for the concepts whose changes are written to the journal (see ChangeJournal)
+func (uOfDPtr *UniverseOfDiscourse) journaledEvents(journal *ChangeJournal, events []*ChangeEvent, trans *Transaction) []*ChangeEvent {
+	var journaled []*ChangeEvent
+	for _, event := range events {
+		state := event.getState()
+		if state == nil || uOfDPtr.isJournaled(journal, state, trans) {
+			journaled = append(journaled, event)
+		}
+	}
+	return journaled
+}
+
+// isJournaled returns true unless the root of the concept with the given state is a core concept, the Transient
+// concept, or a root excluded from the journal. The concept's current owner is used if it is still in the uOfD, since
+// a concept is typically changed before it is given its owner.
+func (uOfDPtr *UniverseOfDiscourse) isJournaled(journal *ChangeJournal, state *ConceptState, trans *Transaction) bool {
+	if state.IsCore == "true" {
+		return false
+	}
+	rootID, rootURI := state.ConceptID, state.URI
+	visited := map[string]bool{rootID: true}
+	ownerID := state.OwningConceptID
+	if el := uOfDPtr.GetElement(state.ConceptID); el != nil {
+		ownerID = el.GetOwningConceptID(trans)
+	}
+	for ownerID != "" && !visited[ownerID] {
+		visited[ownerID] = true
+		owner := uOfDPtr.GetElement(ownerID)
+		if owner == nil {
+			break
+		}
+		if owner.GetIsCore(trans) {
+			return false
+		}
+		rootID, rootURI = ownerID, owner.GetURI(trans)
+		ownerID = owner.GetOwningConceptID(trans)
+	}
+	return rootURI != TransientURI && !journal.isExcludedRoot(rootID)
+}
+
+// isRecordingChanges returns true if committed changes are needed for either the journal or subscriptions
+func (uOfDPtr *UniverseOfDiscourse) isRecordingChanges() bool {
+	return uOfDPtr.journal != nil || uOfDPtr.subscriptions.hasSubscriptions()
+}
+
+// ReplayJournal applies the entries in the journal to the uOfD. The uOfD is expected to contain the base snapshot
+// from which the journal was started, typically recovered with RecoverDomain. The recorded states are applied
+// directly: no notifications are sent and no functions are executed, since any changes they made at the time are
+// themselves in the journal. Added concepts that are already present and removed concepts that are already absent
+// are skipped.
+func (uOfDPtr *UniverseOfDiscourse) ReplayJournal(reader io.Reader, trans *Transaction) error {
+	entries, err := ReadJournal(reader)
+	if err != nil {
+		return errors.Wrap(err, "UniverseOfDiscourse.ReplayJournal failed")
+	}
+	for _, entry := range entries {
+		err = uOfDPtr.replayJournalEntry(entry, trans)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.ReplayJournal failed")
+		}
+	}
+	return nil
+}
+
+func (uOfDPtr *UniverseOfDiscourse) replayJournalEntry(entry *JournalEntry, trans *Transaction) error {
+	natureOfChange, err := FindNatureOfChange(entry.NatureOfChange)
+	if err != nil {
+		return errors.Wrap(err, "UniverseOfDiscourse.replayJournalEntry failed")
+	}
+	switch natureOfChange {
+	case ConceptAdded:
+		if entry.AfterState == nil {
+			return errors.New("UniverseOfDiscourse.replayJournalEntry ConceptAdded entry has no AfterState: " + entry.ConceptID)
+		}
+		if uOfDPtr.GetElement(entry.ConceptID) != nil {
+			return nil
+		}
+		data, err := json.Marshal(entry.AfterState)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.replayJournalEntry failed")
+		}
+		_, err = uOfDPtr.RecoverElement(data, trans)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.replayJournalEntry failed")
+		}
+	case ConceptRemoved:
+		el := uOfDPtr.GetElement(entry.ConceptID)
+		if el == nil {
+			return nil
+		}
+		err := trans.WriteLockElement(el)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.replayJournalEntry failed")
+		}
+		err = uOfDPtr.undoManager.markRemovedElement(el, trans)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.replayJournalEntry failed")
+		}
+		ownerID := el.GetOwningConceptID(trans)
+		if ownerID != "" {
+			uOfDPtr.removeMappedValueFromOwnedIDsMap(ownerID, entry.ConceptID)
+		}
+		uOfDPtr.removeElementForUndo(el, trans)
+		uOfDPtr.deleteKeyFromListenersMap(entry.ConceptID)
+		uOfDPtr.abstractionsMap.DeleteKey(entry.ConceptID)
+		uOfDPtr.deleteKeyFromOwnedIDsMap(entry.ConceptID)
+		err = el.setUniverseOfDiscourse(nil, trans)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.replayJournalEntry failed")
+		}
+	case ConceptChanged, OwningConceptChanged, ReferencedConceptChanged, AbstractConceptChanged, RefinedConceptChanged, OwnedConceptChanged:
+		if entry.AfterState == nil {
+			return errors.New("UniverseOfDiscourse.replayJournalEntry " + entry.NatureOfChange + " entry has no AfterState: " + entry.ConceptID)
+		}
+		el := uOfDPtr.GetElement(entry.ConceptID)
+		if el == nil {
+			return errors.New("UniverseOfDiscourse.replayJournalEntry changed concept not found: " + entry.ConceptID)
+		}
+		afterState, err := uOfDPtr.newConceptFromState(entry.AfterState)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.replayJournalEntry failed")
+		}
+		err = trans.WriteLockElement(el)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.replayJournalEntry failed")
+		}
+		err = uOfDPtr.undoManager.markChangedElement(el, trans)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.replayJournalEntry failed")
+		}
+		// The undo machinery restores a prior state; here the "prior" state is the state after the recorded change
+		replayEntry := newUndoRedoStackEntry(Change, afterState, uOfDPtr.ownedIDsMap.GetMappedValues(entry.ConceptID).Clone(),
+			uOfDPtr.listenersMap.GetMappedValues(entry.ConceptID).Clone(), uOfDPtr.id, el)
+		uOfDPtr.undoManager.undoEntry(replayEntry, trans)
+	default:
+		return errors.New("UniverseOfDiscourse.replayJournalEntry unexpected nature of change: " + entry.NatureOfChange)
+	}
+	return nil
+}
+
+// newConceptFromState creates a concept with the given state that is NOT added to the uOfD
+func (uOfDPtr *UniverseOfDiscourse) newConceptFromState(state *ConceptState) (*concept, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, errors.Wrap(err, "UniverseOfDiscourse.newConceptFromState failed")
+	}
+	var newConcept concept
+	newConcept.Version = newVersionCounter()
+	newConcept.observers = mapset.NewSet()
+	err = newConcept.UnmarshalJSON(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "UniverseOfDiscourse.newConceptFromState failed")
+	}
+	newConcept.uOfD = uOfDPtr
+	return &newConcept, nil
+}
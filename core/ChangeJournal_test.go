@@ -0,0 +1,146 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ChangeJournal tests", func() {
+	var uOfD *UniverseOfDiscourse
+	var trans *Transaction
+	var domain Concept
+	var journalPath string
+	var journal *ChangeJournal
+
+	BeforeEach(func() {
+		uOfD = NewUniverseOfDiscourse()
+		trans = uOfD.NewTransaction()
+		domain, _ = uOfD.NewElement(trans, "http://activeCrl.com/test/JournalDomain")
+		domain.SetLabel("JournalDomain", trans)
+		uOfD.NewOwnedElement(domain, "Existing", trans)
+		trans.Commit()
+		tempDir, err := os.MkdirTemp("", "journal")
+		Expect(err).To(BeNil())
+		journalPath = filepath.Join(tempDir, "changes.journal")
+		journal, err = OpenChangeJournal(journalPath)
+		Expect(err).To(BeNil())
+		uOfD.SetChangeJournal(journal)
+	})
+
+	AfterEach(func() {
+		trans.ReleaseLocks()
+		journal.Close()
+		os.RemoveAll(filepath.Dir(journalPath))
+	})
+
+	readEntries := func() []*JournalEntry {
+		data, err := os.ReadFile(journalPath)
+		Expect(err).To(BeNil())
+		entries, err := ReadJournal(bytes.NewReader(data))
+		Expect(err).To(BeNil())
+		return entries
+	}
+
+	Specify("Committed changes should be written to the journal", func() {
+		domain.SetDefinition("A domain", trans)
+		Expect(readEntries()).To(BeEmpty())
+		trans.Commit()
+		entries := readEntries()
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].NatureOfChange).To(Equal("ConceptChanged"))
+		Expect(entries[0].ConceptID).To(Equal(domain.getConceptIDNoLock()))
+		Expect(entries[0].BeforeState.Definition).To(Equal(""))
+		Expect(entries[0].AfterState.Definition).To(Equal("A domain"))
+		Expect(entries[0].Timestamp.IsZero()).To(BeFalse())
+	})
+
+	Specify("Rolled back changes should not be written to the journal", func() {
+		domain.SetDefinition("A domain", trans)
+		trans.Rollback()
+		Expect(readEntries()).To(BeEmpty())
+	})
+
+	Specify("Additions and removals should be journaled", func() {
+		newElement, _ := uOfD.NewOwnedElement(domain, "New", trans)
+		trans.Commit()
+		uOfD.DeleteElement(newElement, trans)
+		trans.Commit()
+		var natures []string
+		for _, entry := range readEntries() {
+			if entry.ConceptID == newElement.getConceptIDNoLock() {
+				natures = append(natures, entry.NatureOfChange)
+			}
+		}
+		Expect(natures).To(ContainElement("ConceptAdded"))
+		Expect(natures[len(natures)-1]).To(Equal("ConceptRemoved"))
+	})
+
+	Specify("Replaying the journal on the base snapshot should reproduce the domain", func() {
+		snapshot, err := uOfD.MarshalDomain(domain, trans)
+		Expect(err).To(BeNil())
+		trans.Commit()
+
+		target, _ := uOfD.NewOwnedElement(domain, "Target", trans)
+		literal, _ := uOfD.NewOwnedLiteral(domain, "Literal", trans)
+		literal.SetLiteralValue("Value", trans)
+		ref, _ := uOfD.NewOwnedReference(domain, "Ref", trans)
+		ref.SetReferencedConcept(target, NoAttribute, trans)
+		uOfD.NewOwnedRefinement(domain, "Refinement", target, literal, trans)
+		transient, _ := uOfD.NewOwnedElement(domain, "Transient", trans)
+		trans.Commit()
+		target.SetLabel("Renamed Target", trans)
+		uOfD.DeleteElement(transient, trans)
+		trans.Commit()
+
+		replayUofD := NewUniverseOfDiscourse()
+		replayTrans := replayUofD.NewTransaction()
+		defer replayTrans.ReleaseLocks()
+		_, err = replayUofD.RecoverDomain(snapshot, replayTrans)
+		Expect(err).To(BeNil())
+		file, err := os.Open(journalPath)
+		Expect(err).To(BeNil())
+		defer file.Close()
+		Expect(replayUofD.ReplayJournal(file, replayTrans)).To(Succeed())
+
+		Expect(replayUofD.GetElement(transient.getConceptIDNoLock())).To(BeNil())
+		replayedRef := replayUofD.GetElement(ref.getConceptIDNoLock())
+		Expect(replayedRef.GetReferencedConceptID(replayTrans)).To(Equal(target.getConceptIDNoLock()))
+		Expect(replayUofD.GetElement(target.getConceptIDNoLock()).GetLabel(replayTrans)).To(Equal("Renamed Target"))
+		Expect(replayUofD.GetElement(literal.getConceptIDNoLock()).GetLiteralValue(replayTrans)).To(Equal("Value"))
+		Expect(uOfD.IsEquivalent(trans, replayUofD, replayTrans, true)).To(BeTrue())
+	})
+
+	Specify("Changes to concepts that are not saved should not be journaled", func() {
+		transientLiteral, _ := uOfD.NewOwnedLiteral(uOfD.GetElementWithURI(TransientURI), "TransientLiteral", trans)
+		excluded, _ := uOfD.NewElement(trans)
+		excludedChild, _ := uOfD.NewOwnedElement(excluded, "ExcludedChild", trans)
+		journal.ExcludeRoot(excluded.getConceptIDNoLock())
+		trans.Commit()
+		Expect(transientLiteral.SetLiteralValue("Value", trans)).To(Succeed())
+		Expect(excludedChild.SetLabel("Changed", trans)).To(Succeed())
+		Expect(domain.SetDefinition("A domain", trans)).To(Succeed())
+		trans.Commit()
+		var journaledIDs []string
+		for _, entry := range readEntries() {
+			journaledIDs = append(journaledIDs, entry.ConceptID)
+		}
+		Expect(journaledIDs).To(ContainElement(domain.getConceptIDNoLock()))
+		Expect(journaledIDs).ToNot(ContainElement(transientLiteral.getConceptIDNoLock()))
+		Expect(journaledIDs).ToNot(ContainElement(excluded.getConceptIDNoLock()))
+		Expect(journaledIDs).ToNot(ContainElement(excludedChild.getConceptIDNoLock()))
+	})
+
+	Specify("Truncate should discard the journal entries", func() {
+		domain.SetDefinition("A domain", trans)
+		trans.Commit()
+		Expect(journal.Truncate()).To(Succeed())
+		Expect(readEntries()).To(BeEmpty())
+		domain.SetDefinition("Another", trans)
+		trans.Commit()
+		Expect(readEntries()).To(HaveLen(1))
+	})
+})
@@ -63,6 +63,16 @@ func (noc NatureOfChange) String() string {
 	return "Undefined"
 }
 
+// FindNatureOfChange takes the string version of the nature of change and returns the corresponding NatureOfChange value
+func FindNatureOfChange(stringName string) (NatureOfChange, error) {
+	for noc := ConceptAdded; noc <= Tickle; noc++ {
+		if noc.String() == stringName {
+			return noc, nil
+		}
+	}
+	return NatureOfChange(0), errors.New("NatureOfChange value not found for stringName: " + stringName)
+}
+
 // ConceptState is a flattened representation of all concept types. It is used to capture the current state of a concept
 type ConceptState struct {
 	// Element fields
@@ -81,8 +81,11 @@ type concept struct {
 // This is purely an internal housekeeping method. Note that
 // no checking of whether the Element is read-only is performed here. This check
 // is performed by the child
-func (cPtr *concept) addOwnedConcept(ownedConceptID string, trans *Transaction) {
-	trans.ReadLockElement(cPtr)
+func (cPtr *concept) addOwnedConcept(ownedConceptID string, trans *Transaction) error {
+	err := trans.ReadLockElement(cPtr)
+	if err != nil {
+		return errors.Wrap(err, "element.addOwnedConcept failed")
+	}
 	if !cPtr.uOfD.ownedIDsMap.ContainsMappedValue(cPtr.ConceptID, ownedConceptID) {
 		if cPtr.uOfD.undoManager.debugUndo {
 			log.Print("+++")
@@ -92,10 +95,12 @@ func (cPtr *concept) addOwnedConcept(ownedConceptID string, trans *Transaction)
 		cPtr.uOfD.preChange(cPtr, trans)
 		cPtr.Version.incrementVersion()
 		cPtr.uOfD.ownedIDsMap.addMappedValue(cPtr.GetConceptID(trans), ownedConceptID)
+		cPtr.uOfD.recordOwnedConceptChange(cPtr, trans)
 		if cPtr.uOfD != nil {
 			cPtr.uOfD.postChange(cPtr, trans)
 		}
 	}
+	return nil
 }
 
 // addRecoveredOwnedConcept adds the indicated Element as a child (owned) concept without incrementing
@@ -103,8 +108,11 @@ func (cPtr *concept) addOwnedConcept(ownedConceptID string, trans *Transaction)
 // This is purely an internal housekeeping method. Note that
 // no checking of whether the Element is read-only is performed here. This check
 // is performed by the child
-func (cPtr *concept) addRecoveredOwnedConcept(ownedConceptID string, trans *Transaction) {
-	trans.ReadLockElement(cPtr)
+func (cPtr *concept) addRecoveredOwnedConcept(ownedConceptID string, trans *Transaction) error {
+	err := trans.ReadLockElement(cPtr)
+	if err != nil {
+		return errors.Wrap(err, "element.addRecoveredOwnedConcept failed")
+	}
 	if !cPtr.uOfD.ownedIDsMap.ContainsMappedValue(cPtr.ConceptID, ownedConceptID) {
 		if cPtr.uOfD.undoManager.debugUndo {
 			log.Print("+++")
@@ -117,12 +125,16 @@ func (cPtr *concept) addRecoveredOwnedConcept(ownedConceptID string, trans *Tran
 			cPtr.uOfD.postChange(cPtr, trans)
 		}
 	}
+	return nil
 }
 
 // addListener adds the indicated Element as a listening concept.
 // This is an internal housekeeping method.
-func (cPtr *concept) addListener(listeningConceptID string, trans *Transaction) {
-	trans.ReadLockElement(cPtr)
+func (cPtr *concept) addListener(listeningConceptID string, trans *Transaction) error {
+	err := trans.ReadLockElement(cPtr)
+	if err != nil {
+		return errors.Wrap(err, "element.addListener failed")
+	}
 	if !cPtr.uOfD.listenersMap.ContainsMappedValue(cPtr.ConceptID, listeningConceptID) {
 		if cPtr.uOfD.undoManager.debugUndo {
 			log.Print("+++")
@@ -135,13 +147,16 @@ func (cPtr *concept) addListener(listeningConceptID string, trans *Transaction)
 			cPtr.uOfD.postChange(cPtr, trans)
 		}
 	}
+	return nil
 }
 
 // clone is an internal function that makes a copy of the given element - including its
 // identifier. This is done only to support undo/redo: the clone should NEVER be added to the
 // universe of discourse
 func (cPtr *concept) clone(trans *Transaction) *concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return nil
+	}
 	// The newly made clone never gets locked
 	var cl concept
 	cl.initializeConcept(cPtr.ConceptType, "", "")
@@ -167,7 +182,9 @@ func (cPtr *concept) cloneAttributes(source *concept, trans *Transaction) {
 }
 
 func (cPtr *concept) GetAbstractConcept(trans *Transaction) Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return nil
+	}
 	return cPtr.uOfD.GetElement(cPtr.AbstractConceptID)
 }
 
@@ -176,7 +193,9 @@ func (cPtr *concept) getAbstractConceptNoLock() Concept {
 }
 
 func (cPtr *concept) GetAbstractConceptID(trans *Transaction) string {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return ""
+	}
 	return cPtr.AbstractConceptID
 }
 
@@ -186,7 +205,9 @@ func (cPtr *concept) getAbstractConceptIDNoLock() string {
 
 // GetConceptID returns the conceptID
 func (cPtr *concept) GetConceptID(trans *Transaction) string {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return ""
+	}
 	return cPtr.ConceptID
 }
 
@@ -207,7 +228,9 @@ func (cPtr *concept) GetConceptType() ConceptType {
 
 // GetDefinition returns the definition if one exists
 func (cPtr *concept) GetDefinition(trans *Transaction) string {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return ""
+	}
 	return cPtr.Definition
 }
 
@@ -215,7 +238,9 @@ func (cPtr *concept) GetDefinition(trans *Transaction) string {
 // one of its abstractions. Note that there is no ordering of children so in the event that
 // there is more than one child with the given abstraction the result is nondeterministic.
 func (cPtr *concept) GetFirstOwnedConceptRefinedFrom(abstraction Concept, trans *Transaction) Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return nil
+	}
 	it := cPtr.uOfD.ownedIDsMap.GetMappedValues(cPtr.ConceptID).Iterator()
 	for id := range it.C {
 		element := cPtr.uOfD.GetElement(id.(string))
@@ -231,7 +256,9 @@ func (cPtr *concept) GetFirstOwnedConceptRefinedFrom(abstraction Concept, trans
 // by the URI as one of its abstractions. Note that there is no ordering of children so in the event that
 // there is more than one child with the given abstraction the result is nondeterministic.
 func (cPtr *concept) GetFirstOwnedConceptRefinedFromURI(abstractionURI string, trans *Transaction) Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return nil
+	}
 	abstraction := cPtr.uOfD.GetElementWithURI(abstractionURI)
 	if abstraction != nil {
 		return cPtr.GetFirstOwnedConceptRefinedFrom(abstraction, trans)
@@ -242,7 +269,9 @@ func (cPtr *concept) GetFirstOwnedConceptRefinedFromURI(abstractionURI string, t
 // GetFirstOwnedLiteralRefinementOf returns the first child literal that has the indicated
 // abstraction as one of its abstractions.
 func (cPtr *concept) GetFirstOwnedLiteralRefinementOf(abstraction Concept, trans *Transaction) Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return nil
+	}
 	it := cPtr.uOfD.ownedIDsMap.GetMappedValues(cPtr.ConceptID).Iterator()
 	for id := range it.C {
 		element := cPtr.uOfD.GetElement(id.(string))
@@ -261,7 +290,9 @@ func (cPtr *concept) GetFirstOwnedLiteralRefinementOf(abstraction Concept, trans
 // by the URI as one of its abstractions. Note that there is no ordering of children so in the event that
 // there is more than one child with the given abstraction the result is nondeterministic.
 func (cPtr *concept) GetFirstOwnedLiteralRefinementOfURI(abstractionURI string, trans *Transaction) Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return nil
+	}
 	abstraction := cPtr.uOfD.GetElementWithURI(abstractionURI)
 	if abstraction != nil {
 		return cPtr.GetFirstOwnedLiteralRefinementOf(abstraction, trans)
@@ -272,7 +303,9 @@ func (cPtr *concept) GetFirstOwnedLiteralRefinementOfURI(abstractionURI string,
 // GetFirstOwnedReferenceRefinedFrom returns the first child reference that has the indicated
 // abstraction as one of its abstractions.
 func (cPtr *concept) GetFirstOwnedReferenceRefinedFrom(abstraction Concept, trans *Transaction) Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return nil
+	}
 	ownedIDs := cPtr.uOfD.ownedIDsMap.GetMappedValues(cPtr.ConceptID)
 	it := ownedIDs.Iterator()
 	for id := range it.C {
@@ -292,7 +325,9 @@ func (cPtr *concept) GetFirstOwnedReferenceRefinedFrom(abstraction Concept, tran
 // by the URI as one of its abstractions. Note that there is no ordering of children so in the event that
 // there is more than one child with the given abstraction the result is nondeterministic.
 func (cPtr *concept) GetFirstOwnedReferenceRefinedFromURI(abstractionURI string, trans *Transaction) Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return nil
+	}
 	uOfD := cPtr.uOfD
 	if uOfD == nil {
 		return nil
@@ -307,7 +342,9 @@ func (cPtr *concept) GetFirstOwnedReferenceRefinedFromURI(abstractionURI string,
 // GetFirstOwnedRefinementRefinedFrom returns the first child refinement that has the indicated
 // abstraction as one of its abstractions.
 func (cPtr *concept) GetFirstOwnedRefinementRefinedFrom(abstraction Concept, trans *Transaction) Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return nil
+	}
 	it := cPtr.uOfD.ownedIDsMap.GetMappedValues(cPtr.ConceptID).Iterator()
 	for id := range it.C {
 		element := cPtr.uOfD.GetElement(id.(string))
@@ -326,7 +363,9 @@ func (cPtr *concept) GetFirstOwnedRefinementRefinedFrom(abstraction Concept, tra
 // by the URI as one of its abstractions. Note that there is no ordering of children so in the event that
 // there is more than one child with the given abstraction the result is nondeterministic.
 func (cPtr *concept) GetFirstOwnedRefinementRefinedFromURI(abstractionURI string, trans *Transaction) Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return nil
+	}
 	abstraction := cPtr.uOfD.GetElementWithURI(abstractionURI)
 	if abstraction != nil {
 		return cPtr.GetFirstOwnedRefinementRefinedFrom(abstraction, trans)
@@ -336,7 +375,9 @@ func (cPtr *concept) GetFirstOwnedRefinementRefinedFromURI(abstractionURI string
 
 // GetFirstOwnedConceptWithURI
 func (cPtr *concept) GetFirstOwnedConceptWithURI(uri string, trans *Transaction) Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return nil
+	}
 	it := cPtr.uOfD.ownedIDsMap.GetMappedValues(cPtr.ConceptID).Iterator()
 	for id := range it.C {
 		element := cPtr.uOfD.GetElement(id.(string))
@@ -349,7 +390,9 @@ func (cPtr *concept) GetFirstOwnedConceptWithURI(uri string, trans *Transaction)
 }
 
 func (cPtr *concept) GetFirstOwnedLiteralRefinedFrom(abstraction Concept, trans *Transaction) Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return nil
+	}
 	it := cPtr.uOfD.ownedIDsMap.GetMappedValues(cPtr.ConceptID).Iterator()
 	for id := range it.C {
 		element := cPtr.uOfD.GetElement(id.(string))
@@ -365,7 +408,9 @@ func (cPtr *concept) GetFirstOwnedLiteralRefinedFrom(abstraction Concept, trans
 }
 
 func (cPtr *concept) GetFirstOwnedLiteralRefinedFromURI(uri string, trans *Transaction) Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return nil
+	}
 	abstraction := cPtr.uOfD.GetElementWithURI(uri)
 	if abstraction != nil {
 		return cPtr.GetFirstOwnedLiteralRefinedFrom(abstraction, trans)
@@ -374,7 +419,9 @@ func (cPtr *concept) GetFirstOwnedLiteralRefinedFromURI(uri string, trans *Trans
 }
 
 func (cPtr *concept) GetFirstOwnedLiteralWithURI(uri string, trans *Transaction) Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return nil
+	}
 	it := cPtr.uOfD.ownedIDsMap.GetMappedValues(cPtr.ConceptID).Iterator()
 	for id := range it.C {
 		element := cPtr.uOfD.GetElement(id.(string))
@@ -390,7 +437,9 @@ func (cPtr *concept) GetFirstOwnedLiteralWithURI(uri string, trans *Transaction)
 }
 
 func (cPtr *concept) GetFirstOwnedReferenceWithURI(uri string, trans *Transaction) Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return nil
+	}
 	it := cPtr.uOfD.ownedIDsMap.GetMappedValues(cPtr.ConceptID).Iterator()
 	for id := range it.C {
 		element := cPtr.uOfD.GetElement(id.(string))
@@ -406,7 +455,9 @@ func (cPtr *concept) GetFirstOwnedReferenceWithURI(uri string, trans *Transactio
 }
 
 func (cPtr *concept) GetFirstOwnedRefinementWithURI(uri string, trans *Transaction) Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return nil
+	}
 	it := cPtr.uOfD.ownedIDsMap.GetMappedValues(cPtr.ConceptID).Iterator()
 	for id := range it.C {
 		element := cPtr.uOfD.GetElement(id.(string))
@@ -436,6 +487,10 @@ func (cPtr *concept) FindAbstractions(abstractions map[string]Concept, trans *Tr
 		case *concept:
 			abstraction := typedElement.GetAbstractConcept(trans)
 			if abstraction != nil && abstraction.getConceptIDNoLock() != cPtr.getConceptIDNoLock() {
+				// An abstraction already found has already been searched
+				if _, found := abstractions[abstraction.GetConceptID(trans)]; found {
+					continue
+				}
 				abstractions[abstraction.GetConceptID(trans)] = abstraction
 				abstraction.FindAbstractions(abstractions, trans)
 			}
@@ -466,13 +521,17 @@ func (cPtr *concept) FindImmediateAbstractions(abstractions map[string]Concept,
 // function is to prevent SetReadOnly(true) on concepts that are built-in to CRL. Locking is
 // not necessary as this value is set when the object is created and never expected to change
 func (cPtr *concept) GetIsCore(trans *Transaction) bool {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return false
+	}
 	return cPtr.IsCore
 }
 
 // GetGetLabel returns the label if one exists
 func (cPtr *concept) GetLabel(trans *Transaction) string {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return ""
+	}
 	return cPtr.Label
 }
 
@@ -481,13 +540,17 @@ func (cPtr *concept) getLabelNoLock() string {
 }
 
 func (cPtr *concept) GetLiteralValue(trans *Transaction) string {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return ""
+	}
 	return cPtr.LiteralValue
 }
 
 // GetOwningConceptID returns the ID of the concept that owns this one (if any)
 func (cPtr *concept) GetOwningConceptID(trans *Transaction) string {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return ""
+	}
 	return cPtr.OwningConceptID
 }
 
@@ -519,7 +582,9 @@ func (cPtr *concept) GetOwnedConcepts(trans *Transaction) map[string]Concept {
 // GetOwnedConceptsRefinedFrom returns the owned concepts with the indicated abstraction as
 // one of their abstractions.
 func (cPtr *concept) GetOwnedConceptsRefinedFrom(abstraction Concept, trans *Transaction) map[string]Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return map[string]Concept{}
+	}
 	matches := map[string]Concept{}
 	it := cPtr.uOfD.ownedIDsMap.GetMappedValues(cPtr.ConceptID).Iterator()
 	for id := range it.C {
@@ -534,7 +599,9 @@ func (cPtr *concept) GetOwnedConceptsRefinedFrom(abstraction Concept, trans *Tra
 // GetOwnedConceptsRefinedFromURI returns the owned concepts that have the abstraction indicated
 // by the URI as one of their abstractions.
 func (cPtr *concept) GetOwnedConceptsRefinedFromURI(abstractionURI string, trans *Transaction) map[string]Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return map[string]Concept{}
+	}
 	matches := map[string]Concept{}
 	abstraction := cPtr.uOfD.GetElementWithURI(abstractionURI)
 	if abstraction != nil {
@@ -552,7 +619,9 @@ func (cPtr *concept) GetOwnedConceptsRefinedFromURI(abstractionURI string, trans
 // GetOwnedDescendantsRefinedFrom returns the owned concepts with the indicated abstraction as
 // one of their abstractions.
 func (cPtr *concept) GetOwnedDescendantsRefinedFrom(abstraction Concept, trans *Transaction) map[string]Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return map[string]Concept{}
+	}
 	matches := map[string]Concept{}
 	if abstraction != nil {
 		// it := cPtr.uOfD.ownedIDsMap.GetMappedValues(cPtr.ConceptID).Iterator()
@@ -572,7 +641,9 @@ func (cPtr *concept) GetOwnedDescendantsRefinedFrom(abstraction Concept, trans *
 // GetOwnedDescendantsRefinedFromURI returns the descendant concepts that have the indicated abstraction
 // by the URI as one of their abstractions.
 func (cPtr *concept) GetOwnedDescendantsRefinedFromURI(abstractionURI string, trans *Transaction) map[string]Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return map[string]Concept{}
+	}
 	matches := map[string]Concept{}
 	abstraction := cPtr.uOfD.GetElementWithURI(abstractionURI)
 	if abstraction != nil {
@@ -593,7 +664,9 @@ func (cPtr *concept) GetOwnedDescendantsRefinedFromURI(abstractionURI string, tr
 // GetOwnedLiteralsRefinedFrom returns the owned literals that have the indicated
 // abstraction as one of their abstractions.
 func (cPtr *concept) GetOwnedLiteralsRefinedFrom(abstraction Concept, trans *Transaction) map[string]Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return map[string]Concept{}
+	}
 	matches := map[string]Concept{}
 	it := cPtr.uOfD.ownedIDsMap.GetMappedValues(cPtr.ConceptID).Iterator()
 	for id := range it.C {
@@ -611,7 +684,9 @@ func (cPtr *concept) GetOwnedLiteralsRefinedFrom(abstraction Concept, trans *Tra
 // GetOwnedLiteralsRefinedFromURI returns the child literals that have the abstraction indicated
 // by the URI as one of their abstractions.
 func (cPtr *concept) GetOwnedLiteralsRefinedFromURI(abstractionURI string, trans *Transaction) map[string]Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return map[string]Concept{}
+	}
 	matches := map[string]Concept{}
 	abstraction := cPtr.uOfD.GetElementWithURI(abstractionURI)
 	if abstraction != nil {
@@ -632,7 +707,9 @@ func (cPtr *concept) GetOwnedLiteralsRefinedFromURI(abstractionURI string, trans
 // GetOwnedReferencesRefinedFrom returns the owned references that have the indicated
 // abstraction as one of their abstractions.
 func (cPtr *concept) GetOwnedReferencesRefinedFrom(abstraction Concept, trans *Transaction) map[string]Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return map[string]Concept{}
+	}
 	matches := map[string]Concept{}
 	it := cPtr.uOfD.ownedIDsMap.GetMappedValues(cPtr.ConceptID).Iterator()
 	for id := range it.C {
@@ -650,7 +727,9 @@ func (cPtr *concept) GetOwnedReferencesRefinedFrom(abstraction Concept, trans *T
 // GetOwnedReferencesRefinedFromURI returns the owned references that have the abstraction indicated
 // by the URI as one of their abstractions.
 func (cPtr *concept) GetOwnedReferencesRefinedFromURI(abstractionURI string, trans *Transaction) map[string]Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return map[string]Concept{}
+	}
 	matches := map[string]Concept{}
 	abstraction := cPtr.uOfD.GetElementWithURI(abstractionURI)
 	if abstraction != nil {
@@ -672,7 +751,9 @@ func (cPtr *concept) GetOwnedReferencesRefinedFromURI(abstractionURI string, tra
 // GetOwnedRefinementsRefinedFrom returns the owned refinements that have the indicated
 // abstraction as one of their abstractions.
 func (cPtr *concept) GetOwnedRefinementsRefinedFrom(abstraction Concept, trans *Transaction) map[string]Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return map[string]Concept{}
+	}
 	matches := map[string]Concept{}
 	it := cPtr.uOfD.ownedIDsMap.GetMappedValues(cPtr.ConceptID).Iterator()
 	defer it.Stop()
@@ -691,7 +772,9 @@ func (cPtr *concept) GetOwnedRefinementsRefinedFrom(abstraction Concept, trans *
 // GetOwnedRefinementsRefinedFromURI returns the owned refinements that have the abstraction indicated
 // by the URI as one of its abstractions.
 func (cPtr *concept) GetOwnedRefinementsRefinedFromURI(abstractionURI string, trans *Transaction) map[string]Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return map[string]Concept{}
+	}
 	matches := map[string]Concept{}
 	abstraction := cPtr.uOfD.GetElementWithURI(abstractionURI)
 	if abstraction != nil {
@@ -712,7 +795,9 @@ func (cPtr *concept) GetOwnedRefinementsRefinedFromURI(abstractionURI string, tr
 
 // GetOwningConcept returns the Element representing the concept that owns this one (if any)
 func (cPtr *concept) GetOwningConcept(trans *Transaction) Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return nil
+	}
 	if cPtr.uOfD != nil {
 		return cPtr.uOfD.GetElement(cPtr.OwningConceptID)
 	}
@@ -735,7 +820,9 @@ func (cPtr *concept) getOwningConceptIDNoLock() string {
 // GetReferencedConcept returns the element representing  the concept being referenced
 // Note that this is a cached value
 func (cPtr *concept) GetReferencedConcept(trans *Transaction) Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return nil
+	}
 	return cPtr.getReferencedConceptNoLock()
 }
 
@@ -745,19 +832,25 @@ func (cPtr *concept) getReferencedConceptNoLock() Concept {
 
 // GetReferencedConceptID returns the identifier of the concept being referenced
 func (cPtr *concept) GetReferencedConceptID(trans *Transaction) string {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return ""
+	}
 	return cPtr.ReferencedConceptID
 }
 
 // GetReferencedAttributeName returns an indicator of which attribute is being referenced (if any)
 func (cPtr *concept) GetReferencedAttributeName(trans *Transaction) AttributeName {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return NoAttribute
+	}
 	return cPtr.ReferencedAttributeName
 }
 
 // GetReferencedAttributeValue returns the string value of the referenced attribute (if any)
 func (cPtr *concept) GetReferencedAttributeValue(trans *Transaction) string {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return ""
+	}
 	if cPtr.ReferencedConceptID != "" {
 		referencedConcept := cPtr.GetReferencedConcept(trans)
 		if referencedConcept != nil {
@@ -787,7 +880,9 @@ func (cPtr *concept) GetReferencedAttributeValue(trans *Transaction) string {
 }
 
 func (cPtr *concept) GetRefinedConcept(trans *Transaction) Concept {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return nil
+	}
 	return cPtr.uOfD.GetElement(cPtr.RefinedConceptID)
 }
 
@@ -796,7 +891,9 @@ func (cPtr *concept) getRefinedConceptNoLock() Concept {
 }
 
 func (cPtr *concept) GetRefinedConceptID(trans *Transaction) string {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return ""
+	}
 	return cPtr.RefinedConceptID
 }
 
@@ -806,7 +903,9 @@ func (cPtr *concept) getRefinedConceptIDNoLock() string {
 
 // GetUniverseOfDiscourse returns the UniverseOfDiscourse in which the element instance resides
 func (cPtr *concept) GetUniverseOfDiscourse(trans *Transaction) *UniverseOfDiscourse {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return nil
+	}
 	return cPtr.uOfD
 }
 
@@ -817,7 +916,9 @@ func (cPtr *concept) getUniverseOfDiscourseNoLock() *UniverseOfDiscourse {
 
 // GetURI returns the URI string associated with the element if there is one
 func (cPtr *concept) GetURI(trans *Transaction) string {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return ""
+	}
 	return cPtr.URI
 }
 
@@ -828,14 +929,22 @@ func (cPtr *concept) getURINoLock() string {
 
 // GetVersion returns the version of the element
 func (cPtr *concept) GetVersion(trans *Transaction) int {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return 0
+	}
+	return cPtr.Version.getVersion()
+}
+
+func (cPtr *concept) getVersionNoLock() int {
 	return cPtr.Version.getVersion()
 }
 
 // IsRefinementOf returns true if the given abstraction is contained in the abstractions set
 // of this element. No locking is required since the StringIntMap does its own locking
 func (cPtr *concept) IsRefinementOf(abstraction Concept, trans *Transaction) bool {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return false
+	}
 	// Check to see whether the abstraction is one of the core classes
 	abstractionURI := abstraction.GetURI(trans)
 	switch abstractionURI {
@@ -885,7 +994,9 @@ func (cPtr *concept) IsRefinementOf(abstraction Concept, trans *Transaction) boo
 }
 
 func (cPtr *concept) IsRefinementOfURI(uri string, trans *Transaction) bool {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return false
+	}
 	if cPtr.uOfD == nil {
 		return false
 	}
@@ -910,7 +1021,9 @@ func (cPtr *concept) initializeConcept(conceptType ConceptType, identifier strin
 
 // IsReadOnly returns a boolean indicating whether the concept can be modified.
 func (cPtr *concept) IsReadOnly(trans *Transaction) bool {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return false
+	}
 	return cPtr.ReadOnly
 }
 
@@ -929,8 +1042,9 @@ func (cPtr *concept) isEquivalent(hl1 *Transaction, el *concept, hl2 *Transactio
 	if len(printExceptions) > 0 {
 		print = printExceptions[0]
 	}
-	hl1.ReadLockElement(cPtr)
-	hl2.ReadLockElement(el)
+	if hl1.ReadLockElement(cPtr) != nil || hl2.ReadLockElement(el) != nil {
+		return false
+	}
 	if cPtr.AbstractConceptID != el.AbstractConceptID {
 		if print {
 			log.Printf("In refinement.isEquivalent, AbstractConecptIDs do not match")
@@ -1018,7 +1132,9 @@ func (cPtr *concept) isEquivalent(hl1 *Transaction, el *concept, hl2 *Transactio
 // during editing during which the child's owner has been changed but the original owner's OwnedConcept
 // list has not yet been updated.
 func (cPtr *concept) IsOwnedConcept(el Concept, trans *Transaction) bool {
-	trans.ReadLockElement(cPtr)
+	if trans.ReadLockElement(cPtr) != nil {
+		return false
+	}
 	it := cPtr.uOfD.ownedIDsMap.GetMappedValues(cPtr.ConceptID).Iterator()
 	defer it.Stop()
 	for id := range it.C {
@@ -1064,7 +1180,10 @@ func (cPtr *concept) notifyObservers(notification *ChangeNotification, trans *Tr
 }
 
 func (cPtr *concept) notifyPointerOwners(notification *ChangeNotification, trans *Transaction) error {
-	trans.ReadLockElement(cPtr)
+	err := trans.ReadLockElement(cPtr)
+	if err != nil {
+		return errors.Wrap(err, "element.notifyPointerOwners failed")
+	}
 	uOfD := cPtr.uOfD
 	if uOfD != nil {
 		it := uOfD.listenersMap.GetMappedValues(cPtr.ConceptID).Iterator()
@@ -1096,7 +1215,10 @@ func (cPtr *concept) notifyPointerOwners(notification *ChangeNotification, trans
 
 // notifyOwner informs the owner that the concept has changed state
 func (cPtr *concept) notifyOwner(notification *ChangeNotification, trans *Transaction) error {
-	trans.ReadLockElement(cPtr)
+	err := trans.ReadLockElement(cPtr)
+	if err != nil {
+		return errors.Wrap(err, "element.notifyOwner failed")
+	}
 	switch notification.natureOfChange {
 	case OwningConceptChanged:
 		oldOwnerID := notification.beforeConceptState.OwningConceptID
@@ -1214,8 +1336,11 @@ func (cPtr *concept) tickle(targetElement Concept, notification *ChangeNotificat
 }
 
 // removeListener removes the indicated Element as a listening concept.
-func (cPtr *concept) removeListener(listeningConceptID string, trans *Transaction) {
-	trans.ReadLockElement(cPtr)
+func (cPtr *concept) removeListener(listeningConceptID string, trans *Transaction) error {
+	err := trans.ReadLockElement(cPtr)
+	if err != nil {
+		return errors.Wrap(err, "element.removeListener failed")
+	}
 	if cPtr.uOfD.undoManager.debugUndo {
 		log.Print("+++")
 		log.Print("+++ removeListener")
@@ -1226,6 +1351,7 @@ func (cPtr *concept) removeListener(listeningConceptID string, trans *Transactio
 	if cPtr.uOfD != nil {
 		cPtr.uOfD.postChange(cPtr, trans)
 	}
+	return nil
 }
 
 // Register adds the registration of an Observer
@@ -1236,7 +1362,10 @@ func (cPtr *concept) Register(observer Observer) error {
 
 // removeOwnedConcept removes the indicated Element as a child (owned) concept.
 func (cPtr *concept) removeOwnedConcept(ownedConceptID string, trans *Transaction) error {
-	trans.ReadLockElement(cPtr)
+	err := trans.ReadLockElement(cPtr)
+	if err != nil {
+		return errors.Wrap(err, "element.removeOwnedConcept failed")
+	}
 	if cPtr.IsReadOnly(trans) {
 		return errors.New("Element.removedOwnedConcept called on read-only Element")
 	}
@@ -1248,6 +1377,7 @@ func (cPtr *concept) removeOwnedConcept(ownedConceptID string, trans *Transactio
 	cPtr.uOfD.preChange(cPtr, trans)
 	cPtr.Version.incrementVersion()
 	cPtr.uOfD.ownedIDsMap.removeMappedValue(cPtr.ConceptID, ownedConceptID)
+	cPtr.uOfD.recordOwnedConceptChange(cPtr, trans)
 	if cPtr.uOfD != nil {
 		cPtr.uOfD.postChange(cPtr, trans)
 	}
@@ -1259,7 +1389,10 @@ func (cPtr *concept) SetAbstractConcept(el Concept, trans *Transaction) error {
 	if cPtr.uOfD == nil {
 		return errors.New("refinement.SetAbstractConcept failed because the element uOfD is nil")
 	}
-	trans.WriteLockElement(cPtr)
+	err := trans.WriteLockElement(cPtr)
+	if err != nil {
+		return errors.Wrap(err, "refinement.SetAbstractConcept failed")
+	}
 	id := ""
 	if el != nil {
 		id = el.getConceptIDNoLock()
@@ -1271,11 +1404,18 @@ func (cPtr *concept) SetAbstractConceptID(acID string, trans *Transaction) error
 	if cPtr.uOfD == nil {
 		return errors.New("refinement.SetAbstractConceptID failed because the element uOfD is nil")
 	}
-	trans.WriteLockElement(cPtr)
+	err := trans.WriteLockElement(cPtr)
+	if err != nil {
+		return errors.Wrap(err, "refinement.SetAbstractConceptID failed")
+	}
 	if !cPtr.isEditable(trans) {
 		return errors.New("refinement.SetAbstractConceptID failed because the refinement is not editable")
 	}
 	if cPtr.AbstractConceptID != acID {
+		err := checkRefinementStructure(cPtr.uOfD, cPtr.ConceptID, acID, cPtr.RefinedConceptID, AbstractConceptID, trans)
+		if err != nil {
+			return errors.Wrap(err, "refinement.SetAbstractConceptID failed")
+		}
 		if cPtr.uOfD.undoManager.debugUndo {
 			log.Print("+++")
 			log.Print("+++ SetAbstractConcepetID")
@@ -1291,7 +1431,7 @@ func (cPtr *concept) SetAbstractConceptID(acID string, trans *Transaction) error
 		if cPtr.AbstractConceptID != "" {
 			oldAbstractConcept = cPtr.uOfD.GetElement(cPtr.AbstractConceptID)
 			if oldAbstractConcept != nil {
-				oldAbstractConcept.removeListener(cPtr.ConceptID, trans)
+				err = oldAbstractConcept.removeListener(cPtr.ConceptID, trans)
 				if err != nil {
 					return errors.Wrap(err, "refinement.SetAbstractConceptID failed")
 				}
@@ -1304,10 +1444,13 @@ func (cPtr *concept) SetAbstractConceptID(acID string, trans *Transaction) error
 		if acID != "" {
 			newAbstractConcept = cPtr.uOfD.GetElement(acID)
 			if newAbstractConcept != nil {
-				newAbstractConcept.addListener(cPtr.ConceptID, trans)
+				err = newAbstractConcept.addListener(cPtr.ConceptID, trans)
 				if err != nil {
 					return errors.Wrap(err, "refinement.SetAbstractConceptID failed")
 				}
+			} else {
+				// The abstract concept is not currently loaded: the entry is a placeholder until it is
+				cPtr.uOfD.addMappedValueToListenersMap(acID, cPtr.ConceptID)
 			}
 		}
 		cPtr.AbstractConceptID = acID
@@ -1331,7 +1474,10 @@ func (cPtr *concept) SetDefinition(def string, trans *Transaction) error {
 	if cPtr.uOfD == nil {
 		return errors.New("element.SetDefinition failed because the element uOfD is nil")
 	}
-	trans.WriteLockElement(cPtr)
+	err := trans.WriteLockElement(cPtr)
+	if err != nil {
+		return errors.Wrap(err, "element.SetDefinition failed")
+	}
 	if !cPtr.isEditable(trans) {
 		return errors.New("element.SetDefinition failed because the element is not editable")
 	}
@@ -1363,12 +1509,26 @@ func (cPtr *concept) SetDefinition(def string, trans *Transaction) error {
 	return nil
 }
 
+// SetDefinitionIfVersion sets the definition of the Element provided the Element's version is still the expected
+// version. If the Element has changed since the caller read it, a *VersionConflictError is returned and the
+// definition is not changed.
+func (cPtr *concept) SetDefinitionIfVersion(def string, version int, trans *Transaction) error {
+	err := trans.writeLockIfVersion(cPtr, version)
+	if err != nil {
+		return errors.Wrap(err, "element.SetDefinitionIfVersion failed")
+	}
+	return cPtr.SetDefinition(def, trans)
+}
+
 // SetIsCore sets the flag indicating that the element is a Core concept and cannot be edited. Once set, this flag cannot be cleared.
 func (cPtr *concept) SetIsCore(trans *Transaction) error {
 	if cPtr.uOfD == nil {
 		return errors.New("element.SetIsCore failed because the element uOfD is nil")
 	}
-	trans.WriteLockElement(cPtr)
+	err := trans.WriteLockElement(cPtr)
+	if err != nil {
+		return errors.Wrap(err, "element.SetIsCore failed")
+	}
 	if !cPtr.IsCore {
 		if cPtr.uOfD.undoManager.debugUndo {
 			log.Print("+++")
@@ -1402,8 +1562,11 @@ func (cPtr *concept) SetIsCoreRecursively(trans *Transaction) error {
 	if cPtr.uOfD == nil {
 		return errors.New("element.SetIsCoreRecursively failed because the element uOfD is nil")
 	}
-	trans.WriteLockElement(cPtr)
-	err := cPtr.SetIsCore(trans)
+	err := trans.WriteLockElement(cPtr)
+	if err != nil {
+		return errors.Wrap(err, "element.SetIsCoreRecursively failed")
+	}
+	err = cPtr.SetIsCore(trans)
 	if err != nil {
 		return errors.Wrap(err, "Element.SetIsCoreRecursively failed")
 	}
@@ -1424,7 +1587,10 @@ func (cPtr *concept) SetLabel(label string, trans *Transaction) error {
 	if cPtr.uOfD == nil {
 		return errors.New("element.SetLabel failed because the element uOfD is nil")
 	}
-	trans.WriteLockElement(cPtr)
+	err := trans.WriteLockElement(cPtr)
+	if err != nil {
+		return errors.Wrap(err, "element.SetLabel failed")
+	}
 	if !cPtr.isEditable(trans) {
 		return errors.New("element.SetLabel failed because the element is not editable")
 	}
@@ -1456,11 +1622,25 @@ func (cPtr *concept) SetLabel(label string, trans *Transaction) error {
 	return nil
 }
 
+// SetLabelIfVersion sets the label of the Element provided the Element's version is still the expected
+// version. If the Element has changed since the caller read it, a *VersionConflictError is returned and the
+// label is not changed.
+func (cPtr *concept) SetLabelIfVersion(label string, version int, trans *Transaction) error {
+	err := trans.writeLockIfVersion(cPtr, version)
+	if err != nil {
+		return errors.Wrap(err, "element.SetLabelIfVersion failed")
+	}
+	return cPtr.SetLabel(label, trans)
+}
+
 func (cPtr *concept) SetLiteralValue(value string, trans *Transaction) error {
 	if cPtr.uOfD == nil {
 		return errors.New("literal.SetLiteralValue failed because the element uOfD is nil")
 	}
-	trans.WriteLockElement(cPtr)
+	err := trans.WriteLockElement(cPtr)
+	if err != nil {
+		return errors.Wrap(err, "literal.SetLiteralValue failed")
+	}
 	if !cPtr.isEditable(trans) {
 		return errors.New("literal.SetLiteralValue failed because the literal is not editable")
 	}
@@ -1492,13 +1672,27 @@ func (cPtr *concept) SetLiteralValue(value string, trans *Transaction) error {
 	return nil
 }
 
+// SetLiteralValueIfVersion sets the value of the Literal provided the Literal's version is still the expected
+// version. If the Literal has changed since the caller read it, a *VersionConflictError is returned and the
+// value is not changed.
+func (cPtr *concept) SetLiteralValueIfVersion(value string, version int, trans *Transaction) error {
+	err := trans.writeLockIfVersion(cPtr, version)
+	if err != nil {
+		return errors.Wrap(err, "literal.SetLiteralValueIfVersion failed")
+	}
+	return cPtr.SetLiteralValue(value, trans)
+}
+
 // SetOwningConcept takes the ID of the supplied concept and call SetOwningConceptID. It first checks to
 // determine whether the new owner is editable and will throw an error if it is not
 func (cPtr *concept) SetOwningConcept(el Concept, trans *Transaction) error {
 	if cPtr.uOfD == nil {
 		return errors.New("element.SetOwningConcept failed because the element uOfD is nil")
 	}
-	trans.WriteLockElement(cPtr)
+	err := trans.WriteLockElement(cPtr)
+	if err != nil {
+		return errors.Wrap(err, "element.SetOwningConcept failed")
+	}
 	id := ""
 	if el != nil {
 		if !el.isEditable(trans) {
@@ -1506,9 +1700,9 @@ func (cPtr *concept) SetOwningConcept(el Concept, trans *Transaction) error {
 		}
 		id = el.getConceptIDNoLock()
 	}
-	err := cPtr.SetOwningConceptID(id, trans)
+	err = cPtr.SetOwningConceptID(id, trans)
 	if err != nil {
-		errors.Wrap(err, "element.SetOwningConcept failed")
+		return errors.Wrap(err, "element.SetOwningConcept failed")
 	}
 	return nil
 }
@@ -1520,13 +1714,20 @@ func (cPtr *concept) SetOwningConceptID(ocID string, trans *Transaction) error {
 	if cPtr.uOfD == nil {
 		return errors.New("element.SetOwningConceptID failed because the element uOfD is nil")
 	}
-	trans.WriteLockElement(cPtr)
+	err := trans.WriteLockElement(cPtr)
+	if err != nil {
+		return errors.Wrap(err, "element.SetOwningConceptID failed")
+	}
 	if !cPtr.isEditable(trans) {
 		return errors.New("element.SetOwningConceptID failed because the element is not editable")
 	}
 	if ocID == cPtr.ConceptID {
 		return errors.New("element.SetOwningConceptID called with itself as owner")
 	}
+	err = checkOwnershipStructure(cPtr.uOfD, cPtr.ConceptID, ocID, trans)
+	if err != nil {
+		return errors.Wrap(err, "element.SetOwningConceptID failed")
+	}
 	newOwner := cPtr.uOfD.GetElement(ocID)
 	if newOwner != nil && !newOwner.isEditable(trans) {
 		return errors.New("element.SetOwningConceptID called with new owner not editable")
@@ -1548,14 +1749,14 @@ func (cPtr *concept) SetOwningConceptID(ocID string, trans *Transaction) error {
 			return errors.Wrap(err, "element.SetOwningConceptID failed")
 		}
 		if oldOwner != nil {
-			oldOwner.removeOwnedConcept(cPtr.ConceptID, trans)
+			err = oldOwner.removeOwnedConcept(cPtr.ConceptID, trans)
 			if err != nil {
 				return errors.Wrap(err, "element.SetOwningConceptID failed")
 			}
 		}
 		cPtr.Version.incrementVersion()
 		if newOwner != nil {
-			newOwner.addOwnedConcept(cPtr.ConceptID, trans)
+			err = newOwner.addOwnedConcept(cPtr.ConceptID, trans)
 			if err != nil {
 				return errors.Wrap(err, "element.SetOwningConceptID failed")
 			}
@@ -1583,7 +1784,10 @@ func (cPtr *concept) SetReadOnly(value bool, trans *Transaction) error {
 	if cPtr.uOfD == nil {
 		return errors.New("element.SetReadOnly failed because the element uOfD is nil")
 	}
-	trans.WriteLockElement(cPtr)
+	err := trans.WriteLockElement(cPtr)
+	if err != nil {
+		return errors.Wrap(err, "element.SetReadOnly failed")
+	}
 	if cPtr.GetIsCore(trans) {
 		return errors.New("element.SetReadOnly failed because element is a core element")
 	}
@@ -1646,7 +1850,10 @@ func (cPtr *concept) SetReferencedConcept(el Concept, attributeName AttributeNam
 	if cPtr.uOfD == nil {
 		return errors.New("reference.SetReferencedConcept failed because the element uOfD is nil")
 	}
-	trans.WriteLockElement(cPtr)
+	err := trans.WriteLockElement(cPtr)
+	if err != nil {
+		return errors.Wrap(err, "reference.SetReferencedConcept failed")
+	}
 	id := ""
 	if el != nil {
 		id = el.getConceptIDNoLock()
@@ -1659,7 +1866,10 @@ func (cPtr *concept) SetReferencedConceptID(rcID string, attributeName Attribute
 	if cPtr.uOfD == nil {
 		return errors.New("reference.SetReferencedConceptID failed because the element uOfD is nil")
 	}
-	trans.WriteLockElement(cPtr)
+	err := trans.WriteLockElement(cPtr)
+	if err != nil {
+		return errors.Wrap(err, "reference.SetReferencedConceptID failed")
+	}
 	if !cPtr.isEditable(trans) {
 		return errors.New("reference.SetReferencedConceptID failed because the reference is not editable")
 	}
@@ -1674,22 +1884,22 @@ func (cPtr *concept) SetReferencedConceptID(rcID string, attributeName Attribute
 		cPtr.uOfD.preChange(cPtr, trans)
 		if rcID != "" {
 			newReferencedConcept = cPtr.uOfD.GetElement(rcID)
-			switch attributeName {
-			case ReferencedConceptID:
-				switch newReferencedConcept.GetConceptType() {
-				case Reference:
-				default:
-					return errors.New("In reference.SetReferencedConceptID, the ReferencedAttributeName was ReferencedConceptID, but the referenced concept is not a Reference")
-				}
-			case AbstractConceptID, RefinedConceptID:
-				switch newReferencedConcept.GetConceptType() {
-				case Refinement:
-				default:
-					return errors.New("In reference.SetReferencedConceptID, the ReferencedAttributeName was AbstractConceptID or RefinedConceptID, but the referenced concept is not a Refinement")
-				}
-			}
+			// The type of a referenced concept that is not currently loaded cannot be checked
 			if newReferencedConcept != nil {
-				newReferencedConcept.addListener(cPtr.ConceptID, trans)
+				switch attributeName {
+				case ReferencedConceptID:
+					switch newReferencedConcept.GetConceptType() {
+					case Reference:
+					default:
+						return errors.New("In reference.SetReferencedConceptID, the ReferencedAttributeName was ReferencedConceptID, but the referenced concept is not a Reference")
+					}
+				case AbstractConceptID, RefinedConceptID:
+					switch newReferencedConcept.GetConceptType() {
+					case Refinement:
+					default:
+						return errors.New("In reference.SetReferencedConceptID, the ReferencedAttributeName was AbstractConceptID or RefinedConceptID, but the referenced concept is not a Refinement")
+					}
+				}
 			}
 		}
 		beforeState, err := NewConceptState(cPtr)
@@ -1700,15 +1910,24 @@ func (cPtr *concept) SetReferencedConceptID(rcID string, attributeName Attribute
 		if cPtr.ReferencedConceptID != "" {
 			oldReferencedConcept = cPtr.uOfD.GetElement(cPtr.ReferencedConceptID)
 			if oldReferencedConcept != nil {
-				oldReferencedConcept.removeListener(cPtr.ConceptID, trans)
+				err = oldReferencedConcept.removeListener(cPtr.ConceptID, trans)
 				if err != nil {
 					return errors.Wrap(err, "reference.SetReferencedConceptID failed")
 				}
+			} else {
+				// This case can arise if the referenced concept is not currently loaded
+				cPtr.uOfD.listenersMap.removeMappedValue(cPtr.ReferencedConceptID, cPtr.ConceptID)
 			}
 		}
 		if rcID != "" {
 			if newReferencedConcept != nil {
-				newReferencedConcept.addListener(cPtr.ConceptID, trans)
+				err = newReferencedConcept.addListener(cPtr.ConceptID, trans)
+				if err != nil {
+					return errors.Wrap(err, "reference.SetReferencedConceptID failed")
+				}
+			} else {
+				// The referenced concept is not currently loaded: the entry is a placeholder until it is
+				cPtr.uOfD.addMappedValueToListenersMap(rcID, cPtr.ConceptID)
 			}
 		}
 		cPtr.ReferencedConceptID = rcID
@@ -1732,7 +1951,10 @@ func (cPtr *concept) SetRefinedConcept(el Concept, trans *Transaction) error {
 	if cPtr.uOfD == nil {
 		return errors.New("refinement.SetRefinedConcept failed because the element uOfD is nil")
 	}
-	trans.WriteLockElement(cPtr)
+	err := trans.WriteLockElement(cPtr)
+	if err != nil {
+		return errors.Wrap(err, "refinement.SetRefinedConcept failed")
+	}
 	id := ""
 	if el != nil {
 		id = el.getConceptIDNoLock()
@@ -1744,11 +1966,18 @@ func (cPtr *concept) SetRefinedConceptID(rcID string, trans *Transaction) error
 	if cPtr.uOfD == nil {
 		return errors.New("refinement.SetRefinedConceptID failed because the element uOfD is nil")
 	}
-	trans.WriteLockElement(cPtr)
+	err := trans.WriteLockElement(cPtr)
+	if err != nil {
+		return errors.Wrap(err, "refinement.SetRefinedConceptID failed")
+	}
 	if !cPtr.isEditable(trans) {
 		return errors.New("refinement.SetReferencedConceptID failed because the refinement is not editable")
 	}
 	if cPtr.RefinedConceptID != rcID {
+		err := checkRefinementStructure(cPtr.uOfD, cPtr.ConceptID, cPtr.AbstractConceptID, rcID, RefinedConceptID, trans)
+		if err != nil {
+			return errors.Wrap(err, "refinement.SetRefinedConceptID failed")
+		}
 		if cPtr.uOfD.undoManager.debugUndo {
 			log.Print("+++")
 			log.Print("+++ SetRefinedConceptID")
@@ -1764,7 +1993,7 @@ func (cPtr *concept) SetRefinedConceptID(rcID string, trans *Transaction) error
 		if cPtr.RefinedConceptID != "" {
 			oldRefinedConcept = cPtr.uOfD.GetElement(cPtr.RefinedConceptID)
 			if oldRefinedConcept != nil {
-				oldRefinedConcept.removeListener(cPtr.ConceptID, trans)
+				err = oldRefinedConcept.removeListener(cPtr.ConceptID, trans)
 				if err != nil {
 					return errors.Wrap(err, "refinement.SetRefinedConceptID failed")
 				}
@@ -1777,10 +2006,13 @@ func (cPtr *concept) SetRefinedConceptID(rcID string, trans *Transaction) error
 		if rcID != "" {
 			newRefinedConcept = cPtr.uOfD.GetElement(rcID)
 			if newRefinedConcept != nil {
-				newRefinedConcept.addListener(cPtr.ConceptID, trans)
+				err = newRefinedConcept.addListener(cPtr.ConceptID, trans)
 				if err != nil {
 					return errors.Wrap(err, "refinement.SetRefinedConceptID failed")
 				}
+			} else {
+				// The refined concept is not currently loaded: the entry is a placeholder until it is
+				cPtr.uOfD.addMappedValueToListenersMap(rcID, cPtr.ConceptID)
 			}
 		}
 		cPtr.RefinedConceptID = rcID
@@ -1800,9 +2032,13 @@ func (cPtr *concept) SetRefinedConceptID(rcID string, trans *Transaction) error
 }
 
 // setUniverseOfDiscourse is intended to be called only by the UniverseOfDiscourse
-func (cPtr *concept) setUniverseOfDiscourse(uOfD *UniverseOfDiscourse, trans *Transaction) {
-	trans.WriteLockElement(cPtr)
+func (cPtr *concept) setUniverseOfDiscourse(uOfD *UniverseOfDiscourse, trans *Transaction) error {
+	err := trans.WriteLockElement(cPtr)
+	if err != nil {
+		return errors.Wrap(err, "element.setUniverseOfDiscourse failed")
+	}
 	cPtr.uOfD = uOfD
+	return nil
 }
 
 // SetURI sets the URI of the Element
@@ -1810,7 +2046,10 @@ func (cPtr *concept) SetURI(uri string, trans *Transaction) error {
 	if cPtr.uOfD == nil {
 		return errors.New("element.SetURI failed because the element uOfD is nil")
 	}
-	trans.WriteLockElement(cPtr)
+	err := trans.WriteLockElement(cPtr)
+	if err != nil {
+		return errors.Wrap(err, "element.SetURI failed")
+	}
 	if !cPtr.isEditable(trans) {
 		return errors.New("element.SetURI failed because the elementis not editable")
 	}
@@ -1861,6 +2100,22 @@ func (cPtr *concept) TraceableWriteLock(trans *Transaction) {
 	cPtr.Lock()
 }
 
+// traceableTryReadLock attempts to read lock the concept without waiting and returns true if the lock was obtained
+func (cPtr *concept) traceableTryReadLock(trans *Transaction) bool {
+	if TraceLocks {
+		log.Printf("HL %p trying to read lock Element %p %s\n", trans, cPtr, cPtr.Label)
+	}
+	return cPtr.TryRLock()
+}
+
+// traceableTryWriteLock attempts to write lock the concept without waiting and returns true if the lock was obtained
+func (cPtr *concept) traceableTryWriteLock(trans *Transaction) bool {
+	if TraceLocks {
+		log.Printf("HL %p trying to write lock Element %p %s\n", trans, cPtr, cPtr.Label)
+	}
+	return cPtr.TryLock()
+}
+
 func (cPtr *concept) TraceableReadUnlock(trans *Transaction) {
 	if TraceLocks {
 		log.Printf("HL %p about to read unlock Element %p %s\n", trans, cPtr, cPtr.Label)
@@ -1917,9 +2172,9 @@ func (cPtr *concept) UnmarshalJSON(data []byte) error {
 // Concept is the representation of a concept
 type Concept interface {
 	Subject
-	addListener(string, *Transaction)
-	addOwnedConcept(string, *Transaction)
-	addRecoveredOwnedConcept(string, *Transaction)
+	addListener(string, *Transaction) error
+	addOwnedConcept(string, *Transaction) error
+	addRecoveredOwnedConcept(string, *Transaction) error
 	// editableError(*HeldLocks) error
 	FindAbstractions(map[string]Concept, *Transaction)
 	FindImmediateAbstractions(map[string]Concept, *Transaction)
@@ -1967,6 +2222,7 @@ type Concept interface {
 	GetURI(*Transaction) string
 	getURINoLock() string
 	GetVersion(*Transaction) int
+	getVersionNoLock() int
 	isEditable(*Transaction) bool
 	IsRefinementOf(Concept, *Transaction) bool
 	IsRefinementOfURI(string, *Transaction) bool
@@ -1976,26 +2232,31 @@ type Concept interface {
 	notifyPointerOwners(*ChangeNotification, *Transaction) error
 	notifyOwner(*ChangeNotification, *Transaction) error
 	propagateChange(*ChangeNotification, *Transaction) error
-	removeListener(string, *Transaction)
+	removeListener(string, *Transaction) error
 	removeOwnedConcept(string, *Transaction) error
 	SetDefinition(string, *Transaction) error
+	SetDefinitionIfVersion(string, int, *Transaction) error
 	SetIsCore(*Transaction) error
 	SetIsCoreRecursively(*Transaction) error
 	SetLabel(string, *Transaction) error
+	SetLabelIfVersion(string, int, *Transaction) error
 	SetOwningConcept(Concept, *Transaction) error
 	SetOwningConceptID(string, *Transaction) error
 	SetReadOnly(bool, *Transaction) error
 	SetReadOnlyRecursively(bool, *Transaction) error
-	setUniverseOfDiscourse(*UniverseOfDiscourse, *Transaction)
+	setUniverseOfDiscourse(*UniverseOfDiscourse, *Transaction) error
 	SetURI(string, *Transaction) error
 	tickle(targetElement Concept, notification *ChangeNotification, trans *Transaction) error
 	TraceableReadLock(*Transaction)
 	TraceableWriteLock(*Transaction)
+	traceableTryReadLock(*Transaction) bool
+	traceableTryWriteLock(*Transaction) bool
 	TraceableReadUnlock(*Transaction)
 	TraceableWriteUnlock(*Transaction)
 	// Literal
 	GetLiteralValue(*Transaction) string
 	SetLiteralValue(string, *Transaction) error
+	SetLiteralValueIfVersion(string, int, *Transaction) error
 	// Reference
 	GetReferencedConcept(*Transaction) Concept
 	GetReferencedConceptID(*Transaction) string
@@ -0,0 +1,202 @@
+package core
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// conceptGraphBuilder receives the nodes and edges of a concept graph as they are found by a conceptGraphTraversal.
+// CrlGraph and GraphMLGraph are conceptGraphBuilders, so that the DOT and GraphML views of a model show the same
+// concepts.
+type conceptGraphBuilder interface {
+	// hasConceptNode returns true if the node for the concept has already been added
+	hasConceptNode(concept Concept, trans *Transaction) bool
+	// addConceptNode adds the node for an element, literal, or reference
+	addConceptNode(concept Concept, trans *Transaction) error
+	addOwnerEdge(owner Concept, owned Concept, trans *Transaction) error
+	// addReferencedElementEdge is called only when the nodes for both the reference and the referenced concept exist
+	addReferencedElementEdge(reference Concept, referencedConcept Concept, trans *Transaction) error
+	// addRefinement is called only when the nodes for the abstract and refined concepts exist
+	addRefinement(refinement Concept, trans *Transaction) error
+}
+
+// conceptGraphTraversal finds the concepts of a subtree that are selected by the CrlGraphOptions and reports them to
+// a conceptGraphBuilder
+type conceptGraphTraversal struct {
+	builder conceptGraphBuilder
+	options *CrlGraphOptions
+	trans   *Transaction
+}
+
+// addSubtree adds the concept and its child descendants, down to the MaxDepth, and then the edges for the references
+// and refinements found among them. Each concept added is accompanied by its owners so that it is shown in context.
+// Concepts referenced or refined from the subtree are added, but not recursively, when the options follow references
+// or abstractions.
+func (traversal *conceptGraphTraversal) addSubtree(root Concept) error {
+	var references []Concept
+	var refinements []Concept
+	var addDescendants func(concept Concept, depth int) error
+	addDescendants = func(concept Concept, depth int) error {
+		if !traversal.options.shows(concept, traversal.trans) {
+			return nil
+		}
+		if concept.GetConceptType() == Refinement {
+			refinements = append(refinements, concept)
+			return nil
+		}
+		err := traversal.addConcept(concept)
+		if err != nil {
+			return err
+		}
+		if concept.GetConceptType() == Reference {
+			references = append(references, concept)
+		}
+		if traversal.options.MaxDepth > 0 && depth >= traversal.options.MaxDepth {
+			return nil
+		}
+		for _, child := range sortedConcepts(concept.GetOwnedConcepts(traversal.trans), traversal.trans) {
+			err = addDescendants(child, depth+1)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err := addDescendants(root, 0)
+	if err != nil {
+		return errors.Wrap(err, "conceptGraphTraversal.addSubtree failed")
+	}
+	for _, reference := range references {
+		referencedConcept := reference.GetReferencedConcept(traversal.trans)
+		if referencedConcept == nil || referencedConcept.GetConceptType() == Refinement {
+			continue
+		}
+		shown, err := traversal.addRelatedConcept(referencedConcept, traversal.options.FollowReferences)
+		if err != nil {
+			return errors.Wrap(err, "conceptGraphTraversal.addSubtree failed")
+		}
+		if !shown {
+			continue
+		}
+		err = traversal.builder.addReferencedElementEdge(reference, referencedConcept, traversal.trans)
+		if err != nil {
+			return errors.Wrap(err, "conceptGraphTraversal.addSubtree failed")
+		}
+	}
+	for _, refinement := range refinements {
+		abstractConcept := refinement.GetAbstractConcept(traversal.trans)
+		refinedConcept := refinement.GetRefinedConcept(traversal.trans)
+		if abstractConcept == nil || refinedConcept == nil {
+			continue
+		}
+		abstractShown, err := traversal.addRelatedConcept(abstractConcept, traversal.options.FollowAbstractions)
+		if err != nil {
+			return errors.Wrap(err, "conceptGraphTraversal.addSubtree failed")
+		}
+		refinedShown, err := traversal.addRelatedConcept(refinedConcept, traversal.options.FollowAbstractions)
+		if err != nil {
+			return errors.Wrap(err, "conceptGraphTraversal.addSubtree failed")
+		}
+		if !abstractShown || !refinedShown {
+			continue
+		}
+		err = traversal.builder.addRefinement(refinement, traversal.trans)
+		if err != nil {
+			return errors.Wrap(err, "conceptGraphTraversal.addSubtree failed")
+		}
+	}
+	return nil
+}
+
+// addRelatedConcept ensures that the node for a concept related to the subtree exists, adding it if follow is true
+// and the options show it. It returns true if the node exists.
+func (traversal *conceptGraphTraversal) addRelatedConcept(concept Concept, follow bool) (bool, error) {
+	if traversal.builder.hasConceptNode(concept, traversal.trans) {
+		return true, nil
+	}
+	if !follow || concept.GetConceptType() == Refinement || !traversal.options.shows(concept, traversal.trans) {
+		return false, nil
+	}
+	err := traversal.addConcept(concept)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// addConcept adds the node for the element, reference, or literal along with the nodes and owner edges of those of
+// its owners that the options show
+func (traversal *conceptGraphTraversal) addConcept(concept Concept) error {
+	if traversal.builder.hasConceptNode(concept, traversal.trans) {
+		return nil
+	}
+	err := traversal.builder.addConceptNode(concept, traversal.trans)
+	if err != nil {
+		return errors.Wrap(err, "conceptGraphTraversal.addConcept failed")
+	}
+	// Make sure the owner is displayed
+	owner := concept.GetOwningConcept(traversal.trans)
+	if owner != nil && owner.GetConceptType() != Refinement && traversal.options.shows(owner, traversal.trans) {
+		err = traversal.addConcept(owner)
+		if err != nil {
+			return errors.Wrap(err, "conceptGraphTraversal.addConcept failed")
+		}
+		err = traversal.builder.addOwnerEdge(owner, concept, traversal.trans)
+		if err != nil {
+			return errors.Wrap(err, "conceptGraphTraversal.addConcept failed")
+		}
+	}
+	return nil
+}
+
+// shows returns true if the concept passes the filters of the options
+func (options *CrlGraphOptions) shows(concept Concept, trans *Transaction) bool {
+	if len(options.ConceptTypes) > 0 {
+		found := false
+		for _, conceptType := range options.ConceptTypes {
+			if concept.GetConceptType() == conceptType {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if options.HideCoreConcepts && concept.GetIsCore(trans) {
+		return false
+	}
+	name := concept.GetURI(trans)
+	if name == "" {
+		name = concept.GetConceptID(trans)
+	}
+	if len(options.IncludeURIPatterns) > 0 {
+		found := false
+		for _, pattern := range options.IncludeURIPatterns {
+			if pattern.MatchString(name) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, pattern := range options.ExcludeURIPatterns {
+		if pattern.MatchString(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedConcepts returns the concepts ordered by ConceptID so that graphs are generated deterministically
+func sortedConcepts(concepts map[string]Concept, trans *Transaction) []Concept {
+	var sorted []Concept
+	for _, concept := range concepts {
+		sorted = append(sorted, concept)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].GetConceptID(trans) < sorted[j].GetConceptID(trans)
+	})
+	return sorted
+}
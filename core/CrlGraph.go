@@ -1,21 +1,63 @@
 package core
 
 import (
+	"html"
+	"io"
 	"os"
+	"regexp"
+	"strconv"
 
 	"github.com/awalterschulze/gographviz"
 	"github.com/pkg/errors"
 )
 
+// CrlGraphOptions determine which concepts a CrlGraph shows and how they are grouped. A concept is shown only if it
+// passes every filter; a concept that is not shown hides the concepts it owns as well.
+type CrlGraphOptions struct {
+	// MaxDepth limits the number of levels of owned concepts added below the concept given to AddConceptRecursively.
+	// Zero means that there is no limit.
+	MaxDepth int
+	// ConceptTypes, when not empty, restricts the graph to concepts of the listed types. Refinements are drawn as edges
+	// and only when Refinement is listed.
+	ConceptTypes []ConceptType
+	// IncludeURIPatterns, when not empty, restricts the graph to concepts matching at least one of the patterns.
+	// Patterns are matched against the concept's URI or, if it has none, its ConceptID.
+	IncludeURIPatterns []*regexp.Regexp
+	// ExcludeURIPatterns removes the concepts matching any of the patterns, matched as for IncludeURIPatterns
+	ExcludeURIPatterns []*regexp.Regexp
+	// HideCoreConcepts removes the concepts of the core domain
+	HideCoreConcepts bool
+	// FollowReferences adds the concepts referenced from the subtree that lie outside it
+	FollowReferences bool
+	// FollowAbstractions adds the abstract and refined concepts of refinements in the subtree that lie outside it
+	FollowAbstractions bool
+	// ClusterByDomain draws each concept within a cluster subgraph for the domain, i.e. the root owner, containing it
+	ClusterByDomain bool
+}
+
+// DefaultCrlGraphOptions returns the options used by NewCrlGraph: all concepts are shown and references and
+// abstractions are followed outside the subtree
+func DefaultCrlGraphOptions() *CrlGraphOptions {
+	return &CrlGraphOptions{FollowReferences: true, FollowAbstractions: true}
+}
+
 // CrlGraph is a graphviz representation of a specified set of CRL data structures.
 // At present, Refinements cannot be the referencedConcept of a Reference.
 type CrlGraph struct {
 	gvgraph *gographviz.Graph
+	options CrlGraphOptions
+	// clusters maps the ConceptID of each domain to the name of its cluster subgraph
+	clusters map[string]string
 }
 
-// NewCrlGraph returns an initialized CrlGraph
+// NewCrlGraph returns an initialized CrlGraph using the DefaultCrlGraphOptions
 func NewCrlGraph(graphName string) *CrlGraph {
-	graph := &CrlGraph{}
+	return NewCrlGraphWithOptions(graphName, DefaultCrlGraphOptions())
+}
+
+// NewCrlGraphWithOptions returns an initialized CrlGraph using the given options
+func NewCrlGraphWithOptions(graphName string, options *CrlGraphOptions) *CrlGraph {
+	graph := &CrlGraph{options: *options, clusters: make(map[string]string)}
 	graph.gvgraph = gographviz.NewGraph()
 	graph.gvgraph.SetDir(true)
 	graph.gvgraph.SetStrict(true)
@@ -23,129 +65,75 @@ func NewCrlGraph(graphName string) *CrlGraph {
 	return graph
 }
 
-// AddConceptRecursively will add the given concept and all its child descendants to the graph.
-// it will also add any referenced concepts, but not recursively. Existing concepts will not be duplicated.
+// AddConceptRecursively will add the given concept and its child descendants, down to the graph's MaxDepth, to the
+// graph. Each concept added is accompanied by its owners so that it is shown in context. Refinements in the subtree
+// are drawn as edges, as are references to concepts in the graph; concepts referenced or refined from the subtree
+// are added, but not recursively, when the graph follows references or abstractions. Existing concepts will not be
+// duplicated.
 func (graphPtr *CrlGraph) AddConceptRecursively(concept Concept, trans *Transaction) error {
-	err := graphPtr.addConcept(concept, trans)
+	traversal := &conceptGraphTraversal{builder: graphPtr, options: &graphPtr.options, trans: trans}
+	err := traversal.addSubtree(concept)
 	if err != nil {
 		return errors.Wrap(err, "CrlGraph.AddConceptRecursively failed")
 	}
-	ownedConcepts := concept.GetOwnedConcepts(trans)
-	for _, el := range ownedConcepts {
-		switch el.GetConceptType() {
-		case Refinement:
-			ref := el
-			abstractConcept := ref.GetAbstractConcept(trans)
-			refinedConcept := ref.GetRefinedConcept(trans)
-			if abstractConcept != nil && refinedConcept != nil {
-				abstractConceptID := abstractConcept.GetConceptID(trans)
-				if !graphPtr.gvgraph.IsNode(abstractConceptID) {
-					err := graphPtr.addConcept(abstractConcept, trans)
-					if err != nil {
-						return errors.Wrap(err, "CrlGraph.addConcept failed")
-					}
-				}
-				refinedConceptID := refinedConcept.GetConceptID(trans)
-				if !graphPtr.gvgraph.IsNode(refinedConceptID) {
-					err := graphPtr.addConcept(refinedConcept, trans)
-					if err != nil {
-						return errors.Wrap(err, "CrlGraph.addConcept failed")
-					}
-				}
-				err := graphPtr.addRefinementEdge(abstractConcept, refinedConcept, trans)
-				if err != nil {
-					return errors.Wrap(err, "CrlGraph.addConcept failed")
-				}
-			}
-		case Element, Reference, Literal:
-			err := graphPtr.AddConceptRecursively(el, trans)
-			if err != nil {
-				return errors.Wrap(err, "CrlGraph.AddConceptRecursively failed")
-			}
-			err = graphPtr.addOwnerEdge(concept, el, trans)
-			if err != nil {
-				return errors.Wrap(err, "CrlGraph.AddConceptRecursively failed")
-			}
-		}
-	}
 	return nil
 }
 
-func (graphPtr *CrlGraph) addConcept(concept Concept, trans *Transaction) error {
+func (graphPtr *CrlGraph) hasConceptNode(concept Concept, trans *Transaction) bool {
+	return graphPtr.gvgraph.IsNode(graphPtr.nodeID(concept, trans))
+}
+
+// nodeID returns the graphviz ID of the node for the concept
+func (graphPtr *CrlGraph) nodeID(concept Concept, trans *Transaction) string {
+	return "\"" + concept.GetConceptID(trans) + "\""
+}
+
+// parentGraph returns the name of the graph or subgraph in which the concept's node is drawn, adding the cluster
+// subgraph for the concept's domain if necessary
+func (graphPtr *CrlGraph) parentGraph(concept Concept, trans *Transaction) (string, error) {
+	if !graphPtr.options.ClusterByDomain {
+		return "", nil
+	}
+	domain := concept
+	for domain.GetOwningConcept(trans) != nil {
+		domain = domain.GetOwningConcept(trans)
+	}
+	domainID := domain.GetConceptID(trans)
+	if cluster, found := graphPtr.clusters[domainID]; found {
+		return cluster, nil
+	}
+	cluster := "\"cluster_" + domainID + "\""
+	clusterAttrs := make(map[string]string)
+	clusterAttrs["label"] = strconv.Quote(domain.GetLabel(trans))
+	clusterAttrs["style"] = "rounded"
+	err := graphPtr.gvgraph.AddSubGraph(graphPtr.gvgraph.Name, cluster, clusterAttrs)
+	if err != nil {
+		return "", errors.Wrap(err, "CrlGraph.parentGraph failed")
+	}
+	graphPtr.clusters[domainID] = cluster
+	return cluster, nil
+}
+
+// addConceptNode adds the node for the element, reference, or literal
+func (graphPtr *CrlGraph) addConceptNode(concept Concept, trans *Transaction) error {
+	id := graphPtr.nodeID(concept, trans)
+	label := html.EscapeString(concept.GetLabel(trans))
+	typeName := ConceptTypeToString(concept.GetConceptType())
+	nodeAttrs := make(map[string]string)
+	nodeAttrs["shape"] = "none"
+	referencedAttributeNameExt := ""
 	switch concept.GetConceptType() {
-	case Refinement:
-		abstractConcept := concept.GetAbstractConcept(trans)
-		refinedConcept := concept.GetRefinedConcept(trans)
-		if abstractConcept != nil && refinedConcept != nil {
-			abstractConceptID := abstractConcept.GetConceptID(trans)
-			if !graphPtr.gvgraph.IsNode(abstractConceptID) {
-				err := graphPtr.addConcept(abstractConcept, trans)
-				if err != nil {
-					return errors.Wrap(err, "CrlGraph.addConcept failed")
-				}
-			}
-			refinedConceptID := refinedConcept.GetConceptID(trans)
-			if !graphPtr.gvgraph.IsNode(refinedConceptID) {
-				err := graphPtr.addConcept(refinedConcept, trans)
-				if err != nil {
-					return errors.Wrap(err, "CrlGraph.addConcept failed")
-				}
-			}
-			err := graphPtr.addRefinementEdge(abstractConcept, refinedConcept, trans)
-			if err != nil {
-				return errors.Wrap(err, "CrlGraph.addConcept failed")
-			}
-		}
-	case Element, Reference, Literal:
-		id := "\"" + concept.GetConceptID(trans) + "\""
-		label := concept.GetLabel(trans)
-		typeName := ConceptTypeToString(concept.GetConceptType())
-		if !graphPtr.gvgraph.IsNode(id) {
-			nodeAttrs := make(map[string]string)
-			nodeAttrs["shape"] = "none"
-			referencedAttributeNameExt := ""
-			switch concept.GetConceptType() {
-			case Reference:
-				referencedAttributeNameExt = "<TR><TD>" + concept.GetReferencedAttributeName(trans).String() + "</TD></TR>"
-			}
-			nodeAttrs["label"] = "<<TABLE><TR><TD>" + typeName + "</TD></TR><TR><TD>" + label + "</TD></TR><TR><TD>" + id + "</TD></TR>" + referencedAttributeNameExt + " </TABLE>>"
-			err := graphPtr.gvgraph.AddNode("", id, nodeAttrs)
-			if err != nil {
-				return errors.Wrap(err, "CrlGraph.addConcept failed")
-			}
-			// Make sure the owner is displayed
-			owner := concept.GetOwningConcept(trans)
-			if owner != nil {
-				ownerID := owner.GetConceptID(trans)
-				if !graphPtr.gvgraph.IsNode(ownerID) {
-					err := graphPtr.addConcept(owner, trans)
-					if err != nil {
-						return errors.Wrap(err, "CrlGraph.addConcept failed")
-					}
-					err = graphPtr.addOwnerEdge(owner, concept, trans)
-					if err != nil {
-						return errors.Wrap(err, "CrlGraph.addConcept failed")
-					}
-				}
-			}
-			switch concept.GetConceptType() {
-			case Reference:
-				referencedConceptID := concept.GetReferencedConceptID(trans)
-				if referencedConceptID != "" {
-					referencedConcept := concept.GetReferencedConcept(trans)
-					if !graphPtr.gvgraph.IsNode(referencedConceptID) {
-						err := graphPtr.addConcept(referencedConcept, trans)
-						if err != nil {
-							return errors.Wrap(err, "CrlGraph.addConcept failed")
-						}
-					}
-					err := graphPtr.addReferencedElementEdge(concept, referencedConcept, trans)
-					if err != nil {
-						return errors.Wrap(err, "CrlGraph.addConcept failed")
-					}
-				}
-			}
-		}
+	case Reference:
+		referencedAttributeNameExt = "<TR><TD>" + concept.GetReferencedAttributeName(trans).String() + "</TD></TR>"
+	}
+	nodeAttrs["label"] = "<<TABLE><TR><TD>" + typeName + "</TD></TR><TR><TD>" + label + "</TD></TR><TR><TD>" + id + "</TD></TR>" + referencedAttributeNameExt + " </TABLE>>"
+	parentGraph, err := graphPtr.parentGraph(concept, trans)
+	if err != nil {
+		return errors.Wrap(err, "CrlGraph.addConceptNode failed")
+	}
+	err = graphPtr.gvgraph.AddNode(parentGraph, id, nodeAttrs)
+	if err != nil {
+		return errors.Wrap(err, "CrlGraph.addConceptNode failed")
 	}
 	return nil
 }
@@ -217,16 +205,19 @@ func (graphPtr *CrlGraph) addRefinementEdge(abstractConcept Concept, refinedConc
 	return nil
 }
 
+func (graphPtr *CrlGraph) addRefinement(refinement Concept, trans *Transaction) error {
+	return graphPtr.addRefinementEdge(refinement.GetAbstractConcept(trans), refinement.GetRefinedConcept(trans), trans)
+}
+
 // ExportDOT writes a file containing the DOT representation of the graph
 func (graphPtr *CrlGraph) ExportDOT(pathname string, filename string) error {
 	file, err := graphPtr.newFile(pathname, filename)
 	if err != nil {
 		return errors.Wrap(err, "CrlGraph.ExportDOT failed")
 	}
-	graphString := graphPtr.gvgraph.String()
-	graphBytes := []byte(graphString)
-	_, err2 := file.Write(graphBytes)
-	if err2 != nil {
+	err = graphPtr.WriteDOT(file)
+	if err != nil {
+		file.Close()
 		return errors.Wrap(err, "CrlGraph.ExportDOT failed")
 	}
 	err = file.Close()
@@ -236,10 +227,19 @@ func (graphPtr *CrlGraph) ExportDOT(pathname string, filename string) error {
 	return nil
 }
 
+// WriteDOT writes the DOT representation of the graph to the writer
+func (graphPtr *CrlGraph) WriteDOT(writer io.Writer) error {
+	_, err := io.WriteString(writer, graphPtr.gvgraph.String())
+	if err != nil {
+		return errors.Wrap(err, "CrlGraph.WriteDOT failed")
+	}
+	return nil
+}
+
 // newFile creates a file with the name being the ConceptID of the supplied Element and returns the workspaceFile struct
 func (graphPtr *CrlGraph) newFile(path string, filename string) (*os.File, error) {
 	fullPath := path + "/" + filename + ".dot"
-	file, err := os.OpenFile(fullPath, os.O_RDWR|os.O_CREATE, 0644)
+	file, err := os.OpenFile(fullPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		return nil, errors.Wrap(err, "CrlGraph.newFile failed")
 	}
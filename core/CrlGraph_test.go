@@ -1,8 +1,11 @@
 package core
 
 import (
+	"bytes"
 	"log"
 	"os"
+	"regexp"
+	"strings"
 
 	. "github.com/onsi/ginkgo/v2/dsl/core"
 	. "github.com/onsi/gomega"
@@ -37,4 +40,103 @@ var _ = Describe("CrlGraph tests", func() {
 		Expect(graph.AddConceptRecursively(coreDomain, trans)).To(Succeed())
 		Expect(graph.ExportDOT(tempDirPath, "CoreDomain")).To(Succeed())
 	})
+
+	Describe("Graph options", func() {
+		var domain, a, b, grandchild, reference, refinement, external, coreRefinement Concept
+
+		BeforeEach(func() {
+			domain, _ = uOfD.NewElement(trans, "http://graphtest/domain")
+			domain.SetLabel("Domain", trans)
+			a, _ = uOfD.NewOwnedElement(domain, "A", trans, "http://graphtest/domain/A")
+			b, _ = uOfD.NewOwnedElement(domain, "B", trans, "http://graphtest/domain/B")
+			grandchild, _ = uOfD.NewOwnedLiteral(b, "Grandchild", trans, "http://graphtest/domain/B/Grandchild")
+			refinement, _ = uOfD.NewOwnedRefinement(b, "B refines A", a, b, trans)
+			otherDomain, _ := uOfD.NewElement(trans, "http://graphtest/other")
+			otherDomain.SetLabel("Other", trans)
+			external, _ = uOfD.NewOwnedElement(otherDomain, "External", trans, "http://graphtest/other/External")
+			reference, _ = uOfD.NewOwnedReference(a, "R", trans, "http://graphtest/domain/A/R")
+			reference.SetReferencedConcept(external, NoAttribute, trans)
+			coreRefinement, _ = uOfD.NewOwnedRefinement(a, "A refines Element", uOfD.GetElementWithURI(ElementURI), a, trans)
+		})
+
+		writeGraph := func(options *CrlGraphOptions) string {
+			graph := NewCrlGraphWithOptions("Test", options)
+			Expect(graph.AddConceptRecursively(domain, trans)).To(Succeed())
+			var buffer bytes.Buffer
+			Expect(graph.WriteDOT(&buffer)).To(Succeed())
+			return buffer.String()
+		}
+		hasNode := func(dot string, concept Concept) bool {
+			return strings.Contains(dot, "\""+concept.GetConceptID(trans)+"\" [")
+		}
+		hasEdge := func(dot string, from Concept, to Concept) bool {
+			return strings.Contains(dot, "\""+from.GetConceptID(trans)+"\"->\""+to.GetConceptID(trans)+"\"")
+		}
+
+		Specify("The default options should show the subtree and follow references and abstractions", func() {
+			dot := writeGraph(DefaultCrlGraphOptions())
+			Expect(dot).To(HavePrefix("strict digraph Test"))
+			for _, concept := range []Concept{domain, a, b, grandchild, reference, external} {
+				Expect(hasNode(dot, concept)).To(BeTrue(), concept.GetLabel(trans))
+			}
+			Expect(hasNode(dot, uOfD.GetElementWithURI(ElementURI))).To(BeTrue())
+			Expect(hasEdge(dot, a, b)).To(BeTrue())
+			Expect(hasEdge(dot, reference, external)).To(BeTrue())
+			Expect(hasEdge(dot, domain, b)).To(BeTrue())
+		})
+
+		Specify("MaxDepth should limit the levels of owned concepts", func() {
+			dot := writeGraph(&CrlGraphOptions{MaxDepth: 1})
+			Expect(hasNode(dot, b)).To(BeTrue())
+			Expect(hasNode(dot, grandchild)).To(BeFalse())
+			Expect(hasNode(dot, reference)).To(BeFalse())
+			// The refinement is owned at the second level
+			Expect(hasEdge(dot, a, b)).To(BeFalse())
+		})
+
+		Specify("ConceptTypes should restrict the concepts shown", func() {
+			dot := writeGraph(&CrlGraphOptions{ConceptTypes: []ConceptType{Element}, FollowReferences: true, FollowAbstractions: true})
+			Expect(hasNode(dot, a)).To(BeTrue())
+			Expect(hasNode(dot, grandchild)).To(BeFalse())
+			Expect(hasNode(dot, reference)).To(BeFalse())
+			Expect(hasNode(dot, external)).To(BeFalse())
+			Expect(hasEdge(dot, a, b)).To(BeFalse())
+		})
+
+		Specify("URI patterns should include and exclude concepts and their subtrees", func() {
+			dot := writeGraph(&CrlGraphOptions{ExcludeURIPatterns: []*regexp.Regexp{regexp.MustCompile("/B$")}})
+			Expect(hasNode(dot, a)).To(BeTrue())
+			Expect(hasNode(dot, b)).To(BeFalse())
+			Expect(hasNode(dot, grandchild)).To(BeFalse())
+			dot = writeGraph(&CrlGraphOptions{IncludeURIPatterns: []*regexp.Regexp{regexp.MustCompile("^http://graphtest/")}, FollowAbstractions: true})
+			Expect(hasNode(dot, grandchild)).To(BeTrue())
+			// Refinements without URIs are matched by ConceptID and so are not included
+			Expect(hasEdge(dot, a, b)).To(BeFalse())
+		})
+
+		Specify("HideCoreConcepts should remove the core concepts", func() {
+			dot := writeGraph(&CrlGraphOptions{HideCoreConcepts: true, FollowAbstractions: true})
+			Expect(hasNode(dot, uOfD.GetElementWithURI(ElementURI))).To(BeFalse())
+			Expect(hasNode(dot, uOfD.GetElementWithURI(CoreDomainURI))).To(BeFalse())
+			Expect(hasEdge(dot, a, b)).To(BeTrue())
+			Expect(coreRefinement).ToNot(BeNil())
+		})
+
+		Specify("References and abstractions outside the subtree should only be followed when requested", func() {
+			dot := writeGraph(&CrlGraphOptions{})
+			Expect(hasNode(dot, external)).To(BeFalse())
+			Expect(hasNode(dot, uOfD.GetElementWithURI(ElementURI))).To(BeFalse())
+			Expect(hasEdge(dot, a, b)).To(BeTrue())
+			Expect(refinement).ToNot(BeNil())
+		})
+
+		Specify("ClusterByDomain should draw each domain as a cluster subgraph", func() {
+			dot := writeGraph(&CrlGraphOptions{FollowReferences: true, ClusterByDomain: true})
+			Expect(dot).To(ContainSubstring("subgraph \"cluster_" + domain.GetConceptID(trans) + "\""))
+			Expect(dot).To(ContainSubstring("subgraph \"cluster_" + external.GetOwningConcept(trans).GetConceptID(trans) + "\""))
+			Expect(dot).To(ContainSubstring("label=\"Domain\""))
+			Expect(dot).To(ContainSubstring("label=\"Other\""))
+			Expect(hasNode(dot, external)).To(BeTrue())
+		})
+	})
 })
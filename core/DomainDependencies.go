@@ -0,0 +1,137 @@
+package core
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+
+	mapset "github.com/deckarep/golang-set"
+	"github.com/pkg/errors"
+)
+
+// GetDomainDependencies returns the URIs of the domains on which the domain depends, in order. A domain depends on
+// another when one of its concepts references, refines, or is refined by a concept of the other domain. The domain of
+// a concept is the root of its chain of owners. The built-in domains, such as those of the domain providers, are
+// included so that their migrations are applied to the domain; only the core domain and domains without a URI are not.
+func (uOfDPtr *UniverseOfDiscourse) GetDomainDependencies(domain Concept, trans *Transaction) []string {
+	domainID := domain.GetConceptID(trans)
+	members := mapset.NewSet(domainID)
+	uOfDPtr.GetConceptsOwnedConceptIDsRecursively(domainID, members, trans)
+	dependencies := make(map[string]bool)
+	for member := range members.Iter() {
+		el := uOfDPtr.GetElement(member.(string))
+		if el == nil {
+			continue
+		}
+		for _, targetID := range integrityPointers(el, trans) {
+			if members.Contains(targetID) {
+				continue
+			}
+			target := uOfDPtr.GetElement(targetID)
+			if target == nil {
+				continue
+			}
+			if uri := uOfDPtr.getRootConcept(target, trans).GetURI(trans); uri != "" && uri != CoreDomainURI {
+				dependencies[uri] = true
+			}
+		}
+	}
+	var uris []string
+	for uri := range dependencies {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+	return uris
+}
+
+// getRootConcept returns the root of the concept's chain of owners, stopping at an owner that is not loaded
+func (uOfDPtr *UniverseOfDiscourse) getRootConcept(el Concept, trans *Transaction) Concept {
+	visited := make(map[string]bool)
+	for {
+		visited[el.GetConceptID(trans)] = true
+		owner := el.GetOwningConcept(trans)
+		if owner == nil || visited[owner.GetConceptID(trans)] {
+			return el
+		}
+		el = owner
+	}
+}
+
+// ReadDomainHeader reads the DomainHeader of a serialized domain without reading its concepts. A domain serialized
+// before headers were written is given a header with the legacy format version. If the header does not identify the
+// DomainURI, it is taken from the first concept, which is the domain itself.
+func ReadDomainHeader(reader io.Reader) (*DomainHeader, error) {
+	decoder := json.NewDecoder(reader)
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, errors.Wrap(err, "ReadDomainHeader failed")
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, errors.New("ReadDomainHeader expected the start of an array")
+	}
+	header := &DomainHeader{FormatVersion: legacyDomainFormatVersion}
+	for decoder.More() {
+		var data json.RawMessage
+		err = decoder.Decode(&data)
+		if err != nil {
+			return nil, errors.Wrap(err, "ReadDomainHeader failed")
+		}
+		foundHeader, err := parseDomainHeader(data)
+		if err != nil {
+			return nil, errors.Wrap(err, "ReadDomainHeader failed")
+		}
+		if foundHeader != nil {
+			header = foundHeader
+			if header.DomainURI != "" {
+				break
+			}
+			continue
+		}
+		var domain struct {
+			URI string
+		}
+		err = json.Unmarshal(data, &domain)
+		if err != nil {
+			return nil, errors.Wrap(err, "ReadDomainHeader failed")
+		}
+		header.DomainURI = domain.URI
+		break
+	}
+	return header, nil
+}
+
+// OrderDomainsByDependencies returns the indices of the headers ordered so that each domain follows the domains on
+// which it depends. Dependencies on domains that are not among the headers are ignored, and domains that do not
+// depend on each other keep their relative order. A cycle of dependencies is broken at the dependency of the last
+// domain of the cycle to be reached on the first, so the domain of the cycle that comes first in the headers is placed
+// last. The pointers between the domains of a cycle are resolved as the later domains are loaded.
+func OrderDomainsByDependencies(headers []*DomainHeader) []int {
+	indices := make(map[string]int)
+	for i, header := range headers {
+		if header.DomainURI != "" {
+			if _, found := indices[header.DomainURI]; !found {
+				indices[header.DomainURI] = i
+			}
+		}
+	}
+	var order []int
+	// visited holds the domains that have been placed or whose dependencies are being placed
+	visited := make(map[int]bool)
+	var place func(i int)
+	place = func(i int) {
+		if visited[i] {
+			return
+		}
+		visited[i] = true
+		for _, dependency := range headers[i].Dependencies {
+			if j, found := indices[dependency]; found {
+				place(j)
+			}
+		}
+		order = append(order, i)
+	}
+	for i := range headers {
+		place(i)
+	}
+	return order
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Domain dependencies", func() {
+	var uOfD *UniverseOfDiscourse
+	var trans *Transaction
+	var baseDomain, derivedDomain Concept
+	var baseConcept Concept
+
+	BeforeEach(func() {
+		uOfD = NewUniverseOfDiscourse()
+		trans = uOfD.NewTransaction()
+		baseDomain, _ = uOfD.NewElement(trans, "http://activeCrl.com/test/BaseDomain")
+		baseConcept, _ = uOfD.NewElement(trans)
+		Expect(baseConcept.SetOwningConcept(baseDomain, trans)).To(Succeed())
+		derivedDomain, _ = uOfD.NewElement(trans, "http://activeCrl.com/test/DerivedDomain")
+		refinement, _ := uOfD.NewRefinement(trans)
+		Expect(refinement.SetOwningConcept(derivedDomain, trans)).To(Succeed())
+		Expect(refinement.SetAbstractConcept(baseConcept, trans)).To(Succeed())
+		Expect(refinement.SetRefinedConcept(derivedDomain, trans)).To(Succeed())
+		reference, _ := uOfD.NewReference(trans)
+		Expect(reference.SetOwningConcept(derivedDomain, trans)).To(Succeed())
+		Expect(reference.SetReferencedConcept(uOfD.GetElementWithURI(ElementURI), NoAttribute, trans)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		trans.ReleaseLocks()
+	})
+
+	Specify("Dependencies should be found from the pointers that leave the domain", func() {
+		Expect(uOfD.GetDomainDependencies(derivedDomain, trans)).To(Equal([]string{"http://activeCrl.com/test/BaseDomain"}))
+		Expect(uOfD.GetDomainDependencies(baseDomain, trans)).To(BeEmpty())
+	})
+
+	Specify("The header of a serialized domain should declare its URI and dependencies", func() {
+		var buffer bytes.Buffer
+		Expect(uOfD.EncodeDomain(&buffer, derivedDomain, trans)).To(Succeed())
+		header, err := ReadDomainHeader(bytes.NewReader(buffer.Bytes()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(header.FormatVersion).To(Equal(CurrentDomainFormatVersion))
+		Expect(header.DomainURI).To(Equal("http://activeCrl.com/test/DerivedDomain"))
+		Expect(header.Dependencies).To(Equal([]string{"http://activeCrl.com/test/BaseDomain"}))
+	})
+
+	Specify("The URI of a domain without a header should be read from the domain", func() {
+		header, err := ReadDomainHeader(strings.NewReader(`[{"ConceptID":"d","ConceptType":"*core.concept","URI":"http://activeCrl.com/test/Legacy"}]`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(header.FormatVersion).To(Equal(legacyDomainFormatVersion))
+		Expect(header.DomainURI).To(Equal("http://activeCrl.com/test/Legacy"))
+		Expect(header.Dependencies).To(BeEmpty())
+	})
+
+	Specify("Domains should be ordered after the domains on which they depend", func() {
+		headers := []*DomainHeader{
+			{DomainURI: "c", Dependencies: []string{"b", "external"}},
+			{DomainURI: "a"},
+			{DomainURI: "b", Dependencies: []string{"a"}},
+			{DomainURI: "d"}}
+		Expect(OrderDomainsByDependencies(headers)).To(Equal([]int{1, 2, 0, 3}))
+	})
+
+	Specify("Dependency cycles should be broken in the given order", func() {
+		headers := []*DomainHeader{
+			{DomainURI: "a", Dependencies: []string{"b"}},
+			{DomainURI: "b", Dependencies: []string{"a"}}}
+		Expect(OrderDomainsByDependencies(headers)).To(Equal([]int{1, 0}))
+	})
+
+	Specify("Domains loaded in any order should have their pointers resolved", func() {
+		var baseBuffer, derivedBuffer bytes.Buffer
+		Expect(uOfD.EncodeDomain(&baseBuffer, baseDomain, trans)).To(Succeed())
+		Expect(uOfD.EncodeDomain(&derivedBuffer, derivedDomain, trans)).To(Succeed())
+		uOfD2 := NewUniverseOfDiscourse()
+		trans2 := uOfD2.NewTransaction()
+		defer trans2.ReleaseLocks()
+		derived, err := uOfD2.RecoverDomain(derivedBuffer.Bytes(), trans2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(uOfD2.IsUnresolved(baseConcept.GetConceptID(trans), trans2)).To(BeTrue())
+		_, err = uOfD2.RecoverDomain(baseBuffer.Bytes(), trans2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(uOfD2.GetUnresolvedPointers(trans2)).To(BeEmpty())
+		Expect(derived.IsRefinementOf(uOfD2.GetElement(baseConcept.GetConceptID(trans)), trans2)).To(BeTrue())
+	})
+})
@@ -0,0 +1,358 @@
+package core
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// CurrentDomainFormatVersion is the version of the serialization format written by EncodeDomain
+const CurrentDomainFormatVersion = "2"
+
+// legacyDomainFormatVersion is the format version assigned to serialized domains that do not have a header
+const legacyDomainFormatVersion = "1"
+
+// DomainHeader is the first element of a serialized domain. It identifies the version of the serialization format and
+// the versions of the domains that were loaded in the uOfD when the domain was serialized. It also gives the URI of the
+// serialized domain and the URIs of the domains on which it depends, so that domains can be loaded in order.
+type DomainHeader struct {
+	FormatVersion  string
+	DomainVersions map[string]string `json:",omitempty"`
+	DomainURI      string            `json:",omitempty"`
+	Dependencies   []string          `json:",omitempty"`
+}
+
+// parseDomainHeader returns the header if the data is a serialized DomainHeader and nil if it is a serialized concept
+func parseDomainHeader(data []byte) (*DomainHeader, error) {
+	var probe struct {
+		FormatVersion *string
+	}
+	err := json.Unmarshal(data, &probe)
+	if err != nil {
+		return nil, errors.Wrap(err, "parseDomainHeader failed")
+	}
+	if probe.FormatVersion == nil {
+		return nil, nil
+	}
+	var header DomainHeader
+	err = json.Unmarshal(data, &header)
+	if err != nil {
+		return nil, errors.Wrap(err, "parseDomainHeader failed")
+	}
+	return &header, nil
+}
+
+// SerializedConcept is the generic form of a serialized concept that is presented to MigrationFunctions. The keys are
+// the field names written by concept.MarshalJSON.
+type SerializedConcept map[string]interface{}
+
+// MigrationFunction updates a serialized concept in place, returning true if the concept was changed
+type MigrationFunction func(serializedConcept SerializedConcept) (bool, error)
+
+// Migration converts serialized concepts from one version to the next. A Migration with an empty DomainURI converts
+// between versions of the serialization format; otherwise it converts between versions of the identified domain.
+// The concepts of a serialized domain are presented to the Migrations of the domain itself and of the domains on which
+// it depends (see DomainHeader.Dependencies), since they may refer to the concepts of those domains. A nil Migrate
+// function changes only the version.
+type Migration struct {
+	DomainURI   string
+	FromVersion string
+	ToVersion   string
+	Description string
+	Migrate     MigrationFunction
+}
+
+// MigratedConcept records the changes that migration makes to a single concept
+type MigratedConcept struct {
+	ConceptID   string
+	Migrations  []string
+	BeforeState SerializedConcept
+	AfterState  SerializedConcept
+}
+
+// MigrationReport describes the migrations applied, or in a dry run that would be applied, to a serialized domain
+type MigrationReport struct {
+	// FormatVersion is the format version of the serialized domain
+	FormatVersion string
+	// DomainVersions are the domain versions recorded in the serialized domain
+	DomainVersions map[string]string
+	// Migrations are the migrations in the order in which they are applied
+	Migrations []*Migration
+	// ChangedConcepts are the concepts changed by the migrations in the order in which they were serialized
+	ChangedConcepts []*MigratedConcept
+}
+
+// migrationRegistry holds Migrations keyed by domain URI and the version from which they migrate
+type migrationRegistry struct {
+	sync.RWMutex
+	migrations map[string]map[string]*Migration
+}
+
+func newMigrationRegistry() *migrationRegistry {
+	var registry migrationRegistry
+	registry.migrations = make(map[string]map[string]*Migration)
+	registry.add(&Migration{
+		FromVersion: legacyDomainFormatVersion,
+		ToVersion:   CurrentDomainFormatVersion,
+		Description: "Add the domain header"})
+	return &registry
+}
+
+func (registry *migrationRegistry) add(migration *Migration) error {
+	registry.Lock()
+	defer registry.Unlock()
+	if registry.migrations[migration.DomainURI] == nil {
+		registry.migrations[migration.DomainURI] = make(map[string]*Migration)
+	}
+	if registry.migrations[migration.DomainURI][migration.FromVersion] != nil {
+		return errors.New("migrationRegistry.add found existing migration for domain " + migration.DomainURI + " from version " + migration.FromVersion)
+	}
+	registry.migrations[migration.DomainURI][migration.FromVersion] = migration
+	return nil
+}
+
+func (registry *migrationRegistry) copyTo(target *migrationRegistry) {
+	registry.RLock()
+	defer registry.RUnlock()
+	target.Lock()
+	defer target.Unlock()
+	for domainURI, migrations := range registry.migrations {
+		target.migrations[domainURI] = make(map[string]*Migration)
+		for fromVersion, migration := range migrations {
+			target.migrations[domainURI][fromVersion] = migration
+		}
+	}
+}
+
+// chain returns the migrations that convert the domain from the given version to the target version
+func (registry *migrationRegistry) chain(domainURI string, fromVersion string, toVersion string) ([]*Migration, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+	var chain []*Migration
+	visited := make(map[string]bool)
+	version := fromVersion
+	for version != toVersion {
+		if visited[version] {
+			return nil, errors.New("migrationRegistry.chain found cyclic migrations for domain " + domainURI + " at version " + version)
+		}
+		visited[version] = true
+		migration := registry.migrations[domainURI][version]
+		if migration == nil {
+			return nil, errors.New("migrationRegistry.chain found no migration for domain " + domainURI + " from version " + version + " to version " + toVersion)
+		}
+		chain = append(chain, migration)
+		version = migration.ToVersion
+	}
+	return chain, nil
+}
+
+// plan returns the migrations needed to bring a domain serialized with the header up to the current format version
+// and the given domain versions. Format migrations are applied first, followed by domain migrations ordered by
+// domain URI. Only the serialized domain itself and the domains on which it depends (its Dependencies) are migrated,
+// and only if they are currently loaded. A domain whose recorded version cannot be brought to the current version
+// because no migration starts from the recorded version, as when the serialized domain is newer than the loaded one,
+// is recovered unchanged with a warning. A chain of migrations that starts but does not reach the current version is
+// an error, since the migrations show that the concepts must be converted.
+func (registry *migrationRegistry) plan(header *DomainHeader, currentDomainVersions map[string]string) ([]*Migration, error) {
+	plan, err := registry.chain("", header.FormatVersion, CurrentDomainFormatVersion)
+	if err != nil {
+		return nil, errors.Wrap(err, "migrationRegistry.plan failed")
+	}
+	migratedDomains := make(map[string]bool)
+	if header.DomainURI != "" {
+		migratedDomains[header.DomainURI] = true
+	}
+	for _, dependency := range header.Dependencies {
+		migratedDomains[dependency] = true
+	}
+	var domainURIs []string
+	for domainURI := range migratedDomains {
+		domainURIs = append(domainURIs, domainURI)
+	}
+	sort.Strings(domainURIs)
+	for _, domainURI := range domainURIs {
+		recordedVersion := header.DomainVersions[domainURI]
+		currentVersion := currentDomainVersions[domainURI]
+		if recordedVersion == "" || currentVersion == "" {
+			continue
+		}
+		domainChain, err := registry.chain(domainURI, recordedVersion, currentVersion)
+		if err != nil {
+			if registry.hasMigrationFrom(domainURI, recordedVersion) {
+				return nil, errors.Wrap(err, "migrationRegistry.plan failed")
+			}
+			log.Printf("Domain %s was serialized with version %s but version %s is loaded and there is no migration between them", domainURI, recordedVersion, currentVersion)
+			continue
+		}
+		plan = append(plan, domainChain...)
+	}
+	return plan, nil
+}
+
+// hasMigrationFrom returns true if a migration from the version of the domain is registered
+func (registry *migrationRegistry) hasMigrationFrom(domainURI string, fromVersion string) bool {
+	registry.RLock()
+	defer registry.RUnlock()
+	return registry.migrations[domainURI][fromVersion] != nil
+}
+
+// migrateConcept applies the migrations to the serialized concept, returning the migrated data. If the report is not
+// nil and the concept is changed, the change is added to the report.
+func migrateConcept(data []byte, plan []*Migration, report *MigrationReport) ([]byte, error) {
+	var serializedConcept SerializedConcept
+	err := json.Unmarshal(data, &serializedConcept)
+	if err != nil {
+		return nil, errors.Wrap(err, "migrateConcept failed")
+	}
+	var applied []string
+	for _, migration := range plan {
+		if migration.Migrate == nil {
+			continue
+		}
+		changed, err := migration.Migrate(serializedConcept)
+		if err != nil {
+			return nil, errors.Wrap(err, "migrateConcept failed: "+migration.Description)
+		}
+		if changed {
+			applied = append(applied, migration.Description)
+		}
+	}
+	if len(applied) == 0 {
+		return data, nil
+	}
+	migratedData, err := json.Marshal(serializedConcept)
+	if err != nil {
+		return nil, errors.Wrap(err, "migrateConcept failed")
+	}
+	if report != nil {
+		var migratedConcept MigratedConcept
+		err = json.Unmarshal(data, &migratedConcept.BeforeState)
+		if err != nil {
+			return nil, errors.Wrap(err, "migrateConcept failed")
+		}
+		migratedConcept.AfterState = serializedConcept
+		migratedConcept.ConceptID, _ = serializedConcept["ConceptID"].(string)
+		migratedConcept.Migrations = applied
+		report.ChangedConcepts = append(report.ChangedConcepts, &migratedConcept)
+	}
+	return migratedData, nil
+}
+
+// RegisterMigration adds a migration that is applied when recovering serialized domains of the migration's
+// FromVersion. There can be at most one migration from each version of a domain.
+func (uOfDPtr *UniverseOfDiscourse) RegisterMigration(migration Migration) error {
+	if migration.FromVersion == "" || migration.ToVersion == "" {
+		return errors.New("UniverseOfDiscourse.RegisterMigration called without both FromVersion and ToVersion")
+	}
+	if migration.FromVersion == migration.ToVersion {
+		return errors.New("UniverseOfDiscourse.RegisterMigration called with identical FromVersion and ToVersion: " + migration.FromVersion)
+	}
+	err := uOfDPtr.migrations.add(&migration)
+	if err != nil {
+		return errors.Wrap(err, "UniverseOfDiscourse.RegisterMigration failed")
+	}
+	return nil
+}
+
+// SetDomainVersion records the version of a domain loaded in the uOfD. The versions of all loaded domains are written
+// in the header of serialized domains and are the targets of domain migrations.
+func (uOfDPtr *UniverseOfDiscourse) SetDomainVersion(domainURI string, version string) {
+	uOfDPtr.domainVersions.SetEntry(domainURI, version)
+}
+
+// GetDomainVersions returns the versions of the domains loaded in the uOfD keyed by domain URI
+func (uOfDPtr *UniverseOfDiscourse) GetDomainVersions() map[string]string {
+	return uOfDPtr.domainVersions.CopyMap()
+}
+
+// DryRunDomainMigration reads a serialized domain and reports the migrations that RecoverDomain would apply and the
+// concepts they would change. The uOfD is not modified.
+func (uOfDPtr *UniverseOfDiscourse) DryRunDomainMigration(reader io.Reader) (*MigrationReport, error) {
+	var report MigrationReport
+	err := uOfDPtr.readDomain(reader, &report, func(data []byte) error { return nil })
+	if err != nil {
+		return &report, errors.Wrap(err, "UniverseOfDiscourse.DryRunDomainMigration failed")
+	}
+	return &report, nil
+}
+
+// readDomain reads a serialized domain, migrating each concept as needed and passing it to the recoverConcept function. If
+// the report is not nil, the changes made by the migrations are added to it.
+func (uOfDPtr *UniverseOfDiscourse) readDomain(reader io.Reader, report *MigrationReport, recoverConcept func(data []byte) error) error {
+	decoder := json.NewDecoder(reader)
+	token, err := decoder.Token()
+	if err != nil {
+		return errors.Wrap(err, "UniverseOfDiscourse.readDomain failed")
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return errors.New("UniverseOfDiscourse.readDomain expected the start of an array")
+	}
+	header := &DomainHeader{FormatVersion: legacyDomainFormatVersion}
+	var firstConcept json.RawMessage
+	if decoder.More() {
+		var data json.RawMessage
+		err = decoder.Decode(&data)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.readDomain failed")
+		}
+		var foundHeader *DomainHeader
+		foundHeader, err = parseDomainHeader(data)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.readDomain failed")
+		}
+		if foundHeader != nil {
+			header = foundHeader
+		} else {
+			firstConcept = data
+		}
+	}
+	plan, err := uOfDPtr.migrations.plan(header, uOfDPtr.GetDomainVersions())
+	if err != nil {
+		return errors.Wrap(err, "UniverseOfDiscourse.readDomain failed")
+	}
+	if report != nil {
+		report.FormatVersion = header.FormatVersion
+		report.DomainVersions = header.DomainVersions
+		report.Migrations = plan
+	}
+	for _, migration := range plan {
+		if migration.Migrate != nil {
+			log.Printf("Migrating serialized domain: %s", migration.Description)
+		}
+	}
+	process := func(data []byte) error {
+		if len(plan) > 0 {
+			data, err = migrateConcept(data, plan, report)
+			if err != nil {
+				return err
+			}
+		}
+		return recoverConcept(data)
+	}
+	if firstConcept != nil {
+		err = process(firstConcept)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.readDomain failed")
+		}
+	}
+	for decoder.More() {
+		var data json.RawMessage
+		err = decoder.Decode(&data)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.readDomain failed")
+		}
+		err = process(data)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.readDomain failed")
+		}
+	}
+	_, err = decoder.Token()
+	if err != nil {
+		return errors.Wrap(err, "UniverseOfDiscourse.readDomain failed")
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Domain migration tests", func() {
+	var uOfD *UniverseOfDiscourse
+	var trans *Transaction
+	var domain Concept
+	var child Concept
+	testDomainURI := "http://activeCrl.com/test/MigratedDomain"
+	otherDomainURI := "http://activeCrl.com/test/OtherDomain"
+
+	renameOld := func(serializedConcept SerializedConcept) (bool, error) {
+		if serializedConcept["Label"] == "Old" {
+			serializedConcept["Label"] = "New"
+			return true, nil
+		}
+		return false, nil
+	}
+
+	encode := func() *bytes.Buffer {
+		var buffer bytes.Buffer
+		Expect(uOfD.EncodeDomain(&buffer, domain, trans)).To(Succeed())
+		return &buffer
+	}
+
+	BeforeEach(func() {
+		uOfD = NewUniverseOfDiscourse()
+		trans = uOfD.NewTransaction()
+		uOfD.SetDomainVersion(testDomainURI, "1")
+		uOfD.SetDomainVersion(otherDomainURI, "1")
+		// The serialized domain depends on the migrated domain through a reference
+		migratedDomain, _ := uOfD.NewElement(trans, testDomainURI)
+		migratedConcept, _ := uOfD.NewOwnedElement(migratedDomain, "Migrated", trans)
+		domain, _ = uOfD.NewElement(trans)
+		domain.SetLabel("Domain", trans)
+		child, _ = uOfD.NewOwnedElement(domain, "Old", trans)
+		reference, _ := uOfD.NewOwnedReference(domain, "Reference", trans)
+		reference.SetReferencedConcept(migratedConcept, NoAttribute, trans)
+	})
+
+	AfterEach(func() {
+		trans.ReleaseLocks()
+	})
+
+	Specify("EncodeDomain should write a header with the format and domain versions", func() {
+		var entries []json.RawMessage
+		Expect(json.Unmarshal(encode().Bytes(), &entries)).To(Succeed())
+		Expect(entries).To(HaveLen(4))
+		header, err := parseDomainHeader(entries[0])
+		Expect(err).To(BeNil())
+		Expect(header).ToNot(BeNil())
+		Expect(header.FormatVersion).To(Equal(CurrentDomainFormatVersion))
+		Expect(header.DomainVersions).To(HaveKeyWithValue(testDomainURI, "1"))
+		Expect(header.Dependencies).To(Equal([]string{testDomainURI}))
+	})
+	Specify("RecoverDomain should apply registered domain migrations", func() {
+		serialized, err := uOfD.MarshalDomain(domain, trans)
+		Expect(err).To(BeNil())
+		uOfD2 := NewUniverseOfDiscourse()
+		trans2 := uOfD2.NewTransaction()
+		defer trans2.ReleaseLocks()
+		uOfD2.SetDomainVersion(testDomainURI, "3")
+		Expect(uOfD2.RegisterMigration(Migration{DomainURI: testDomainURI, FromVersion: "1", ToVersion: "2", Description: "Rename Old", Migrate: renameOld})).To(Succeed())
+		Expect(uOfD2.RegisterMigration(Migration{DomainURI: testDomainURI, FromVersion: "2", ToVersion: "3", Description: "No change"})).To(Succeed())
+		_, err = uOfD2.RecoverDomain(serialized, trans2)
+		Expect(err).To(BeNil())
+		Expect(uOfD2.GetElement(child.GetConceptID(trans)).GetLabel(trans2)).To(Equal("New"))
+		Expect(uOfD2.GetElement(domain.GetConceptID(trans)).GetLabel(trans2)).To(Equal("Domain"))
+	})
+	Specify("RecoverDomain should fail when the migrations do not reach the current domain version", func() {
+		serialized, err := uOfD.MarshalDomain(domain, trans)
+		Expect(err).To(BeNil())
+		uOfD2 := NewUniverseOfDiscourse()
+		trans2 := uOfD2.NewTransaction()
+		defer trans2.ReleaseLocks()
+		uOfD2.SetDomainVersion(testDomainURI, "3")
+		Expect(uOfD2.RegisterMigration(Migration{DomainURI: testDomainURI, FromVersion: "1", ToVersion: "2", Description: "Rename Old", Migrate: renameOld})).To(Succeed())
+		_, err = uOfD2.RecoverDomain(serialized, trans2)
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("no migration for domain " + testDomainURI + " from version 2"))
+		Expect(uOfD2.GetElement(domain.GetConceptID(trans))).To(BeNil())
+	})
+	Specify("RecoverDomain should recover the domain unchanged when no migration starts from the recorded version", func() {
+		serialized, err := uOfD.MarshalDomain(domain, trans)
+		Expect(err).To(BeNil())
+		for _, currentVersion := range []string{"2", "0"} {
+			uOfD2 := NewUniverseOfDiscourse()
+			trans2 := uOfD2.NewTransaction()
+			uOfD2.SetDomainVersion(testDomainURI, currentVersion)
+			// The migration to the serialized version from the loaded one shows that the loaded version is older
+			Expect(uOfD2.RegisterMigration(Migration{DomainURI: testDomainURI, FromVersion: "0", ToVersion: "1", Migrate: renameOld})).To(Succeed())
+			_, err = uOfD2.RecoverDomain(serialized, trans2)
+			Expect(err).To(BeNil())
+			Expect(uOfD2.GetElement(child.GetConceptID(trans)).GetLabel(trans2)).To(Equal("Old"))
+			trans2.ReleaseLocks()
+		}
+	})
+	Specify("RecoverDomain should not migrate loaded domains on which the domain does not depend", func() {
+		serialized, err := uOfD.MarshalDomain(domain, trans)
+		Expect(err).To(BeNil())
+		uOfD2 := NewUniverseOfDiscourse()
+		trans2 := uOfD2.NewTransaction()
+		defer trans2.ReleaseLocks()
+		uOfD2.SetDomainVersion(otherDomainURI, "3")
+		Expect(uOfD2.RegisterMigration(Migration{DomainURI: otherDomainURI, FromVersion: "1", ToVersion: "2", Migrate: renameOld})).To(Succeed())
+		report, err := uOfD2.DryRunDomainMigration(bytes.NewReader(serialized))
+		Expect(err).To(BeNil())
+		Expect(report.Migrations).To(BeEmpty())
+		_, err = uOfD2.RecoverDomain(serialized, trans2)
+		Expect(err).To(BeNil())
+		Expect(uOfD2.GetElement(child.GetConceptID(trans)).GetLabel(trans2)).To(Equal("Old"))
+	})
+	Specify("RecoverDomain should apply the migrations of a built-in domain on which the domain depends", func() {
+		builtInDomainURI := "http://activeCrl.com/test/BuiltInDomain"
+		uOfD.SetDomainVersion(builtInDomainURI, "1")
+		builtInDomain, _ := uOfD.NewElement(trans, builtInDomainURI)
+		builtInConcept, _ := uOfD.NewOwnedElement(builtInDomain, "BuiltIn", trans)
+		Expect(builtInDomain.SetIsCoreRecursively(trans)).To(Succeed())
+		refinement, _ := uOfD.NewOwnedRefinement(domain, "Refinement", builtInConcept, child, trans)
+		Expect(refinement).ToNot(BeNil())
+		serialized, err := uOfD.MarshalDomain(domain, trans)
+		Expect(err).To(BeNil())
+		header, err := ReadDomainHeader(bytes.NewReader(serialized))
+		Expect(err).To(BeNil())
+		Expect(header.Dependencies).To(ContainElement(builtInDomainURI))
+		uOfD2 := NewUniverseOfDiscourse()
+		trans2 := uOfD2.NewTransaction()
+		defer trans2.ReleaseLocks()
+		uOfD2.SetDomainVersion(builtInDomainURI, "2")
+		Expect(uOfD2.RegisterMigration(Migration{DomainURI: builtInDomainURI, FromVersion: "1", ToVersion: "2", Description: "Rename Old", Migrate: renameOld})).To(Succeed())
+		_, err = uOfD2.RecoverDomain(serialized, trans2)
+		Expect(err).To(BeNil())
+		Expect(uOfD2.GetElement(child.GetConceptID(trans)).GetLabel(trans2)).To(Equal("New"))
+	})
+	Specify("DryRunDomainMigration should report changes without modifying the uOfD", func() {
+		buffer := encode()
+		uOfD2 := NewUniverseOfDiscourse()
+		uOfD2.SetDomainVersion(testDomainURI, "2")
+		Expect(uOfD2.RegisterMigration(Migration{DomainURI: testDomainURI, FromVersion: "1", ToVersion: "2", Description: "Rename Old", Migrate: renameOld})).To(Succeed())
+		report, err := uOfD2.DryRunDomainMigration(buffer)
+		Expect(err).To(BeNil())
+		Expect(report.FormatVersion).To(Equal(CurrentDomainFormatVersion))
+		Expect(report.DomainVersions).To(HaveKeyWithValue(testDomainURI, "1"))
+		Expect(report.Migrations).To(HaveLen(1))
+		Expect(report.ChangedConcepts).To(HaveLen(1))
+		Expect(report.ChangedConcepts[0].ConceptID).To(Equal(child.GetConceptID(trans)))
+		Expect(report.ChangedConcepts[0].Migrations).To(Equal([]string{"Rename Old"}))
+		Expect(report.ChangedConcepts[0].BeforeState["Label"]).To(Equal("Old"))
+		Expect(report.ChangedConcepts[0].AfterState["Label"]).To(Equal("New"))
+		Expect(uOfD2.GetElement(child.GetConceptID(trans))).To(BeNil())
+	})
+	Specify("Domains serialized without a header should be recovered as the legacy format", func() {
+		var serializedConcepts []string
+		for _, el := range []Concept{domain, child} {
+			serializedConcept, err := el.MarshalJSON()
+			Expect(err).To(BeNil())
+			serializedConcepts = append(serializedConcepts, string(serializedConcept))
+		}
+		legacy := "[" + strings.Join(serializedConcepts, ",") + "]"
+		uOfD2 := NewUniverseOfDiscourse()
+		trans2 := uOfD2.NewTransaction()
+		defer trans2.ReleaseLocks()
+		report, err := uOfD2.DryRunDomainMigration(strings.NewReader(legacy))
+		Expect(err).To(BeNil())
+		Expect(report.FormatVersion).To(Equal(legacyDomainFormatVersion))
+		Expect(report.Migrations).To(HaveLen(1))
+		Expect(report.ChangedConcepts).To(BeEmpty())
+		recoveredDomain, err := uOfD2.RecoverDomain([]byte(legacy), trans2)
+		Expect(err).To(BeNil())
+		Expect(recoveredDomain.GetConceptID(trans2)).To(Equal(domain.GetConceptID(trans)))
+	})
+	Specify("RegisterMigration should reject a second migration from the same version", func() {
+		Expect(uOfD.RegisterMigration(Migration{DomainURI: testDomainURI, FromVersion: "1", ToVersion: "2"})).To(Succeed())
+		Expect(uOfD.RegisterMigration(Migration{DomainURI: testDomainURI, FromVersion: "1", ToVersion: "3"})).ToNot(Succeed())
+		Expect(uOfD.RegisterMigration(Migration{DomainURI: testDomainURI, FromVersion: "4", ToVersion: "4"})).ToNot(Succeed())
+	})
+})
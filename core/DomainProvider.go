@@ -0,0 +1,139 @@
+package core
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DomainBuildFunction is a function that adds the concepts of a domain to the uOfD
+type DomainBuildFunction func(uOfD *UniverseOfDiscourse, trans *Transaction) error
+
+// DomainProvider supplies a domain to a UofDManager. Each provider declares the URI and version of its domain along
+// with the URIs of the domains on which it depends. The UofDManager builds the providers' domains in dependency order
+// during its initialization.
+type DomainProvider interface {
+	GetDomainURI() string
+	GetDomainVersion() string
+	GetDependencies() []string
+	BuildDomain(uOfD *UniverseOfDiscourse, trans *Transaction) error
+}
+
+// domainProvider is a DomainProvider that delegates the construction of its domain to a DomainBuildFunction
+type domainProvider struct {
+	uri           string
+	version       string
+	dependencies  []string
+	buildFunction DomainBuildFunction
+}
+
+// NewDomainProvider returns a DomainProvider for the domain with the given URI and version that depends on the
+// domains with the given URIs. The build function is called to construct the domain.
+func NewDomainProvider(uri string, version string, dependencies []string, buildFunction DomainBuildFunction) DomainProvider {
+	var provider domainProvider
+	provider.uri = uri
+	provider.version = version
+	provider.dependencies = append([]string{}, dependencies...)
+	provider.buildFunction = buildFunction
+	return &provider
+}
+
+// GetDomainURI returns the URI of the domain
+func (dpPtr *domainProvider) GetDomainURI() string {
+	return dpPtr.uri
+}
+
+// GetDomainVersion returns the version of the domain
+func (dpPtr *domainProvider) GetDomainVersion() string {
+	return dpPtr.version
+}
+
+// GetDependencies returns the URIs of the domains on which the domain depends
+func (dpPtr *domainProvider) GetDependencies() []string {
+	return append([]string{}, dpPtr.dependencies...)
+}
+
+// BuildDomain constructs the domain in the uOfD
+func (dpPtr *domainProvider) BuildDomain(uOfD *UniverseOfDiscourse, trans *Transaction) error {
+	if dpPtr.buildFunction == nil {
+		return nil
+	}
+	err := dpPtr.buildFunction(uOfD, trans)
+	if err != nil {
+		return errors.Wrap(err, "domainProvider.BuildDomain failed for "+dpPtr.uri)
+	}
+	return nil
+}
+
+// LoadedDomain identifies a domain that has been built by a UofDManager
+type LoadedDomain struct {
+	URI     string
+	Version string
+}
+
+// orderDomainProviders returns the providers ordered so that each provider follows all of the providers on which it
+// depends. Providers without a dependency relationship retain their registration order. An error is returned if a
+// provider depends on a domain that has no provider or if the dependencies are cyclic.
+func orderDomainProviders(providers []DomainProvider) ([]DomainProvider, error) {
+	providerMap := make(map[string]DomainProvider)
+	for _, provider := range providers {
+		providerMap[provider.GetDomainURI()] = provider
+	}
+	var missing []string
+	for _, provider := range providers {
+		for _, dependency := range provider.GetDependencies() {
+			if providerMap[dependency] == nil {
+				missing = append(missing, provider.GetDomainURI()+" requires "+dependency)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, errors.New("orderDomainProviders found missing dependencies: " + strings.Join(missing, ", "))
+	}
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var ordered []DomainProvider
+	var path []string
+	var visit func(provider DomainProvider) error
+	visit = func(provider DomainProvider) error {
+		uri := provider.GetDomainURI()
+		switch state[uri] {
+		case visited:
+			return nil
+		case visiting:
+			cycleStart := 0
+			for i, pathURI := range path {
+				if pathURI == uri {
+					cycleStart = i
+				}
+			}
+			cycle := append(append([]string{}, path[cycleStart:]...), uri)
+			return errors.New("orderDomainProviders found cyclic dependencies: " + strings.Join(cycle, " -> "))
+		}
+		state[uri] = visiting
+		path = append(path, uri)
+		for _, dependency := range provider.GetDependencies() {
+			err := visit(providerMap[dependency])
+			if err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[uri] = visited
+		ordered = append(ordered, provider)
+		return nil
+	}
+	for _, provider := range providers {
+		err := visit(provider)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
@@ -5,6 +5,11 @@
 package core
 
 import (
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+
 	"github.com/pkg/errors"
 )
 
@@ -34,6 +39,174 @@ func newFunctionCallRecord(functionID string, function crlExecutionFunction, tar
 // The functions type maps core Element identifiers to the array of crlExecutionFunctions associated with the identfier.
 type functions map[string][]crlExecutionFunction
 
+// FunctionRegistration describes a function bound to a URI. When several functions are bound to the same URI they
+// are executed in order of increasing Priority, with functions of equal priority executed in the order in which they
+// were registered. Disabled functions are not executed.
+type FunctionRegistration struct {
+	URI      string
+	Name     string
+	Priority int
+	Enabled  bool
+	function crlExecutionFunction
+}
+
+// functionName returns the name of the go function implementing the crlExecutionFunction
+func functionName(function crlExecutionFunction) string {
+	runtimeFunction := runtime.FuncForPC(reflect.ValueOf(function).Pointer())
+	if runtimeFunction == nil {
+		return ""
+	}
+	return runtimeFunction.Name()
+}
+
+// AddFunction registers a function with the indicated uri. The function is named after the go function implementing
+// it and has priority zero.
+func (uOfDPtr *UniverseOfDiscourse) AddFunction(uri string, function crlExecutionFunction) {
+	name := functionName(function)
+	uOfDPtr.functionsMutex.Lock()
+	defer uOfDPtr.functionsMutex.Unlock()
+	// The same go function may legitimately be registered more than once for a URI
+	baseName := name
+	for i := 2; uOfDPtr.findRegistration(uri, name) != nil; i++ {
+		name = baseName + "#" + strconv.Itoa(i)
+	}
+	uOfDPtr.addRegistration(&FunctionRegistration{URI: uri, Name: name, Enabled: true, function: function})
+}
+
+// AddNamedFunction registers a function with the indicated uri, name, and priority. The name must be unique among
+// the functions registered with the uri.
+func (uOfDPtr *UniverseOfDiscourse) AddNamedFunction(uri string, name string, priority int, function crlExecutionFunction) error {
+	uOfDPtr.functionsMutex.Lock()
+	defer uOfDPtr.functionsMutex.Unlock()
+	if uOfDPtr.findRegistration(uri, name) != nil {
+		return errors.New("UniverseOfDiscourse.AddNamedFunction failed: a function named " + name + " is already registered for " + uri)
+	}
+	uOfDPtr.addRegistration(&FunctionRegistration{URI: uri, Name: name, Priority: priority, Enabled: true, function: function})
+	return nil
+}
+
+// addRegistration adds the registration. The caller is expected to hold the functionsMutex.
+func (uOfDPtr *UniverseOfDiscourse) addRegistration(registration *FunctionRegistration) {
+	uOfDPtr.functionRegistrations[registration.URI] = append(uOfDPtr.functionRegistrations[registration.URI], registration)
+	uOfDPtr.updateComputeFunctions(registration.URI)
+}
+
+// findRegistration returns the registration with the given uri and name, if any. The caller is expected to hold the
+// functionsMutex.
+func (uOfDPtr *UniverseOfDiscourse) findRegistration(uri string, name string) *FunctionRegistration {
+	for _, registration := range uOfDPtr.functionRegistrations[uri] {
+		if registration.Name == name {
+			return registration
+		}
+	}
+	return nil
+}
+
+// GetFunctionRegistrations returns the functions registered with the uri in execution order
+func (uOfDPtr *UniverseOfDiscourse) GetFunctionRegistrations(uri string) []FunctionRegistration {
+	uOfDPtr.functionsMutex.RLock()
+	defer uOfDPtr.functionsMutex.RUnlock()
+	var registrations []FunctionRegistration
+	for _, registration := range uOfDPtr.functionRegistrations[uri] {
+		registrations = append(registrations, *registration)
+	}
+	return registrations
+}
+
+// GetFunctionsForConcept returns the enabled functions that will be executed when the concept changes: those
+// registered with the URIs of the concept and its abstractions
+func (uOfDPtr *UniverseOfDiscourse) GetFunctionsForConcept(el Concept, trans *Transaction) []FunctionRegistration {
+	var registrations []FunctionRegistration
+	for _, uri := range uOfDPtr.findFunctions(el, nil, trans) {
+		for _, registration := range uOfDPtr.GetFunctionRegistrations(uri) {
+			if registration.Enabled {
+				registrations = append(registrations, registration)
+			}
+		}
+	}
+	return registrations
+}
+
+// ListFunctions returns all of the registered functions ordered by URI and, within each URI, in execution order
+func (uOfDPtr *UniverseOfDiscourse) ListFunctions() []FunctionRegistration {
+	uOfDPtr.functionsMutex.RLock()
+	var uris []string
+	for uri := range uOfDPtr.functionRegistrations {
+		uris = append(uris, uri)
+	}
+	uOfDPtr.functionsMutex.RUnlock()
+	sort.Strings(uris)
+	var registrations []FunctionRegistration
+	for _, uri := range uris {
+		registrations = append(registrations, uOfDPtr.GetFunctionRegistrations(uri)...)
+	}
+	return registrations
+}
+
+// RemoveFunction removes the named function registered with the uri
+func (uOfDPtr *UniverseOfDiscourse) RemoveFunction(uri string, name string) error {
+	uOfDPtr.functionsMutex.Lock()
+	defer uOfDPtr.functionsMutex.Unlock()
+	registrations := uOfDPtr.functionRegistrations[uri]
+	for i, registration := range registrations {
+		if registration.Name == name {
+			uOfDPtr.functionRegistrations[uri] = append(registrations[:i:i], registrations[i+1:]...)
+			if len(uOfDPtr.functionRegistrations[uri]) == 0 {
+				delete(uOfDPtr.functionRegistrations, uri)
+			}
+			uOfDPtr.updateComputeFunctions(uri)
+			return nil
+		}
+	}
+	return errors.New("UniverseOfDiscourse.RemoveFunction failed: no function named " + name + " is registered for " + uri)
+}
+
+// SetFunctionEnabled enables or disables the named function registered with the uri
+func (uOfDPtr *UniverseOfDiscourse) SetFunctionEnabled(uri string, name string, enabled bool) error {
+	uOfDPtr.functionsMutex.Lock()
+	defer uOfDPtr.functionsMutex.Unlock()
+	registration := uOfDPtr.findRegistration(uri, name)
+	if registration == nil {
+		return errors.New("UniverseOfDiscourse.SetFunctionEnabled failed: no function named " + name + " is registered for " + uri)
+	}
+	registration.Enabled = enabled
+	uOfDPtr.updateComputeFunctions(uri)
+	return nil
+}
+
+// SetFunctionPriority sets the priority of the named function registered with the uri
+func (uOfDPtr *UniverseOfDiscourse) SetFunctionPriority(uri string, name string, priority int) error {
+	uOfDPtr.functionsMutex.Lock()
+	defer uOfDPtr.functionsMutex.Unlock()
+	registration := uOfDPtr.findRegistration(uri, name)
+	if registration == nil {
+		return errors.New("UniverseOfDiscourse.SetFunctionPriority failed: no function named " + name + " is registered for " + uri)
+	}
+	registration.Priority = priority
+	uOfDPtr.updateComputeFunctions(uri)
+	return nil
+}
+
+// updateComputeFunctions orders the registrations for the uri by priority and rebuilds the array of enabled
+// functions executed for the uri. The caller is expected to hold the functionsMutex.
+func (uOfDPtr *UniverseOfDiscourse) updateComputeFunctions(uri string) {
+	registrations := uOfDPtr.functionRegistrations[uri]
+	sort.SliceStable(registrations, func(i, j int) bool {
+		return registrations[i].Priority < registrations[j].Priority
+	})
+	var enabledFunctions []crlExecutionFunction
+	for _, registration := range registrations {
+		if registration.Enabled {
+			enabledFunctions = append(enabledFunctions, registration.function)
+		}
+	}
+	if len(enabledFunctions) == 0 {
+		delete(uOfDPtr.computeFunctions, uri)
+		return
+	}
+	uOfDPtr.computeFunctions[uri] = enabledFunctions
+}
+
 // isDiagramRelatedFunction returns true if the functionID matches one of the diagram related functions
 func isDiagramRelatedFunction(functionID string) bool {
 	if functionID == "http://activeCrl.com/corediagram/CoreDiagram/CrlDiagram" ||
@@ -0,0 +1,194 @@
+// Copyright 2017, 2018 Paul C. Brown. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"hash/fnv"
+	"log"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// functionCallPool executes crlExecutionFunctions asynchronously using a fixed number of workers. Each call runs in
+// its own transaction. Calls are assigned to workers by target, so calls for the same target are executed one at a
+// time in the order in which they were submitted.
+type functionCallPool struct {
+	sync.Mutex
+	// changed is signalled whenever calls are queued or completed, or the pool is stopped
+	changed  *sync.Cond
+	uOfD     *UniverseOfDiscourse
+	capacity int
+	// pending is the number of calls that are queued or running
+	pending  int
+	queues   [][]*functionCallRecord
+	stopping bool
+	workers  sync.WaitGroup
+}
+
+func newFunctionCallPool(uOfD *UniverseOfDiscourse, workerCount int, capacity int) *functionCallPool {
+	var pool functionCallPool
+	pool.changed = sync.NewCond(&pool)
+	pool.uOfD = uOfD
+	pool.capacity = capacity
+	pool.queues = make([][]*functionCallRecord, workerCount)
+	for i := 0; i < workerCount; i++ {
+		pool.workers.Add(1)
+		go pool.work(i)
+	}
+	return &pool
+}
+
+// workerIndex returns the index of the worker responsible for the target
+func (pool *functionCallPool) workerIndex(targetID string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(targetID))
+	return int(hash.Sum32() % uint32(len(pool.queues)))
+}
+
+// submit queues the calls for execution. Unless the calls are made from a worker, submit blocks while the number of
+// pending calls is at or above the pool's capacity. Calls made from workers are never blocked since the
+// workers are the ones that reduce the number of pending calls. Once the pool is stopping there are no workers to
+// execute queued calls, so the calls are executed by the caller instead.
+func (pool *functionCallPool) submit(calls []*functionCallRecord, fromWorker bool) {
+	pool.Lock()
+	for i, call := range calls {
+		for !fromWorker && !pool.stopping && pool.pending >= pool.capacity {
+			pool.changed.Wait()
+		}
+		if pool.stopping {
+			pool.Unlock()
+			for _, remainingCall := range calls[i:] {
+				pool.execute(remainingCall)
+			}
+			return
+		}
+		index := pool.workerIndex(call.target.getConceptIDNoLock())
+		pool.queues[index] = append(pool.queues[index], call)
+		pool.pending++
+		pool.changed.Broadcast()
+	}
+	pool.Unlock()
+}
+
+// waitForQuiescence blocks until there are no queued or running calls
+func (pool *functionCallPool) waitForQuiescence() {
+	pool.Lock()
+	defer pool.Unlock()
+	for pool.pending > 0 {
+		pool.changed.Wait()
+	}
+}
+
+// stop waits for all pending calls to complete and then stops the workers
+func (pool *functionCallPool) stop() {
+	pool.waitForQuiescence()
+	pool.Lock()
+	pool.stopping = true
+	pool.changed.Broadcast()
+	pool.Unlock()
+	pool.workers.Wait()
+}
+
+// work executes the calls in the worker's queue until the pool is stopped
+func (pool *functionCallPool) work(index int) {
+	defer pool.workers.Done()
+	for {
+		pool.Lock()
+		for len(pool.queues[index]) == 0 && !pool.stopping {
+			pool.changed.Wait()
+		}
+		if len(pool.queues[index]) == 0 {
+			pool.Unlock()
+			return
+		}
+		call := pool.queues[index][0]
+		pool.queues[index] = pool.queues[index][1:]
+		pool.Unlock()
+		pool.execute(call)
+		pool.Lock()
+		pool.pending--
+		pool.changed.Broadcast()
+		pool.Unlock()
+	}
+}
+
+// execute runs the call in its own transaction, committing the transaction if the function succeeds and rolling it
+// back if the function fails or panics. Calls to the same function on the same target triggered by the call's own
+// changes are suppressed, as they are when functions are executed synchronously.
+func (pool *functionCallPool) execute(call *functionCallRecord) {
+	trans := pool.uOfD.NewTransaction()
+	trans.executingAsync = true
+	trans.inProgressCalls[call.functionID+call.target.getConceptIDNoLock()] = true
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Asynchronous execution of function %s on %s panicked: %v", call.functionID, call.target.getConceptIDNoLock(), r)
+			trans.Rollback()
+		}
+	}()
+	if call.target.GetUniverseOfDiscourse(trans) == nil {
+		// The target was deleted after the call was queued
+		trans.Commit()
+		return
+	}
+	err := call.function(call.target, call.notification, trans)
+	if err != nil {
+		log.Printf("Asynchronous execution of function %s on %s failed: %s", call.functionID, call.target.getConceptIDNoLock(), err.Error())
+		trans.Rollback()
+		return
+	}
+	err = trans.Commit()
+	if err != nil {
+		log.Printf("Asynchronous execution of function %s on %s was rolled back: %s", call.functionID, call.target.getConceptIDNoLock(), err.Error())
+	}
+}
+
+// StartAsyncFunctionExecution switches the uOfD to asynchronous function execution. Rather than being called
+// synchronously within the transaction making a change, the functions triggered by the change are queued when the
+// transaction releases its locks and are executed by a pool of workerCount workers, each call in its own
+// transaction. Calls for the same target are executed in order, one at a time. Once queueCapacity calls are pending,
+// transactions releasing their locks block until there is room in the queue.
+func (uOfDPtr *UniverseOfDiscourse) StartAsyncFunctionExecution(workerCount int, queueCapacity int) error {
+	if workerCount < 1 || queueCapacity < 1 {
+		return errors.New("UniverseOfDiscourse.StartAsyncFunctionExecution requires at least one worker and a queue capacity of at least one")
+	}
+	uOfDPtr.functionPoolMutex.Lock()
+	defer uOfDPtr.functionPoolMutex.Unlock()
+	if uOfDPtr.functionPool != nil {
+		return errors.New("UniverseOfDiscourse.StartAsyncFunctionExecution called when asynchronous execution is already started")
+	}
+	uOfDPtr.functionPool = newFunctionCallPool(uOfDPtr, workerCount, queueCapacity)
+	return nil
+}
+
+// StopAsyncFunctionExecution waits for all pending function calls to complete, stops the workers, and returns the
+// uOfD to synchronous function execution
+func (uOfDPtr *UniverseOfDiscourse) StopAsyncFunctionExecution() {
+	pool := uOfDPtr.getFunctionCallPool()
+	if pool == nil {
+		return
+	}
+	pool.stop()
+	uOfDPtr.functionPoolMutex.Lock()
+	uOfDPtr.functionPool = nil
+	uOfDPtr.functionPoolMutex.Unlock()
+}
+
+// WaitForQuiescence blocks until all queued function calls, including those queued by the calls themselves, have
+// completed. It returns immediately if functions are being executed synchronously.
+func (uOfDPtr *UniverseOfDiscourse) WaitForQuiescence() {
+	pool := uOfDPtr.getFunctionCallPool()
+	if pool != nil {
+		pool.waitForQuiescence()
+	}
+}
+
+// getFunctionCallPool returns the pool executing functions asynchronously, or nil if functions are executed
+// synchronously
+func (uOfDPtr *UniverseOfDiscourse) getFunctionCallPool() *functionCallPool {
+	uOfDPtr.functionPoolMutex.RLock()
+	defer uOfDPtr.functionPoolMutex.RUnlock()
+	return uOfDPtr.functionPool
+}
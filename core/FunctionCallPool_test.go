@@ -0,0 +1,168 @@
+package core
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FunctionCallPool tests", func() {
+	var uOfD *UniverseOfDiscourse
+	var trans *Transaction
+	var target Concept
+	var mutex sync.Mutex
+	var definitions []string
+	var transactions []*Transaction
+	var release chan bool
+	var panicking bool
+	functionURI := "http://activeCrl.com/test/AsyncFunction"
+
+	asyncFunction := func(el Concept, notification *ChangeNotification, functionTrans *Transaction) error {
+		if release != nil {
+			<-release
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		if notification.GetAfterConceptState() != nil {
+			definitions = append(definitions, notification.GetAfterConceptState().Definition)
+		}
+		transactions = append(transactions, functionTrans)
+		err := el.SetLabel("Updated by function", functionTrans)
+		if panicking {
+			panic("test panic")
+		}
+		return err
+	}
+
+	BeforeEach(func() {
+		definitions = nil
+		transactions = nil
+		release = nil
+		panicking = false
+		uOfD = NewUniverseOfDiscourse()
+		trans = uOfD.NewTransaction()
+		uOfD.AddFunction(functionURI, asyncFunction)
+		target, _ = uOfD.NewElement(trans)
+		target.SetURI(functionURI, trans)
+		trans.Commit()
+		mutex.Lock()
+		definitions = nil
+		transactions = nil
+		mutex.Unlock()
+	})
+
+	AfterEach(func() {
+		trans.ReleaseLocks()
+		uOfD.StopAsyncFunctionExecution()
+	})
+
+	Specify("Start should validate its arguments and not start twice", func() {
+		Expect(uOfD.StartAsyncFunctionExecution(0, 1)).ToNot(Succeed())
+		Expect(uOfD.StartAsyncFunctionExecution(1, 0)).ToNot(Succeed())
+		Expect(uOfD.StartAsyncFunctionExecution(2, 10)).To(Succeed())
+		Expect(uOfD.StartAsyncFunctionExecution(2, 10)).ToNot(Succeed())
+	})
+
+	Specify("Functions should run in their own transaction after the triggering transaction releases its locks", func() {
+		Expect(uOfD.StartAsyncFunctionExecution(2, 10)).To(Succeed())
+		target.SetDefinition("Changed", trans)
+		time.Sleep(10 * time.Millisecond)
+		mutex.Lock()
+		Expect(transactions).To(BeEmpty())
+		mutex.Unlock()
+		trans.Commit()
+		uOfD.WaitForQuiescence()
+		mutex.Lock()
+		defer mutex.Unlock()
+		Expect(definitions).To(Equal([]string{"Changed"}))
+		Expect(transactions).To(HaveLen(1))
+		Expect(transactions[0]).ToNot(Equal(trans))
+		Expect(target.GetLabel(trans)).To(Equal("Updated by function"))
+	})
+
+	Specify("Calls for the same target should execute in order", func() {
+		Expect(uOfD.StartAsyncFunctionExecution(4, 100)).To(Succeed())
+		var expected []string
+		for i := 0; i < 20; i++ {
+			definition := strconv.Itoa(i)
+			expected = append(expected, definition)
+			target.SetDefinition(definition, trans)
+			trans.Commit()
+		}
+		uOfD.WaitForQuiescence()
+		mutex.Lock()
+		defer mutex.Unlock()
+		Expect(definitions).To(Equal(expected))
+	})
+
+	Specify("A full queue should block the transaction releasing its locks", func() {
+		release = make(chan bool)
+		Expect(uOfD.StartAsyncFunctionExecution(1, 1)).To(Succeed())
+		target.SetDefinition("First", trans)
+		trans.Commit()
+		done := make(chan bool)
+		go func() {
+			otherTrans := uOfD.NewTransaction()
+			target.SetDefinition("Second", otherTrans)
+			otherTrans.Commit()
+			done <- true
+		}()
+		Consistently(done, 20*time.Millisecond).ShouldNot(Receive())
+		release <- true
+		Eventually(done).Should(Receive())
+		release <- true
+		uOfD.WaitForQuiescence()
+		mutex.Lock()
+		defer mutex.Unlock()
+		Expect(definitions).To(Equal([]string{"First", "Second"}))
+	})
+
+	Specify("A panicking function should have its transaction rolled back without stopping the pool", func() {
+		Expect(uOfD.StartAsyncFunctionExecution(1, 10)).To(Succeed())
+		panicking = true
+		target.SetLabel("Before", trans)
+		trans.Commit()
+		done := make(chan bool)
+		go func() {
+			uOfD.WaitForQuiescence()
+			done <- true
+		}()
+		Eventually(done).Should(Receive())
+		Expect(target.GetLabel(trans)).To(Equal("Before"))
+		trans.ReleaseLocks()
+		panicking = false
+		target.SetDefinition("After", trans)
+		trans.Commit()
+		uOfD.WaitForQuiescence()
+		Expect(target.GetLabel(trans)).To(Equal("Updated by function"))
+	})
+
+	Specify("Calls submitted once the pool is stopping should be executed by the submitter", func() {
+		Expect(uOfD.StartAsyncFunctionExecution(2, 10)).To(Succeed())
+		pool := uOfD.getFunctionCallPool()
+		target.SetDefinition("Late", trans)
+		calls := trans.pendingFunctionCalls
+		trans.pendingFunctionCalls = nil
+		trans.Commit()
+		uOfD.StopAsyncFunctionExecution()
+		pool.submit(calls, false)
+		pool.waitForQuiescence()
+		mutex.Lock()
+		defer mutex.Unlock()
+		Expect(definitions).To(Equal([]string{"Late"}))
+		Expect(transactions[0]).ToNot(Equal(trans))
+	})
+
+	Specify("Stopping should return to synchronous execution", func() {
+		Expect(uOfD.StartAsyncFunctionExecution(2, 10)).To(Succeed())
+		uOfD.StopAsyncFunctionExecution()
+		target.SetDefinition("Synchronous", trans)
+		mutex.Lock()
+		defer mutex.Unlock()
+		Expect(definitions).To(Equal([]string{"Synchronous"}))
+		Expect(transactions[0]).To(Equal(trans))
+	})
+})
@@ -0,0 +1,93 @@
+package core
+
+import (
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Function registry tests", func() {
+	var uOfD *UniverseOfDiscourse
+	var trans *Transaction
+	var target Concept
+	var calls []string
+	functionURI := "http://activeCrl.com/test/RegistryFunction"
+
+	recordingFunction := func(name string) crlExecutionFunction {
+		return func(el Concept, notification *ChangeNotification, trans *Transaction) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+
+	BeforeEach(func() {
+		uOfD = NewUniverseOfDiscourse()
+		trans = uOfD.NewTransaction()
+		target, _ = uOfD.NewElement(trans)
+		target.SetURI(functionURI, trans)
+		calls = nil
+	})
+
+	AfterEach(func() {
+		trans.ReleaseLocks()
+	})
+
+	Specify("AddFunction should register a named, enabled function", func() {
+		uOfD.AddFunction(functionURI, dummyChangeFunction)
+		uOfD.AddFunction(functionURI, dummyChangeFunction)
+		registrations := uOfD.GetFunctionRegistrations(functionURI)
+		Expect(registrations).To(HaveLen(2))
+		Expect(registrations[0].Name).To(ContainSubstring("dummyChangeFunction"))
+		Expect(registrations[1].Name).To(Equal(registrations[0].Name + "#2"))
+		Expect(registrations[0].Enabled).To(BeTrue())
+		Expect(registrations[0].URI).To(Equal(functionURI))
+	})
+
+	Specify("Functions should execute in priority order", func() {
+		Expect(uOfD.AddNamedFunction(functionURI, "Late", 10, recordingFunction("Late"))).To(Succeed())
+		Expect(uOfD.AddNamedFunction(functionURI, "Early", -10, recordingFunction("Early"))).To(Succeed())
+		Expect(uOfD.AddNamedFunction(functionURI, "Default", 0, recordingFunction("Default"))).To(Succeed())
+		Expect(uOfD.AddNamedFunction(functionURI, "Default", 0, recordingFunction("Default"))).ToNot(Succeed())
+		target.SetDefinition("Changed", trans)
+		Expect(calls).To(Equal([]string{"Early", "Default", "Late"}))
+		Expect(uOfD.SetFunctionPriority(functionURI, "Late", -20)).To(Succeed())
+		calls = nil
+		target.SetDefinition("Changed again", trans)
+		Expect(calls).To(Equal([]string{"Late", "Early", "Default"}))
+	})
+
+	Specify("Disabled and removed functions should not execute", func() {
+		uOfD.AddNamedFunction(functionURI, "First", 0, recordingFunction("First"))
+		uOfD.AddNamedFunction(functionURI, "Second", 0, recordingFunction("Second"))
+		Expect(uOfD.SetFunctionEnabled(functionURI, "First", false)).To(Succeed())
+		target.SetDefinition("Changed", trans)
+		Expect(calls).To(Equal([]string{"Second"}))
+		Expect(uOfD.SetFunctionEnabled(functionURI, "First", true)).To(Succeed())
+		Expect(uOfD.RemoveFunction(functionURI, "Second")).To(Succeed())
+		Expect(uOfD.RemoveFunction(functionURI, "Second")).ToNot(Succeed())
+		Expect(uOfD.SetFunctionEnabled(functionURI, "Second", true)).ToNot(Succeed())
+		calls = nil
+		target.SetDefinition("Changed again", trans)
+		Expect(calls).To(Equal([]string{"First"}))
+		Expect(uOfD.RemoveFunction(functionURI, "First")).To(Succeed())
+		Expect(uOfD.GetFunctionRegistrations(functionURI)).To(BeEmpty())
+		Expect(uOfD.getFunctions(functionURI)).To(BeEmpty())
+	})
+
+	Specify("ListFunctions and GetFunctionsForConcept should report the registered functions", func() {
+		uOfD.AddNamedFunction(functionURI, "Enabled", 0, recordingFunction("Enabled"))
+		uOfD.AddNamedFunction(functionURI, "Disabled", 0, recordingFunction("Disabled"))
+		uOfD.SetFunctionEnabled(functionURI, "Disabled", false)
+		found := false
+		for _, registration := range uOfD.ListFunctions() {
+			if registration.URI == functionURI && registration.Name == "Disabled" {
+				found = true
+				Expect(registration.Enabled).To(BeFalse())
+			}
+		}
+		Expect(found).To(BeTrue())
+		refinedConcept, _ := uOfD.CreateReplicateAsRefinement(target, trans)
+		forConcept := uOfD.GetFunctionsForConcept(refinedConcept, trans)
+		Expect(forConcept).To(HaveLen(1))
+		Expect(forConcept[0].Name).To(Equal("Enabled"))
+	})
+})
@@ -0,0 +1,194 @@
+package core
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// GraphMLNamespace is the XML namespace of GraphML documents
+const GraphMLNamespace = "http://graphml.graphdrawing.org/xmlns"
+
+// The GraphML edge types
+const (
+	GraphMLOwnerEdge       = "owner"
+	GraphMLReferenceEdge   = "reference"
+	GraphMLAbstractionEdge = "abstraction"
+	GraphMLRefinedEdge     = "refined"
+)
+
+// The graphML...XML types give the structure of the GraphML document
+
+type graphMLDocumentXML struct {
+	XMLName xml.Name         `xml:"graphml"`
+	Xmlns   string           `xml:"xmlns,attr"`
+	Keys    []*graphMLKeyXML `xml:"key"`
+	Graph   *graphMLGraphXML `xml:"graph"`
+}
+
+type graphMLKeyXML struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraphXML struct {
+	ID          string            `xml:"id,attr"`
+	EdgeDefault string            `xml:"edgedefault,attr"`
+	Nodes       []*graphMLNodeXML `xml:"node"`
+	Edges       []*graphMLEdgeXML `xml:"edge"`
+}
+
+type graphMLNodeXML struct {
+	ID   string            `xml:"id,attr"`
+	Data []*graphMLDataXML `xml:"data"`
+}
+
+type graphMLEdgeXML struct {
+	ID     string            `xml:"id,attr"`
+	Source string            `xml:"source,attr"`
+	Target string            `xml:"target,attr"`
+	Data   []*graphMLDataXML `xml:"data"`
+}
+
+type graphMLDataXML struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// graphMLKeys are the data keys declared by every GraphML document
+var graphMLKeys = []*graphMLKeyXML{
+	{ID: "conceptID", For: "node", AttrName: "conceptID", AttrType: "string"},
+	{ID: "label", For: "node", AttrName: "label", AttrType: "string"},
+	{ID: "uri", For: "node", AttrName: "uri", AttrType: "string"},
+	{ID: "type", For: "node", AttrName: "type", AttrType: "string"},
+	{ID: "literalValue", For: "node", AttrName: "literalValue", AttrType: "string"},
+	{ID: "edgeType", For: "edge", AttrName: "type", AttrType: "string"},
+	{ID: "referencedAttributeName", For: "edge", AttrName: "referencedAttributeName", AttrType: "string"}}
+
+// GraphMLGraph is a GraphML representation of a specified set of CRL data structures, for use in graph tools such as
+// yEd and Gephi. The concepts are selected as for a CrlGraph. Each element, literal, reference, and refinement is a
+// node carrying its ConceptID, label, URI, type, and literal value. Edges are typed as owner, from owner to owned
+// concept; reference, from reference to referenced concept and carrying the ReferencedAttributeName; abstraction,
+// from refinement to abstract concept; and refined, from refinement to refined concept.
+type GraphMLGraph struct {
+	graph   *graphMLGraphXML
+	options CrlGraphOptions
+	nodeIDs map[string]bool
+}
+
+// NewGraphMLGraph returns an initialized GraphMLGraph using the given options
+func NewGraphMLGraph(graphName string, options *CrlGraphOptions) *GraphMLGraph {
+	return &GraphMLGraph{
+		graph:   &graphMLGraphXML{ID: graphName, EdgeDefault: "directed"},
+		options: *options,
+		nodeIDs: make(map[string]bool)}
+}
+
+// AddConceptRecursively adds the given concept and its child descendants to the graph in the same way as
+// CrlGraph.AddConceptRecursively. Existing concepts will not be duplicated.
+func (graphPtr *GraphMLGraph) AddConceptRecursively(concept Concept, trans *Transaction) error {
+	traversal := &conceptGraphTraversal{builder: graphPtr, options: &graphPtr.options, trans: trans}
+	err := traversal.addSubtree(concept)
+	if err != nil {
+		return errors.Wrap(err, "GraphMLGraph.AddConceptRecursively failed")
+	}
+	return nil
+}
+
+// AddUniverseOfDiscourse adds each of the root concepts of the uOfD, and their descendants, to the graph
+func (graphPtr *GraphMLGraph) AddUniverseOfDiscourse(uOfD *UniverseOfDiscourse, trans *Transaction) error {
+	for _, root := range sortedConcepts(uOfD.GetRootElements(trans), trans) {
+		err := graphPtr.AddConceptRecursively(root, trans)
+		if err != nil {
+			return errors.Wrap(err, "GraphMLGraph.AddUniverseOfDiscourse failed")
+		}
+	}
+	return nil
+}
+
+// WriteGraphML writes the GraphML document for the graph to the writer
+func (graphPtr *GraphMLGraph) WriteGraphML(writer io.Writer) error {
+	document := &graphMLDocumentXML{Xmlns: GraphMLNamespace, Keys: graphMLKeys, Graph: graphPtr.graph}
+	_, err := io.WriteString(writer, xml.Header)
+	if err != nil {
+		return errors.Wrap(err, "GraphMLGraph.WriteGraphML failed")
+	}
+	encoder := xml.NewEncoder(writer)
+	encoder.Indent("", "  ")
+	err = encoder.Encode(document)
+	if err != nil {
+		return errors.Wrap(err, "GraphMLGraph.WriteGraphML failed")
+	}
+	_, err = io.WriteString(writer, "\n")
+	if err != nil {
+		return errors.Wrap(err, "GraphMLGraph.WriteGraphML failed")
+	}
+	return nil
+}
+
+func (graphPtr *GraphMLGraph) hasConceptNode(concept Concept, trans *Transaction) bool {
+	return graphPtr.nodeIDs[concept.GetConceptID(trans)]
+}
+
+func (graphPtr *GraphMLGraph) addConceptNode(concept Concept, trans *Transaction) error {
+	id := concept.GetConceptID(trans)
+	node := &graphMLNodeXML{ID: id}
+	node.Data = append(node.Data,
+		&graphMLDataXML{Key: "conceptID", Value: id},
+		&graphMLDataXML{Key: "label", Value: concept.GetLabel(trans)})
+	if uri := concept.GetURI(trans); uri != "" {
+		node.Data = append(node.Data, &graphMLDataXML{Key: "uri", Value: uri})
+	}
+	node.Data = append(node.Data, &graphMLDataXML{Key: "type", Value: ConceptTypeToString(concept.GetConceptType())})
+	if concept.GetConceptType() == Literal {
+		node.Data = append(node.Data, &graphMLDataXML{Key: "literalValue", Value: concept.GetLiteralValue(trans)})
+	}
+	graphPtr.graph.Nodes = append(graphPtr.graph.Nodes, node)
+	graphPtr.nodeIDs[id] = true
+	return nil
+}
+
+// addEdge adds an edge of the given type between the nodes of two concepts
+func (graphPtr *GraphMLGraph) addEdge(edgeType string, source Concept, target Concept, trans *Transaction) *graphMLEdgeXML {
+	edge := &graphMLEdgeXML{
+		ID:     "e" + strconv.Itoa(len(graphPtr.graph.Edges)),
+		Source: source.GetConceptID(trans),
+		Target: target.GetConceptID(trans),
+		Data:   []*graphMLDataXML{{Key: "edgeType", Value: edgeType}}}
+	graphPtr.graph.Edges = append(graphPtr.graph.Edges, edge)
+	return edge
+}
+
+func (graphPtr *GraphMLGraph) addOwnerEdge(owner Concept, owned Concept, trans *Transaction) error {
+	graphPtr.addEdge(GraphMLOwnerEdge, owner, owned, trans)
+	return nil
+}
+
+func (graphPtr *GraphMLGraph) addReferencedElementEdge(reference Concept, referencedConcept Concept, trans *Transaction) error {
+	edge := graphPtr.addEdge(GraphMLReferenceEdge, reference, referencedConcept, trans)
+	edge.Data = append(edge.Data, &graphMLDataXML{Key: "referencedAttributeName", Value: reference.GetReferencedAttributeName(trans).String()})
+	return nil
+}
+
+// addRefinement adds the refinement as a node with abstraction and refined edges, together with its owner edge if its
+// owner is in the graph
+func (graphPtr *GraphMLGraph) addRefinement(refinement Concept, trans *Transaction) error {
+	if graphPtr.hasConceptNode(refinement, trans) {
+		return nil
+	}
+	err := graphPtr.addConceptNode(refinement, trans)
+	if err != nil {
+		return errors.Wrap(err, "GraphMLGraph.addRefinement failed")
+	}
+	owner := refinement.GetOwningConcept(trans)
+	if owner != nil && graphPtr.hasConceptNode(owner, trans) {
+		graphPtr.addEdge(GraphMLOwnerEdge, owner, refinement, trans)
+	}
+	graphPtr.addEdge(GraphMLAbstractionEdge, refinement, refinement.GetAbstractConcept(trans), trans)
+	graphPtr.addEdge(GraphMLRefinedEdge, refinement, refinement.GetRefinedConcept(trans), trans)
+	return nil
+}
@@ -0,0 +1,129 @@
+package core
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GraphML export", func() {
+	var uOfD *UniverseOfDiscourse
+	var trans *Transaction
+	var domain, a, b, literal, reference, refinement, external Concept
+
+	BeforeEach(func() {
+		uOfD = NewUniverseOfDiscourse()
+		trans = uOfD.NewTransaction()
+		domain, _ = uOfD.NewElement(trans, "http://graphmltest/domain")
+		domain.SetLabel("Domain", trans)
+		a, _ = uOfD.NewOwnedElement(domain, "A & <B>", trans)
+		b, _ = uOfD.NewOwnedElement(domain, "B", trans)
+		literal, _ = uOfD.NewOwnedLiteral(b, "L", trans)
+		literal.SetLiteralValue("literal value", trans)
+		refinement, _ = uOfD.NewOwnedRefinement(b, "B refines A", a, b, trans)
+		otherDomain, _ := uOfD.NewElement(trans)
+		external, _ = uOfD.NewOwnedElement(otherDomain, "External", trans)
+		reference, _ = uOfD.NewOwnedReference(a, "R", trans)
+		reference.SetReferencedConcept(external, OwningConceptID, trans)
+	})
+
+	AfterEach(func() {
+		trans.ReleaseLocks()
+	})
+
+	readGraphML := func(graph *GraphMLGraph) *graphMLDocumentXML {
+		var buffer bytes.Buffer
+		Expect(graph.WriteGraphML(&buffer)).To(Succeed())
+		Expect(buffer.String()).To(HavePrefix(xml.Header))
+		document := &graphMLDocumentXML{}
+		Expect(xml.Unmarshal(buffer.Bytes(), document)).To(Succeed())
+		return document
+	}
+	nodeData := func(document *graphMLDocumentXML, concept Concept) map[string]string {
+		for _, node := range document.Graph.Nodes {
+			if node.ID == concept.GetConceptID(trans) {
+				data := make(map[string]string)
+				for _, datum := range node.Data {
+					data[datum.Key] = datum.Value
+				}
+				return data
+			}
+		}
+		return nil
+	}
+	findEdge := func(document *graphMLDocumentXML, edgeType string, source Concept, target Concept) *graphMLEdgeXML {
+		for _, edge := range document.Graph.Edges {
+			if edge.Source == source.GetConceptID(trans) && edge.Target == target.GetConceptID(trans) && edge.Data[0].Value == edgeType {
+				return edge
+			}
+		}
+		return nil
+	}
+
+	Specify("WriteGraphML should write the nodes of a subtree with their data", func() {
+		graph := NewGraphMLGraph("Test", DefaultCrlGraphOptions())
+		Expect(graph.AddConceptRecursively(domain, trans)).To(Succeed())
+		document := readGraphML(graph)
+		Expect(document.XMLName.Space).To(Equal(GraphMLNamespace))
+		Expect(document.Keys).To(HaveLen(len(graphMLKeys)))
+		Expect(document.Graph.ID).To(Equal("Test"))
+		Expect(document.Graph.EdgeDefault).To(Equal("directed"))
+		Expect(nodeData(document, domain)).To(Equal(map[string]string{
+			"conceptID": domain.GetConceptID(trans), "label": "Domain", "uri": "http://graphmltest/domain", "type": "Element"}))
+		Expect(nodeData(document, a)["label"]).To(Equal("A & <B>"))
+		Expect(nodeData(document, literal)["literalValue"]).To(Equal("literal value"))
+		Expect(nodeData(document, reference)["type"]).To(Equal("Reference"))
+		Expect(nodeData(document, refinement)["type"]).To(Equal("Refinement"))
+		Expect(nodeData(document, external)).ToNot(BeNil())
+	})
+
+	Specify("WriteGraphML should write typed edges", func() {
+		graph := NewGraphMLGraph("Test", DefaultCrlGraphOptions())
+		Expect(graph.AddConceptRecursively(domain, trans)).To(Succeed())
+		document := readGraphML(graph)
+		Expect(findEdge(document, GraphMLOwnerEdge, domain, a)).ToNot(BeNil())
+		Expect(findEdge(document, GraphMLOwnerEdge, b, literal)).ToNot(BeNil())
+		Expect(findEdge(document, GraphMLOwnerEdge, b, refinement)).ToNot(BeNil())
+		Expect(findEdge(document, GraphMLAbstractionEdge, refinement, a)).ToNot(BeNil())
+		Expect(findEdge(document, GraphMLRefinedEdge, refinement, b)).ToNot(BeNil())
+		referenceEdge := findEdge(document, GraphMLReferenceEdge, reference, external)
+		Expect(referenceEdge).ToNot(BeNil())
+		Expect(referenceEdge.Data[1].Key).To(Equal("referencedAttributeName"))
+		Expect(referenceEdge.Data[1].Value).To(Equal(OwningConceptID.String()))
+	})
+
+	Specify("GraphMLGraph should select the same concepts as CrlGraph", func() {
+		options := &CrlGraphOptions{MaxDepth: 1, HideCoreConcepts: true}
+		graph := NewGraphMLGraph("Test", options)
+		Expect(graph.AddConceptRecursively(domain, trans)).To(Succeed())
+		crlGraph := NewCrlGraphWithOptions("Test", options)
+		Expect(crlGraph.AddConceptRecursively(domain, trans)).To(Succeed())
+		var dot bytes.Buffer
+		Expect(crlGraph.WriteDOT(&dot)).To(Succeed())
+		document := readGraphML(graph)
+		Expect(document.Graph.Nodes).To(HaveLen(3))
+		for _, node := range document.Graph.Nodes {
+			Expect(strings.Contains(dot.String(), "\""+node.ID+"\" [")).To(BeTrue())
+		}
+		Expect(nodeData(document, literal)).To(BeNil())
+		Expect(nodeData(document, external)).To(BeNil())
+	})
+
+	Specify("AddUniverseOfDiscourse should add every root concept", func() {
+		graph := NewGraphMLGraph("Test", DefaultCrlGraphOptions())
+		Expect(graph.AddUniverseOfDiscourse(uOfD, trans)).To(Succeed())
+		document := readGraphML(graph)
+		Expect(nodeData(document, uOfD.GetElementWithURI(CoreDomainURI))).ToNot(BeNil())
+		Expect(nodeData(document, external.GetOwningConcept(trans))).ToNot(BeNil())
+		Expect(nodeData(document, literal)).ToNot(BeNil())
+		// Concepts reached from several roots are written once
+		ids := make(map[string]bool)
+		for _, node := range document.Graph.Nodes {
+			Expect(ids[node.ID]).To(BeFalse())
+			ids[node.ID] = true
+		}
+	})
+})
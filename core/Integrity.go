@@ -0,0 +1,373 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// IssueKind identifies the nature of an integrity Issue
+type IssueKind int
+
+// DanglingPointer indicates that the ReferencedConceptID, AbstractConceptID, or RefinedConceptID of a concept is the
+// ID of a concept that is not in the uOfD
+// OrphanedConcept indicates that the OwningConceptID of a concept is the ID of a concept that is not in the uOfD
+// OwnershipCycle indicates that a concept is, directly or indirectly, its own owner
+// RefinementCycle indicates that a concept is, directly or indirectly, its own abstraction
+// SelfReferentialRefinement indicates that a refinement is its own abstract or refined concept, or that its abstract and
+// refined concepts are the same
+// StaleListenerEntry indicates that the listenersMap records a listener whose pointers do not indicate the concept
+// MissingListenerEntry indicates that the listenersMap does not record a listener whose pointer indicates the concept
+const (
+	DanglingPointer IssueKind = iota
+	OrphanedConcept
+	OwnershipCycle
+	RefinementCycle
+	SelfReferentialRefinement
+	StaleListenerEntry
+	MissingListenerEntry
+)
+
+func (kind IssueKind) String() string {
+	switch kind {
+	case DanglingPointer:
+		return "DanglingPointer"
+	case OrphanedConcept:
+		return "OrphanedConcept"
+	case OwnershipCycle:
+		return "OwnershipCycle"
+	case RefinementCycle:
+		return "RefinementCycle"
+	case SelfReferentialRefinement:
+		return "SelfReferentialRefinement"
+	case StaleListenerEntry:
+		return "StaleListenerEntry"
+	case MissingListenerEntry:
+		return "MissingListenerEntry"
+	}
+	return "Undefined"
+}
+
+// Issue is a violation of the referential integrity of a uOfD found by CheckIntegrity. ConceptID identifies the
+// concept with the problem: for listener entries it is the listener. Attribute and TargetID identify the pointer
+// involved: the attribute of a dangling pointer or orphan and the missing concept, or the attribute of the listener
+// and the key of the listenersMap entry. The IDs of the concepts in an ownership cycle are given in ownership order,
+// and those in a refinement cycle in abstraction order, starting with the ConceptID. CheckIntegrity starts each cycle
+// with its smallest ID. The TargetID of a refinement cycle is the refinement from the first concept of the cycle to the
+// second, and that of a self-referential refinement is the concept it indicates with the Attribute.
+type Issue struct {
+	Kind      IssueKind
+	ConceptID string
+	Attribute AttributeName
+	TargetID  string
+	CycleIDs  []string
+}
+
+func (issue Issue) String() string {
+	switch issue.Kind {
+	case DanglingPointer:
+		return fmt.Sprintf("%s of concept %s is the missing concept %s", issue.Attribute.String(), issue.ConceptID, issue.TargetID)
+	case OrphanedConcept:
+		return fmt.Sprintf("owner of concept %s is the missing concept %s", issue.ConceptID, issue.TargetID)
+	case OwnershipCycle:
+		return fmt.Sprintf("ownership cycle %s", strings.Join(append(issue.CycleIDs, issue.CycleIDs[0]), " -> "))
+	case RefinementCycle:
+		return fmt.Sprintf("refinement cycle %s through refinement %s", strings.Join(append(issue.CycleIDs, issue.CycleIDs[0]), " -> "), issue.TargetID)
+	case SelfReferentialRefinement:
+		if issue.TargetID == issue.ConceptID {
+			return fmt.Sprintf("%s of refinement %s is the refinement itself", issue.Attribute.String(), issue.ConceptID)
+		}
+		return fmt.Sprintf("abstract and refined concepts of refinement %s are both concept %s", issue.ConceptID, issue.TargetID)
+	case StaleListenerEntry:
+		return fmt.Sprintf("listener %s recorded for concept %s does not indicate it", issue.ConceptID, issue.TargetID)
+	case MissingListenerEntry:
+		return fmt.Sprintf("%s of concept %s indicates concept %s but the listener is not recorded", issue.Attribute.String(), issue.ConceptID, issue.TargetID)
+	}
+	return issue.Kind.String() + " " + issue.ConceptID
+}
+
+// integrityPointers are the pointers of a concept, other than its owner, that are checked by CheckIntegrity
+func integrityPointers(el Concept, trans *Transaction) map[AttributeName]string {
+	pointers := make(map[AttributeName]string)
+	switch el.GetConceptType() {
+	case Reference:
+		if id := el.GetReferencedConceptID(trans); id != "" {
+			pointers[ReferencedConceptID] = id
+		}
+	case Refinement:
+		if id := el.GetAbstractConceptID(trans); id != "" {
+			pointers[AbstractConceptID] = id
+		}
+		if id := el.GetRefinedConceptID(trans); id != "" {
+			pointers[RefinedConceptID] = id
+		}
+	}
+	return pointers
+}
+
+// CheckIntegrity examines all of the concepts in the uOfD and returns the integrity issues found: pointers and owners
+// indicating concepts that are not in the uOfD, as happens when a workspace file refers to a concept that no file
+// defines, violations of the structural invariants, and entries in the listenersMap that do not match the pointers. The
+// issues are ordered by kind and then by ConceptID.
+func CheckIntegrity(uOfD *UniverseOfDiscourse, trans *Transaction) []Issue {
+	var issues []Issue
+	ids := sortedElementIDs(uOfD)
+	for _, id := range ids {
+		el := uOfD.GetElement(id)
+		if trans.ReadLockElement(el) != nil {
+			// The transaction has failed (see Transaction.Err) and the remaining concepts cannot be examined
+			return nil
+		}
+		pointers := integrityPointers(el, trans)
+		for _, attribute := range []AttributeName{ReferencedConceptID, AbstractConceptID, RefinedConceptID} {
+			targetID, found := pointers[attribute]
+			if found && uOfD.GetElement(targetID) == nil {
+				issues = append(issues, Issue{Kind: DanglingPointer, ConceptID: id, Attribute: attribute, TargetID: targetID})
+			}
+		}
+		ownerID := el.GetOwningConceptID(trans)
+		if ownerID != "" && uOfD.GetElement(ownerID) == nil {
+			issues = append(issues, Issue{Kind: OrphanedConcept, ConceptID: id, Attribute: OwningConceptID, TargetID: ownerID})
+		}
+	}
+	issues = append(issues, findOwnershipCycles(uOfD, ids, trans)...)
+	issues = append(issues, findRefinementIssues(uOfD, ids, trans)...)
+	issues = append(issues, checkListenersMap(uOfD, ids, trans)...)
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Kind != issues[j].Kind {
+			return issues[i].Kind < issues[j].Kind
+		}
+		return issues[i].ConceptID < issues[j].ConceptID
+	})
+	return issues
+}
+
+// sortedElementIDs returns the IDs of the concepts in the uOfD in order
+func sortedElementIDs(uOfD *UniverseOfDiscourse) []string {
+	var ids []string
+	for id := range uOfD.GetElements() {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// findOwnershipCycles follows the chain of owners from each concept and returns an issue for each cycle found
+func findOwnershipCycles(uOfD *UniverseOfDiscourse, ids []string, trans *Transaction) []Issue {
+	var issues []Issue
+	// finished holds the concepts whose chains of owners have been completely followed
+	finished := make(map[string]bool)
+	for _, id := range ids {
+		onPath := make(map[string]int)
+		var path []string
+		currentID := id
+		for currentID != "" && !finished[currentID] {
+			if start, found := onPath[currentID]; found {
+				cycle := path[start:]
+				smallest := 0
+				for i, cycleID := range cycle {
+					if cycleID < cycle[smallest] {
+						smallest = i
+					}
+				}
+				cycleIDs := append(append([]string{}, cycle[smallest:]...), cycle[:smallest]...)
+				issues = append(issues, Issue{Kind: OwnershipCycle, ConceptID: cycleIDs[0], Attribute: OwningConceptID, CycleIDs: cycleIDs})
+				break
+			}
+			el := uOfD.GetElement(currentID)
+			if el == nil {
+				break
+			}
+			onPath[currentID] = len(path)
+			path = append(path, currentID)
+			currentID = el.GetOwningConceptID(trans)
+		}
+		for _, pathID := range path {
+			finished[pathID] = true
+		}
+	}
+	return issues
+}
+
+// checkListenersMap compares the listenersMap with the pointers of the concepts
+func checkListenersMap(uOfD *UniverseOfDiscourse, ids []string, trans *Transaction) []Issue {
+	var issues []Issue
+	listenersMap := uOfD.listenersMap.CopyMap()
+	for _, id := range ids {
+		pointers := integrityPointers(uOfD.GetElement(id), trans)
+		for _, attribute := range []AttributeName{ReferencedConceptID, AbstractConceptID, RefinedConceptID} {
+			targetID, found := pointers[attribute]
+			if !found {
+				continue
+			}
+			listeners := listenersMap[targetID]
+			if listeners == nil || !listeners.Contains(id) {
+				issues = append(issues, Issue{Kind: MissingListenerEntry, ConceptID: id, Attribute: attribute, TargetID: targetID})
+			}
+		}
+	}
+	var keys []string
+	for key := range listenersMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var listenerIDs []string
+		for listenerID := range listenersMap[key].Iter() {
+			listenerIDs = append(listenerIDs, listenerID.(string))
+		}
+		sort.Strings(listenerIDs)
+		for _, listenerID := range listenerIDs {
+			stale := true
+			if listener := uOfD.GetElement(listenerID); listener != nil {
+				for _, targetID := range integrityPointers(listener, trans) {
+					if targetID == key {
+						stale = false
+					}
+				}
+			}
+			if stale {
+				issues = append(issues, Issue{Kind: StaleListenerEntry, ConceptID: listenerID, TargetID: key})
+			}
+		}
+	}
+	return issues
+}
+
+// RepairStrategy identifies how RepairIntegrity resolves the ownership issues
+type RepairStrategy int
+
+// NullifyRepair clears the owner of orphans and of the concept that starts each ownership cycle, making them roots
+// QuarantineRepair re-owns orphans and the concept that starts each ownership cycle to the quarantine domain
+const (
+	NullifyRepair RepairStrategy = iota
+	QuarantineRepair
+)
+
+// QuarantineDomainURI is the URI of the domain to which QuarantineRepair re-owns concepts
+var QuarantineDomainURI = "http://activeCrl.com/QuarantineDomain"
+
+// GetQuarantineDomain returns the domain to which QuarantineRepair re-owns concepts, creating it if necessary
+func GetQuarantineDomain(uOfD *UniverseOfDiscourse, trans *Transaction) (Concept, error) {
+	quarantine := uOfD.GetElementWithURI(QuarantineDomainURI)
+	if quarantine != nil {
+		return quarantine, nil
+	}
+	quarantine, err := uOfD.NewElement(trans, QuarantineDomainURI)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetQuarantineDomain failed")
+	}
+	err = quarantine.SetLabel("Quarantine", trans)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetQuarantineDomain failed")
+	}
+	return quarantine, nil
+}
+
+// RepairIntegrity repairs the issues found by CheckIntegrity. Dangling pointers are set to nil, and orphans and
+// ownership cycles are resolved as specified by the strategy. Refinement cycles are broken by setting the abstract
+// concept of the refinement identified by the issue to nil, as are the self-referential pointers of refinements. These
+// repairs are made with the normal mutators, so they can be undone. The listenersMap is then brought into line with the
+// pointers of all of the concepts, which also resolves the listener issues.
+func RepairIntegrity(uOfD *UniverseOfDiscourse, issues []Issue, strategy RepairStrategy, trans *Transaction) error {
+	for _, issue := range issues {
+		el := uOfD.GetElement(issue.ConceptID)
+		if el == nil {
+			continue
+		}
+		var err error
+		switch issue.Kind {
+		case DanglingPointer:
+			if uOfD.GetElement(issue.TargetID) != nil {
+				// Already resolved
+				continue
+			}
+			switch issue.Attribute {
+			case ReferencedConceptID:
+				if el.GetReferencedConceptID(trans) == issue.TargetID {
+					err = el.SetReferencedConceptID("", NoAttribute, trans)
+				}
+			case AbstractConceptID:
+				if el.GetAbstractConceptID(trans) == issue.TargetID {
+					err = el.SetAbstractConceptID("", trans)
+				}
+			case RefinedConceptID:
+				if el.GetRefinedConceptID(trans) == issue.TargetID {
+					err = el.SetRefinedConceptID("", trans)
+				}
+			}
+		case OrphanedConcept:
+			if el.GetOwningConceptID(trans) == issue.TargetID && uOfD.GetElement(issue.TargetID) == nil {
+				err = repairOwner(uOfD, el, strategy, trans)
+				uOfD.removeMappedValueFromOwnedIDsMap(issue.TargetID, issue.ConceptID)
+			}
+		case OwnershipCycle:
+			if isInOwnershipCycle(uOfD, el, trans) {
+				err = repairOwner(uOfD, el, strategy, trans)
+			}
+		case RefinementCycle:
+			refinement := uOfD.GetElement(issue.TargetID)
+			// The cycle may already have been broken by the repair of another issue
+			if refinement != nil && refinement.GetAbstractConceptID(trans) == issue.CycleIDs[1] && refinement.GetRefinedConceptID(trans) == issue.ConceptID &&
+				abstractionPath(uOfD, issue.CycleIDs[1], issue.ConceptID, issue.TargetID, trans) != nil {
+				err = refinement.SetAbstractConceptID("", trans)
+			}
+		case SelfReferentialRefinement:
+			switch issue.Attribute {
+			case AbstractConceptID:
+				if el.GetAbstractConceptID(trans) == issue.TargetID {
+					err = el.SetAbstractConceptID("", trans)
+				}
+			case RefinedConceptID:
+				if el.GetRefinedConceptID(trans) == issue.TargetID {
+					err = el.SetRefinedConceptID("", trans)
+				}
+			}
+		}
+		if err != nil {
+			return errors.Wrap(err, "RepairIntegrity failed to repair "+issue.String())
+		}
+	}
+	for _, issue := range checkListenersMap(uOfD, sortedElementIDs(uOfD), trans) {
+		switch issue.Kind {
+		case StaleListenerEntry:
+			uOfD.removeMappedValueFromListenersMap(issue.TargetID, issue.ConceptID)
+		case MissingListenerEntry:
+			uOfD.addMappedValueToListenersMap(issue.TargetID, issue.ConceptID)
+		}
+	}
+	return nil
+}
+
+// repairOwner re-owns the concept as specified by the strategy
+func repairOwner(uOfD *UniverseOfDiscourse, el Concept, strategy RepairStrategy, trans *Transaction) error {
+	newOwnerID := ""
+	if strategy == QuarantineRepair {
+		quarantine, err := GetQuarantineDomain(uOfD, trans)
+		if err != nil {
+			return err
+		}
+		newOwnerID = quarantine.GetConceptID(trans)
+	}
+	return el.SetOwningConceptID(newOwnerID, trans)
+}
+
+// isInOwnershipCycle returns true if the concept is, directly or indirectly, its own owner
+func isInOwnershipCycle(uOfD *UniverseOfDiscourse, el Concept, trans *Transaction) bool {
+	id := el.GetConceptID(trans)
+	visited := make(map[string]bool)
+	for ownerID := el.GetOwningConceptID(trans); ownerID != "" && !visited[ownerID]; {
+		if ownerID == id {
+			return true
+		}
+		visited[ownerID] = true
+		owner := uOfD.GetElement(ownerID)
+		if owner == nil {
+			return false
+		}
+		ownerID = owner.GetOwningConceptID(trans)
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package core
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Referential integrity", func() {
+	var uOfD *UniverseOfDiscourse
+	var trans *Transaction
+	var domain, reference, refinement Concept
+	var externalID string
+
+	// recoverState adds a concept with the given state to the uOfD in the way that a workspace file is loaded. Bulk
+	// loading allows structural violations to be created.
+	recoverState := func(state *ConceptState) Concept {
+		data, err := json.Marshal(state)
+		Expect(err).ToNot(HaveOccurred())
+		uOfD.SetBulkLoading(true)
+		defer uOfD.SetBulkLoading(false)
+		el, err := uOfD.RecoverElement(data, trans)
+		Expect(err).ToNot(HaveOccurred())
+		return el
+	}
+
+	BeforeEach(func() {
+		// The domain refers to a concept in another domain, and only the domain is loaded
+		sourceUofD := NewUniverseOfDiscourse()
+		sourceTrans := sourceUofD.NewTransaction()
+		defer sourceTrans.ReleaseLocks()
+		sourceDomain, _ := sourceUofD.NewElement(sourceTrans, "http://integritytest/domain")
+		a, _ := sourceUofD.NewOwnedElement(sourceDomain, "A", sourceTrans)
+		external, _ := sourceUofD.NewElement(sourceTrans)
+		externalID = external.GetConceptID(sourceTrans)
+		sourceReference, _ := sourceUofD.NewOwnedReference(sourceDomain, "R", sourceTrans)
+		sourceReference.SetReferencedConcept(external, NoAttribute, sourceTrans)
+		sourceRefinement, _ := sourceUofD.NewOwnedRefinement(sourceDomain, "A refines External", external, a, sourceTrans)
+		data, err := sourceUofD.MarshalDomain(sourceDomain, sourceTrans)
+		Expect(err).ToNot(HaveOccurred())
+
+		uOfD = NewUniverseOfDiscourse()
+		trans = uOfD.NewTransaction()
+		domain, err = uOfD.RecoverDomain(data, trans)
+		Expect(err).ToNot(HaveOccurred())
+		reference = uOfD.GetElement(sourceReference.GetConceptID(sourceTrans))
+		refinement = uOfD.GetElement(sourceRefinement.GetConceptID(sourceTrans))
+	})
+
+	AfterEach(func() {
+		trans.ReleaseLocks()
+	})
+
+	Specify("A consistent uOfD should have no issues", func() {
+		Expect(CheckIntegrity(NewUniverseOfDiscourse(), trans)).To(BeEmpty())
+	})
+
+	Specify("Pointers to concepts that are not loaded should be dangling", func() {
+		Expect(CheckIntegrity(uOfD, trans)).To(ConsistOf(
+			Issue{Kind: DanglingPointer, ConceptID: reference.GetConceptID(trans), Attribute: ReferencedConceptID, TargetID: externalID},
+			Issue{Kind: DanglingPointer, ConceptID: refinement.GetConceptID(trans), Attribute: AbstractConceptID, TargetID: externalID}))
+	})
+
+	Specify("Concepts whose owner is not loaded should be orphans", func() {
+		orphan := recoverState(&ConceptState{ConceptID: "orphan", ConceptType: "Element", OwningConceptID: "missingOwner", Label: "Orphan", ReferencedAttributeName: "NoAttribute"})
+		Expect(CheckIntegrity(uOfD, trans)).To(ContainElement(
+			Issue{Kind: OrphanedConcept, ConceptID: orphan.GetConceptID(trans), Attribute: OwningConceptID, TargetID: "missingOwner"}))
+	})
+
+	Specify("Ownership cycles should be found", func() {
+		recoverState(&ConceptState{ConceptID: "cycle2", ConceptType: "Element", OwningConceptID: "cycle1", ReferencedAttributeName: "NoAttribute"})
+		recoverState(&ConceptState{ConceptID: "cycle1", ConceptType: "Element", OwningConceptID: "cycle3", ReferencedAttributeName: "NoAttribute"})
+		recoverState(&ConceptState{ConceptID: "cycle3", ConceptType: "Element", OwningConceptID: "cycle2", ReferencedAttributeName: "NoAttribute"})
+		recoverState(&ConceptState{ConceptID: "cycle4", ConceptType: "Element", OwningConceptID: "cycle3", ReferencedAttributeName: "NoAttribute"})
+		issues := CheckIntegrity(uOfD, trans)
+		Expect(issues).To(ContainElement(Issue{Kind: OwnershipCycle, ConceptID: "cycle1", Attribute: OwningConceptID, CycleIDs: []string{"cycle1", "cycle3", "cycle2"}}))
+		cycles := 0
+		for _, issue := range issues {
+			if issue.Kind == OwnershipCycle {
+				cycles++
+				Expect(issue.String()).To(Equal("ownership cycle cycle1 -> cycle3 -> cycle2 -> cycle1"))
+			}
+		}
+		Expect(cycles).To(Equal(1))
+	})
+
+	Specify("Listener entries that do not match the pointers should be found", func() {
+		a := refinement.GetRefinedConcept(trans)
+		newReference, _ := uOfD.NewOwnedReference(domain, "New", trans)
+		newReference.SetReferencedConcept(a, NoAttribute, trans)
+		uOfD.removeMappedValueFromListenersMap(a.GetConceptID(trans), newReference.GetConceptID(trans))
+		uOfD.addMappedValueToListenersMap(domain.GetConceptID(trans), reference.GetConceptID(trans))
+		issues := CheckIntegrity(uOfD, trans)
+		Expect(issues).To(ContainElement(Issue{Kind: MissingListenerEntry, ConceptID: newReference.GetConceptID(trans), Attribute: ReferencedConceptID, TargetID: a.GetConceptID(trans)}))
+		Expect(issues).To(ContainElement(Issue{Kind: StaleListenerEntry, ConceptID: reference.GetConceptID(trans), TargetID: domain.GetConceptID(trans)}))
+		Expect(RepairIntegrity(uOfD, issues, NullifyRepair, trans)).To(Succeed())
+		Expect(CheckIntegrity(uOfD, trans)).To(BeEmpty())
+	})
+
+	Specify("Refinement cycles and self-referential refinements should be found and repaired", func() {
+		recoverState(&ConceptState{ConceptID: "rc1", ConceptType: "Element", ReferencedAttributeName: "NoAttribute"})
+		recoverState(&ConceptState{ConceptID: "rc2", ConceptType: "Element", ReferencedAttributeName: "NoAttribute"})
+		recoverState(&ConceptState{ConceptID: "r12", ConceptType: "Refinement", AbstractConceptID: "rc2", RefinedConceptID: "rc1", ReferencedAttributeName: "NoAttribute"})
+		recoverState(&ConceptState{ConceptID: "r21", ConceptType: "Refinement", AbstractConceptID: "rc1", RefinedConceptID: "rc2", ReferencedAttributeName: "NoAttribute"})
+		recoverState(&ConceptState{ConceptID: "selfRef", ConceptType: "Refinement", AbstractConceptID: "selfRef", ReferencedAttributeName: "NoAttribute"})
+		recoverState(&ConceptState{ConceptID: "same", ConceptType: "Refinement", AbstractConceptID: "rc1", RefinedConceptID: "rc1", ReferencedAttributeName: "NoAttribute"})
+		issues := CheckIntegrity(uOfD, trans)
+		Expect(issues).To(ContainElement(Issue{Kind: RefinementCycle, ConceptID: "rc1", Attribute: AbstractConceptID, TargetID: "r12", CycleIDs: []string{"rc1", "rc2"}}))
+		Expect(issues).To(ContainElement(Issue{Kind: SelfReferentialRefinement, ConceptID: "selfRef", Attribute: AbstractConceptID, TargetID: "selfRef"}))
+		Expect(issues).To(ContainElement(Issue{Kind: SelfReferentialRefinement, ConceptID: "same", Attribute: RefinedConceptID, TargetID: "rc1"}))
+		Expect(RepairIntegrity(uOfD, issues, NullifyRepair, trans)).To(Succeed())
+		Expect(CheckIntegrity(uOfD, trans)).To(BeEmpty())
+		Expect(uOfD.GetElement("r12").GetAbstractConceptID(trans)).To(Equal(""))
+		Expect(uOfD.GetElement("r21").GetAbstractConceptID(trans)).To(Equal("rc1"))
+		Expect(uOfD.GetElement("selfRef").GetAbstractConceptID(trans)).To(Equal(""))
+		Expect(uOfD.GetElement("same").GetRefinedConceptID(trans)).To(Equal(""))
+	})
+
+	Describe("Repairs", func() {
+		BeforeEach(func() {
+			recoverState(&ConceptState{ConceptID: "orphan", ConceptType: "Element", OwningConceptID: "missingOwner", Label: "Orphan", ReferencedAttributeName: "NoAttribute"})
+			recoverState(&ConceptState{ConceptID: "cycle1", ConceptType: "Element", OwningConceptID: "cycle2", ReferencedAttributeName: "NoAttribute"})
+			recoverState(&ConceptState{ConceptID: "cycle2", ConceptType: "Element", OwningConceptID: "cycle1", ReferencedAttributeName: "NoAttribute"})
+		})
+
+		Specify("NullifyRepair should clear dangling pointers and owners", func() {
+			Expect(RepairIntegrity(uOfD, CheckIntegrity(uOfD, trans), NullifyRepair, trans)).To(Succeed())
+			Expect(CheckIntegrity(uOfD, trans)).To(BeEmpty())
+			Expect(reference.GetReferencedConceptID(trans)).To(Equal(""))
+			Expect(refinement.GetAbstractConceptID(trans)).To(Equal(""))
+			Expect(uOfD.GetElement("orphan").GetOwningConceptID(trans)).To(Equal(""))
+			Expect(uOfD.GetElement("cycle1").GetOwningConceptID(trans)).To(Equal(""))
+			Expect(uOfD.GetElement("cycle2").GetOwningConceptID(trans)).To(Equal("cycle1"))
+			Expect(uOfD.GetElementWithURI(QuarantineDomainURI)).To(BeNil())
+		})
+
+		Specify("QuarantineRepair should re-own orphans and cycles to the quarantine domain", func() {
+			Expect(RepairIntegrity(uOfD, CheckIntegrity(uOfD, trans), QuarantineRepair, trans)).To(Succeed())
+			Expect(CheckIntegrity(uOfD, trans)).To(BeEmpty())
+			quarantine := uOfD.GetElementWithURI(QuarantineDomainURI)
+			Expect(quarantine).ToNot(BeNil())
+			Expect(quarantine.GetLabel(trans)).To(Equal("Quarantine"))
+			Expect(uOfD.GetElement("orphan").GetOwningConcept(trans)).To(Equal(quarantine))
+			Expect(uOfD.GetElement("cycle1").GetOwningConcept(trans)).To(Equal(quarantine))
+			Expect(reference.GetReferencedConceptID(trans)).To(Equal(""))
+		})
+
+		Specify("Repairs should be undoable", func() {
+			uOfD.SetRecordingUndo(true)
+			uOfD.MarkUndoPoint()
+			Expect(RepairIntegrity(uOfD, CheckIntegrity(uOfD, trans), NullifyRepair, trans)).To(Succeed())
+			uOfD.Undo(trans)
+			Expect(reference.GetReferencedConceptID(trans)).To(Equal(externalID))
+			Expect(uOfD.GetElement("orphan").GetOwningConceptID(trans)).To(Equal("missingOwner"))
+			Expect(uOfD.GetElement("cycle1").GetOwningConceptID(trans)).To(Equal("cycle2"))
+		})
+	})
+})
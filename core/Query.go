@@ -0,0 +1,596 @@
+// Copyright 2017, 2018 Paul C. Brown. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// ConceptQuery is a compiled path expression that can be evaluated against a UniverseOfDiscourse. The syntax is
+// patterned after XPath:
+//
+//	query      := ["/" | "//"] step (("/" | "//") step)*
+//	step       := "." | ".." | [axis "::"] nodeTest predicate*
+//	axis       := "self" | "owned" | "descendant" | "owner" | "abstraction" | "refinement" | "referenced" | "literal"
+//	nodeTest   := "*" | name | 'quoted label'
+//	predicate  := "[" expression "]"
+//	expression := term (("and" | "or") term)*
+//	term       := "not" term | "(" expression ")" | "@" attribute ("=" | "!=") 'value' | "refines" "(" 'uri' ")"
+//	attribute  := "id" | "label" | "uri" | "type" | "value" | "definition"
+//
+// The default axis is "owned". The owned axis selects the owned concepts, descendant selects all owned concepts
+// recursively, owner selects the owning concept, abstraction selects the immediate abstractions, refinement selects
+// the concepts that are immediate refinements, referenced selects the concept referenced by a Reference, and literal
+// selects the owned Literals. The node test matches against the concept label. In predicates, "type" is the
+// ConceptType name and "value" is the literal value. "refines" is true when the concept is a refinement of the
+// concept with the given URI. A leading "/" starts the evaluation at the root elements of the UniverseOfDiscourse;
+// "//" selects the step from the context concepts and all of their descendants.
+type ConceptQuery struct {
+	expression string
+	absolute   bool
+	steps      []*queryStep
+}
+
+// queryAxis identifies the relationship followed by a query step
+type queryAxis int
+
+const (
+	selfAxis queryAxis = iota
+	ownedAxis
+	descendantAxis
+	ownerAxis
+	abstractionAxis
+	refinementAxis
+	referencedAxis
+	literalAxis
+)
+
+var queryAxisNames = map[string]queryAxis{
+	"self":        selfAxis,
+	"owned":       ownedAxis,
+	"descendant":  descendantAxis,
+	"owner":       ownerAxis,
+	"abstraction": abstractionAxis,
+	"refinement":  refinementAxis,
+	"referenced":  referencedAxis,
+	"literal":     literalAxis,
+}
+
+// queryStep is a single step in a path expression
+type queryStep struct {
+	// includeDescendants is true when the step was introduced by "//"
+	includeDescendants bool
+	axis               queryAxis
+	// label is the label to be matched. The empty string matches all labels
+	label      string
+	predicates []queryPredicate
+}
+
+// queryPredicate is a compiled predicate expression
+type queryPredicate func(Concept, *Transaction) bool
+
+// NewConceptQuery compiles the given path expression
+func NewConceptQuery(expression string) (*ConceptQuery, error) {
+	tokens, err := tokenizeQuery(expression)
+	if err != nil {
+		return nil, errors.Wrap(err, "NewConceptQuery failed")
+	}
+	parser := &queryParser{tokens: tokens}
+	query, err := parser.parseQuery()
+	if err != nil {
+		return nil, errors.Wrap(err, "NewConceptQuery failed")
+	}
+	query.expression = expression
+	return query, nil
+}
+
+// Evaluate evaluates the query within the given transaction and returns the selected concepts mapped by their
+// ConceptIDs. Concepts are read locked as they are visited. If the query is not absolute, evaluation starts with
+// the supplied context concepts. If no context concepts are supplied, evaluation starts at the root elements.
+func (qPtr *ConceptQuery) Evaluate(trans *Transaction, contextConcepts ...Concept) (map[string]Concept, error) {
+	if trans == nil {
+		return nil, errors.New("ConceptQuery.Evaluate called with nil transaction")
+	}
+	uOfD := trans.GetUniverseOfDiscourse()
+	// The empty key holds the virtual root: the implied owner of all root elements
+	current := make(map[string]Concept)
+	if qPtr.absolute || len(contextConcepts) == 0 {
+		current[""] = nil
+	} else {
+		for _, contextConcept := range contextConcepts {
+			if contextConcept == nil {
+				return nil, errors.New("ConceptQuery.Evaluate called with nil context concept")
+			}
+			current[contextConcept.GetConceptID(trans)] = contextConcept
+		}
+	}
+	for _, step := range qPtr.steps {
+		if step.includeDescendants {
+			current = queryDescendantsOrSelf(current, uOfD, trans)
+		}
+		next := make(map[string]Concept)
+		for _, contextConcept := range current {
+			for id, candidate := range queryAxisConcepts(step.axis, contextConcept, uOfD, trans) {
+				if step.matches(candidate, trans) {
+					next[id] = candidate
+				}
+			}
+		}
+		current = next
+	}
+	// A concept that cannot be locked fails the transaction
+	err := trans.Err()
+	if err != nil {
+		return nil, errors.Wrap(err, "ConceptQuery.Evaluate failed")
+	}
+	delete(current, "")
+	return current, nil
+}
+
+// String returns the expression from which the query was compiled
+func (qPtr *ConceptQuery) String() string {
+	return qPtr.expression
+}
+
+// Query compiles and evaluates the path expression. See ConceptQuery for the syntax.
+func (uOfDPtr *UniverseOfDiscourse) Query(expression string, trans *Transaction, contextConcepts ...Concept) (map[string]Concept, error) {
+	query, err := NewConceptQuery(expression)
+	if err != nil {
+		return nil, errors.Wrap(err, "UniverseOfDiscourse.Query failed")
+	}
+	result, err := query.Evaluate(trans, contextConcepts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "UniverseOfDiscourse.Query failed")
+	}
+	return result, nil
+}
+
+// matches returns true if the candidate satisfies the node test and all predicates of the step
+func (stepPtr *queryStep) matches(candidate Concept, trans *Transaction) bool {
+	if candidate == nil {
+		// Only the self axis can return the virtual root
+		return stepPtr.label == "" && len(stepPtr.predicates) == 0
+	}
+	if stepPtr.label != "" && candidate.GetLabel(trans) != stepPtr.label {
+		return false
+	}
+	for _, predicate := range stepPtr.predicates {
+		if !predicate(candidate, trans) {
+			return false
+		}
+	}
+	return true
+}
+
+// queryAxisConcepts returns the concepts reachable from the context concept along the given axis.
+// A nil context concept is the virtual root.
+func queryAxisConcepts(axis queryAxis, contextConcept Concept, uOfD *UniverseOfDiscourse, trans *Transaction) map[string]Concept {
+	result := make(map[string]Concept)
+	if contextConcept == nil {
+		switch axis {
+		case selfAxis:
+			result[""] = nil
+		case ownedAxis:
+			return uOfD.GetRootElements(trans)
+		case literalAxis:
+			for id, root := range uOfD.GetRootElements(trans) {
+				if root.GetConceptType() == Literal {
+					result[id] = root
+				}
+			}
+		case descendantAxis:
+			for id, root := range uOfD.GetRootElements(trans) {
+				result[id] = root
+				queryAddDescendants(root, result, uOfD, trans)
+			}
+		}
+		return result
+	}
+	if trans.ReadLockElement(contextConcept) != nil {
+		return result
+	}
+	switch axis {
+	case selfAxis:
+		result[contextConcept.getConceptIDNoLock()] = contextConcept
+	case ownedAxis:
+		return contextConcept.GetOwnedConcepts(trans)
+	case descendantAxis:
+		queryAddDescendants(contextConcept, result, uOfD, trans)
+	case ownerAxis:
+		owner := contextConcept.GetOwningConcept(trans)
+		if owner != nil {
+			result[owner.GetConceptID(trans)] = owner
+		}
+	case abstractionAxis:
+		contextConcept.FindImmediateAbstractions(result, trans)
+	case refinementAxis:
+		contextID := contextConcept.getConceptIDNoLock()
+		it := uOfD.GetListenerIDs(contextID).Iterator()
+		for id := range it.C {
+			listener := uOfD.GetElement(id.(string))
+			if listener == nil || listener.GetConceptType() != Refinement {
+				continue
+			}
+			if listener.GetAbstractConceptID(trans) == contextID {
+				refinedConcept := listener.GetRefinedConcept(trans)
+				if refinedConcept != nil && refinedConcept.GetConceptID(trans) != contextID {
+					result[refinedConcept.getConceptIDNoLock()] = refinedConcept
+				}
+			}
+		}
+	case referencedAxis:
+		if contextConcept.GetConceptType() == Reference {
+			referencedConcept := contextConcept.GetReferencedConcept(trans)
+			if referencedConcept != nil {
+				result[referencedConcept.GetConceptID(trans)] = referencedConcept
+			}
+		}
+	case literalAxis:
+		for id, owned := range contextConcept.GetOwnedConcepts(trans) {
+			if owned.GetConceptType() == Literal {
+				result[id] = owned
+			}
+		}
+	}
+	return result
+}
+
+// queryAddDescendants adds all of the owned concepts of the parent, recursively, to the descendants
+func queryAddDescendants(parent Concept, descendants map[string]Concept, uOfD *UniverseOfDiscourse, trans *Transaction) {
+	for id, child := range parent.GetOwnedConcepts(trans) {
+		if _, found := descendants[id]; !found {
+			if trans.ReadLockElement(child) != nil {
+				return
+			}
+			descendants[id] = child
+			queryAddDescendants(child, descendants, uOfD, trans)
+		}
+	}
+}
+
+// queryDescendantsOrSelf returns the supplied concepts together with all of their descendants
+func queryDescendantsOrSelf(concepts map[string]Concept, uOfD *UniverseOfDiscourse, trans *Transaction) map[string]Concept {
+	result := make(map[string]Concept)
+	for id, el := range concepts {
+		result[id] = el
+		for descendantID, descendant := range queryAxisConcepts(descendantAxis, el, uOfD, trans) {
+			result[descendantID] = descendant
+		}
+	}
+	return result
+}
+
+// queryAttributeValue returns the value of the named attribute for use in predicates
+func queryAttributeValue(attribute string, el Concept, trans *Transaction) string {
+	switch attribute {
+	case "id":
+		return el.GetConceptID(trans)
+	case "label":
+		return el.GetLabel(trans)
+	case "uri":
+		return el.GetURI(trans)
+	case "type":
+		return ConceptTypeToString(el.GetConceptType())
+	case "value":
+		return el.GetLiteralValue(trans)
+	case "definition":
+		return el.GetDefinition(trans)
+	}
+	return ""
+}
+
+// queryTokenType identifies the lexical category of a queryToken
+type queryTokenType int
+
+const (
+	querySymbolToken queryTokenType = iota
+	queryNameToken
+	queryStringToken
+)
+
+// queryToken is a lexical element of a query expression
+type queryToken struct {
+	tokenType queryTokenType
+	value     string
+	position  int
+}
+
+// tokenizeQuery splits the expression into tokens
+func tokenizeQuery(expression string) ([]queryToken, error) {
+	var tokens []queryToken
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '/' || r == ':' || r == '.':
+			if i+1 < len(runes) && runes[i+1] == r {
+				tokens = append(tokens, queryToken{querySymbolToken, string([]rune{r, r}), i})
+				i += 2
+			} else if r == ':' {
+				return nil, errors.Errorf("unexpected ':' at position %d", i)
+			} else {
+				tokens = append(tokens, queryToken{querySymbolToken, string(r), i})
+				i++
+			}
+		case r == '!':
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				tokens = append(tokens, queryToken{querySymbolToken, "!=", i})
+				i += 2
+			} else {
+				return nil, errors.Errorf("unexpected '!' at position %d", i)
+			}
+		case strings.ContainsRune("*[]()@=", r):
+			tokens = append(tokens, queryToken{querySymbolToken, string(r), i})
+			i++
+		case r == '\'' || r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end == len(runes) {
+				return nil, errors.Errorf("unterminated string starting at position %d", i)
+			}
+			tokens = append(tokens, queryToken{queryStringToken, string(runes[i+1 : end]), i})
+			i = end + 1
+		case isQueryNameRune(r):
+			end := i
+			for end < len(runes) && isQueryNameRune(runes[end]) {
+				end++
+			}
+			tokens = append(tokens, queryToken{queryNameToken, string(runes[i:end]), i})
+			i = end
+		default:
+			return nil, errors.Errorf("unexpected character '%c' at position %d", r, i)
+		}
+	}
+	return tokens, nil
+}
+
+func isQueryNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-'
+}
+
+// queryParser is a recursive descent parser for query expressions
+type queryParser struct {
+	tokens   []queryToken
+	position int
+}
+
+func (pPtr *queryParser) atEnd() bool {
+	return pPtr.position >= len(pPtr.tokens)
+}
+
+func (pPtr *queryParser) peek() *queryToken {
+	if pPtr.atEnd() {
+		return nil
+	}
+	return &pPtr.tokens[pPtr.position]
+}
+
+// peekSymbol returns true if the next token is the given symbol
+func (pPtr *queryParser) peekSymbol(symbol string) bool {
+	token := pPtr.peek()
+	return token != nil && token.tokenType == querySymbolToken && token.value == symbol
+}
+
+// peekName returns true if the next token is the given name
+func (pPtr *queryParser) peekName(name string) bool {
+	token := pPtr.peek()
+	return token != nil && token.tokenType == queryNameToken && token.value == name
+}
+
+func (pPtr *queryParser) expectSymbol(symbol string) error {
+	if !pPtr.peekSymbol(symbol) {
+		return pPtr.unexpected("'" + symbol + "'")
+	}
+	pPtr.position++
+	return nil
+}
+
+func (pPtr *queryParser) expectString() (string, error) {
+	token := pPtr.peek()
+	if token == nil || token.tokenType != queryStringToken {
+		return "", pPtr.unexpected("quoted string")
+	}
+	pPtr.position++
+	return token.value, nil
+}
+
+func (pPtr *queryParser) unexpected(expected string) error {
+	token := pPtr.peek()
+	if token == nil {
+		return errors.New("expected " + expected + " but found end of query")
+	}
+	return errors.Errorf("expected %s but found '%s' at position %d", expected, token.value, token.position)
+}
+
+func (pPtr *queryParser) parseQuery() (*ConceptQuery, error) {
+	query := &ConceptQuery{}
+	if pPtr.atEnd() {
+		return nil, errors.New("empty query")
+	}
+	includeDescendants := false
+	if pPtr.peekSymbol("/") || pPtr.peekSymbol("//") {
+		query.absolute = true
+		includeDescendants = pPtr.peek().value == "//"
+		pPtr.position++
+		if pPtr.atEnd() && !includeDescendants {
+			// "/" alone selects the root elements
+			query.steps = append(query.steps, &queryStep{axis: ownedAxis})
+			return query, nil
+		}
+	}
+	for {
+		step, err := pPtr.parseStep()
+		if err != nil {
+			return nil, err
+		}
+		step.includeDescendants = includeDescendants
+		query.steps = append(query.steps, step)
+		if pPtr.atEnd() {
+			return query, nil
+		}
+		if !pPtr.peekSymbol("/") && !pPtr.peekSymbol("//") {
+			return nil, pPtr.unexpected("'/' or '//'")
+		}
+		includeDescendants = pPtr.peek().value == "//"
+		pPtr.position++
+	}
+}
+
+func (pPtr *queryParser) parseStep() (*queryStep, error) {
+	step := &queryStep{axis: ownedAxis}
+	if pPtr.peekSymbol(".") {
+		pPtr.position++
+		step.axis = selfAxis
+		return step, nil
+	}
+	if pPtr.peekSymbol("..") {
+		pPtr.position++
+		step.axis = ownerAxis
+		return step, nil
+	}
+	if pPtr.position+1 < len(pPtr.tokens) && pPtr.tokens[pPtr.position+1].value == "::" {
+		axisToken := pPtr.peek()
+		axis, found := queryAxisNames[axisToken.value]
+		if axisToken.tokenType != queryNameToken || !found {
+			return nil, errors.Errorf("unknown axis '%s' at position %d", axisToken.value, axisToken.position)
+		}
+		step.axis = axis
+		pPtr.position += 2
+	}
+	token := pPtr.peek()
+	switch {
+	case token == nil:
+		return nil, pPtr.unexpected("node test")
+	case token.tokenType == querySymbolToken && token.value == "*":
+	case token.tokenType == queryNameToken || token.tokenType == queryStringToken:
+		step.label = token.value
+	default:
+		return nil, pPtr.unexpected("node test")
+	}
+	pPtr.position++
+	for pPtr.peekSymbol("[") {
+		pPtr.position++
+		predicate, err := pPtr.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		err = pPtr.expectSymbol("]")
+		if err != nil {
+			return nil, err
+		}
+		step.predicates = append(step.predicates, predicate)
+	}
+	return step, nil
+}
+
+// parseExpression parses a sequence of terms joined by "and" and "or", with "and" binding more tightly
+func (pPtr *queryParser) parseExpression() (queryPredicate, error) {
+	left, err := pPtr.parseConjunction()
+	if err != nil {
+		return nil, err
+	}
+	for pPtr.peekName("or") {
+		pPtr.position++
+		right, err := pPtr.parseConjunction()
+		if err != nil {
+			return nil, err
+		}
+		first := left
+		left = func(el Concept, trans *Transaction) bool {
+			return first(el, trans) || right(el, trans)
+		}
+	}
+	return left, nil
+}
+
+func (pPtr *queryParser) parseConjunction() (queryPredicate, error) {
+	left, err := pPtr.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for pPtr.peekName("and") {
+		pPtr.position++
+		right, err := pPtr.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		first := left
+		left = func(el Concept, trans *Transaction) bool {
+			return first(el, trans) && right(el, trans)
+		}
+	}
+	return left, nil
+}
+
+func (pPtr *queryParser) parseTerm() (queryPredicate, error) {
+	switch {
+	case pPtr.peekName("not"):
+		pPtr.position++
+		term, err := pPtr.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		return func(el Concept, trans *Transaction) bool {
+			return !term(el, trans)
+		}, nil
+	case pPtr.peekSymbol("("):
+		pPtr.position++
+		expression, err := pPtr.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		return expression, pPtr.expectSymbol(")")
+	case pPtr.peekName("refines"):
+		pPtr.position++
+		err := pPtr.expectSymbol("(")
+		if err != nil {
+			return nil, err
+		}
+		uri, err := pPtr.expectString()
+		if err != nil {
+			return nil, err
+		}
+		return func(el Concept, trans *Transaction) bool {
+			return el.IsRefinementOfURI(uri, trans)
+		}, pPtr.expectSymbol(")")
+	case pPtr.peekSymbol("@"):
+		pPtr.position++
+		token := pPtr.peek()
+		if token == nil || token.tokenType != queryNameToken {
+			return nil, pPtr.unexpected("attribute name")
+		}
+		attribute := token.value
+		switch attribute {
+		case "id", "label", "uri", "type", "value", "definition":
+		default:
+			return nil, errors.Errorf("unknown attribute '%s' at position %d", attribute, token.position)
+		}
+		pPtr.position++
+		negate := pPtr.peekSymbol("!=")
+		if !negate {
+			err := pPtr.expectSymbol("=")
+			if err != nil {
+				return nil, pPtr.unexpected("'=' or '!='")
+			}
+		} else {
+			pPtr.position++
+		}
+		value, err := pPtr.expectString()
+		if err != nil {
+			return nil, err
+		}
+		return func(el Concept, trans *Transaction) bool {
+			return (queryAttributeValue(attribute, el, trans) == value) != negate
+		}, nil
+	}
+	return nil, pPtr.unexpected("predicate term")
+}
@@ -0,0 +1,150 @@
+package core
+
+import (
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Query tests", func() {
+	var uOfD *UniverseOfDiscourse
+	var trans *Transaction
+	var domain Concept
+	var abstractElement Concept
+	var refinedElement Concept
+	var literal Concept
+	var reference Concept
+
+	BeforeEach(func() {
+		uOfD = NewUniverseOfDiscourse()
+		trans = uOfD.NewTransaction()
+		domain, _ = uOfD.NewElement(trans, "http://activeCrl.com/test/QueryDomain")
+		domain.SetLabel("QueryDomain", trans)
+		abstractElement, _ = uOfD.NewOwnedElement(domain, "Abstract", trans, "http://activeCrl.com/test/QueryDomain/Abstract")
+		refinedElement, _ = uOfD.NewOwnedElement(domain, "Refined Element", trans)
+		uOfD.NewOwnedRefinement(refinedElement, "Refinement", abstractElement, refinedElement, trans)
+		literal, _ = uOfD.NewOwnedLiteral(refinedElement, "Value", trans)
+		literal.SetLiteralValue("42", trans)
+		reference, _ = uOfD.NewOwnedReference(domain, "Pointer", trans)
+		reference.SetReferencedConcept(refinedElement, NoAttribute, trans)
+	})
+
+	AfterEach(func() {
+		trans.ReleaseLocks()
+	})
+
+	Describe("Compiling queries", func() {
+		Specify("Valid queries should compile", func() {
+			for _, expression := range []string{
+				"/",
+				"/QueryDomain",
+				"//*",
+				"./owned::*[@type='Literal']",
+				"../..",
+				"descendant::*[not (@label='x' or @label!='y') and refines('http://activeCrl.com/core/Literal')]",
+				"'Refined Element'/literal::Value",
+			} {
+				query, err := NewConceptQuery(expression)
+				Expect(err).To(BeNil(), expression)
+				Expect(query.String()).To(Equal(expression))
+			}
+		})
+		Specify("Invalid queries should return errors", func() {
+			for _, expression := range []string{
+				"",
+				"//",
+				"bogus::*",
+				"*[@bogus='x']",
+				"*[@label='x'",
+				"*[@label=x]",
+				"'unterminated",
+				"a b",
+				"a:b",
+				"#",
+			} {
+				_, err := NewConceptQuery(expression)
+				Expect(err).ToNot(BeNil(), expression)
+			}
+		})
+	})
+
+	Describe("Evaluating queries", func() {
+		Specify("Absolute paths should start at the root elements", func() {
+			result, err := uOfD.Query("/QueryDomain", trans)
+			Expect(err).To(BeNil())
+			Expect(result).To(HaveLen(1))
+			Expect(result[domain.getConceptIDNoLock()]).To(Equal(domain))
+			result, err = uOfD.Query("/", trans)
+			Expect(err).To(BeNil())
+			Expect(result).To(Equal(uOfD.GetRootElements(trans)))
+		})
+		Specify("Relative paths should start at the context concepts", func() {
+			result, err := uOfD.Query("Abstract", trans, domain)
+			Expect(err).To(BeNil())
+			Expect(result).To(HaveLen(1))
+			Expect(result[abstractElement.getConceptIDNoLock()]).To(Equal(abstractElement))
+			result, err = uOfD.Query("..", trans, abstractElement)
+			Expect(err).To(BeNil())
+			Expect(result).To(HaveLen(1))
+			Expect(result[domain.getConceptIDNoLock()]).To(Equal(domain))
+			result, err = uOfD.Query(".", trans, abstractElement, refinedElement)
+			Expect(err).To(BeNil())
+			Expect(result).To(HaveLen(2))
+		})
+		Specify("Descendant steps should search recursively", func() {
+			result, err := uOfD.Query("//Value", trans)
+			Expect(err).To(BeNil())
+			Expect(result).To(HaveLen(1))
+			Expect(result[literal.getConceptIDNoLock()]).To(Equal(literal))
+			result, err = uOfD.Query("descendant::*", trans, domain)
+			Expect(err).To(BeNil())
+			Expect(result).To(HaveLen(5))
+		})
+		Specify("Literal steps and value predicates should work", func() {
+			result, err := uOfD.Query("/QueryDomain/'Refined Element'/literal::*[@value='42']", trans)
+			Expect(err).To(BeNil())
+			Expect(result).To(HaveLen(1))
+			Expect(result[literal.getConceptIDNoLock()]).To(Equal(literal))
+			result, err = uOfD.Query("literal::*[@value!='42']", trans, refinedElement)
+			Expect(err).To(BeNil())
+			Expect(result).To(HaveLen(0))
+		})
+		Specify("Abstraction and refinement steps should follow refinements", func() {
+			result, err := uOfD.Query("abstraction::*", trans, refinedElement)
+			Expect(err).To(BeNil())
+			Expect(result).To(HaveLen(1))
+			Expect(result[abstractElement.getConceptIDNoLock()]).To(Equal(abstractElement))
+			result, err = uOfD.Query("refinement::*", trans, abstractElement)
+			Expect(err).To(BeNil())
+			Expect(result).To(HaveLen(1))
+			Expect(result[refinedElement.getConceptIDNoLock()]).To(Equal(refinedElement))
+			result, err = uOfD.Query("//*[refines('http://activeCrl.com/test/QueryDomain/Abstract')]", trans)
+			Expect(err).To(BeNil())
+			Expect(result).To(HaveLen(1))
+		})
+		Specify("Referenced steps should follow references", func() {
+			result, err := uOfD.Query("/QueryDomain/owned::*[@type='Reference']/referenced::*", trans)
+			Expect(err).To(BeNil())
+			Expect(result).To(HaveLen(1))
+			Expect(result[refinedElement.getConceptIDNoLock()]).To(Equal(refinedElement))
+		})
+		Specify("Boolean predicates should combine correctly", func() {
+			result, err := uOfD.Query("*[@label='Abstract' or (@type='Reference' and not @label='x')]", trans, domain)
+			Expect(err).To(BeNil())
+			Expect(result).To(HaveLen(2))
+			Expect(result[abstractElement.getConceptIDNoLock()]).To(Equal(abstractElement))
+			Expect(result[reference.getConceptIDNoLock()]).To(Equal(reference))
+			result, err = uOfD.Query("*[@uri='http://activeCrl.com/test/QueryDomain/Abstract']", trans, domain)
+			Expect(err).To(BeNil())
+			Expect(result).To(HaveLen(1))
+		})
+		Specify("Evaluation should read lock the visited concepts", func() {
+			trans.ReleaseLocks()
+			otherTrans := uOfD.NewTransaction()
+			defer otherTrans.ReleaseLocks()
+			_, err := uOfD.Query("descendant::*", otherTrans, domain)
+			Expect(err).To(BeNil())
+			Expect(otherTrans.readLocks).To(HaveKey(domain.getConceptIDNoLock()))
+			Expect(otherTrans.readLocks).To(HaveKey(literal.getConceptIDNoLock()))
+		})
+	})
+})
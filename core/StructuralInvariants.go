@@ -0,0 +1,251 @@
+package core
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The structural invariants of a uOfD are that no concept is, directly or indirectly, its own owner; that no concept
+// is, directly or indirectly, its own abstraction; and that no refinement is its own abstract or refined concept or has
+// the same concept as both. Without them, FindAbstractions and the recursive walks of owned concepts never terminate.
+// The mutators and RecoverElement reject changes that would violate the invariants. While bulk loading, RecoverElement
+// does not check them, and VerifyStructure should be called once the loading is complete.
+
+// StructuralViolationError is returned when a change or a load would violate the structural invariants. Issues
+// describes each violation.
+type StructuralViolationError struct {
+	Issues []Issue
+}
+
+func (sve *StructuralViolationError) Error() string {
+	var descriptions []string
+	for _, issue := range sve.Issues {
+		descriptions = append(descriptions, issue.String())
+	}
+	return "structural invariant violated: " + strings.Join(descriptions, "; ")
+}
+
+// IsStructuralViolation returns true if the error, or any error it wraps, is a *StructuralViolationError
+func IsStructuralViolation(err error) bool {
+	var sve *StructuralViolationError
+	return errors.As(err, &sve)
+}
+
+// VerifyStructure checks the structural invariants of all of the concepts in the uOfD, returning a
+// *StructuralViolationError describing the violations found. It is intended to be called after bulk loading.
+func VerifyStructure(uOfD *UniverseOfDiscourse, trans *Transaction) error {
+	err := verifyStructure(uOfD, sortedElementIDs(uOfD), trans)
+	if err != nil {
+		return errors.Wrap(err, "VerifyStructure failed")
+	}
+	return nil
+}
+
+// verifyStructure checks the structural invariants of the indicated concepts
+func verifyStructure(uOfD *UniverseOfDiscourse, ids []string, trans *Transaction) error {
+	issues := append(findOwnershipCycles(uOfD, ids, trans), findRefinementIssues(uOfD, ids, trans)...)
+	if len(issues) > 0 {
+		return &StructuralViolationError{Issues: issues}
+	}
+	return nil
+}
+
+// checkOwnershipStructure returns a *StructuralViolationError if making the owner the owner of the concept would make
+// the concept, directly or indirectly, its own owner
+func checkOwnershipStructure(uOfD *UniverseOfDiscourse, conceptID string, ownerID string, trans *Transaction) error {
+	cycleIDs := []string{conceptID}
+	visited := make(map[string]bool)
+	for currentID := ownerID; currentID != "" && !visited[currentID]; {
+		if currentID == conceptID {
+			return &StructuralViolationError{Issues: []Issue{{Kind: OwnershipCycle, ConceptID: conceptID, Attribute: OwningConceptID, TargetID: ownerID, CycleIDs: cycleIDs}}}
+		}
+		visited[currentID] = true
+		cycleIDs = append(cycleIDs, currentID)
+		owner := uOfD.GetElement(currentID)
+		if owner == nil {
+			break
+		}
+		currentID = owner.GetOwningConceptID(trans)
+	}
+	return nil
+}
+
+// checkStructure returns a *StructuralViolationError if adding the concept to its uOfD would violate the structural
+// invariants
+func (cPtr *concept) checkStructure(trans *Transaction) error {
+	err := checkOwnershipStructure(cPtr.uOfD, cPtr.ConceptID, cPtr.OwningConceptID, trans)
+	if err != nil || cPtr.ConceptType != Refinement {
+		return err
+	}
+	return checkRefinementStructure(cPtr.uOfD, cPtr.ConceptID, cPtr.AbstractConceptID, cPtr.RefinedConceptID, NoAttribute, trans)
+}
+
+// checkRefinementStructure returns a *StructuralViolationError if giving the refinement the abstract and refined
+// concepts would make it self-referential or create a refinement cycle. The attribute identifies the pointer being
+// changed, or is NoAttribute if both are.
+func checkRefinementStructure(uOfD *UniverseOfDiscourse, refinementID string, abstractID string, refinedID string, attribute AttributeName, trans *Transaction) error {
+	if issue := refinementSelfReference(refinementID, abstractID, refinedID, attribute); issue != nil {
+		return &StructuralViolationError{Issues: []Issue{*issue}}
+	}
+	if abstractID == "" || refinedID == "" {
+		return nil
+	}
+	path := abstractionPath(uOfD, abstractID, refinedID, refinementID, trans)
+	if path != nil {
+		cycleIDs := append([]string{refinedID}, path[:len(path)-1]...)
+		return &StructuralViolationError{Issues: []Issue{{Kind: RefinementCycle, ConceptID: refinedID, Attribute: AbstractConceptID, TargetID: refinementID, CycleIDs: cycleIDs}}}
+	}
+	return nil
+}
+
+// refinementSelfReference returns the issue if the refinement is its own abstract or refined concept, or has the same
+// abstract and refined concept. Only the pointer identified by the attribute is checked for being the refinement
+// itself, so that the other pointer of a refinement that is already self-referential can still be repaired.
+// NoAttribute checks both.
+func refinementSelfReference(refinementID string, abstractID string, refinedID string, attribute AttributeName) *Issue {
+	for _, pointer := range []struct {
+		attribute AttributeName
+		targetID  string
+	}{{AbstractConceptID, abstractID}, {RefinedConceptID, refinedID}} {
+		if (attribute == NoAttribute || attribute == pointer.attribute) && pointer.targetID != "" && pointer.targetID == refinementID {
+			return &Issue{Kind: SelfReferentialRefinement, ConceptID: refinementID, Attribute: pointer.attribute, TargetID: refinementID}
+		}
+	}
+	if abstractID != "" && abstractID == refinedID {
+		if attribute == NoAttribute {
+			attribute = RefinedConceptID
+		}
+		return &Issue{Kind: SelfReferentialRefinement, ConceptID: refinementID, Attribute: attribute, TargetID: refinedID}
+	}
+	return nil
+}
+
+// abstractionEdge is a refinement of which a concept is the refined concept, together with its abstract concept
+type abstractionEdge struct {
+	refinementID string
+	abstractID   string
+}
+
+// abstractionEdges returns the refinements of which the concept is the refined concept, ordered by refinement ID.
+// Refinements without an abstract concept, or whose abstract concept is also the refined concept, are omitted.
+func abstractionEdges(uOfD *UniverseOfDiscourse, conceptID string, trans *Transaction) []abstractionEdge {
+	var edges []abstractionEdge
+	for listenerID := range uOfD.listenersMap.GetMappedValues(conceptID).Iter() {
+		listener := uOfD.GetElement(listenerID.(string))
+		if listener == nil || listener.GetConceptType() != Refinement || listener.GetRefinedConceptID(trans) != conceptID {
+			continue
+		}
+		abstractID := listener.GetAbstractConceptID(trans)
+		if abstractID == "" || abstractID == conceptID {
+			continue
+		}
+		edges = append(edges, abstractionEdge{refinementID: listenerID.(string), abstractID: abstractID})
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		return edges[i].refinementID < edges[j].refinementID
+	})
+	return edges
+}
+
+// abstractionPath returns the concepts from the one concept to the other following abstractions, ignoring the
+// excluded refinement, or nil if the other concept is not an abstraction of the one
+func abstractionPath(uOfD *UniverseOfDiscourse, fromID string, toID string, excludedRefinementID string, trans *Transaction) []string {
+	visited := make(map[string]bool)
+	var search func(id string) []string
+	search = func(id string) []string {
+		if id == toID {
+			return []string{id}
+		}
+		visited[id] = true
+		for _, edge := range abstractionEdges(uOfD, id, trans) {
+			if edge.refinementID == excludedRefinementID || visited[edge.abstractID] {
+				continue
+			}
+			if path := search(edge.abstractID); path != nil {
+				return append([]string{id}, path...)
+			}
+		}
+		return nil
+	}
+	return search(fromID)
+}
+
+// findRefinementIssues returns an issue for each self-referential refinement among the concepts and for each
+// refinement cycle reachable from them
+func findRefinementIssues(uOfD *UniverseOfDiscourse, ids []string, trans *Transaction) []Issue {
+	var issues []Issue
+	var startIDs []string
+	for _, id := range ids {
+		el := uOfD.GetElement(id)
+		if el == nil {
+			continue
+		}
+		startIDs = append(startIDs, id)
+		if el.GetConceptType() != Refinement {
+			continue
+		}
+		if issue := refinementSelfReference(id, el.GetAbstractConceptID(trans), el.GetRefinedConceptID(trans), NoAttribute); issue != nil {
+			issues = append(issues, *issue)
+		}
+		if refinedID := el.GetRefinedConceptID(trans); refinedID != "" {
+			startIDs = append(startIDs, refinedID)
+		}
+	}
+	return append(issues, findRefinementCycles(uOfD, startIDs, trans)...)
+}
+
+// findRefinementCycles follows the abstractions from each concept and returns an issue for each cycle found
+func findRefinementCycles(uOfD *UniverseOfDiscourse, ids []string, trans *Transaction) []Issue {
+	var issues []Issue
+	found := make(map[string]bool)
+	// finished holds the concepts whose abstractions have been completely followed
+	finished := make(map[string]bool)
+	onPath := make(map[string]int)
+	var path []string
+	var search func(id string)
+	search = func(id string) {
+		onPath[id] = len(path)
+		path = append(path, id)
+		for _, edge := range abstractionEdges(uOfD, id, trans) {
+			if start, isOnPath := onPath[edge.abstractID]; isOnPath {
+				cycle := path[start:]
+				smallest := 0
+				for i, cycleID := range cycle {
+					if cycleID < cycle[smallest] {
+						smallest = i
+					}
+				}
+				cycleIDs := append(append([]string{}, cycle[smallest:]...), cycle[:smallest]...)
+				key := strings.Join(cycleIDs, " ")
+				if !found[key] {
+					found[key] = true
+					issues = append(issues, Issue{Kind: RefinementCycle, ConceptID: cycleIDs[0], Attribute: AbstractConceptID,
+						TargetID: cycleRefinementID(uOfD, cycleIDs, trans), CycleIDs: cycleIDs})
+				}
+			} else if !finished[edge.abstractID] {
+				search(edge.abstractID)
+			}
+		}
+		path = path[:len(path)-1]
+		delete(onPath, id)
+		finished[id] = true
+	}
+	for _, id := range ids {
+		if !finished[id] {
+			search(id)
+		}
+	}
+	return issues
+}
+
+// cycleRefinementID returns the ID of the refinement from the first concept of the cycle to the second
+func cycleRefinementID(uOfD *UniverseOfDiscourse, cycleIDs []string, trans *Transaction) string {
+	for _, edge := range abstractionEdges(uOfD, cycleIDs[0], trans) {
+		if edge.abstractID == cycleIDs[1] {
+			return edge.refinementID
+		}
+	}
+	return ""
+}
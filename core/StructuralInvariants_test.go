@@ -0,0 +1,143 @@
+package core
+
+import (
+	"encoding/json"
+
+	mapset "github.com/deckarep/golang-set"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Structural invariants", func() {
+	var uOfD *UniverseOfDiscourse
+	var trans *Transaction
+	var a, b, c Concept
+
+	BeforeEach(func() {
+		uOfD = NewUniverseOfDiscourse()
+		trans = uOfD.NewTransaction()
+		a, _ = uOfD.NewElement(trans)
+		b, _ = uOfD.NewElement(trans)
+		c, _ = uOfD.NewElement(trans)
+	})
+
+	AfterEach(func() {
+		trans.ReleaseLocks()
+	})
+
+	// newRefinement returns a refinement of the refined concept by the abstract concept
+	newRefinement := func(abstractConcept Concept, refinedConcept Concept) Concept {
+		refinement, err := uOfD.NewRefinement(trans)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(refinement.SetAbstractConcept(abstractConcept, trans)).To(Succeed())
+		Expect(refinement.SetRefinedConcept(refinedConcept, trans)).To(Succeed())
+		return refinement
+	}
+
+	// recoverState adds a concept with the given state to the uOfD with RecoverElement
+	recoverState := func(state *ConceptState) (Concept, error) {
+		data, err := json.Marshal(state)
+		Expect(err).ToNot(HaveOccurred())
+		return uOfD.RecoverElement(data, trans)
+	}
+
+	Describe("Ownership", func() {
+		BeforeEach(func() {
+			Expect(b.SetOwningConcept(a, trans)).To(Succeed())
+			Expect(c.SetOwningConcept(b, trans)).To(Succeed())
+		})
+
+		Specify("Ownership cycles should be rejected", func() {
+			err := a.SetOwningConcept(c, trans)
+			Expect(err).To(HaveOccurred())
+			Expect(IsStructuralViolation(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("ownership cycle"))
+			Expect(a.GetOwningConceptID(trans)).To(Equal(""))
+			Expect(IsStructuralViolation(b.SetOwningConcept(c, trans))).To(BeTrue())
+			Expect(b.GetOwningConcept(trans)).To(Equal(a))
+		})
+
+		Specify("Moving a concept within its owner's tree should be allowed", func() {
+			Expect(c.SetOwningConcept(a, trans)).To(Succeed())
+			Expect(b.SetOwningConcept(c, trans)).To(Succeed())
+			Expect(VerifyStructure(uOfD, trans)).To(Succeed())
+		})
+	})
+
+	Describe("Refinements", func() {
+		Specify("Self-referential refinements should be rejected", func() {
+			refinement, _ := uOfD.NewRefinement(trans)
+			err := refinement.SetAbstractConcept(refinement, trans)
+			Expect(IsStructuralViolation(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("is the refinement itself"))
+			Expect(IsStructuralViolation(refinement.SetRefinedConcept(refinement, trans))).To(BeTrue())
+			Expect(refinement.SetAbstractConcept(a, trans)).To(Succeed())
+			err = refinement.SetRefinedConcept(a, trans)
+			Expect(IsStructuralViolation(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("are both concept"))
+			Expect(refinement.GetRefinedConceptID(trans)).To(Equal(""))
+		})
+
+		Specify("Refinement cycles should be rejected", func() {
+			newRefinement(a, b)
+			newRefinement(b, c)
+			refinement := newRefinement(a, nil)
+			err := refinement.SetRefinedConcept(c, trans)
+			Expect(err).ToNot(HaveOccurred())
+			closing, _ := uOfD.NewRefinement(trans)
+			Expect(closing.SetRefinedConcept(a, trans)).To(Succeed())
+			err = closing.SetAbstractConcept(c, trans)
+			Expect(IsStructuralViolation(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("refinement cycle"))
+			Expect(closing.GetAbstractConceptID(trans)).To(Equal(""))
+			Expect(a.IsRefinementOf(c, trans)).To(BeFalse())
+		})
+
+		Specify("Reversing a refinement should not be mistaken for a cycle", func() {
+			refinement := newRefinement(a, b)
+			Expect(IsStructuralViolation(newRefinement(b, nil).SetRefinedConcept(a, trans))).To(BeTrue())
+			// The refinement's own abstraction is replaced, so it does not form a cycle with the new one
+			_, err := recoverState(&ConceptState{ConceptID: refinement.GetConceptID(trans), ConceptType: "Refinement",
+				AbstractConceptID: b.GetConceptID(trans), RefinedConceptID: a.GetConceptID(trans), ReferencedAttributeName: "NoAttribute"})
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	Describe("Loading", func() {
+		Specify("RecoverElement should reject structural violations", func() {
+			Expect(b.SetOwningConcept(a, trans)).To(Succeed())
+			_, err := recoverState(&ConceptState{ConceptID: a.GetConceptID(trans), ConceptType: "Element", OwningConceptID: b.GetConceptID(trans), ReferencedAttributeName: "NoAttribute"})
+			Expect(IsStructuralViolation(err)).To(BeTrue())
+			Expect(a.GetOwningConceptID(trans)).To(Equal(""))
+			_, err = recoverState(&ConceptState{ConceptID: "refinement", ConceptType: "Refinement", AbstractConceptID: "refinement", ReferencedAttributeName: "NoAttribute"})
+			Expect(IsStructuralViolation(err)).To(BeTrue())
+			Expect(uOfD.GetElement("refinement")).To(BeNil())
+		})
+
+		Specify("Bulk loading should defer the checks to VerifyStructure", func() {
+			uOfD.SetBulkLoading(true)
+			Expect(uOfD.IsBulkLoading()).To(BeTrue())
+			_, err := recoverState(&ConceptState{ConceptID: "owner", ConceptType: "Element", OwningConceptID: "owned", ReferencedAttributeName: "NoAttribute"})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = recoverState(&ConceptState{ConceptID: "owned", ConceptType: "Element", OwningConceptID: "owner", ReferencedAttributeName: "NoAttribute"})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = recoverState(&ConceptState{ConceptID: "r1", ConceptType: "Refinement", AbstractConceptID: a.GetConceptID(trans), RefinedConceptID: b.GetConceptID(trans), ReferencedAttributeName: "NoAttribute"})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = recoverState(&ConceptState{ConceptID: "r2", ConceptType: "Refinement", AbstractConceptID: b.GetConceptID(trans), RefinedConceptID: a.GetConceptID(trans), ReferencedAttributeName: "NoAttribute"})
+			Expect(err).ToNot(HaveOccurred())
+			uOfD.SetBulkLoading(false)
+			err = VerifyStructure(uOfD, trans)
+			Expect(IsStructuralViolation(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("ownership cycle owned -> owner -> owned"))
+			Expect(err.Error()).To(ContainSubstring("refinement cycle"))
+			// The walks through abstractions and owned concepts must still terminate
+			abstractions := make(map[string]Concept)
+			a.FindAbstractions(abstractions, trans)
+			Expect(abstractions).To(HaveKey(b.GetConceptID(trans)))
+			descendants := mapset.NewSet()
+			uOfD.GetConceptsOwnedConceptIDsRecursively("owner", descendants, trans)
+			Expect(descendants.Contains("owned")).To(BeTrue())
+		})
+	})
+})
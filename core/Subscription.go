@@ -0,0 +1,273 @@
+// Copyright 2017, 2018 Paul C. Brown. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChangeEvent describes a single committed change. Added concepts have only an AfterState; removed concepts have
+// only a BeforeState.
+type ChangeEvent struct {
+	NatureOfChange NatureOfChange
+	ConceptID      string
+	ConceptType    ConceptType
+	BeforeState    *ConceptState
+	AfterState     *ConceptState
+	Timestamp      time.Time
+}
+
+// newChangeEvent creates a ChangeEvent time-stamped with the current time
+func newChangeEvent(natureOfChange NatureOfChange, beforeState *ConceptState, afterState *ConceptState) *ChangeEvent {
+	var event ChangeEvent
+	event.Timestamp = time.Now()
+	event.NatureOfChange = natureOfChange
+	event.BeforeState = beforeState
+	event.AfterState = afterState
+	state := event.getState()
+	if state != nil {
+		event.ConceptID = state.ConceptID
+		event.ConceptType, _ = StringToConceptType(state.ConceptType)
+	}
+	return &event
+}
+
+// getState returns the after state of the concept if there is one and the before state otherwise
+func (event *ChangeEvent) getState() *ConceptState {
+	if event.AfterState != nil {
+		return event.AfterState
+	}
+	return event.BeforeState
+}
+
+// SubscriptionFilter selects the ChangeEvents delivered to a subscription. Each criterion that is set must be
+// satisfied; an empty filter matches every event.
+type SubscriptionFilter struct {
+	// NaturesOfChange, if not empty, lists the natures of change of interest
+	NaturesOfChange []NatureOfChange
+	// ConceptTypes, if not empty, lists the types of the changed concepts of interest
+	ConceptTypes []ConceptType
+	// URIPrefix, if not empty, is a prefix of the URIs of the changed concepts of interest
+	URIPrefix string
+	// SubtreeRootID, if not empty, is the ID of a concept. Only changes to that concept and the concepts it
+	// (recursively) owns are of interest
+	SubtreeRootID string
+	// AbstractionURI, if not empty, is the URI of an abstraction. Only changes to refinements of that abstraction
+	// are of interest
+	AbstractionURI string
+}
+
+// matches determines whether the event satisfies the filter. The transaction is used to read the concepts needed to
+// evaluate the subtree and abstraction criteria.
+func (filter *SubscriptionFilter) matches(event *ChangeEvent, uOfD *UniverseOfDiscourse, trans *Transaction) bool {
+	if len(filter.NaturesOfChange) > 0 {
+		found := false
+		for _, natureOfChange := range filter.NaturesOfChange {
+			if natureOfChange == event.NatureOfChange {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(filter.ConceptTypes) > 0 {
+		found := false
+		for _, conceptType := range filter.ConceptTypes {
+			if conceptType == event.ConceptType {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	state := event.getState()
+	if filter.URIPrefix != "" && (state == nil || !strings.HasPrefix(state.URI, filter.URIPrefix)) {
+		return false
+	}
+	if filter.SubtreeRootID != "" {
+		if state == nil || !filter.isInSubtree(state, uOfD, trans) {
+			return false
+		}
+	}
+	if filter.AbstractionURI != "" {
+		el := uOfD.GetElement(event.ConceptID)
+		if el == nil || !el.IsRefinementOfURI(filter.AbstractionURI, trans) {
+			return false
+		}
+	}
+	return true
+}
+
+// isInSubtree determines whether the concept is the subtree root or one of its descendants. The owner recorded in
+// the state is used first so that concepts that have been removed are still located.
+func (filter *SubscriptionFilter) isInSubtree(state *ConceptState, uOfD *UniverseOfDiscourse, trans *Transaction) bool {
+	if state.ConceptID == filter.SubtreeRootID {
+		return true
+	}
+	visited := make(map[string]bool)
+	ownerID := state.OwningConceptID
+	for ownerID != "" && !visited[ownerID] {
+		if ownerID == filter.SubtreeRootID {
+			return true
+		}
+		visited[ownerID] = true
+		owner := uOfD.GetElement(ownerID)
+		if owner == nil {
+			return false
+		}
+		ownerID = owner.GetOwningConceptID(trans)
+	}
+	return false
+}
+
+// subscription holds the events matched for a subscriber until they can be delivered. The queue is unbounded so
+// that a slow consumer never blocks the transaction delivering the events.
+type subscription struct {
+	sync.Mutex
+	filter  SubscriptionFilter
+	queue   []ChangeEvent
+	pending chan struct{}
+	done    chan struct{}
+	events  chan ChangeEvent
+}
+
+func newSubscription(filter SubscriptionFilter) *subscription {
+	var sub subscription
+	sub.filter = filter
+	sub.pending = make(chan struct{}, 1)
+	sub.done = make(chan struct{})
+	sub.events = make(chan ChangeEvent)
+	return &sub
+}
+
+// enqueue adds the events to the queue and wakes the delivery goroutine
+func (sub *subscription) enqueue(events []*ChangeEvent) {
+	sub.Lock()
+	for _, event := range events {
+		sub.queue = append(sub.queue, *event)
+	}
+	sub.Unlock()
+	select {
+	case sub.pending <- struct{}{}:
+	default:
+	}
+}
+
+// deliver sends queued events to the subscriber in order until the subscription is cancelled, at which point the
+// events channel is closed
+func (sub *subscription) deliver() {
+	defer close(sub.events)
+	for {
+		sub.Lock()
+		if len(sub.queue) == 0 {
+			sub.Unlock()
+			select {
+			case <-sub.pending:
+				continue
+			case <-sub.done:
+				return
+			}
+		}
+		event := sub.queue[0]
+		sub.queue = sub.queue[1:]
+		sub.Unlock()
+		select {
+		case sub.events <- event:
+		case <-sub.done:
+			return
+		}
+	}
+}
+
+// subscriptionRegistry holds the subscriptions of a UniverseOfDiscourse
+type subscriptionRegistry struct {
+	sync.RWMutex
+	subscriptions map[*subscription]bool
+}
+
+func newSubscriptionRegistry() *subscriptionRegistry {
+	var registry subscriptionRegistry
+	registry.subscriptions = make(map[*subscription]bool)
+	return &registry
+}
+
+func (registry *subscriptionRegistry) add(sub *subscription) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.subscriptions[sub] = true
+}
+
+func (registry *subscriptionRegistry) hasSubscriptions() bool {
+	registry.RLock()
+	defer registry.RUnlock()
+	return len(registry.subscriptions) > 0
+}
+
+func (registry *subscriptionRegistry) remove(sub *subscription) {
+	registry.Lock()
+	defer registry.Unlock()
+	delete(registry.subscriptions, sub)
+}
+
+// pendingDelivery holds the events matched for a subscription by a transaction
+type pendingDelivery struct {
+	sub    *subscription
+	events []*ChangeEvent
+}
+
+// match determines which events are of interest to each subscription
+func (registry *subscriptionRegistry) match(events []*ChangeEvent, trans *Transaction) []*pendingDelivery {
+	registry.RLock()
+	var subs []*subscription
+	for sub := range registry.subscriptions {
+		subs = append(subs, sub)
+	}
+	registry.RUnlock()
+	var deliveries []*pendingDelivery
+	for _, sub := range subs {
+		var matched []*ChangeEvent
+		for _, event := range events {
+			if sub.filter.matches(event, trans.uOfD, trans) {
+				matched = append(matched, event)
+			}
+		}
+		if len(matched) > 0 {
+			deliveries = append(deliveries, &pendingDelivery{sub: sub, events: matched})
+		}
+	}
+	return deliveries
+}
+
+// deliverEvents queues the matched events for delivery to their subscribers
+func deliverEvents(deliveries []*pendingDelivery) {
+	for _, delivery := range deliveries {
+		delivery.sub.enqueue(delivery.events)
+	}
+}
+
+// Subscribe returns a channel on which the committed changes satisfying the filter are delivered, along with a
+// function that cancels the subscription. Events are delivered asynchronously, in the order in which they were
+// committed, after the transaction making the changes has released its locks. Events are queued for the subscriber
+// so that a slow consumer never delays the transaction. Cancelling the subscription discards any undelivered events
+// and closes the channel.
+func (uOfDPtr *UniverseOfDiscourse) Subscribe(filter SubscriptionFilter) (<-chan ChangeEvent, func()) {
+	sub := newSubscription(filter)
+	uOfDPtr.subscriptions.add(sub)
+	go sub.deliver()
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			uOfDPtr.subscriptions.remove(sub)
+			close(sub.done)
+		})
+	}
+	return sub.events, cancel
+}
@@ -0,0 +1,128 @@
+package core
+
+import (
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Subscription tests", func() {
+	var uOfD *UniverseOfDiscourse
+	var trans *Transaction
+	var domain Concept
+	var child Concept
+	var other Concept
+	var abstraction Concept
+
+	BeforeEach(func() {
+		uOfD = NewUniverseOfDiscourse()
+		trans = uOfD.NewTransaction()
+		domain, _ = uOfD.NewElement(trans, "http://activeCrl.com/test/SubscriptionDomain")
+		domain.SetLabel("SubscriptionDomain", trans)
+		child, _ = uOfD.NewOwnedElement(domain, "Child", trans, "http://activeCrl.com/test/SubscriptionDomain/Child")
+		other, _ = uOfD.NewElement(trans)
+		abstraction, _ = uOfD.NewOwnedElement(domain, "Abstraction", trans, "http://activeCrl.com/test/SubscriptionDomain/Abstraction")
+		uOfD.NewOwnedRefinement(child, "Refinement", abstraction, child, trans)
+		trans.Commit()
+	})
+
+	AfterEach(func() {
+		trans.ReleaseLocks()
+	})
+
+	receiveLabels := func(events <-chan ChangeEvent, count int) []string {
+		var labels []string
+		for i := 0; i < count; i++ {
+			var event ChangeEvent
+			Eventually(events).Should(Receive(&event))
+			labels = append(labels, event.AfterState.Label)
+		}
+		return labels
+	}
+
+	Specify("Events should only be delivered after the transaction releases its locks", func() {
+		events, cancel := uOfD.Subscribe(SubscriptionFilter{})
+		defer cancel()
+		child.SetLabel("Changed", trans)
+		Consistently(events, 20*time.Millisecond).ShouldNot(Receive())
+		trans.Commit()
+		var event ChangeEvent
+		Eventually(events).Should(Receive(&event))
+		Expect(event.NatureOfChange).To(Equal(ConceptChanged))
+		Expect(event.ConceptID).To(Equal(child.getConceptIDNoLock()))
+		Expect(event.ConceptType).To(Equal(Element))
+		Expect(event.BeforeState.Label).To(Equal("Child"))
+		Expect(event.AfterState.Label).To(Equal("Changed"))
+	})
+
+	Specify("Rolled back changes should not be delivered", func() {
+		events, cancel := uOfD.Subscribe(SubscriptionFilter{})
+		defer cancel()
+		child.SetLabel("Changed", trans)
+		trans.Rollback()
+		Consistently(events, 20*time.Millisecond).ShouldNot(Receive())
+	})
+
+	Specify("Nature of change, concept type, and URI prefix filters should select events", func() {
+		events, cancel := uOfD.Subscribe(SubscriptionFilter{
+			NaturesOfChange: []NatureOfChange{ConceptChanged},
+			ConceptTypes:    []ConceptType{Element},
+			URIPrefix:       "http://activeCrl.com/test/SubscriptionDomain/",
+		})
+		defer cancel()
+		domain.SetLabel("Not matched: URI", trans)
+		other.SetLabel("Not matched: no URI", trans)
+		uOfD.NewOwnedLiteral(domain, "Not matched: type", trans, "http://activeCrl.com/test/SubscriptionDomain/Literal")
+		child.SetOwningConcept(other, trans)
+		child.SetLabel("Matched", trans)
+		trans.Commit()
+		Expect(receiveLabels(events, 1)).To(Equal([]string{"Matched"}))
+		Consistently(events, 20*time.Millisecond).ShouldNot(Receive())
+	})
+
+	Specify("Subtree filters should select changes to the root and its descendants", func() {
+		events, cancel := uOfD.Subscribe(SubscriptionFilter{SubtreeRootID: domain.getConceptIDNoLock(), NaturesOfChange: []NatureOfChange{ConceptChanged}})
+		defer cancel()
+		other.SetLabel("Outside", trans)
+		domain.SetLabel("Root", trans)
+		child.SetLabel("Descendant", trans)
+		trans.Commit()
+		Expect(receiveLabels(events, 2)).To(Equal([]string{"Root", "Descendant"}))
+		Consistently(events, 20*time.Millisecond).ShouldNot(Receive())
+	})
+
+	Specify("Abstraction filters should select changes to refinements of the abstraction", func() {
+		events, cancel := uOfD.Subscribe(SubscriptionFilter{AbstractionURI: "http://activeCrl.com/test/SubscriptionDomain/Abstraction"})
+		defer cancel()
+		other.SetLabel("Not a refinement", trans)
+		child.SetLabel("Refinement", trans)
+		trans.Commit()
+		Expect(receiveLabels(events, 1)).To(Equal([]string{"Refinement"}))
+		Consistently(events, 20*time.Millisecond).ShouldNot(Receive())
+	})
+
+	Specify("A slow consumer should not block transactions", func() {
+		events, cancel := uOfD.Subscribe(SubscriptionFilter{NaturesOfChange: []NatureOfChange{ConceptChanged}})
+		defer cancel()
+		for i := 0; i < 100; i++ {
+			other.SetDefinition(strconv.Itoa(i), trans)
+			trans.Commit()
+		}
+		count := 0
+		for count < 100 {
+			Eventually(events).Should(Receive())
+			count++
+		}
+	})
+
+	Specify("Cancelling a subscription should close the channel and stop recording", func() {
+		events, cancel := uOfD.Subscribe(SubscriptionFilter{})
+		Expect(uOfD.isRecordingChanges()).To(BeTrue())
+		cancel()
+		Eventually(events).Should(BeClosed())
+		Expect(uOfD.isRecordingChanges()).To(BeFalse())
+		cancel()
+	})
+})
@@ -5,6 +5,8 @@
 package core
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"sync"
 
@@ -16,11 +18,154 @@ import (
 // suppression of circular function calls.
 type Transaction struct {
 	sync.Mutex
-	readLocks  map[string]Concept
+	// ctx bounds the time the transaction will wait to acquire a lock
+	ctx context.Context
+	// sequence orders transactions by age: younger transactions have larger sequence numbers
+	sequence uint64
+	// failure is the reason a lock could not be acquired. It is cleared when the transaction is rolled back.
+	failure   error
+	readLocks map[string]Concept
+	// acquiring holds, for each concept whose lock is being acquired, a channel closed once the attempt is complete
+	acquiring  map[string]chan struct{}
 	uOfD       *UniverseOfDiscourse
 	writeLocks map[string]Concept
 	// The key to inProgressCalls is the catenation of the functionID and the target element ID
 	inProgressCalls map[string]bool
+	// executingAsync is true if the transaction is executing a function call on behalf of a functionCallPool
+	executingAsync bool
+	// pendingFunctionCalls are the calls to be submitted to the uOfD's functionCallPool when the locks are released
+	pendingFunctionCalls []*functionCallRecord
+	// changeEvents are the changes to be journaled and delivered to subscribers when the locks are released
+	changeEvents []*ChangeEvent
+	// rollbackStack records the prior state of each concept as it is created, changed, or deleted in the transaction
+	rollbackStack undoStack
+}
+
+// transactionSequence is the sequence number of the most recently created Transaction
+var transactionSequence uint64
+
+// acquireLock obtains the read or write lock on the element. If the lock is not immediately available the transaction
+// waits until it is, until the transaction's context is done, or until the transaction is chosen as the victim of
+// a deadlock. The caller must not hold the transaction's mutex, so that the transaction remains usable while it waits.
+func (transPtr *Transaction) acquireLock(el Concept, write bool) error {
+	tryLock, lock, unlock := el.traceableTryReadLock, el.TraceableReadLock, el.TraceableReadUnlock
+	if write {
+		tryLock, lock, unlock = el.traceableTryWriteLock, el.TraceableWriteLock, el.TraceableWriteUnlock
+	}
+	if tryLock(transPtr) {
+		lockWaitForGraph.acquired(transPtr, el)
+		return nil
+	}
+	if transPtr.ctx.Err() != nil {
+		return transPtr.contextError(el)
+	}
+	abort, err := lockWaitForGraph.startWaiting(transPtr, el)
+	if err != nil {
+		return err
+	}
+	defer lockWaitForGraph.stopWaiting(transPtr)
+	// The lock is requested by a separate goroutine so that the wait can be abandoned. Waiting in the lock itself
+	// queues a writer ahead of later readers, so a writer cannot be starved. A lock obtained after the wait has been
+	// abandoned is released immediately.
+	acquired := make(chan struct{})
+	abandoned := make(chan struct{})
+	go func() {
+		lock(transPtr)
+		select {
+		case acquired <- struct{}{}:
+		case <-abandoned:
+			unlock(transPtr)
+		}
+	}()
+	select {
+	case <-acquired:
+		lockWaitForGraph.acquired(transPtr, el)
+		return nil
+	case <-transPtr.ctx.Done():
+		close(abandoned)
+		return transPtr.contextError(el)
+	case <-abort:
+		close(abandoned)
+		return lockWaitForGraph.getFailure(transPtr)
+	}
+}
+
+// contextError returns the error reported when the transaction's context is done before the lock on the element
+// is obtained
+func (transPtr *Transaction) contextError(el Concept) error {
+	err := errors.Wrapf(transPtr.ctx.Err(), "Transaction %d failed waiting for lock on concept %q (%s)", transPtr.sequence, el.getLabelNoLock(), el.getConceptIDNoLock())
+	if TraceLocks {
+		log.Print(err.Error())
+	}
+	return err
+}
+
+// lockElement records the read or write lock on the element, acquiring it if the transaction does not already hold
+// it. A read lock held when a write lock is requested is upgraded: it is released before the write lock is acquired,
+// and if another transaction changes the element in between, the upgrade fails the transaction with a
+// *VersionConflictError. Once the transaction has failed no further locks are acquired and no write locks are
+// granted, so that the failed transaction can make no further changes.
+func (transPtr *Transaction) lockElement(el Concept, write bool) error {
+	transPtr.Lock()
+	defer transPtr.Unlock()
+	id := el.getConceptIDNoLock()
+	upgrading := false
+	var readVersion int
+	for {
+		_, writeLocked := transPtr.writeLocks[id]
+		_, readLocked := transPtr.readLocks[id]
+		err := transPtr.errNoLock()
+		switch {
+		case err != nil && (write || !(readLocked || writeLocked)):
+			return errors.Wrapf(err, "Transaction %d has failed", transPtr.sequence)
+		case writeLocked || (readLocked && !write):
+			return nil
+		case readLocked:
+			// The read lock cannot be converted in place, so another transaction may lock the element before the
+			// write lock is obtained. The version read now shows whether it has changed the element.
+			upgrading = true
+			readVersion = el.getVersionNoLock()
+			delete(transPtr.readLocks, id)
+			lockWaitForGraph.releasedConcept(transPtr, el)
+			el.TraceableReadUnlock(transPtr)
+			continue
+		}
+		// Another goroutine using the transaction may already be acquiring the lock
+		acquiring, found := transPtr.acquiring[id]
+		if !found {
+			break
+		}
+		transPtr.Unlock()
+		<-acquiring
+		transPtr.Lock()
+	}
+	acquiring := make(chan struct{})
+	transPtr.acquiring[id] = acquiring
+	transPtr.Unlock()
+	err := transPtr.acquireLock(el, write)
+	transPtr.Lock()
+	delete(transPtr.acquiring, id)
+	close(acquiring)
+	if err != nil {
+		transPtr.failure = errors.Cause(err)
+		return err
+	}
+	if upgrading {
+		err = checkVersion(el, readVersion)
+		if err != nil {
+			// What the transaction read from the element is out of date
+			lockWaitForGraph.releasedConcept(transPtr, el)
+			el.TraceableWriteUnlock(transPtr)
+			transPtr.failure = err
+			return errors.Wrapf(err, "Transaction %d failed upgrading its read lock", transPtr.sequence)
+		}
+	}
+	if write {
+		transPtr.writeLocks[id] = el
+	} else {
+		transPtr.readLocks[id] = el
+	}
+	return nil
 }
 
 // callFunction calls the referenced function on the target element
@@ -48,7 +193,13 @@ func (transPtr *Transaction) callFunctions(functionID string, targetElement Conc
 		}
 		inProgressKey := functionID + targetID
 		_, inProgress := transPtr.inProgressCalls[inProgressKey]
-		if !inProgress {
+		if !inProgress && transPtr.uOfD.getFunctionCallPool() != nil {
+			functionCallRecord, err := newFunctionCallRecord(functionID, function, targetElement, notification)
+			if err != nil {
+				return errors.Wrap(err, "Transaction.callFunctions failed to queue functionCallRecord")
+			}
+			transPtr.pendingFunctionCalls = append(transPtr.pendingFunctionCalls, functionCallRecord)
+		} else if !inProgress {
 			transPtr.inProgressCalls[inProgressKey] = true
 			err := function(targetElement, notification, transPtr)
 			if err != nil {
@@ -61,55 +212,190 @@ func (transPtr *Transaction) callFunctions(functionID string, targetElement Conc
 	return nil
 }
 
+// Commit accepts all of the changes made in the transaction, writes them to the uOfD's ChangeJournal (if any), and
+// releases all currently held locks. After Commit the changes can no longer be rolled back. A failed transaction
+// (see Err) cannot be committed: it is rolled back instead, and the error returned reports the failure.
+func (transPtr *Transaction) Commit() error {
+	err := transPtr.Err()
+	if err != nil {
+		transPtr.Rollback()
+		return errors.Wrapf(err, "Transaction.Commit rolled back failed transaction %d", transPtr.sequence)
+	}
+	transPtr.releaseLocks()
+	return nil
+}
+
 // GetUniverseOfDiscourse returns the UniverseOfDiscourse to which this HeldLocks belongs
 func (transPtr *Transaction) GetUniverseOfDiscourse() *UniverseOfDiscourse {
 	return transPtr.uOfD
 }
 
-// ReadLockElement checks to see whether this HeldLocks structure already has a record of the Element being
-// locked, either read or write. If it does, it simply returns. If not, it attempts to acquire the read on the Element and makes
-// a record of the fact that the read lock has been obtained.
-func (transPtr *Transaction) ReadLockElement(el Concept) {
+// VersionConflictError is returned when a concept has been changed since the caller read it
+type VersionConflictError struct {
+	ConceptID       string
+	Label           string
+	ExpectedVersion int
+	ActualVersion   int
+}
+
+func (vce *VersionConflictError) Error() string {
+	return fmt.Sprintf("Version conflict on concept %q (%s): expected version %d but found version %d", vce.Label, vce.ConceptID, vce.ExpectedVersion, vce.ActualVersion)
+}
+
+// IsVersionConflict returns true if the error, or any error it wraps, is a *VersionConflictError
+func IsVersionConflict(err error) bool {
+	var vce *VersionConflictError
+	return errors.As(err, &vce)
+}
+
+// ExpectVersion verifies that the version of the concept is the expected version, read locking the concept if the
+// transaction holds no lock on it. If the concept has changed since the caller read the version, a
+// *VersionConflictError is returned. The check does not write lock the concept, so it can follow reads of the concept
+// made with this transaction. Should another transaction change the concept while the read lock is upgraded to the
+// write lock needed for a change, the upgrade fails the transaction (see WriteLockElement).
+func (transPtr *Transaction) ExpectVersion(el Concept, version int) error {
+	err := transPtr.ReadLockElement(el)
+	if err != nil {
+		return errors.Wrap(err, "Transaction.ExpectVersion failed")
+	}
+	return checkVersion(el, version)
+}
+
+// writeLockIfVersion write locks the concept provided its version is the expected version. A change made by another
+// transaction while the read lock taken for the check is upgraded fails the transaction with a *VersionConflictError.
+func (transPtr *Transaction) writeLockIfVersion(el Concept, version int) error {
+	err := transPtr.ExpectVersion(el, version)
+	if err != nil {
+		return err
+	}
+	err = transPtr.WriteLockElement(el)
+	if err != nil {
+		return errors.Wrap(err, "Transaction.writeLockIfVersion failed")
+	}
+	return nil
+}
+
+// checkVersion returns a *VersionConflictError if the version of the locked concept is not the expected version
+func checkVersion(el Concept, version int) error {
+	actualVersion := el.getVersionNoLock()
+	if actualVersion != version {
+		return &VersionConflictError{
+			ConceptID:       el.getConceptIDNoLock(),
+			Label:           el.getLabelNoLock(),
+			ExpectedVersion: version,
+			ActualVersion:   actualVersion,
+		}
+	}
+	return nil
+}
+
+// Err returns the reason the transaction has failed, if it has. A transaction fails when a lock cannot be acquired
+// because the transaction's context is done or the transaction has been chosen as the victim of a deadlock, and when
+// another transaction changes a concept while its read lock is upgraded to a write lock. A failed transaction acquires
+// no further locks and makes no further changes; the changes it has already made are rolled back when its locks are
+// released. Err is cleared once the transaction has been rolled back.
+func (transPtr *Transaction) Err() error {
 	transPtr.Lock()
 	defer transPtr.Unlock()
-	id := el.getConceptIDNoLock()
-	_, writeLocked := transPtr.writeLocks[id]
-	if writeLocked {
-		return
+	return transPtr.errNoLock()
+}
+
+// errNoLock returns the reason the transaction has failed, if it has. The caller is expected to hold the
+// transaction's mutex.
+func (transPtr *Transaction) errNoLock() error {
+	if transPtr.failure != nil {
+		return transPtr.failure
 	}
-	_, readLocked := transPtr.readLocks[id]
-	if !readLocked {
-		el.TraceableReadLock(transPtr)
-		transPtr.readLocks[id] = el
+	// The transaction may have been chosen as the victim of a deadlock just as it obtained the lock it was waiting for
+	return lockWaitForGraph.getFailure(transPtr)
+}
+
+// ReadLockElement checks to see whether this HeldLocks structure already has a record of the Element being
+// locked, either read or write. If it does, it simply returns. If not, it attempts to acquire the read on the Element and makes
+// a record of the fact that the read lock has been obtained. An error is returned if the lock cannot be acquired
+// because the transaction has failed (see Err). Callers that cannot return the error, such as the getters of
+// Concept, return the zero value instead of reading the Element without the lock.
+func (transPtr *Transaction) ReadLockElement(el Concept) error {
+	err := transPtr.lockElement(el, false)
+	if err != nil {
+		return errors.Wrap(err, "Transaction.ReadLockElement failed")
 	}
+	return nil
 }
 
 // WriteLockElement checks to see whether this HeldLocks structure already has a record of the Element being
 // write locked. If it does, it simply returns. If not, it attempts to acquire the write lock on the Element and makes
-// a record of the fact that the lock has been obtained.
+// a record of the fact that the lock has been obtained. A read lock held on the Element is released first, so another
+// transaction may change the Element between the two locks; if it does, what this transaction has read is out of
+// date, and the transaction fails with a *VersionConflictError. An error is returned if the transaction has failed
+// (see Err), in which case the Element must not be changed.
 func (transPtr *Transaction) WriteLockElement(el Concept) error {
-	transPtr.Lock()
-	defer transPtr.Unlock()
-	id := el.getConceptIDNoLock()
-	_, readLocked := transPtr.readLocks[id]
-	if readLocked {
-		return errors.New("Write lock attempted on Element with read lock: " + id)
-	}
-	_, writeLocked := transPtr.writeLocks[id]
-	if !writeLocked {
-		el.TraceableWriteLock(transPtr)
-		transPtr.writeLocks[id] = el
+	err := transPtr.lockElement(el, true)
+	if err != nil {
+		return errors.Wrap(err, "Transaction.WriteLockElement failed")
 	}
 	return nil
 }
 
-// ReleaseLocks releases all pending functions for execution (asynchronously) and releases all currently held locks
+// ReleaseLocks releases all pending functions for execution (asynchronously) and releases all currently held locks.
+// Once the locks are released other transactions may modify the concepts, so the record of changes used by
+// Rollback is discarded as well. If the transaction has failed (see Err), it is rolled back instead.
 func (transPtr *Transaction) ReleaseLocks() {
+	if transPtr.Err() != nil {
+		transPtr.Rollback()
+		return
+	}
+	transPtr.releaseLocks()
+}
+
+// releaseLocks submits the pending function calls, delivers the change events, and releases all currently held locks
+func (transPtr *Transaction) releaseLocks() {
+	transPtr.uOfD.undoManager.discardRollback(transPtr)
+	transPtr.Lock()
+	events := transPtr.changeEvents
+	transPtr.changeEvents = nil
+	calls := transPtr.pendingFunctionCalls
+	transPtr.pendingFunctionCalls = nil
+	transPtr.Unlock()
+	// Function calls are submitted once the locks have been released so that a transaction blocked by a full queue
+	// never holds locks needed by the functions draining the queue
+	pool := transPtr.uOfD.getFunctionCallPool()
+	if pool != nil && len(calls) > 0 {
+		defer pool.submit(calls, transPtr.executingAsync)
+	}
+	// Subscriptions are matched while the locks are still held, but the events are only delivered once the
+	// locks have been released
+	var deliveries []*pendingDelivery
+	if len(events) > 0 {
+		deliveries = transPtr.uOfD.subscriptions.match(events, transPtr)
+		defer deliverEvents(deliveries)
+	}
+	journal := transPtr.uOfD.journal
+	var journaled []*ChangeEvent
+	if journal != nil && len(events) > 0 {
+		journaled = transPtr.uOfD.journaledEvents(journal, events, transPtr)
+	}
 	transPtr.Lock()
 	defer transPtr.Unlock()
 	if TraceLocks {
 		log.Printf("HL %p about to ReleaseLocks", transPtr)
 	}
+	// The journal is written before the locks are released so that entries for the same concept appear in the
+	// order in which the changes were made
+	if len(journaled) > 0 {
+		err := journal.appendEvents(journaled)
+		if err != nil {
+			log.Printf("Transaction.ReleaseLocks failed to write the change journal: %s", err.Error())
+		}
+	}
+	var released []Concept
+	for _, el := range transPtr.readLocks {
+		released = append(released, el)
+	}
+	for _, el := range transPtr.writeLocks {
+		released = append(released, el)
+	}
+	lockWaitForGraph.released(transPtr, released)
 	for _, el := range transPtr.readLocks {
 		el.TraceableReadUnlock(transPtr)
 		delete(transPtr.readLocks, el.getConceptIDNoLock())
@@ -119,3 +405,69 @@ func (transPtr *Transaction) ReleaseLocks() {
 		delete(transPtr.writeLocks, el.getConceptIDNoLock())
 	}
 }
+
+// Rollback restores every concept created, changed, or deleted in the transaction to its state prior to the
+// transaction and then releases all currently held locks. It works whether or not undo is being recorded. As with
+// Undo, no change notifications are sent for the restoration. Rollback also clears the failure of a failed
+// transaction: the concepts it restores are those the transaction has locked, so they can be restored even though
+// the transaction could not acquire further locks.
+func (transPtr *Transaction) Rollback() {
+	transPtr.Lock()
+	transPtr.failure = nil
+	transPtr.Unlock()
+	lockWaitForGraph.clearFailure(transPtr)
+	transPtr.uOfD.undoManager.rollback(transPtr)
+	transPtr.Lock()
+	transPtr.changeEvents = nil
+	transPtr.pendingFunctionCalls = nil
+	transPtr.Unlock()
+	transPtr.releaseLocks()
+}
+
+// Savepoint marks a point within a transaction to which the changes made in the transaction can be rolled back
+type Savepoint struct {
+	trans                *Transaction
+	rollbackDepth        int
+	changeEvents         int
+	pendingFunctionCalls int
+}
+
+// Savepoint returns a Savepoint marking the current point in the transaction. The savepoint is valid until the
+// transaction releases its locks.
+func (transPtr *Transaction) Savepoint() *Savepoint {
+	transPtr.uOfD.undoManager.TraceableLock()
+	rollbackDepth := len(transPtr.rollbackStack)
+	transPtr.uOfD.undoManager.TraceableUnlock()
+	transPtr.Lock()
+	defer transPtr.Unlock()
+	return &Savepoint{
+		trans:                transPtr,
+		rollbackDepth:        rollbackDepth,
+		changeEvents:         len(transPtr.changeEvents),
+		pendingFunctionCalls: len(transPtr.pendingFunctionCalls)}
+}
+
+// RollbackToSavepoint restores every concept created, changed, or deleted in the transaction since the savepoint was
+// taken to its state at the savepoint. Unlike Rollback, the locks are retained and the transaction can continue to be
+// used. As with Rollback, no change notifications are sent for the restoration.
+func (transPtr *Transaction) RollbackToSavepoint(savepoint *Savepoint) error {
+	if savepoint == nil || savepoint.trans != transPtr {
+		return errors.New("Transaction.RollbackToSavepoint called with a savepoint from another transaction")
+	}
+	transPtr.uOfD.undoManager.TraceableLock()
+	valid := len(transPtr.rollbackStack) >= savepoint.rollbackDepth
+	transPtr.uOfD.undoManager.TraceableUnlock()
+	if !valid {
+		return errors.New("Transaction.RollbackToSavepoint called with a savepoint that is no longer valid")
+	}
+	transPtr.uOfD.undoManager.rollbackTo(transPtr, savepoint.rollbackDepth)
+	transPtr.Lock()
+	defer transPtr.Unlock()
+	if len(transPtr.changeEvents) > savepoint.changeEvents {
+		transPtr.changeEvents = transPtr.changeEvents[:savepoint.changeEvents]
+	}
+	if len(transPtr.pendingFunctionCalls) > savepoint.pendingFunctionCalls {
+		transPtr.pendingFunctionCalls = transPtr.pendingFunctionCalls[:savepoint.pendingFunctionCalls]
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Transaction tests", func() {
+	var uOfD *UniverseOfDiscourse
+	var trans *Transaction
+	var owner Concept
+	var child Concept
+	var target Concept
+	var ref Concept
+
+	BeforeEach(func() {
+		uOfD = NewUniverseOfDiscourse()
+		trans = uOfD.NewTransaction()
+		owner, _ = uOfD.NewElement(trans)
+		owner.SetLabel("Owner", trans)
+		child, _ = uOfD.NewOwnedElement(owner, "Child", trans, "http://activeCrl.com/test/TransactionChild")
+		target, _ = uOfD.NewElement(trans)
+		ref, _ = uOfD.NewOwnedReference(owner, "Ref", trans)
+		ref.SetReferencedConcept(target, NoAttribute, trans)
+		trans.Commit()
+		trans = uOfD.NewTransaction()
+	})
+
+	AfterEach(func() {
+		trans.ReleaseLocks()
+	})
+
+	Describe("Rollback", func() {
+		testRollback := func() {
+			originalUofD := uOfD.Clone(trans)
+			originalTrans := originalUofD.NewTransaction()
+			defer originalTrans.ReleaseLocks()
+
+			Expect(owner.SetLabel("Changed", trans)).To(Succeed())
+			Expect(child.SetURI("http://activeCrl.com/test/TransactionChildChanged", trans)).To(Succeed())
+			Expect(child.SetOwningConcept(target, trans)).To(Succeed())
+			newElement, _ := uOfD.NewOwnedElement(owner, "New", trans)
+			newID := newElement.getConceptIDNoLock()
+			Expect(uOfD.DeleteElement(target, trans)).To(Succeed())
+			Expect(uOfD.GetElement(target.getConceptIDNoLock())).To(BeNil())
+
+			trans.Rollback()
+
+			Expect(uOfD.GetElement(newID)).To(BeNil())
+			Expect(uOfD.GetElement(target.getConceptIDNoLock())).To(Equal(target))
+			Expect(owner.GetLabel(trans)).To(Equal("Owner"))
+			Expect(child.GetOwningConcept(trans)).To(Equal(owner))
+			Expect(uOfD.GetElementWithURI("http://activeCrl.com/test/TransactionChild")).To(Equal(child))
+			Expect(uOfD.GetElementWithURI("http://activeCrl.com/test/TransactionChildChanged")).To(BeNil())
+			Expect(ref.GetReferencedConcept(trans)).To(Equal(target))
+			Expect(uOfD.IsEquivalent(trans, originalUofD, originalTrans, true)).To(BeTrue())
+		}
+		Specify("Rollback should restore all changes with undo recording off", func() {
+			testRollback()
+		})
+		Specify("Rollback should restore all changes with undo recording on and remove them from the undo stack", func() {
+			uOfD.SetRecordingUndo(true)
+			uOfD.MarkUndoPoint()
+			testRollback()
+			Expect(uOfD.undoManager.undoStack).To(HaveLen(1))
+			Expect(uOfD.undoManager.undoStack[0].changeType).To(Equal(Marker))
+		})
+		Specify("Rollback should release the locks", func() {
+			owner.SetLabel("Changed", trans)
+			trans.Rollback()
+			Expect(trans.writeLocks).To(BeEmpty())
+			Expect(trans.readLocks).To(BeEmpty())
+			Expect(trans.rollbackStack).To(BeEmpty())
+		})
+	})
+
+	Describe("Commit", func() {
+		Specify("Commit should retain the changes and release the locks", func() {
+			owner.SetLabel("Changed", trans)
+			Expect(trans.rollbackStack).ToNot(BeEmpty())
+			trans.Commit()
+			Expect(trans.rollbackStack).To(BeEmpty())
+			Expect(trans.writeLocks).To(BeEmpty())
+			trans.Rollback()
+			Expect(owner.GetLabel(trans)).To(Equal("Changed"))
+		})
+		Specify("Commit should roll back a failed transaction and report it", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			failing := uOfD.NewTransactionWithContext(ctx)
+			Expect(owner.SetLabel("Changed", failing)).To(Succeed())
+			holder := uOfD.NewTransaction()
+			Expect(holder.WriteLockElement(target)).To(Succeed())
+			cancel()
+			Expect(target.SetLabel("Changed", failing)).ToNot(Succeed())
+			Expect(failing.Commit()).ToNot(Succeed())
+			Expect(failing.Err()).To(BeNil())
+			Expect(failing.writeLocks).To(BeEmpty())
+			holder.ReleaseLocks()
+			Expect(owner.GetLabel(trans)).To(Equal("Owner"))
+		})
+	})
+
+	Describe("Savepoints", func() {
+		Specify("RollbackToSavepoint should restore only the changes made since the savepoint", func() {
+			Expect(owner.SetLabel("Before", trans)).To(Succeed())
+			savepoint := trans.Savepoint()
+			Expect(owner.SetLabel("After", trans)).To(Succeed())
+			Expect(child.SetOwningConcept(target, trans)).To(Succeed())
+			newElement, _ := uOfD.NewOwnedElement(owner, "New", trans)
+			Expect(trans.RollbackToSavepoint(savepoint)).To(Succeed())
+			Expect(owner.GetLabel(trans)).To(Equal("Before"))
+			Expect(child.GetOwningConcept(trans)).To(Equal(owner))
+			Expect(uOfD.GetElement(newElement.getConceptIDNoLock())).To(BeNil())
+			Expect(trans.writeLocks).ToNot(BeEmpty())
+			trans.Rollback()
+			Expect(owner.GetLabel(trans)).To(Equal("Owner"))
+		})
+		Specify("RollbackToSavepoint should remove the rolled back changes from the undo stack", func() {
+			uOfD.SetRecordingUndo(true)
+			uOfD.MarkUndoPoint()
+			Expect(owner.SetLabel("Before", trans)).To(Succeed())
+			depth := len(uOfD.undoManager.undoStack)
+			savepoint := trans.Savepoint()
+			Expect(owner.SetLabel("After", trans)).To(Succeed())
+			Expect(trans.RollbackToSavepoint(savepoint)).To(Succeed())
+			Expect(uOfD.undoManager.undoStack).To(HaveLen(depth))
+		})
+		Specify("RollbackToSavepoint should reject a savepoint from another transaction", func() {
+			otherTrans := uOfD.NewTransaction()
+			defer otherTrans.ReleaseLocks()
+			Expect(trans.RollbackToSavepoint(otherTrans.Savepoint())).ToNot(Succeed())
+		})
+	})
+
+	Describe("Optimistic concurrency", func() {
+		var literal Concept
+		BeforeEach(func() {
+			literal, _ = uOfD.NewOwnedLiteral(owner, "Value", trans)
+			literal.SetLiteralValue("1", trans)
+			trans.Commit()
+		})
+		// readVersion reads the version of the concept with a separate transaction, as an editor does before the user
+		// makes an edit
+		readVersion := func(el Concept) int {
+			readTrans := uOfD.NewTransaction()
+			defer readTrans.ReleaseLocks()
+			return el.GetVersion(readTrans)
+		}
+		Specify("ExpectVersion should succeed when the version is unchanged", func() {
+			version := owner.GetVersion(trans)
+			Expect(trans.ExpectVersion(owner, version)).To(Succeed())
+			Expect(trans.readLocks).To(HaveKey(owner.getConceptIDNoLock()))
+			Expect(trans.writeLocks).ToNot(HaveKey(owner.getConceptIDNoLock()))
+			Expect(owner.SetLabel("Changed", trans)).To(Succeed())
+		})
+		Specify("ExpectVersion should return a VersionConflictError when the concept has changed", func() {
+			version := readVersion(owner)
+			otherTrans := uOfD.NewTransaction()
+			owner.SetLabel("Newer", otherTrans)
+			otherTrans.Commit()
+			err := trans.ExpectVersion(owner, version)
+			Expect(IsVersionConflict(err)).To(BeTrue())
+			vce, ok := err.(*VersionConflictError)
+			Expect(ok).To(BeTrue())
+			Expect(vce.ConceptID).To(Equal(owner.getConceptIDNoLock()))
+			Expect(vce.ExpectedVersion).To(Equal(version))
+			Expect(vce.ActualVersion).To(Equal(version + 1))
+			Expect(trans.writeLocks).ToNot(HaveKey(owner.getConceptIDNoLock()))
+		})
+		Specify("SetLiteralValueIfVersion should reject stale edits", func() {
+			version := readVersion(literal)
+			otherTrans := uOfD.NewTransaction()
+			literal.SetLiteralValue("2", otherTrans)
+			otherTrans.Commit()
+			err := literal.SetLiteralValueIfVersion("3", version, trans)
+			Expect(IsVersionConflict(err)).To(BeTrue())
+			Expect(literal.GetLiteralValue(trans)).To(Equal("2"))
+			Expect(literal.SetLiteralValueIfVersion("3", version+1, trans)).To(Succeed())
+			Expect(literal.GetLiteralValue(trans)).To(Equal("3"))
+		})
+		Specify("SetLabelIfVersion and SetDefinitionIfVersion should check the version", func() {
+			version := owner.GetVersion(trans)
+			Expect(owner.SetLabelIfVersion("Updated", version, trans)).To(Succeed())
+			Expect(owner.GetLabel(trans)).To(Equal("Updated"))
+			Expect(IsVersionConflict(owner.SetDefinitionIfVersion("Definition", version, trans))).To(BeTrue())
+			Expect(owner.SetDefinitionIfVersion("Definition", version+1, trans)).To(Succeed())
+			Expect(owner.GetDefinition(trans)).To(Equal("Definition"))
+		})
+		Specify("A change made while the read lock is upgraded should fail the transaction with a conflict", func() {
+			version := owner.GetVersion(trans)
+			otherDone := make(chan error, 1)
+			go func() {
+				otherTrans := uOfD.NewTransaction()
+				defer otherTrans.Commit()
+				otherDone <- owner.SetLabel("Newer", otherTrans)
+			}()
+			time.Sleep(5 * time.Millisecond)
+			err := owner.SetLabelIfVersion("Stale", version, trans)
+			Expect(IsVersionConflict(err)).To(BeTrue())
+			Expect(IsVersionConflict(trans.Err())).To(BeTrue())
+			Eventually(otherDone).Should(Receive(BeNil()))
+			Expect(trans.writeLocks).ToNot(HaveKey(owner.getConceptIDNoLock()))
+			trans.Rollback()
+			Expect(owner.GetLabel(trans)).To(Equal("Newer"))
+		})
+		Specify("A change made while the read lock is upgraded should fail any write", func() {
+			Expect(owner.GetLabel(trans)).To(Equal("Owner"))
+			otherDone := make(chan error, 1)
+			go func() {
+				otherTrans := uOfD.NewTransaction()
+				defer otherTrans.Commit()
+				otherDone <- owner.SetLabel("Newer", otherTrans)
+			}()
+			time.Sleep(5 * time.Millisecond)
+			Expect(owner.SetLabel("Owner changed", trans)).ToNot(Succeed())
+			Expect(IsVersionConflict(trans.Err())).To(BeTrue())
+			Eventually(otherDone).Should(Receive(BeNil()))
+			trans.Rollback()
+			Expect(owner.GetLabel(trans)).To(Equal("Newer"))
+		})
+	})
+})
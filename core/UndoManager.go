@@ -5,9 +5,10 @@
 package core
 
 import (
-	"errors"
 	"log"
 	"sync"
+
+	"github.com/pkg/errors"
 )
 
 type undoManager struct {
@@ -28,70 +29,53 @@ func newUndoManager(uOfD *UniverseOfDiscourse) *undoManager {
 	return &undoMgr
 }
 
-// markChangedElement() If undo is enabled, updates the undo stack.
+// markChangedElement() records the prior state of the element in the transaction and, if undo is enabled, updates the undo stack.
 func (undoMgr *undoManager) markChangedElement(changedElement Concept, trans *Transaction) error {
 	undoMgr.TraceableLock()
 	defer undoMgr.TraceableUnlock()
-	trans.ReadLockElement(changedElement)
-	priorState := clone(changedElement, trans)
-	priorOwnedElements := undoMgr.uOfD.ownedIDsMap.GetMappedValues(changedElement.GetConceptID(trans)).Clone()
-	priorListeners := undoMgr.uOfD.listenersMap.GetMappedValues(changedElement.GetConceptID(trans)).Clone()
-	priorUofD := ""
-	if changedElement.getUniverseOfDiscourseNoLock() != nil {
-		priorUofD = changedElement.getUniverseOfDiscourseNoLock().id
-	}
-	if undoMgr.recordingUndo {
-		stackEntry := newUndoRedoStackEntry(Change, priorState, priorOwnedElements, priorListeners, priorUofD, changedElement)
-		if undoMgr.debugUndo {
-			PrintStackEntry(stackEntry, trans)
-		}
-		undoMgr.undoStack.Push(stackEntry)
+	if trans == nil {
+		return errors.New("UndoManager.markChangedElement called with nil HeldLocks")
 	}
-	return nil
+	return undoMgr.recordEntry(Change, changedElement, trans)
 }
 
-// markNewElement() If undo is enabled, updates the undo stack.
+// markNewElement() records the creation of the element in the transaction and, if undo is enabled, updates the undo stack.
 func (undoMgr *undoManager) markNewElement(el Concept, trans *Transaction) error {
 	undoMgr.TraceableLock()
 	defer undoMgr.TraceableUnlock()
 	if trans == nil {
 		return errors.New("UndoManager.markNewElement called with nil HeldLocks")
 	}
-	trans.ReadLockElement(el)
-	if undoMgr.recordingUndo {
-		clone := clone(el, trans)
-		priorOwnedElements := undoMgr.uOfD.ownedIDsMap.GetMappedValues(el.GetConceptID(trans)).Clone()
-		priorListeners := undoMgr.uOfD.listenersMap.GetMappedValues(el.GetConceptID(trans)).Clone()
-		priorUofD := ""
-		if el.getUniverseOfDiscourseNoLock() != nil {
-			priorUofD = el.getUniverseOfDiscourseNoLock().id
-		}
-		stackEntry := newUndoRedoStackEntry(Creation, clone, priorOwnedElements, priorListeners, priorUofD, el)
-		if undoMgr.debugUndo {
-			PrintStackEntry(stackEntry, trans)
-		}
-		undoMgr.undoStack.Push(stackEntry)
-	}
-	return nil
+	return undoMgr.recordEntry(Creation, el, trans)
 }
 
-// markRemoveElement() If undo is enabled, updates the undo stack.
+// markRemoveElement() records the prior state of the element in the transaction and, if undo is enabled, updates the undo stack.
 func (undoMgr *undoManager) markRemovedElement(el Concept, trans *Transaction) error {
 	undoMgr.TraceableLock()
 	defer undoMgr.TraceableUnlock()
 	if trans == nil {
 		return errors.New("UndoManager.markRemovedElement called with nil HeldLocks")
 	}
-	trans.ReadLockElement(el)
+	return undoMgr.recordEntry(Deletion, el, trans)
+}
+
+// recordEntry captures the current state of the element, adds the resulting entry to the transaction's rollback stack
+// and, if undo is enabled, to the undo stack. The caller is expected to hold the undoManager lock.
+func (undoMgr *undoManager) recordEntry(changeType UndoChangeType, el Concept, trans *Transaction) error {
+	err := trans.ReadLockElement(el)
+	if err != nil {
+		return errors.Wrap(err, "UndoManager.recordEntry failed")
+	}
+	priorState := clone(el, trans)
+	priorOwnedElements := undoMgr.uOfD.ownedIDsMap.GetMappedValues(el.GetConceptID(trans)).Clone()
+	priorListeners := undoMgr.uOfD.listenersMap.GetMappedValues(el.GetConceptID(trans)).Clone()
+	priorUofD := ""
+	if el.getUniverseOfDiscourseNoLock() != nil {
+		priorUofD = el.getUniverseOfDiscourseNoLock().id
+	}
+	stackEntry := newUndoRedoStackEntry(changeType, priorState, priorOwnedElements, priorListeners, priorUofD, el)
+	trans.rollbackStack.Push(stackEntry)
 	if undoMgr.recordingUndo {
-		clone := clone(el, trans)
-		priorOwnedElements := undoMgr.uOfD.ownedIDsMap.GetMappedValues(el.GetConceptID(trans)).Clone()
-		priorListeners := undoMgr.uOfD.listenersMap.GetMappedValues(el.GetConceptID(trans)).Clone()
-		priorUofD := ""
-		if el.getUniverseOfDiscourseNoLock() != nil {
-			priorUofD = el.getUniverseOfDiscourseNoLock().id
-		}
-		stackEntry := newUndoRedoStackEntry(Deletion, clone, priorOwnedElements, priorListeners, priorUofD, el)
 		if undoMgr.debugUndo {
 			PrintStackEntry(stackEntry, trans)
 		}
@@ -374,14 +358,9 @@ func (undoMgr *undoManager) undo(trans *Transaction) {
 	}
 	undoMgr.TraceableLock()
 	defer undoMgr.TraceableUnlock()
-	uOfD := undoMgr.uOfD
 	firstEntry := true
 	for len(undoMgr.undoStack) > 0 {
 		currentEntry := undoMgr.undoStack.Pop()
-		var currentID string
-		if currentEntry.changedElement != nil {
-			currentID = currentEntry.changedElement.GetConceptID(trans)
-		}
 		if currentEntry.changeType == Marker {
 			if firstEntry {
 				undoMgr.redoStack.Push(currentEntry)
@@ -391,139 +370,187 @@ func (undoMgr *undoManager) undo(trans *Transaction) {
 				return
 			}
 		} else {
-			if currentEntry.changeType == Creation {
-				// Update listeners. If this is a reference or refinement pointing to another element, remove this element from the other element's listener's set
-				currentOwnerID := currentEntry.changedElement.(*concept).OwningConceptID
-				if currentOwnerID != "" {
-					uOfD.removeMappedValueFromOwnedIDsMap(currentOwnerID, currentID)
-				}
-				switch currentEntry.changedElement.GetConceptType() {
-				case Reference:
-					referencedElementID := currentEntry.changedElement.(*concept).ReferencedConceptID
-					if referencedElementID != "" {
-						uOfD.removeMappedValueFromListenersMap(referencedElementID, currentID)
-					}
-				case Refinement:
-					abstractID := currentEntry.changedElement.(*concept).AbstractConceptID
-					if abstractID != "" {
-						uOfD.removeMappedValueFromListenersMap(abstractID, currentID)
-					}
-					refinedID := currentEntry.changedElement.(*concept).RefinedConceptID
-					if refinedID != "" {
-						uOfD.removeMappedValueFromListenersMap(refinedID, currentID)
-					}
-				}
-				// Update the uriUUIDMap
-				uri := currentEntry.changedElement.GetURI(trans)
-				if uri != "" {
-					uOfD.uriUUIDMap.DeleteEntry(uri)
-				}
-				undoMgr.redoStack.Push(currentEntry)
-				uOfD.removeElementForUndo(currentEntry.changedElement, trans)
-				uOfD.setOwnedIDsMapValues(currentID, currentEntry.priorOwnedElements)
-				uOfD.setMappedValuesForListenersMap(currentID, currentEntry.priorListeners)
-			} else if currentEntry.changeType == Deletion {
-				// Update listeners. If this is a reference or refinement pointing to another element, add this element to the other element's listener's set
-				priorOwnerID := currentEntry.priorState.(*concept).OwningConceptID
-				if priorOwnerID != "" {
-					uOfD.addMappedValueToOwnedIDsMap(priorOwnerID, currentEntry.priorState.(*concept).ConceptID)
-				}
-				switch currentEntry.priorState.GetConceptType() {
-				case Reference:
-					referencedElementID := currentEntry.priorState.(*concept).ReferencedConceptID
-					if referencedElementID != "" {
-						uOfD.addMappedValueToListenersMap(referencedElementID, currentEntry.priorState.GetConceptID(trans))
-					}
-				case Refinement:
-					abstractID := currentEntry.priorState.(*concept).AbstractConceptID
-					if abstractID != "" {
-						uOfD.addMappedValueToListenersMap(abstractID, currentEntry.priorState.GetConceptID(trans))
-					}
-					refinedID := currentEntry.priorState.(*concept).RefinedConceptID
-					if refinedID != "" {
-						uOfD.addMappedValueToListenersMap(refinedID, currentEntry.priorState.GetConceptID(trans))
-					}
-				}
-				// Update the uriUUIDMap
-				uri := currentEntry.priorState.GetURI(trans)
-				if uri != "" {
-					uOfD.uriUUIDMap.SetEntry(uri, currentID)
+			undoMgr.redoStack.Push(undoMgr.undoEntry(currentEntry, trans))
+		}
+		firstEntry = false
+	}
+}
+
+// undoEntry reverses the change recorded in the entry and returns the entry to be used to redo the change
+func (undoMgr *undoManager) undoEntry(currentEntry *undoRedoStackEntry, trans *Transaction) *undoRedoStackEntry {
+	uOfD := undoMgr.uOfD
+	var currentID string
+	if currentEntry.changedElement != nil {
+		currentID = currentEntry.changedElement.GetConceptID(trans)
+	}
+	if currentEntry.changeType == Creation {
+		// Update listeners. If this is a reference or refinement pointing to another element, remove this element from the other element's listener's set
+		currentOwnerID := currentEntry.changedElement.(*concept).OwningConceptID
+		if currentOwnerID != "" {
+			uOfD.removeMappedValueFromOwnedIDsMap(currentOwnerID, currentID)
+		}
+		switch currentEntry.changedElement.GetConceptType() {
+		case Reference:
+			referencedElementID := currentEntry.changedElement.(*concept).ReferencedConceptID
+			if referencedElementID != "" {
+				uOfD.removeMappedValueFromListenersMap(referencedElementID, currentID)
+			}
+		case Refinement:
+			abstractID := currentEntry.changedElement.(*concept).AbstractConceptID
+			if abstractID != "" {
+				uOfD.removeMappedValueFromListenersMap(abstractID, currentID)
+			}
+			refinedID := currentEntry.changedElement.(*concept).RefinedConceptID
+			if refinedID != "" {
+				uOfD.removeMappedValueFromListenersMap(refinedID, currentID)
+			}
+		}
+		// Update the uriUUIDMap
+		uri := currentEntry.changedElement.GetURI(trans)
+		if uri != "" {
+			uOfD.uriUUIDMap.DeleteEntry(uri)
+		}
+		uOfD.removeElementForUndo(currentEntry.changedElement, trans)
+		uOfD.setOwnedIDsMapValues(currentID, currentEntry.priorOwnedElements)
+		uOfD.setMappedValuesForListenersMap(currentID, currentEntry.priorListeners)
+	} else if currentEntry.changeType == Deletion {
+		// Update listeners. If this is a reference or refinement pointing to another element, add this element to the other element's listener's set
+		priorOwnerID := currentEntry.priorState.(*concept).OwningConceptID
+		if priorOwnerID != "" {
+			uOfD.addMappedValueToOwnedIDsMap(priorOwnerID, currentEntry.priorState.(*concept).ConceptID)
+		}
+		switch currentEntry.priorState.GetConceptType() {
+		case Reference:
+			referencedElementID := currentEntry.priorState.(*concept).ReferencedConceptID
+			if referencedElementID != "" {
+				uOfD.addMappedValueToListenersMap(referencedElementID, currentEntry.priorState.GetConceptID(trans))
+			}
+		case Refinement:
+			abstractID := currentEntry.priorState.(*concept).AbstractConceptID
+			if abstractID != "" {
+				uOfD.addMappedValueToListenersMap(abstractID, currentEntry.priorState.GetConceptID(trans))
+			}
+			refinedID := currentEntry.priorState.(*concept).RefinedConceptID
+			if refinedID != "" {
+				uOfD.addMappedValueToListenersMap(refinedID, currentEntry.priorState.GetConceptID(trans))
+			}
+		}
+		// Update the uriUUIDMap
+		uri := currentEntry.priorState.GetURI(trans)
+		if uri != "" {
+			uOfD.uriUUIDMap.SetEntry(uri, currentID)
+		}
+		undoMgr.restoreState(currentEntry.priorState, currentEntry.changedElement, trans)
+		uOfD.addElementForUndo(currentEntry.changedElement, trans)
+		uOfD.setOwnedIDsMapValues(currentID, currentEntry.priorOwnedElements)
+		uOfD.setMappedValuesForListenersMap(currentID, currentEntry.priorListeners)
+	} else if currentEntry.changeType == Change {
+		// Update listeners. If this is a reference or refinement pointing to another element, remove this element from the other element's listener's set
+		currentOwnerID := currentEntry.changedElement.(*concept).OwningConceptID
+		if currentOwnerID != "" {
+			uOfD.removeMappedValueFromOwnedIDsMap(currentOwnerID, currentID)
+		}
+		priorOwnerID := currentEntry.priorState.(*concept).OwningConceptID
+		if priorOwnerID != "" {
+			uOfD.addMappedValueToOwnedIDsMap(priorOwnerID, currentEntry.priorState.(*concept).ConceptID)
+		}
+		switch currentEntry.changedElement.GetConceptType() {
+		case Reference:
+			currentReferencedElementID := currentEntry.changedElement.(*concept).ReferencedConceptID
+			priorReferencedElementID := currentEntry.priorState.(*concept).ReferencedConceptID
+			if currentReferencedElementID != priorReferencedElementID {
+				if currentReferencedElementID != "" {
+					uOfD.removeMappedValueFromListenersMap(currentReferencedElementID, currentID)
 				}
-				undoMgr.restoreState(currentEntry.priorState, currentEntry.changedElement, trans)
-				undoMgr.redoStack.Push(currentEntry)
-				uOfD.addElementForUndo(currentEntry.changedElement, trans)
-				uOfD.setOwnedIDsMapValues(currentID, currentEntry.priorOwnedElements)
-				uOfD.setMappedValuesForListenersMap(currentID, currentEntry.priorListeners)
-			} else if currentEntry.changeType == Change {
-				// Update listeners. If this is a reference or refinement pointing to another element, remove this element from the other element's listener's set
-				currentOwnerID := currentEntry.changedElement.(*concept).OwningConceptID
-				if currentOwnerID != "" {
-					uOfD.removeMappedValueFromOwnedIDsMap(currentOwnerID, currentID)
+				if priorReferencedElementID != "" {
+					uOfD.addMappedValueToListenersMap(priorReferencedElementID, currentID)
 				}
-				priorOwnerID := currentEntry.priorState.(*concept).OwningConceptID
-				if priorOwnerID != "" {
-					uOfD.addMappedValueToOwnedIDsMap(priorOwnerID, currentEntry.priorState.(*concept).ConceptID)
+			}
+		case Refinement:
+			currentAbstractID := currentEntry.changedElement.(*concept).AbstractConceptID
+			priorAbstractID := currentEntry.priorState.(*concept).AbstractConceptID
+			if currentAbstractID != priorAbstractID {
+				if currentAbstractID != "" {
+					uOfD.removeMappedValueFromListenersMap(currentAbstractID, currentID)
 				}
-				switch currentEntry.changedElement.GetConceptType() {
-				case Reference:
-					currentReferencedElementID := currentEntry.changedElement.(*concept).ReferencedConceptID
-					priorReferencedElementID := currentEntry.priorState.(*concept).ReferencedConceptID
-					if currentReferencedElementID != priorReferencedElementID {
-						if currentReferencedElementID != "" {
-							uOfD.removeMappedValueFromListenersMap(currentReferencedElementID, currentID)
-						}
-						if priorReferencedElementID != "" {
-							uOfD.addMappedValueToListenersMap(priorReferencedElementID, currentID)
-						}
-					}
-				case Refinement:
-					currentAbstractID := currentEntry.changedElement.(*concept).AbstractConceptID
-					priorAbstractID := currentEntry.priorState.(*concept).AbstractConceptID
-					if currentAbstractID != priorAbstractID {
-						if currentAbstractID != "" {
-							uOfD.removeMappedValueFromListenersMap(currentAbstractID, currentID)
-						}
-						if priorAbstractID != "" {
-							uOfD.addMappedValueToListenersMap(priorAbstractID, currentID)
-						}
-					}
-					currentRefinedID := currentEntry.changedElement.(*concept).RefinedConceptID
-					priorRefinedID := currentEntry.priorState.(*concept).RefinedConceptID
-					if currentRefinedID != priorRefinedID {
-						if currentRefinedID != "" {
-							uOfD.removeMappedValueFromListenersMap(currentRefinedID, currentID)
-						}
-						if priorRefinedID != "" {
-							uOfD.addMappedValueToListenersMap(priorRefinedID, currentID)
-						}
-					}
+				if priorAbstractID != "" {
+					uOfD.addMappedValueToListenersMap(priorAbstractID, currentID)
 				}
-				// Update the uriUUIDMap
-				currentURI := currentEntry.changedElement.GetURI(trans)
-				priorURI := currentEntry.priorState.GetURI(trans)
-				if currentURI != priorURI {
-					if currentURI != "" {
-						uOfD.uriUUIDMap.DeleteEntry(currentURI)
-					}
-					if priorURI != "" {
-						uOfD.uriUUIDMap.SetEntry(priorURI, currentID)
-					}
+			}
+			currentRefinedID := currentEntry.changedElement.(*concept).RefinedConceptID
+			priorRefinedID := currentEntry.priorState.(*concept).RefinedConceptID
+			if currentRefinedID != priorRefinedID {
+				if currentRefinedID != "" {
+					uOfD.removeMappedValueFromListenersMap(currentRefinedID, currentID)
 				}
-				clone := clone(currentEntry.changedElement, trans)
-				priorOwnedElements := uOfD.ownedIDsMap.GetMappedValues(currentID).Clone()
-				priorListeners := uOfD.listenersMap.GetMappedValues(currentID).Clone()
-				redoEntry := newUndoRedoStackEntry(Change, clone, priorOwnedElements, priorListeners, currentEntry.priorUofD, currentEntry.changedElement)
-				undoMgr.restoreState(currentEntry.priorState, currentEntry.changedElement, trans)
-				uOfD.setOwnedIDsMapValues(currentID, currentEntry.priorOwnedElements)
-				uOfD.setMappedValuesForListenersMap(currentID, currentEntry.priorListeners)
-				if currentEntry.priorUofD != uOfD.id {
-					uOfD.deleteUUIDElementMapEntry(currentID)
-				} else if currentEntry.priorUofD == uOfD.id {
-					uOfD.setUUIDElementMapEntry(currentID, currentEntry.changedElement)
+				if priorRefinedID != "" {
+					uOfD.addMappedValueToListenersMap(priorRefinedID, currentID)
 				}
-				undoMgr.redoStack.Push(redoEntry)
 			}
 		}
-		firstEntry = false
+		// Update the uriUUIDMap
+		currentURI := currentEntry.changedElement.GetURI(trans)
+		priorURI := currentEntry.priorState.GetURI(trans)
+		if currentURI != priorURI {
+			if currentURI != "" {
+				uOfD.uriUUIDMap.DeleteEntry(currentURI)
+			}
+			if priorURI != "" {
+				uOfD.uriUUIDMap.SetEntry(priorURI, currentID)
+			}
+		}
+		clone := clone(currentEntry.changedElement, trans)
+		priorOwnedElements := uOfD.ownedIDsMap.GetMappedValues(currentID).Clone()
+		priorListeners := uOfD.listenersMap.GetMappedValues(currentID).Clone()
+		redoEntry := newUndoRedoStackEntry(Change, clone, priorOwnedElements, priorListeners, currentEntry.priorUofD, currentEntry.changedElement)
+		undoMgr.restoreState(currentEntry.priorState, currentEntry.changedElement, trans)
+		uOfD.setOwnedIDsMapValues(currentID, currentEntry.priorOwnedElements)
+		uOfD.setMappedValuesForListenersMap(currentID, currentEntry.priorListeners)
+		if currentEntry.priorUofD != uOfD.id {
+			uOfD.deleteUUIDElementMapEntry(currentID)
+		} else if currentEntry.priorUofD == uOfD.id {
+			uOfD.setUUIDElementMapEntry(currentID, currentEntry.changedElement)
+		}
+		return redoEntry
+	}
+	return currentEntry
+}
+
+// rollback reverses all of the changes recorded in the transaction, most recent first, and removes the
+// corresponding entries from the undo stack.
+func (undoMgr *undoManager) rollback(trans *Transaction) {
+	undoMgr.rollbackTo(trans, 0)
+}
+
+// rollbackTo reverses the changes recorded in the transaction, most recent first, until only depth entries remain on
+// its rollback stack, and removes the corresponding entries from the undo stack.
+func (undoMgr *undoManager) rollbackTo(trans *Transaction, depth int) {
+	if undoMgr.debugUndo {
+		log.Print("***** BEGIN ROLLBACK ****")
+	}
+	undoMgr.TraceableLock()
+	defer undoMgr.TraceableUnlock()
+	if len(trans.rollbackStack) <= depth {
+		return
+	}
+	rolledBackEntries := make(map[*undoRedoStackEntry]bool)
+	for len(trans.rollbackStack) > depth {
+		currentEntry := trans.rollbackStack.Pop()
+		rolledBackEntries[currentEntry] = true
+		undoMgr.undoEntry(currentEntry, trans)
 	}
+	var remainingEntries undoStack
+	for _, entry := range undoMgr.undoStack {
+		if !rolledBackEntries[entry] {
+			remainingEntries.Push(entry)
+		}
+	}
+	undoMgr.undoStack = remainingEntries
+}
+
+// discardRollback discards the changes recorded in the transaction so that they can no longer be rolled back
+func (undoMgr *undoManager) discardRollback(trans *Transaction) {
+	undoMgr.TraceableLock()
+	defer undoMgr.TraceableUnlock()
+	trans.rollbackStack = nil
 }
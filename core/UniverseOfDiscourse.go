@@ -1,13 +1,18 @@
 package core
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/url"
 	"reflect"
 	"sort"
 	"strconv"
+	"sync"
+	"sync/atomic"
 
 	"github.com/pkg/errors"
 
@@ -17,17 +22,29 @@ import (
 
 // UniverseOfDiscourse represents the scope of relevant concepts
 type UniverseOfDiscourse struct {
-	id                  string
-	computeFunctions    functions
-	executedCalls       chan *functionCallRecord
-	undoManager         *undoManager
-	uriUUIDMap          *StringStringMap
-	uuidElementMap      *StringElementMap
-	inProgressDeletions *StringElementMap
-	ownedIDsMap         *OneToNStringMap
-	listenersMap        *OneToNStringMap
-	abstractionsMap     *OneToNStringMap
-	observers           mapset.Set
+	id               string
+	computeFunctions functions
+	// functionRegistrations is the registry from which computeFunctions is derived
+	functionRegistrations map[string][]*FunctionRegistration
+	functionsMutex        sync.RWMutex
+	executedCalls         chan *functionCallRecord
+	undoManager           *undoManager
+	uriUUIDMap            *StringStringMap
+	uuidElementMap        *StringElementMap
+	inProgressDeletions   *StringElementMap
+	ownedIDsMap           *OneToNStringMap
+	listenersMap          *OneToNStringMap
+	abstractionsMap       *OneToNStringMap
+	unresolvedTargets     mapset.Set
+	observers             mapset.Set
+	journal               *ChangeJournal
+	subscriptions         *subscriptionRegistry
+	functionPoolMutex     sync.RWMutex
+	functionPool          *functionCallPool
+	domainVersions        *StringStringMap
+	migrations            *migrationRegistry
+	// bulkLoading suspends the checking of the structural invariants by RecoverElement
+	bulkLoading bool
 }
 
 // NewUniverseOfDiscourse creates and initializes a new UniverseOfDiscourse
@@ -40,6 +57,7 @@ func NewUniverseOfDiscourse() *UniverseOfDiscourse {
 	uOfD.id = newUUID.String()
 	uOfD.observers = mapset.NewSet()
 	uOfD.computeFunctions = make(map[string][]crlExecutionFunction)
+	uOfD.functionRegistrations = make(map[string][]*FunctionRegistration)
 	uOfD.undoManager = newUndoManager(&uOfD)
 	uOfD.uriUUIDMap = NewStringStringMap()
 	uOfD.uuidElementMap = NewStringElementMap()
@@ -47,6 +65,10 @@ func NewUniverseOfDiscourse() *UniverseOfDiscourse {
 	uOfD.ownedIDsMap = NewOneToNStringMap()
 	uOfD.listenersMap = NewOneToNStringMap()
 	uOfD.abstractionsMap = NewOneToNStringMap()
+	uOfD.unresolvedTargets = mapset.NewSet()
+	uOfD.subscriptions = newSubscriptionRegistry()
+	uOfD.domainVersions = NewStringStringMap()
+	uOfD.migrations = newMigrationRegistry()
 	trans := uOfD.NewTransaction()
 	buildCoreDomain(&uOfD, trans)
 	trans.ReleaseLocks()
@@ -87,16 +109,40 @@ func (uOfDPtr *UniverseOfDiscourse) addElement(el Concept, inRecovery bool, tran
 	if el == nil {
 		return errors.New("UniverseOfDiscource addElement() failed because element was nil")
 	}
-	trans.WriteLockElement(el)
+	err := trans.WriteLockElement(el)
+	if err != nil {
+		return errors.Wrap(err, "UniverseOfDiscourse.addElement failed")
+	}
 	uuid := el.GetConceptID(trans)
 	if uuid == "" {
 		return errors.New("UniverseOfDiscource addElement() failed because UUID was nil")
 	}
-	uOfDPtr.undoManager.markNewElement(el, trans)
+	err = uOfDPtr.undoManager.markNewElement(el, trans)
+	if err != nil {
+		return errors.Wrap(err, "UniverseOfDiscourse.addElement failed")
+	}
 
-	uOfDPtr.addElementForUndo(el, trans)
+	resolving := uOfDPtr.unresolvedTargets.Contains(uuid)
+	err = uOfDPtr.addElementForUndo(el, trans)
+	if err != nil {
+		return errors.Wrap(err, "UniverseOfDiscourse.addElement failed")
+	}
+
+	if !inRecovery && uOfDPtr.isRecordingChanges() {
+		afterState, err := NewConceptState(el)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.addElement failed")
+		}
+		uOfDPtr.recordChange(ConceptAdded, nil, afterState, trans)
+	}
 
 	uOfDPtr.postChange(el, trans)
+	if resolving {
+		err := uOfDPtr.resolvePointers(el, trans)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.addElement failed")
+		}
+	}
 	return nil
 }
 
@@ -104,13 +150,17 @@ func (uOfDPtr *UniverseOfDiscourse) addElementForUndo(el Concept, trans *Transac
 	if el == nil {
 		return errors.New("UniverseOfDiscource addElementForUndo() failed because element was nil")
 	}
-	trans.WriteLockElement(el)
+	err := trans.WriteLockElement(el)
+	if err != nil {
+		return errors.Wrap(err, "UniverseOfDiscourse.addElementForUndo failed")
+	}
 	if uOfDPtr.undoManager.debugUndo {
 		log.Printf("Adding element for undo, id: %s\n", el.GetConceptID(trans))
 		Print(el, "Added Element: ", trans)
 	}
 	uOfDPtr.setUUIDElementMapEntry(el.GetConceptID(trans), el)
 	uuid := el.GetConceptID(trans)
+	uOfDPtr.unresolvedTargets.Remove(uuid)
 	uri := el.GetURI(trans)
 	if uri != "" {
 		uOfDPtr.uriUUIDMap.SetEntry(uri, el.GetConceptID(trans))
@@ -140,11 +190,6 @@ func (uOfDPtr *UniverseOfDiscourse) addElementForUndo(el Concept, trans *Transac
 	return nil
 }
 
-// AddFunction registers a function with the indicated uri
-func (uOfDPtr *UniverseOfDiscourse) AddFunction(uri string, function crlExecutionFunction) {
-	uOfDPtr.computeFunctions[string(uri)] = append(uOfDPtr.computeFunctions[string(uri)], function)
-}
-
 func (uOfDPtr *UniverseOfDiscourse) changeURIForElement(el Concept, oldURI string, newURI string) error {
 	if oldURI != "" && uOfDPtr.uriUUIDMap.GetEntry(oldURI) == el.getConceptIDNoLock() {
 		uOfDPtr.uriUUIDMap.DeleteEntry(oldURI)
@@ -160,6 +205,9 @@ func (uOfDPtr *UniverseOfDiscourse) changeURIForElement(el Concept, oldURI strin
 
 func (uOfDPtr *UniverseOfDiscourse) addMappedValueToListenersMap(listenerID string, value string) {
 	uOfDPtr.listenersMap.addMappedValue(listenerID, value)
+	if uOfDPtr.GetElement(listenerID) == nil {
+		uOfDPtr.unresolvedTargets.Add(listenerID)
+	}
 	if uOfDPtr.undoManager.debugUndo {
 		log.Printf("      addMappedValueToListenersMap listenerID: %s value: %s resultingOwnedIDs: %v", listenerID, value, uOfDPtr.listenersMap.GetMappedValues(listenerID))
 	}
@@ -178,19 +226,30 @@ func (uOfDPtr *UniverseOfDiscourse) Clone(trans *Transaction) *UniverseOfDiscour
 	newUofD := NewUniverseOfDiscourse()
 
 	// uOfD.computeFunctions = make(map[string][]crlExecutionFunction)
-	var uri string
-	var functionArray []crlExecutionFunction
-	for uri, functionArray = range uOfDPtr.computeFunctions {
+	uOfDPtr.functionsMutex.RLock()
+	newUofD.functionsMutex.Lock()
+	for uri, registrations := range uOfDPtr.functionRegistrations {
 		// Housekeeping functions are already present in a new uOfD
 		if uri != "http://activeCrl.com/core/coreHousekeeping" {
-			newUofD.computeFunctions[uri] = append(newUofD.computeFunctions[uri], functionArray...)
+			for _, registration := range registrations {
+				registrationCopy := *registration
+				newUofD.functionRegistrations[uri] = append(newUofD.functionRegistrations[uri], &registrationCopy)
+			}
+			newUofD.updateComputeFunctions(uri)
 		}
 	}
+	newUofD.functionsMutex.Unlock()
+	uOfDPtr.functionsMutex.RUnlock()
 
 	for uri, uuid := range uOfDPtr.uriUUIDMap.CopyMap() {
 		newUofD.uriUUIDMap.SetEntry(uri, uuid)
 	}
 
+	for uri, version := range uOfDPtr.domainVersions.CopyMap() {
+		newUofD.domainVersions.SetEntry(uri, version)
+	}
+	uOfDPtr.migrations.copyTo(newUofD.migrations)
+
 	for id, el := range uOfDPtr.uuidElementMap.CopyMap() {
 		newElement := clone(el, trans)
 		newUofD.setUUIDElementMapEntry(id, newElement)
@@ -398,8 +457,8 @@ func (uOfDPtr *UniverseOfDiscourse) findFunctions(element Concept, notification
 	for _, candidate := range selfAndAbstractions {
 		uri := candidate.GetURI(trans)
 		if uri != "" {
-			functions := uOfDPtr.computeFunctions[uri]
-			if functions != nil {
+			functions := uOfDPtr.getFunctions(uri)
+			if len(functions) > 0 {
 				functionIdentifiers = append(functionIdentifiers, uri)
 			}
 		}
@@ -411,12 +470,18 @@ func (uOfDPtr *UniverseOfDiscourse) deleteElement(el Concept, trans *Transaction
 	if el == nil {
 		return errors.New("UniverseOfDiscource removeElement failed elcause Element was nil")
 	}
-	trans.WriteLockElement(el)
+	err := trans.WriteLockElement(el)
+	if err != nil {
+		return errors.Wrap(err, "UniverseOfDiscourse.deleteElement failed")
+	}
 	beforeState, err := NewConceptState(el)
 	if err != nil {
 		return errors.Wrap(err, "UniverseOfDiscourse.deleteElement failed")
 	}
-	uOfDPtr.undoManager.markRemovedElement(el, trans)
+	err = uOfDPtr.undoManager.markRemovedElement(el, trans)
+	if err != nil {
+		return errors.Wrap(err, "UniverseOfDiscourse.deleteElement failed")
+	}
 
 	uuid := el.GetConceptID(trans)
 	uri := el.GetURI(trans)
@@ -426,24 +491,30 @@ func (uOfDPtr *UniverseOfDiscourse) deleteElement(el Concept, trans *Transaction
 	// Remove element from owner's child list
 	ownerID := el.GetOwningConceptID(trans)
 	if ownerID != "" {
-		el.SetOwningConceptID("", trans)
+		err = el.SetOwningConceptID("", trans)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.deleteElement failed")
+		}
 	}
-	it := uOfDPtr.listenersMap.GetMappedValues(uuid).Iterator()
-	for id := range it.C {
+	for _, id := range uOfDPtr.listenersMap.GetMappedValues(uuid).ToSlice() {
 		listener := uOfDPtr.GetElement(id.(string))
 		if listener != nil {
 			switch listener.GetConceptType() {
 			case Reference:
-				listener.SetReferencedConcept(nil, NoAttribute, trans)
+				err = listener.SetReferencedConcept(nil, NoAttribute, trans)
 			case Refinement:
 				if listener.GetAbstractConcept(trans) == el {
-					listener.SetAbstractConcept(nil, trans)
+					err = listener.SetAbstractConcept(nil, trans)
 				} else if listener.GetRefinedConcept(trans) == el {
-					listener.SetRefinedConcept(nil, trans)
+					err = listener.SetRefinedConcept(nil, trans)
 				}
 			}
+			if err != nil {
+				return errors.Wrap(err, "UniverseOfDiscourse.deleteElement failed")
+			}
 		}
 	}
+	uOfDPtr.recordChange(ConceptRemoved, beforeState, nil, trans)
 	// Spread the news
 	conceptRemovedNotification := uOfDPtr.newUofDConceptRemovedNotification(beforeState, trans)
 	err = uOfDPtr.NotifyUofDObservers(conceptRemovedNotification, trans)
@@ -476,14 +547,20 @@ func (uOfDPtr *UniverseOfDiscourse) deleteElement(el Concept, trans *Transaction
 	uOfDPtr.deleteKeyFromOwnedIDsMap(uuid)
 	uOfDPtr.deleteUUIDElementMapEntry(uuid)
 	// Finally, remove from the universe of discourse
-	el.setUniverseOfDiscourse(nil, trans)
+	err = el.setUniverseOfDiscourse(nil, trans)
+	if err != nil {
+		return errors.Wrap(err, "UniverseOfDiscourse.deleteElement failed")
+	}
 	return nil
 }
 
 // DeleteElement removes a single element and its descentants from the uOfD. Pointers to the elements from other elements are set to nil.
 func (uOfDPtr *UniverseOfDiscourse) DeleteElement(element Concept, trans *Transaction) error {
-	id := element.GetConceptID(trans)
-	elements := mapset.NewSet(id)
+	if element == nil {
+		return errors.New("UniverseOfDiscourse.DeleteElement called with nil element")
+	}
+	// The ID is read without a lock so that the element can still be write locked for its deletion
+	elements := mapset.NewSet(element.getConceptIDNoLock())
 	return uOfDPtr.DeleteElements(elements, trans)
 }
 
@@ -495,6 +572,11 @@ func (uOfDPtr *UniverseOfDiscourse) DeleteElements(elements mapset.Set, trans *T
 		if el == nil {
 			break
 		}
+		err := trans.WriteLockElement(el)
+		if err != nil {
+			it.Stop()
+			return errors.Wrap(err, "UniverseOfDiscourse.DeleteElements failed")
+		}
 		if el.GetIsCore(trans) {
 			it.Stop()
 			return errors.New("UniverseOfDiscourse.DeleteElements called on a CRL core concept")
@@ -518,13 +600,15 @@ func (uOfDPtr *UniverseOfDiscourse) DeleteElements(elements mapset.Set, trans *T
 			}
 		}
 	}
+	defer uOfDPtr.inProgressDeletions.Clear()
 	for _, el := range uOfDPtr.inProgressDeletions.CopyMap() {
 		if el != nil {
-			trans.WriteLockElement(el)
-			uOfDPtr.deleteElement(el, trans)
+			err := uOfDPtr.deleteElement(el, trans)
+			if err != nil {
+				return errors.Wrap(err, "UniverseOfDiscourse.DeleteElements failed")
+			}
 		}
 	}
-	uOfDPtr.inProgressDeletions.Clear()
 	return nil
 }
 
@@ -614,6 +698,8 @@ func (uOfDPtr *UniverseOfDiscourse) getExecutedCalls() chan *functionCallRecord
 
 // getFunctions returns the array of functions associatee with the given URI
 func (uOfDPtr *UniverseOfDiscourse) getFunctions(uri string) []crlExecutionFunction {
+	uOfDPtr.functionsMutex.RLock()
+	defer uOfDPtr.functionsMutex.RUnlock()
 	return uOfDPtr.computeFunctions[string(uri)]
 }
 
@@ -667,8 +753,9 @@ func (uOfDPtr *UniverseOfDiscourse) GetConceptsOwnedConceptIDs(id string) mapset
 func (uOfDPtr *UniverseOfDiscourse) GetConceptsOwnedConceptIDsRecursively(rootID string, descendants mapset.Set, trans *Transaction) {
 	it := uOfDPtr.ownedIDsMap.GetMappedValues(rootID).Iterator()
 	for id := range it.C {
-		descendants.Add(id.(string))
-		uOfDPtr.GetConceptsOwnedConceptIDsRecursively(id.(string), descendants, trans)
+		if descendants.Add(id.(string)) {
+			uOfDPtr.GetConceptsOwnedConceptIDsRecursively(id.(string), descendants, trans)
+		}
 	}
 }
 
@@ -752,6 +839,11 @@ func (uOfDPtr *UniverseOfDiscourse) getURIUUIDMap() *StringStringMap {
 	return uOfDPtr.uriUUIDMap
 }
 
+// IsBulkLoading reveals whether RecoverElement is suspending the checking of the structural invariants
+func (uOfDPtr *UniverseOfDiscourse) IsBulkLoading() bool {
+	return uOfDPtr.bulkLoading
+}
+
 // IsEquivalent returns true if all of the root elements in the uOfD are recursively equivalent
 func (uOfDPtr *UniverseOfDiscourse) IsEquivalent(hl1 *Transaction, uOfD2 *UniverseOfDiscourse, hl2 *Transaction, printExceptions ...bool) bool {
 	var printEquivalenceExceptions bool
@@ -889,41 +981,129 @@ func (uOfDPtr *UniverseOfDiscourse) MarkUndoPoint() {
 
 // MarshalDomain creates a JSON representation of an element and all of its descendants
 func (uOfDPtr *UniverseOfDiscourse) MarshalDomain(el Concept, trans *Transaction) ([]byte, error) {
-	var result []byte
-	result = append(result, []byte("[")...)
-	marshaledConcept, err := uOfDPtr.marshalConceptRecursively(el, trans)
+	var buffer bytes.Buffer
+	err := uOfDPtr.EncodeDomain(&buffer, el, trans)
+	if err != nil {
+		return buffer.Bytes(), errors.Wrap(err, "UniverseOfDiscourse.MarshalDomain failed")
+	}
+	return buffer.Bytes(), nil
+}
+
+// EncodeDomain writes the JSON representation of an element and all of its descendants to the writer. The
+// representation is a JSON array with one entry per line: a DomainHeader followed by the concepts. Concepts are
+// encoded and written one at a time so that the representation of the domain as a whole is never held in memory.
+func (uOfDPtr *UniverseOfDiscourse) EncodeDomain(writer io.Writer, el Concept, trans *Transaction) error {
+	err := uOfDPtr.encodeDomain(writer, el, nil, false, trans)
+	if err != nil {
+		return errors.Wrap(err, "UniverseOfDiscourse.EncodeDomain failed")
+	}
+	return nil
+}
+
+// EncodeDomainCanonically writes the canonical JSON representation of an element and all of its descendants to the
+// writer. The canonical representation always serializes a given domain to the same text: the children of each
+// concept are ordered by label and then by ConceptID, and each entry is indented. It is intended for files that are
+// kept under version control.
+func (uOfDPtr *UniverseOfDiscourse) EncodeDomainCanonically(writer io.Writer, el Concept, trans *Transaction) error {
+	err := uOfDPtr.encodeDomain(writer, el, nil, true, trans)
 	if err != nil {
-		return result, err
+		return errors.Wrap(err, "UniverseOfDiscourse.EncodeDomainCanonically failed")
 	}
-	// The last byte of marshaledConcept is going to be a comma we don't want
-	result = append(result, marshaledConcept[0:len(marshaledConcept)-1]...)
-	result = append(result, []byte("]")...)
-	return result, nil
+	return nil
+}
+
+// EncodeDomainCanonicallyWithHeader writes the canonical JSON representation of an element and all of its descendants
+// to the writer as EncodeDomainCanonically does, but with the DomainVersions and Dependencies of the given header
+// rather than those of the uOfD. It is intended for domains assembled outside the uOfD in which they were serialized,
+// as when merging files.
+func (uOfDPtr *UniverseOfDiscourse) EncodeDomainCanonicallyWithHeader(writer io.Writer, el Concept, header *DomainHeader, trans *Transaction) error {
+	if header == nil {
+		return errors.New("UniverseOfDiscourse.EncodeDomainCanonicallyWithHeader called with nil header")
+	}
+	err := uOfDPtr.encodeDomain(writer, el, header, true, trans)
+	if err != nil {
+		return errors.Wrap(err, "UniverseOfDiscourse.EncodeDomainCanonicallyWithHeader failed")
+	}
+	return nil
 }
 
-func (uOfDPtr *UniverseOfDiscourse) marshalConceptRecursively(el Concept, trans *Transaction) ([]byte, error) {
-	var result []byte
+// encodeDomain writes the header and the concepts of the domain. The fields of each entry are always written in the
+// same order: concept fields in the order in which concept.MarshalJSON declares them and map keys sorted. If a
+// domainHeader is given, its DomainVersions and Dependencies are written in place of those of the uOfD.
+func (uOfDPtr *UniverseOfDiscourse) encodeDomain(writer io.Writer, el Concept, domainHeader *DomainHeader, canonical bool, trans *Transaction) error {
 	if el == nil {
-		return result, errors.New("UniverseOfDiscourse.marshalConceptRecursively called with nil concept")
+		return errors.New("UniverseOfDiscourse.encodeDomain called with nil concept")
 	}
-	marshaledElement, err := el.MarshalJSON()
+	_, err := io.WriteString(writer, "[\n")
 	if err != nil {
-		return result, err
+		return err
 	}
-	result = append(result, marshaledElement...)
-	result = append(result, []byte(",")...)
-	elID := el.GetConceptID(trans)
-	it := uOfDPtr.GetConceptsOwnedConceptIDs(elID).Iterator()
-	for id := range it.C {
-		child := uOfDPtr.GetElement(id.(string))
-		marshaledChild, err := uOfDPtr.marshalConceptRecursively(child, trans)
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+	if canonical {
+		encoder.SetIndent("", "  ")
+	}
+	header := DomainHeader{FormatVersion: CurrentDomainFormatVersion, DomainURI: el.GetURI(trans)}
+	if domainHeader != nil {
+		header.DomainVersions = domainHeader.DomainVersions
+		header.Dependencies = domainHeader.Dependencies
+	} else {
+		header.DomainVersions = uOfDPtr.GetDomainVersions()
+		header.Dependencies = uOfDPtr.GetDomainDependencies(el, trans)
+	}
+	err = encoder.Encode(&header)
+	if err != nil {
+		return err
+	}
+	err = uOfDPtr.encodeConceptRecursively(writer, encoder, el, canonical, trans)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(writer, "]\n")
+	return err
+}
+
+func (uOfDPtr *UniverseOfDiscourse) encodeConceptRecursively(writer io.Writer, encoder *json.Encoder, el Concept, canonical bool, trans *Transaction) error {
+	if el == nil {
+		return errors.New("UniverseOfDiscourse.encodeConceptRecursively called with nil concept")
+	}
+	_, err := io.WriteString(writer, ",")
+	if err != nil {
+		return err
+	}
+	err = encoder.Encode(el)
+	if err != nil {
+		return err
+	}
+	var children []Concept
+	for _, id := range uOfDPtr.GetConceptsOwnedConceptIDs(el.GetConceptID(trans)).ToSlice() {
+		children = append(children, uOfDPtr.GetElement(id.(string)))
+	}
+	if canonical {
+		uOfDPtr.sortConceptsByLabelAndID(children, trans)
+	}
+	for _, child := range children {
+		err = uOfDPtr.encodeConceptRecursively(writer, encoder, child, canonical, trans)
 		if err != nil {
-			it.Stop()
-			return result, err
+			return err
 		}
-		result = append(result, marshaledChild...)
 	}
-	return result, nil
+	return nil
+}
+
+// sortConceptsByLabelAndID sorts the concepts by label and then by ConceptID
+func (uOfDPtr *UniverseOfDiscourse) sortConceptsByLabelAndID(concepts []Concept, trans *Transaction) {
+	sort.SliceStable(concepts, func(i, j int) bool {
+		if concepts[i] == nil || concepts[j] == nil {
+			return concepts[j] == nil && concepts[i] != nil
+		}
+		labelI := concepts[i].GetLabel(trans)
+		labelJ := concepts[j].GetLabel(trans)
+		if labelI != labelJ {
+			return labelI < labelJ
+		}
+		return concepts[i].GetConceptID(trans) < concepts[j].GetConceptID(trans)
+	})
 }
 
 // newUofDConceptAddedNotification creates a UofDConceptAdded notification
@@ -947,6 +1127,7 @@ func (uOfDPtr *UniverseOfDiscourse) SendConceptChangeNotification(reportingEleme
 	notification.afterConceptState = afterState
 	notification.natureOfChange = ConceptChanged
 	notification.uOfD = uOfDPtr
+	uOfDPtr.recordChange(ConceptChanged, beforeState, afterState, trans)
 	err = reportingElement.propagateChange(notification, trans)
 	if err != nil {
 		return errors.Wrap(err, "UniverseOfDiscourse.SendConceptChangeNotification failed")
@@ -966,6 +1147,7 @@ func (uOfDPtr *UniverseOfDiscourse) SendPointerChangeNotification(reportingEleme
 	notification.afterConceptState = afterConceptState
 	notification.natureOfChange = natureOfChange
 	notification.uOfD = uOfDPtr
+	uOfDPtr.recordChange(natureOfChange, beforeConceptState, afterConceptState, trans)
 	reportingElement.propagateChange(notification, trans)
 	return nil
 }
@@ -1024,10 +1206,41 @@ func (uOfDPtr *UniverseOfDiscourse) NewConcept(conceptType ConceptType, trans *T
 	}
 	var el concept
 	el.initializeConcept(conceptType, conceptID, actualURI)
-	trans.WriteLockElement(&el)
-	uOfDPtr.SetUniverseOfDiscourse(&el, trans)
+	err = trans.WriteLockElement(&el)
+	if err != nil {
+		return nil, errors.Wrap(err, "UniverseOfDiscourse.NewConcept failed")
+	}
+	err = uOfDPtr.SetUniverseOfDiscourse(&el, trans)
+	if err != nil {
+		return nil, errors.Wrap(err, "UniverseOfDiscourse.NewConcept failed")
+	}
 	if actualURI != "" {
-		el.SetURI(actualURI, trans)
+		err = el.SetURI(actualURI, trans)
+		if err != nil {
+			return nil, errors.Wrap(err, "UniverseOfDiscourse.NewConcept failed")
+		}
+	}
+	return &el, nil
+}
+
+// NewConceptWithID creates and initializes a new Concept with the given ConceptID rather than a generated one. It is
+// intended for replicating concepts from another uOfD and fails if the ConceptID is already in use.
+func (uOfDPtr *UniverseOfDiscourse) NewConceptWithID(conceptType ConceptType, conceptID string, trans *Transaction) (Concept, error) {
+	if conceptID == "" {
+		return nil, errors.New("UniverseOfDiscourse.NewConceptWithID called with an empty ConceptID")
+	}
+	if uOfDPtr.GetElement(conceptID) != nil {
+		return nil, errors.New("UniverseOfDiscourse.NewConceptWithID called with a ConceptID already in use: " + conceptID)
+	}
+	var el concept
+	el.initializeConcept(conceptType, conceptID, "")
+	err := trans.WriteLockElement(&el)
+	if err != nil {
+		return nil, errors.Wrap(err, "UniverseOfDiscourse.NewConceptWithID failed")
+	}
+	err = uOfDPtr.SetUniverseOfDiscourse(&el, trans)
+	if err != nil {
+		return nil, errors.Wrap(err, "UniverseOfDiscourse.NewConceptWithID failed")
 	}
 	return &el, nil
 }
@@ -1044,18 +1257,36 @@ func (uOfDPtr *UniverseOfDiscourse) NewElement(trans *Transaction, uri ...string
 	}
 	var el concept
 	el.initializeConcept(Element, conceptID, actualURI)
-	trans.WriteLockElement(&el)
-	uOfDPtr.SetUniverseOfDiscourse(&el, trans)
+	err = trans.WriteLockElement(&el)
+	if err != nil {
+		return nil, errors.Wrap(err, "UniverseOfDiscourse.NewElement failed")
+	}
+	err = uOfDPtr.SetUniverseOfDiscourse(&el, trans)
+	if err != nil {
+		return nil, errors.Wrap(err, "UniverseOfDiscourse.NewElement failed")
+	}
 	if actualURI != "" {
-		el.SetURI(actualURI, trans)
+		err = el.SetURI(actualURI, trans)
+		if err != nil {
+			return nil, errors.Wrap(err, "UniverseOfDiscourse.NewElement failed")
+		}
 	}
 	return &el, nil
 }
 
 // NewTransaction creates and initializes a HeldLocks structure utilizing the supplied WaitGroup
 func (uOfDPtr *UniverseOfDiscourse) NewTransaction() *Transaction {
+	return uOfDPtr.NewTransactionWithContext(context.Background())
+}
+
+// NewTransactionWithContext creates and initializes a Transaction whose lock acquisition is bounded by the supplied
+// context. If the context is done while the transaction is waiting for a lock, the attempt fails with an error.
+func (uOfDPtr *UniverseOfDiscourse) NewTransactionWithContext(ctx context.Context) *Transaction {
 	var trans Transaction
+	trans.ctx = ctx
+	trans.sequence = atomic.AddUint64(&transactionSequence, 1)
 	trans.readLocks = make(map[string]Concept)
+	trans.acquiring = make(map[string]chan struct{})
 	trans.writeLocks = make(map[string]Concept)
 	trans.inProgressCalls = make(map[string]bool)
 	trans.uOfD = uOfDPtr
@@ -1074,10 +1305,19 @@ func (uOfDPtr *UniverseOfDiscourse) NewLiteral(trans *Transaction, uri ...string
 	}
 	var lit concept
 	lit.initializeConcept(Literal, conceptID, actualURI)
-	trans.WriteLockElement(&lit)
-	uOfDPtr.SetUniverseOfDiscourse(&lit, trans)
+	err = trans.WriteLockElement(&lit)
+	if err != nil {
+		return nil, errors.Wrap(err, "UniverseOfDiscourse.NewLiteral failed")
+	}
+	err = uOfDPtr.SetUniverseOfDiscourse(&lit, trans)
+	if err != nil {
+		return nil, errors.Wrap(err, "UniverseOfDiscourse.NewLiteral failed")
+	}
 	if actualURI != "" {
-		lit.SetURI(actualURI, trans)
+		err = lit.SetURI(actualURI, trans)
+		if err != nil {
+			return nil, errors.Wrap(err, "UniverseOfDiscourse.NewLiteral failed")
+		}
 	}
 	return &lit, nil
 }
@@ -1196,10 +1436,19 @@ func (uOfDPtr *UniverseOfDiscourse) NewReference(trans *Transaction, uri ...stri
 	}
 	var ref concept
 	ref.initializeConcept(Reference, conceptID, actualURI)
-	trans.WriteLockElement(&ref)
-	uOfDPtr.SetUniverseOfDiscourse(&ref, trans)
+	err = trans.WriteLockElement(&ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "UniverseOfDiscourse.NewReference failed")
+	}
+	err = uOfDPtr.SetUniverseOfDiscourse(&ref, trans)
+	if err != nil {
+		return nil, errors.Wrap(err, "UniverseOfDiscourse.NewReference failed")
+	}
 	if actualURI != "" {
-		ref.SetURI(actualURI, trans)
+		err = ref.SetURI(actualURI, trans)
+		if err != nil {
+			return nil, errors.Wrap(err, "UniverseOfDiscourse.NewReference failed")
+		}
 	}
 	return &ref, nil
 }
@@ -1216,10 +1465,19 @@ func (uOfDPtr *UniverseOfDiscourse) NewRefinement(trans *Transaction, uri ...str
 	}
 	var ref concept
 	ref.initializeConcept(Refinement, conceptID, actualURI)
-	trans.WriteLockElement(&ref)
-	uOfDPtr.SetUniverseOfDiscourse(&ref, trans)
+	err = trans.WriteLockElement(&ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "UniverseOfDiscourse.NewRefinement failed")
+	}
+	err = uOfDPtr.SetUniverseOfDiscourse(&ref, trans)
+	if err != nil {
+		return nil, errors.Wrap(err, "UniverseOfDiscourse.NewRefinement failed")
+	}
 	if actualURI != "" {
-		ref.SetURI(actualURI, trans)
+		err = ref.SetURI(actualURI, trans)
+		if err != nil {
+			return nil, errors.Wrap(err, "UniverseOfDiscourse.NewRefinement failed")
+		}
 	}
 	return &ref, nil
 }
@@ -1276,38 +1534,51 @@ func (uOfDPtr *UniverseOfDiscourse) postChange(el Concept, trans *Transaction) {
 	}
 }
 
+// preChange records the state of the element prior to a change so that the change can be rolled back or undone
 func (uOfDPtr *UniverseOfDiscourse) preChange(el Concept, trans *Transaction) {
-	if el != nil && uOfDPtr.IsRecordingUndo() {
+	if el != nil {
 		uOfDPtr.undoManager.markChangedElement(el, trans)
 	}
 }
 
-// RecoverDomain reconstructs a concept space from its JSON representation
+// RecoverDomain reconstructs a concept space from its JSON representation, applying any migrations needed to bring it
+// up to the current format and domain versions
 func (uOfDPtr *UniverseOfDiscourse) RecoverDomain(data []byte, trans *Transaction) (Concept, error) {
-	var unmarshaledData []json.RawMessage
-	var conceptSpace Concept
-	err := json.Unmarshal(data, &unmarshaledData)
+	conceptSpace, err := uOfDPtr.DecodeDomain(bytes.NewReader(data), trans)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "UniverseOfDiscourse.RecoverDomain failed")
 	}
-	for _, data := range unmarshaledData {
-		var el Concept
-		el, err = uOfDPtr.RecoverElement(data, trans)
+	return conceptSpace, nil
+}
+
+// DecodeDomain reconstructs a concept space from the JSON representation read from the reader, applying any
+// migrations needed to bring it up to the current format and domain versions. Concepts are decoded, migrated, and
+// added to the uOfD one at a time so that the representation of the domain as a whole is never held in memory.
+func (uOfDPtr *UniverseOfDiscourse) DecodeDomain(reader io.Reader, trans *Transaction) (Concept, error) {
+	var conceptSpace Concept
+	err := uOfDPtr.readDomain(reader, nil, func(data []byte) error {
+		el, err := uOfDPtr.RecoverElement(data, trans)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		if el.GetOwningConceptID(trans) == "" {
 			if conceptSpace == nil {
 				conceptSpace = el
 			} else {
-				log.Printf("In UniverseOfDiscourse.RecoverDomain more than one element does not have an owner: %s %s", el.GetLabel(trans), el.GetConceptID(trans))
+				log.Printf("In UniverseOfDiscourse.DecodeDomain more than one element does not have an owner: %s %s", el.GetLabel(trans), el.GetConceptID(trans))
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "UniverseOfDiscourse.DecodeDomain failed")
 	}
 	return conceptSpace, nil
 }
 
-// RecoverElement reconstructs an Element (or subclass) from its JSON representation
+// RecoverElement reconstructs an Element (or subclass) from its JSON representation. Unless bulk loading, a concept
+// whose owner or refinement pointers would violate the structural invariants is rejected with a
+// *StructuralViolationError.
 func (uOfDPtr *UniverseOfDiscourse) RecoverElement(data []byte, trans *Transaction) (Concept, error) {
 	if len(data) == 0 {
 		err := errors.New("RecoverElement called with no data")
@@ -1323,6 +1594,12 @@ func (uOfDPtr *UniverseOfDiscourse) RecoverElement(data []byte, trans *Transacti
 		return nil, err
 	}
 	recoveredElement.uOfD = uOfDPtr
+	if !uOfDPtr.bulkLoading {
+		err = recoveredElement.checkStructure(trans)
+		if err != nil {
+			return nil, errors.Wrap(err, "UniverseOfDiscourse.RecoverElement failed")
+		}
+	}
 	uOfDPtr.addElement(recoveredElement, true, trans)
 	return recoveredElement, nil
 }
@@ -1333,8 +1610,8 @@ func (uOfDPtr *UniverseOfDiscourse) Redo(trans *Transaction) {
 }
 
 func (uOfDPtr *UniverseOfDiscourse) removeElementForUndo(el Concept, trans *Transaction) {
-	if el != nil {
-		trans.ReadLockElement(el)
+	// The element is locked by the transaction unless it has failed, in which case it must not be read
+	if el != nil && trans.ReadLockElement(el) == nil {
 		elID := el.GetConceptID(trans)
 		if uOfDPtr.undoManager.debugUndo {
 			log.Printf("Removing element for undo, id: %s\n", elID)
@@ -1345,6 +1622,10 @@ func (uOfDPtr *UniverseOfDiscourse) removeElementForUndo(el Concept, trans *Tran
 			uOfDPtr.uriUUIDMap.DeleteEntry(uri)
 		}
 		uOfDPtr.deleteUUIDElementMapEntry(elID)
+		// Pointers that still indicate the element, as when its addition is undone, become unresolved
+		if uOfDPtr.listenersMap.GetMappedValues(elID).Cardinality() > 0 {
+			uOfDPtr.unresolvedTargets.Add(elID)
+		}
 		// Remove element from all listener's lists
 		switch el.GetConceptType() {
 		case Reference:
@@ -1387,11 +1668,17 @@ func (uOfDPtr *UniverseOfDiscourse) removeMappedValueFromOwnedIDsMap(ownerID str
 // Elements of that structure that have existing Refinement relationships with original Elements
 // will not be re-created.
 func (uOfDPtr *UniverseOfDiscourse) replicateAsRefinement(original Concept, replicate Concept, trans *Transaction, uri ...string) error {
-	trans.ReadLockElement(original)
-	trans.WriteLockElement(replicate)
+	err := trans.ReadLockElement(original)
+	if err != nil {
+		return errors.Wrap(err, "UniverseOfDiscourse.replicateAsRefinement failed")
+	}
+	err = trans.WriteLockElement(replicate)
+	if err != nil {
+		return errors.Wrap(err, "UniverseOfDiscourse.replicateAsRefinement failed")
+	}
 
 	// Set the attributes - but no IDs
-	err := replicate.SetLabel("Instance of "+original.GetLabel(trans), trans)
+	err = replicate.SetLabel("Instance of "+original.GetLabel(trans), trans)
 	if err != nil {
 		return errors.Wrap(err, "UniverseOfDiscourse.replicateAsRefinement replicate.SetLabel failed")
 	}
@@ -1399,7 +1686,10 @@ func (uOfDPtr *UniverseOfDiscourse) replicateAsRefinement(original Concept, repl
 	case Reference:
 		switch replicate.GetConceptType() {
 		case Reference:
-			replicate.SetReferencedConcept(nil, original.GetReferencedAttributeName(trans), trans)
+			err = replicate.SetReferencedConcept(nil, original.GetReferencedAttributeName(trans), trans)
+			if err != nil {
+				return errors.Wrap(err, "UniverseOfDiscourse.replicateAsRefinement failed")
+			}
 		}
 	}
 
@@ -1413,10 +1703,22 @@ func (uOfDPtr *UniverseOfDiscourse) replicateAsRefinement(original Concept, repl
 		if err != nil {
 			return errors.Wrap(err, "UniverseOfDiscourse.replicateAsRefinement failed: ")
 		}
-		refinement.SetOwningConcept(replicate, trans)
-		refinement.SetAbstractConcept(original, trans)
-		refinement.SetRefinedConcept(replicate, trans)
-		refinement.SetLabel("Refines "+original.GetLabel(trans), trans)
+		err = refinement.SetOwningConcept(replicate, trans)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.replicateAsRefinement failed")
+		}
+		err = refinement.SetAbstractConcept(original, trans)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.replicateAsRefinement failed")
+		}
+		err = refinement.SetRefinedConcept(replicate, trans)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.replicateAsRefinement failed")
+		}
+		err = refinement.SetLabel("Refines "+original.GetLabel(trans), trans)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.replicateAsRefinement failed")
+		}
 	}
 
 	// Now determine which children need to be replicated
@@ -1495,6 +1797,13 @@ func (uOfDPtr *UniverseOfDiscourse) setOwnedIDsMapValues(currentOwnerID string,
 	uOfDPtr.ownedIDsMap.SetMappedValues(currentOwnerID, values)
 }
 
+// SetBulkLoading turns bulk loading on and off. While bulk loading, RecoverElement does not check the structural
+// invariants, so that concepts can be loaded in any order and without the cost of the checks. VerifyStructure should be
+// called once the loading is complete.
+func (uOfDPtr *UniverseOfDiscourse) SetBulkLoading(newSetting bool) {
+	uOfDPtr.bulkLoading = newSetting
+}
+
 // SetRecordingUndo turns undo/redo recording on and off
 func (uOfDPtr *UniverseOfDiscourse) SetRecordingUndo(newSetting bool) {
 	uOfDPtr.undoManager.setRecordingUndo(newSetting)
@@ -1505,7 +1814,10 @@ func (uOfDPtr *UniverseOfDiscourse) SetRecordingUndo(newSetting bool) {
 // the element is operating in which the element may be able to locate other objects
 // by id.
 func (uOfDPtr *UniverseOfDiscourse) SetUniverseOfDiscourse(el Concept, trans *Transaction) error {
-	trans.WriteLockElement(el)
+	err := trans.WriteLockElement(el)
+	if err != nil {
+		return errors.Wrap(err, "UniverseOfDiscourse.SetUniverseOfDiscourse failed")
+	}
 	currentUofD := el.GetUniverseOfDiscourse(trans)
 	if currentUofD != uOfDPtr {
 		if el.GetIsCore(trans) {
@@ -1517,14 +1829,23 @@ func (uOfDPtr *UniverseOfDiscourse) SetUniverseOfDiscourse(el Concept, trans *Tr
 		if el.IsReadOnly(trans) {
 			return errors.New("SetUniverseOfDiscourse called on read-only Element")
 		}
-		el.setUniverseOfDiscourse(uOfDPtr, trans)
-		uOfDPtr.addElement(el, false, trans)
+		err = el.setUniverseOfDiscourse(uOfDPtr, trans)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.SetUniverseOfDiscourse failed")
+		}
+		err = uOfDPtr.addElement(el, false, trans)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.SetUniverseOfDiscourse failed")
+		}
 		elementState, err := NewConceptState(el)
 		if err != nil {
 			return errors.Wrap(err, "UniverseOfDiscourse.SetUniverseOfDiscourse failed")
 		}
 		conceptAddedNotification := uOfDPtr.newUofDConceptAddedNotification(elementState, trans)
-		uOfDPtr.NotifyUofDObservers(conceptAddedNotification, trans)
+		err = uOfDPtr.NotifyUofDObservers(conceptAddedNotification, trans)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.SetUniverseOfDiscourse failed")
+		}
 	}
 	return nil
 }
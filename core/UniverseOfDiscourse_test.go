@@ -1,6 +1,7 @@
 package core
 
 import (
+	"bytes"
 	"reflect"
 	"strings"
 
@@ -105,6 +106,24 @@ var _ = Describe("UniverseOfDiscourse", func() {
 		})
 	})
 
+	Describe("Creating a Concept with a given ConceptID", func() {
+		It("should have the given ConceptID", func() {
+			conceptID := uuid.NewV5(uuid.NamespaceURL, "http://activeCrl.com/test/NewConceptWithID").String()
+			el, err := uOfD.NewConceptWithID(Literal, conceptID, trans)
+			Expect(err).Should(BeNil())
+			Expect(el.GetConceptID(trans)).To(Equal(conceptID))
+			Expect(el.GetConceptType()).To(Equal(Literal))
+			Expect(uOfD.GetElement(conceptID)).To(Equal(el))
+		})
+		It("should reject a ConceptID already in use", func() {
+			el, _ := uOfD.NewElement(trans)
+			_, err := uOfD.NewConceptWithID(Element, el.GetConceptID(trans), trans)
+			Expect(err).ShouldNot(BeNil())
+			_, err = uOfD.NewConceptWithID(Element, "", trans)
+			Expect(err).ShouldNot(BeNil())
+		})
+	})
+
 	Describe("Creating a Reference", func() {
 		Context("without URI specified", func() {
 			It("should not be nil", func() {
@@ -562,4 +581,99 @@ var _ = Describe("UniverseOfDiscourse", func() {
 			Expect(uOfD1.IsEquivalent(hl1, uOfD2, hl2)).To(BeFalse())
 		})
 	})
+
+	Describe("Encoding and decoding domains", func() {
+		var domain Concept
+		var child Concept
+		var grandchild Concept
+
+		BeforeEach(func() {
+			domain, _ = uOfD.NewElement(trans)
+			domain.SetLabel("Domain", trans)
+			child, _ = uOfD.NewOwnedReference(domain, "Child", trans)
+			grandchild, _ = uOfD.NewOwnedLiteral(child, "Grandchild", trans)
+			grandchild.SetLiteralValue("<value>", trans)
+		})
+
+		Specify("EncodeDomain should write the header and one concept per line and DecodeDomain should recover them", func() {
+			var buffer bytes.Buffer
+			Expect(uOfD.EncodeDomain(&buffer, domain, trans)).To(Succeed())
+			Expect(strings.Count(buffer.String(), "\n")).To(Equal(6))
+			uOfD2 := NewUniverseOfDiscourse()
+			trans2 := uOfD2.NewTransaction()
+			defer trans2.ReleaseLocks()
+			recoveredDomain, err := uOfD2.DecodeDomain(&buffer, trans2)
+			Expect(err).To(BeNil())
+			Expect(recoveredDomain.GetConceptID(trans2)).To(Equal(domain.GetConceptID(trans)))
+			recoveredChild := uOfD2.GetReference(child.GetConceptID(trans))
+			Expect(recoveredChild).ToNot(BeNil())
+			Expect(recoveredChild.GetOwningConceptID(trans2)).To(Equal(domain.GetConceptID(trans)))
+			recoveredGrandchild := uOfD2.GetLiteral(grandchild.GetConceptID(trans))
+			Expect(recoveredGrandchild).ToNot(BeNil())
+			Expect(recoveredGrandchild.GetLiteralValue(trans2)).To(Equal("<value>"))
+		})
+		Specify("DecodeDomain should recover a domain serialized as a single-line array", func() {
+			var serializedConcepts []string
+			for _, el := range []Concept{domain, child, grandchild} {
+				serializedConcept, err := el.MarshalJSON()
+				Expect(err).To(BeNil())
+				serializedConcepts = append(serializedConcepts, string(serializedConcept))
+			}
+			uOfD2 := NewUniverseOfDiscourse()
+			trans2 := uOfD2.NewTransaction()
+			defer trans2.ReleaseLocks()
+			recoveredDomain, err := uOfD2.DecodeDomain(strings.NewReader("["+strings.Join(serializedConcepts, ",")+"]"), trans2)
+			Expect(err).To(BeNil())
+			Expect(recoveredDomain.GetConceptID(trans2)).To(Equal(domain.GetConceptID(trans)))
+			Expect(uOfD2.GetLiteral(grandchild.GetConceptID(trans))).ToNot(BeNil())
+		})
+		Specify("DecodeDomain should reject data that is not an array", func() {
+			uOfD2 := NewUniverseOfDiscourse()
+			trans2 := uOfD2.NewTransaction()
+			defer trans2.ReleaseLocks()
+			_, err := uOfD2.DecodeDomain(strings.NewReader("{}"), trans2)
+			Expect(err).ToNot(BeNil())
+		})
+		Specify("EncodeDomainCanonically should order children by label and ConceptID and indent the entries", func() {
+			uOfD.NewOwnedElement(domain, "B", trans)
+			a1, _ := uOfD.NewOwnedElement(domain, "A", trans)
+			a2, _ := uOfD.NewOwnedElement(domain, "A", trans)
+			firstA, secondA := a1, a2
+			if a2.GetConceptID(trans) < a1.GetConceptID(trans) {
+				firstA, secondA = a2, a1
+			}
+			var buffer1 bytes.Buffer
+			Expect(uOfD.EncodeDomainCanonically(&buffer1, domain, trans)).To(Succeed())
+			serialized := buffer1.String()
+			Expect(serialized).To(ContainSubstring("\n  \"ConceptID\": "))
+			firstAIndex := strings.Index(serialized, firstA.GetConceptID(trans))
+			secondAIndex := strings.Index(serialized, secondA.GetConceptID(trans))
+			bIndex := strings.Index(serialized, "\"Label\": \"B\"")
+			childIndex := strings.Index(serialized, "\"Label\": \"Child\"")
+			Expect(firstAIndex).To(BeNumerically("<", secondAIndex))
+			Expect(secondAIndex).To(BeNumerically("<", bIndex))
+			Expect(bIndex).To(BeNumerically("<", childIndex))
+			for i := 0; i < 5; i++ {
+				var buffer2 bytes.Buffer
+				Expect(uOfD.EncodeDomainCanonically(&buffer2, domain, trans)).To(Succeed())
+				Expect(buffer2.String()).To(Equal(serialized))
+			}
+			uOfD2 := NewUniverseOfDiscourse()
+			trans2 := uOfD2.NewTransaction()
+			defer trans2.ReleaseLocks()
+			recoveredDomain, err := uOfD2.DecodeDomain(&buffer1, trans2)
+			Expect(err).To(BeNil())
+			Expect(recoveredDomain.GetConceptID(trans2)).To(Equal(domain.GetConceptID(trans)))
+		})
+		Specify("MarshalDomain and RecoverDomain should round trip", func() {
+			serialized, err := uOfD.MarshalDomain(domain, trans)
+			Expect(err).To(BeNil())
+			uOfD2 := NewUniverseOfDiscourse()
+			trans2 := uOfD2.NewTransaction()
+			defer trans2.ReleaseLocks()
+			recoveredDomain, err := uOfD2.RecoverDomain(serialized, trans2)
+			Expect(err).To(BeNil())
+			Expect(recoveredDomain.GetLabel(trans2)).To(Equal("Domain"))
+		})
+	})
 })
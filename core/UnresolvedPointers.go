@@ -0,0 +1,113 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// A pointer to a concept that is not in the uOfD, as when a domain refers to a concept in a domain that has not yet
+// been loaded, is unresolved. The listenersMap records the pointer under the ID of the missing concept just as it does
+// for a loaded one, and this entry serves as the placeholder for the pointer. The IDs of the missing concepts are kept
+// in the unresolvedTargets. When a concept with one of these IDs is added to the uOfD, its pointers are resolved: each
+// concept holding one is sent an IndicatedConceptChanged notification forwarding the ConceptAdded notification of the
+// target.
+
+// UnresolvedPointer is a ReferencedConceptID, AbstractConceptID, or RefinedConceptID of a concept that indicates a
+// concept that is not in the uOfD
+type UnresolvedPointer struct {
+	ConceptID string
+	Attribute AttributeName
+	TargetID  string
+}
+
+func (pointer UnresolvedPointer) String() string {
+	return fmt.Sprintf("%s of concept %s is the unresolved concept %s", pointer.Attribute.String(), pointer.ConceptID, pointer.TargetID)
+}
+
+// GetUnresolvedPointers returns the unresolved pointers of the concepts in the uOfD ordered by TargetID, then by
+// ConceptID and attribute
+func (uOfDPtr *UniverseOfDiscourse) GetUnresolvedPointers(trans *Transaction) []UnresolvedPointer {
+	var targetIDs []string
+	for targetID := range uOfDPtr.unresolvedTargets.Iter() {
+		targetIDs = append(targetIDs, targetID.(string))
+	}
+	sort.Strings(targetIDs)
+	var unresolvedPointers []UnresolvedPointer
+	for _, targetID := range targetIDs {
+		pointers := uOfDPtr.getPointersTo(targetID, trans)
+		if len(pointers) == 0 || uOfDPtr.GetElement(targetID) != nil {
+			// The pointers have since been changed
+			uOfDPtr.unresolvedTargets.Remove(targetID)
+			continue
+		}
+		unresolvedPointers = append(unresolvedPointers, pointers...)
+	}
+	return unresolvedPointers
+}
+
+// IsUnresolved returns true if the ID is that of a concept that is not in the uOfD but is indicated by a pointer
+func (uOfDPtr *UniverseOfDiscourse) IsUnresolved(conceptID string, trans *Transaction) bool {
+	return uOfDPtr.unresolvedTargets.Contains(conceptID) && uOfDPtr.GetElement(conceptID) == nil && len(uOfDPtr.getPointersTo(conceptID, trans)) > 0
+}
+
+// getPointersTo returns the pointers of the listeners of the concept with the ID that indicate it, ordered by ConceptID
+// and attribute
+func (uOfDPtr *UniverseOfDiscourse) getPointersTo(targetID string, trans *Transaction) []UnresolvedPointer {
+	var pointers []UnresolvedPointer
+	for listenerID := range uOfDPtr.listenersMap.GetMappedValues(targetID).Iter() {
+		listener := uOfDPtr.GetElement(listenerID.(string))
+		if listener == nil {
+			continue
+		}
+		for attribute, pointerTargetID := range integrityPointers(listener, trans) {
+			if pointerTargetID == targetID {
+				pointers = append(pointers, UnresolvedPointer{ConceptID: listenerID.(string), Attribute: attribute, TargetID: targetID})
+			}
+		}
+	}
+	sort.Slice(pointers, func(i, j int) bool {
+		if pointers[i].ConceptID != pointers[j].ConceptID {
+			return pointers[i].ConceptID < pointers[j].ConceptID
+		}
+		return pointers[i].Attribute < pointers[j].Attribute
+	})
+	return pointers
+}
+
+// resolvePointers notifies the concepts whose pointers indicate the newly added concept that the pointers have been
+// resolved
+func (uOfDPtr *UniverseOfDiscourse) resolvePointers(el Concept, trans *Transaction) error {
+	afterState, err := NewConceptState(el)
+	if err != nil {
+		return errors.Wrap(err, "UniverseOfDiscourse.resolvePointers failed")
+	}
+	conceptAddedNotification := uOfDPtr.newUofDConceptAddedNotification(afterState, trans)
+	conceptAddedNotification.reportingElementState = afterState
+	notified := make(map[string]bool)
+	for _, pointer := range uOfDPtr.getPointersTo(el.GetConceptID(trans), trans) {
+		if notified[pointer.ConceptID] {
+			continue
+		}
+		notified[pointer.ConceptID] = true
+		listener := uOfDPtr.GetElement(pointer.ConceptID)
+		notification, err := uOfDPtr.NewForwardingChangeNotification(listener, IndicatedConceptChanged, conceptAddedNotification, trans)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.resolvePointers failed")
+		}
+		err = uOfDPtr.callAssociatedFunctions(listener, notification, trans)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.resolvePointers failed")
+		}
+		err = listener.notifyOwner(notification, trans)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.resolvePointers failed")
+		}
+		err = listener.notifyObservers(notification, trans)
+		if err != nil {
+			return errors.Wrap(err, "UniverseOfDiscourse.resolvePointers failed")
+		}
+	}
+	return nil
+}
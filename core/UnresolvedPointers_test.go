@@ -0,0 +1,101 @@
+package core
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Unresolved pointers", func() {
+	var uOfD *UniverseOfDiscourse
+	var trans *Transaction
+	var reference Concept
+	var refinement Concept
+
+	// recoverState adds a concept with the given state to the uOfD with RecoverElement
+	recoverState := func(state *ConceptState) Concept {
+		data, err := json.Marshal(state)
+		Expect(err).ToNot(HaveOccurred())
+		el, err := uOfD.RecoverElement(data, trans)
+		Expect(err).ToNot(HaveOccurred())
+		return el
+	}
+
+	BeforeEach(func() {
+		uOfD = NewUniverseOfDiscourse()
+		trans = uOfD.NewTransaction()
+		reference = recoverState(&ConceptState{ConceptID: "reference", ConceptType: "Reference", ReferencedConceptID: "target", ReferencedAttributeName: "NoAttribute"})
+		refinement = recoverState(&ConceptState{ConceptID: "refinement", ConceptType: "Refinement", AbstractConceptID: "target", RefinedConceptID: "refined", ReferencedAttributeName: "NoAttribute"})
+	})
+
+	AfterEach(func() {
+		trans.ReleaseLocks()
+	})
+
+	Specify("Pointers to concepts that are not loaded should be unresolved", func() {
+		Expect(uOfD.GetUnresolvedPointers(trans)).To(Equal([]UnresolvedPointer{
+			{ConceptID: "refinement", Attribute: RefinedConceptID, TargetID: "refined"},
+			{ConceptID: "reference", Attribute: ReferencedConceptID, TargetID: "target"},
+			{ConceptID: "refinement", Attribute: AbstractConceptID, TargetID: "target"}}))
+		Expect(uOfD.IsUnresolved("target", trans)).To(BeTrue())
+		Expect(uOfD.IsUnresolved("reference", trans)).To(BeFalse())
+		Expect(reference.GetReferencedConcept(trans)).To(BeNil())
+	})
+
+	Specify("Pointers should be resolved with notifications when the concept is loaded", func() {
+		referenceObserver := &testObserver{}
+		Expect(reference.Register(referenceObserver)).To(Succeed())
+		refinementObserver := &testObserver{}
+		Expect(refinement.Register(refinementObserver)).To(Succeed())
+		target := recoverState(&ConceptState{ConceptID: "target", ConceptType: "Element", Label: "Target", ReferencedAttributeName: "NoAttribute"})
+		Expect(reference.GetReferencedConcept(trans)).To(Equal(target))
+		Expect(refinement.GetAbstractConcept(trans)).To(Equal(target))
+		Expect(uOfD.IsUnresolved("target", trans)).To(BeFalse())
+		Expect(uOfD.GetUnresolvedPointers(trans)).To(Equal([]UnresolvedPointer{{ConceptID: "refinement", Attribute: RefinedConceptID, TargetID: "refined"}}))
+		for _, observer := range []*testObserver{referenceObserver, refinementObserver} {
+			Expect(observer.notifications).To(HaveLen(1))
+			Expect(observer.notifications[0].GetNatureOfChange()).To(Equal(IndicatedConceptChanged))
+			Expect(observer.notifications[0].GetUnderlyingChange().GetNatureOfChange()).To(Equal(ConceptAdded))
+			Expect(observer.notifications[0].GetUnderlyingChange().GetAfterConceptState().Label).To(Equal("Target"))
+		}
+		// The listenersMap is consistent once all of the pointers are resolved
+		recoverState(&ConceptState{ConceptID: "refined", ConceptType: "Element", ReferencedAttributeName: "NoAttribute"})
+		Expect(uOfD.GetUnresolvedPointers(trans)).To(BeEmpty())
+		Expect(CheckIntegrity(uOfD, trans)).To(BeEmpty())
+	})
+
+	Specify("Creating a concept with the ID of an unresolved concept should resolve the pointers", func() {
+		observer := &testObserver{}
+		Expect(reference.Register(observer)).To(Succeed())
+		target, err := uOfD.NewConceptWithID(Element, "target", trans)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reference.GetReferencedConcept(trans)).To(Equal(target))
+		Expect(observer.notifications).ToNot(BeEmpty())
+		Expect(observer.notifications[0].GetNatureOfChange()).To(Equal(IndicatedConceptChanged))
+	})
+
+	Specify("Setting a pointer to a concept that is not loaded should leave it unresolved", func() {
+		newReference, _ := uOfD.NewReference(trans)
+		Expect(newReference.SetReferencedConceptID("elsewhere", ReferencedConceptID, trans)).To(Succeed())
+		Expect(uOfD.IsUnresolved("elsewhere", trans)).To(BeTrue())
+		Expect(newReference.SetReferencedConceptID("", NoAttribute, trans)).To(Succeed())
+		Expect(uOfD.IsUnresolved("elsewhere", trans)).To(BeFalse())
+		Expect(refinement.SetAbstractConceptID("", trans)).To(Succeed())
+		Expect(refinement.SetRefinedConceptID("", trans)).To(Succeed())
+		Expect(reference.SetReferencedConceptID("", NoAttribute, trans)).To(Succeed())
+		Expect(uOfD.GetUnresolvedPointers(trans)).To(BeEmpty())
+		Expect(CheckIntegrity(uOfD, trans)).To(BeEmpty())
+	})
+
+	Specify("Undoing the addition of the concept should leave the pointers unresolved again", func() {
+		uOfD.SetRecordingUndo(true)
+		uOfD.MarkUndoPoint()
+		_, err := uOfD.NewConceptWithID(Element, "target", trans)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(uOfD.IsUnresolved("target", trans)).To(BeFalse())
+		uOfD.Undo(trans)
+		Expect(uOfD.GetElement("target")).To(BeNil())
+		Expect(uOfD.IsUnresolved("target", trans)).To(BeTrue())
+	})
+})
@@ -17,6 +17,8 @@ type UofDManager struct {
 	UofD                        *UniverseOfDiscourse
 	initializationFunctions     []UofDInitializationFunction
 	postInitializationFunctions []UofDPostInitializationFunction
+	domainProviders             []DomainProvider
+	loadedDomains               []LoadedDomain
 }
 
 // AddInitializationFunction adds a function that will be called during the UniverseOfDiscourse initialization. The function is intended
@@ -27,26 +29,72 @@ func (mgr *UofDManager) AddInitializationFunction(function UofDInitializationFun
 
 // AddPostInitializationFunction adds a function that will be called during the UniverseOfDiscourse initialization. The function is intended
 // to be used by applications to perform activities after all core concepts have been added to the uOfD
-func (mgr *UofDManager) AddPostInitializationFunction(function UofDInitializationFunction) {
-	mgr.initializationFunctions = append(mgr.initializationFunctions, function)
+func (mgr *UofDManager) AddPostInitializationFunction(function UofDPostInitializationFunction) {
+	mgr.postInitializationFunctions = append(mgr.postInitializationFunctions, function)
+}
+
+// RegisterDomainProvider adds a provider whose domain will be built during the UniverseOfDiscourse initialization.
+// Providers may be registered in any order: their domains are built after all of the domains on which they depend.
+func (mgr *UofDManager) RegisterDomainProvider(provider DomainProvider) error {
+	if provider == nil {
+		return errors.New("UofDManager.RegisterDomainProvider called with nil provider")
+	}
+	if provider.GetDomainURI() == "" {
+		return errors.New("UofDManager.RegisterDomainProvider called with provider that has no domain URI")
+	}
+	for _, registered := range mgr.domainProviders {
+		if registered.GetDomainURI() == provider.GetDomainURI() {
+			return errors.New("UofDManager.RegisterDomainProvider called with duplicate domain URI: " + provider.GetDomainURI())
+		}
+	}
+	mgr.domainProviders = append(mgr.domainProviders, provider)
+	return nil
+}
+
+// GetDomainProviders returns the registered domain providers in the order in which their domains will be built. An
+// error is returned if a provider depends on a domain that has not been registered or if the dependencies are cyclic.
+func (mgr *UofDManager) GetDomainProviders() ([]DomainProvider, error) {
+	ordered, err := orderDomainProviders(mgr.domainProviders)
+	if err != nil {
+		return nil, errors.Wrap(err, "UofDManager.GetDomainProviders failed")
+	}
+	return ordered, nil
+}
+
+// GetLoadedDomains returns the domains built by the most recent Initialize in the order in which they were built
+func (mgr *UofDManager) GetLoadedDomains() []LoadedDomain {
+	return append([]LoadedDomain{}, mgr.loadedDomains...)
 }
 
 // Initialize establishes an initialized UniverseOfDiscourse. It creates the uOfD, calls all of the initialization functions,
-// and then calls all of the post-initialization functions.
+// builds the domains of the registered providers in dependency order, and then calls all of the post-initialization functions.
 func (mgr *UofDManager) Initialize() error {
 	mgr.UofD = NewUniverseOfDiscourse()
+	mgr.loadedDomains = nil
+	providers, err := mgr.GetDomainProviders()
+	if err != nil {
+		return errors.Wrap(err, "UofDManager.Initialize failed")
+	}
 	trans := mgr.UofD.NewTransaction()
 	defer trans.ReleaseLocks()
 	for _, function := range mgr.initializationFunctions {
 		err := function(mgr.UofD, trans)
 		if err != nil {
-			errors.Wrap(err, "UofDManager.Initialize failed")
+			return errors.Wrap(err, "UofDManager.Initialize failed")
+		}
+	}
+	for _, provider := range providers {
+		err := provider.BuildDomain(mgr.UofD, trans)
+		if err != nil {
+			return errors.Wrap(err, "UofDManager.Initialize failed")
 		}
+		mgr.UofD.SetDomainVersion(provider.GetDomainURI(), provider.GetDomainVersion())
+		mgr.loadedDomains = append(mgr.loadedDomains, LoadedDomain{URI: provider.GetDomainURI(), Version: provider.GetDomainVersion()})
 	}
 	for _, function := range mgr.postInitializationFunctions {
 		err := function(mgr.UofD, trans)
 		if err != nil {
-			errors.Wrap(err, "UofDManager.Initialize failed")
+			return errors.Wrap(err, "UofDManager.Initialize failed")
 		}
 	}
 	return nil
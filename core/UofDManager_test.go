@@ -0,0 +1,72 @@
+package core
+
+import (
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("UofDManager domain provider tests", func() {
+	var mgr *UofDManager
+	var built []string
+	domainAURI := "http://activeCrl.com/test/DomainA"
+	domainBURI := "http://activeCrl.com/test/DomainB"
+	domainCURI := "http://activeCrl.com/test/DomainC"
+
+	newProvider := func(uri string, dependencies ...string) DomainProvider {
+		return NewDomainProvider(uri, "1.0", dependencies, func(uOfD *UniverseOfDiscourse, trans *Transaction) error {
+			for _, dependency := range dependencies {
+				Expect(uOfD.GetElementWithURI(dependency)).ToNot(BeNil())
+			}
+			_, err := uOfD.NewElement(trans, uri)
+			built = append(built, uri)
+			return err
+		})
+	}
+
+	BeforeEach(func() {
+		mgr = &UofDManager{}
+		built = nil
+	})
+
+	Specify("Initialize should build domains after their dependencies", func() {
+		Expect(mgr.RegisterDomainProvider(newProvider(domainCURI, domainAURI, domainBURI))).To(Succeed())
+		Expect(mgr.RegisterDomainProvider(newProvider(domainBURI, domainAURI))).To(Succeed())
+		Expect(mgr.RegisterDomainProvider(newProvider(domainAURI))).To(Succeed())
+		Expect(mgr.Initialize()).To(Succeed())
+		Expect(built).To(Equal([]string{domainAURI, domainBURI, domainCURI}))
+		loaded := mgr.GetLoadedDomains()
+		Expect(loaded).To(HaveLen(3))
+		Expect(loaded[0]).To(Equal(LoadedDomain{URI: domainAURI, Version: "1.0"}))
+		Expect(loaded[2].URI).To(Equal(domainCURI))
+	})
+	Specify("RegisterDomainProvider should reject duplicate URIs", func() {
+		Expect(mgr.RegisterDomainProvider(newProvider(domainAURI))).To(Succeed())
+		Expect(mgr.RegisterDomainProvider(newProvider(domainAURI))).ToNot(Succeed())
+	})
+	Specify("Initialize should report missing dependencies", func() {
+		Expect(mgr.RegisterDomainProvider(newProvider(domainBURI, domainAURI))).To(Succeed())
+		err := mgr.Initialize()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(domainBURI + " requires " + domainAURI))
+		Expect(built).To(BeEmpty())
+		Expect(mgr.GetLoadedDomains()).To(BeEmpty())
+	})
+	Specify("Initialize should report cyclic dependencies", func() {
+		Expect(mgr.RegisterDomainProvider(newProvider(domainAURI, domainCURI))).To(Succeed())
+		Expect(mgr.RegisterDomainProvider(newProvider(domainBURI, domainAURI))).To(Succeed())
+		Expect(mgr.RegisterDomainProvider(newProvider(domainCURI, domainBURI))).To(Succeed())
+		err := mgr.Initialize()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(domainAURI + " -> " + domainCURI + " -> " + domainBURI + " -> " + domainAURI))
+		Expect(built).To(BeEmpty())
+	})
+	Specify("Initialize should call post-initialization functions after building the domains", func() {
+		Expect(mgr.RegisterDomainProvider(newProvider(domainAURI))).To(Succeed())
+		mgr.AddPostInitializationFunction(func(uOfD *UniverseOfDiscourse, trans *Transaction) error {
+			built = append(built, "post")
+			return nil
+		})
+		Expect(mgr.Initialize()).To(Succeed())
+		Expect(built).To(Equal([]string{domainAURI, "post"}))
+	})
+})
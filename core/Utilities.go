@@ -41,9 +41,11 @@ func Equivalent(be1 Concept, hl1 *Transaction, be2 Concept, hl2 *Transaction, pr
 	if (be1 == nil && be2 != nil) || (be1 != nil && be2 == nil) {
 		return false
 	}
-	hl1.ReadLockElement(be1)
-	if be2 != be1 {
-		hl2.ReadLockElement(be2)
+	if hl1.ReadLockElement(be1) != nil {
+		return false
+	}
+	if be2 != be1 && hl2.ReadLockElement(be2) != nil {
+		return false
 	}
 	return equivalent(be1, hl1, be2, hl2, print)
 }
@@ -122,10 +124,9 @@ func Print(el Concept, prefix string, trans *Transaction) {
 }
 
 func printElement(el Concept, prefix string, trans *Transaction) {
-	if el == nil {
+	if el == nil || trans.ReadLockElement(el) != nil {
 		return
 	}
-	trans.ReadLockElement(el)
 	serializedElement, _ := el.MarshalJSON()
 	log.Printf("%s%s", prefix, string(serializedElement))
 	uOfD := el.GetUniverseOfDiscourse(trans)
@@ -0,0 +1,180 @@
+// Copyright 2017, 2018 Paul C. Brown. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// waitForGraph records which transactions hold locks on which concepts and which concept, if any, each transaction
+// is waiting to lock. A transaction waiting for a concept has an edge to every other transaction holding a lock on
+// that concept. A cycle in the graph is a deadlock.
+type waitForGraph struct {
+	sync.Mutex
+	holders  map[Concept]map[*Transaction]bool
+	waiting  map[*Transaction]*lockWait
+	failures map[*Transaction]error
+}
+
+// lockWait is the wait of a transaction for the lock on a concept. The abort channel is closed if the transaction is
+// chosen as the victim of a deadlock.
+type lockWait struct {
+	concept Concept
+	abort   chan struct{}
+}
+
+// lockWaitForGraph is shared by all transactions. Concepts in different UniverseOfDiscourse instances may share
+// identifiers, so the graph is keyed by the concepts themselves.
+var lockWaitForGraph = newWaitForGraph()
+
+func newWaitForGraph() *waitForGraph {
+	var graph waitForGraph
+	graph.holders = make(map[Concept]map[*Transaction]bool)
+	graph.waiting = make(map[*Transaction]*lockWait)
+	graph.failures = make(map[*Transaction]error)
+	return &graph
+}
+
+// waitForEdge records that the waiter is waiting for a concept locked by the holder
+type waitForEdge struct {
+	waiter  *Transaction
+	concept Concept
+	holder  *Transaction
+}
+
+// acquired records that the transaction has obtained a lock on the concept and is no longer waiting
+func (graph *waitForGraph) acquired(trans *Transaction, el Concept) {
+	graph.Lock()
+	defer graph.Unlock()
+	delete(graph.waiting, trans)
+	transactions, ok := graph.holders[el]
+	if !ok {
+		transactions = make(map[*Transaction]bool)
+		graph.holders[el] = transactions
+	}
+	transactions[trans] = true
+}
+
+// getFailure returns the error recorded when the transaction was chosen as the victim of a deadlock
+func (graph *waitForGraph) getFailure(trans *Transaction) error {
+	graph.Lock()
+	defer graph.Unlock()
+	return graph.failures[trans]
+}
+
+// clearFailure discards the error recorded when the transaction was chosen as the victim of a deadlock
+func (graph *waitForGraph) clearFailure(trans *Transaction) {
+	graph.Lock()
+	defer graph.Unlock()
+	delete(graph.failures, trans)
+}
+
+// released removes the transaction as a holder of the concepts and clears any recorded failure
+func (graph *waitForGraph) released(trans *Transaction, els []Concept) {
+	graph.Lock()
+	defer graph.Unlock()
+	for _, el := range els {
+		transactions := graph.holders[el]
+		delete(transactions, trans)
+		if len(transactions) == 0 {
+			delete(graph.holders, el)
+		}
+	}
+	delete(graph.waiting, trans)
+	delete(graph.failures, trans)
+}
+
+// releasedConcept removes the transaction as a holder of the concept, as when its read lock is released to be upgraded
+func (graph *waitForGraph) releasedConcept(trans *Transaction, el Concept) {
+	graph.Lock()
+	defer graph.Unlock()
+	transactions := graph.holders[el]
+	delete(transactions, trans)
+	if len(transactions) == 0 {
+		delete(graph.holders, el)
+	}
+}
+
+// startWaiting records that the transaction is waiting for the concept and checks for a deadlock. If one is found,
+// the youngest transaction in the cycle fails and the error is recorded for it until it releases its locks. If the
+// victim is this transaction the error is also returned; otherwise the victim's wait is aborted. The returned channel
+// is closed if this transaction is later chosen as the victim of a deadlock while it waits.
+func (graph *waitForGraph) startWaiting(trans *Transaction, el Concept) (<-chan struct{}, error) {
+	graph.Lock()
+	defer graph.Unlock()
+	wait := &lockWait{concept: el, abort: make(chan struct{})}
+	graph.waiting[trans] = wait
+	cycle := graph.findCycle(trans, trans, nil, make(map[*Transaction]bool))
+	if cycle == nil {
+		return wait.abort, nil
+	}
+	victim := cycle[0].waiter
+	for _, edge := range cycle {
+		if edge.waiter.sequence > victim.sequence {
+			victim = edge.waiter
+		}
+	}
+	err := errors.New(describeDeadlock(cycle, victim))
+	if TraceLocks {
+		log.Print(err.Error())
+	}
+	graph.failures[victim] = err
+	if victim == trans {
+		delete(graph.waiting, trans)
+		return nil, err
+	}
+	close(graph.waiting[victim].abort)
+	delete(graph.waiting, victim)
+	return wait.abort, nil
+}
+
+// stopWaiting records that the transaction is no longer waiting
+func (graph *waitForGraph) stopWaiting(trans *Transaction) {
+	graph.Lock()
+	defer graph.Unlock()
+	delete(graph.waiting, trans)
+}
+
+// findCycle performs a depth-first search from the current transaction for a path back to the start transaction.
+// The caller is expected to hold the graph lock.
+func (graph *waitForGraph) findCycle(start *Transaction, current *Transaction, path []waitForEdge, visited map[*Transaction]bool) []waitForEdge {
+	visited[current] = true
+	wait, isWaiting := graph.waiting[current]
+	if !isWaiting {
+		return nil
+	}
+	el := wait.concept
+	for holder := range graph.holders[el] {
+		if holder == current {
+			continue
+		}
+		extendedPath := append(path[:len(path):len(path)], waitForEdge{waiter: current, concept: el, holder: holder})
+		if holder == start {
+			return extendedPath
+		}
+		if !visited[holder] {
+			cycle := graph.findCycle(start, holder, extendedPath, visited)
+			if cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// describeDeadlock produces a description of the cycle listing the transactions and concepts involved
+func describeDeadlock(cycle []waitForEdge, victim *Transaction) string {
+	var descriptions []string
+	for _, edge := range cycle {
+		descriptions = append(descriptions, fmt.Sprintf("transaction %d waiting for concept %q (%s) held by transaction %d",
+			edge.waiter.sequence, edge.concept.getLabelNoLock(), edge.concept.getConceptIDNoLock(), edge.holder.sequence))
+	}
+	return fmt.Sprintf("Deadlock detected: %s; failing youngest transaction %d", strings.Join(descriptions, "; "), victim.sequence)
+}
@@ -0,0 +1,119 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Lock wait tests", func() {
+	var uOfD *UniverseOfDiscourse
+	var first Concept
+	var second Concept
+
+	BeforeEach(func() {
+		uOfD = NewUniverseOfDiscourse()
+		trans := uOfD.NewTransaction()
+		first, _ = uOfD.NewElement(trans)
+		first.SetLabel("First", trans)
+		second, _ = uOfD.NewElement(trans)
+		second.SetLabel("Second", trans)
+		trans.Commit()
+	})
+
+	Specify("A lock attempt should fail when the transaction's context times out", func() {
+		holder := uOfD.NewTransaction()
+		defer holder.ReleaseLocks()
+		Expect(holder.WriteLockElement(first)).To(Succeed())
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		waiter := uOfD.NewTransactionWithContext(ctx)
+		defer waiter.ReleaseLocks()
+		err := waiter.ReadLockElement(first)
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("First"))
+		Expect(waiter.Err()).To(Equal(context.DeadlineExceeded))
+		Expect(waiter.readLocks).To(BeEmpty())
+	})
+
+	Specify("A waiting transaction should obtain the lock once it is released", func() {
+		holder := uOfD.NewTransaction()
+		Expect(holder.WriteLockElement(first)).To(Succeed())
+		done := make(chan error)
+		waiter := uOfD.NewTransaction()
+		defer waiter.ReleaseLocks()
+		go func() {
+			done <- waiter.WriteLockElement(first)
+		}()
+		time.Sleep(5 * time.Millisecond)
+		holder.ReleaseLocks()
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	Specify("A read lock should be upgraded once the other readers release the concept", func() {
+		reader := uOfD.NewTransaction()
+		Expect(reader.ReadLockElement(first)).To(Succeed())
+		upgrader := uOfD.NewTransaction()
+		defer upgrader.ReleaseLocks()
+		Expect(first.GetLabel(upgrader)).To(Equal("First"))
+		done := make(chan error)
+		go func() {
+			done <- first.SetLabel("Upgraded", upgrader)
+		}()
+		Consistently(done, 10*time.Millisecond).ShouldNot(Receive())
+		reader.ReleaseLocks()
+		Eventually(done).Should(Receive(BeNil()))
+		Expect(upgrader.readLocks).To(BeEmpty())
+		Expect(first.GetLabel(upgrader)).To(Equal("Upgraded"))
+	})
+
+	Specify("A deadlock should fail the youngest transaction", func() {
+		older := uOfD.NewTransaction()
+		younger := uOfD.NewTransaction()
+		Expect(older.WriteLockElement(first)).To(Succeed())
+		Expect(younger.WriteLockElement(second)).To(Succeed())
+		olderDone := make(chan error)
+		go func() {
+			olderDone <- older.WriteLockElement(second)
+		}()
+		time.Sleep(5 * time.Millisecond)
+		err := younger.WriteLockElement(first)
+		Expect(err).ToNot(BeNil())
+		Expect(strings.Contains(err.Error(), "Deadlock detected")).To(BeTrue())
+		Expect(younger.Err()).ToNot(BeNil())
+		younger.Rollback()
+		Eventually(olderDone).Should(Receive(BeNil()))
+		older.Commit()
+		Expect(younger.Err()).To(BeNil())
+	})
+
+	Specify("A deadlock victim should make no further changes and have its changes rolled back", func() {
+		older := uOfD.NewTransaction()
+		younger := uOfD.NewTransaction()
+		Expect(older.WriteLockElement(first)).To(Succeed())
+		Expect(second.SetLabel("Changed", younger)).To(Succeed())
+		olderDone := make(chan error)
+		go func() {
+			olderDone <- older.WriteLockElement(second)
+		}()
+		time.Sleep(5 * time.Millisecond)
+		Expect(first.SetLabel("Victim", younger)).ToNot(Succeed())
+		Expect(younger.Err()).ToNot(BeNil())
+		// The victim can neither change the concepts it holds nor lock others
+		Expect(second.SetLabel("Victim", younger)).ToNot(Succeed())
+		Expect(second.GetLabel(younger)).To(Equal("Changed"))
+		_, err := uOfD.NewElement(younger)
+		Expect(err).ToNot(BeNil())
+		Expect(uOfD.DeleteElement(second, younger)).ToNot(Succeed())
+		Expect(uOfD.GetElement(second.getConceptIDNoLock())).ToNot(BeNil())
+		younger.ReleaseLocks()
+		Expect(younger.Err()).To(BeNil())
+		Eventually(olderDone).Should(Receive(BeNil()))
+		Expect(first.GetLabel(older)).To(Equal("First"))
+		Expect(second.GetLabel(older)).To(Equal("Second"))
+		older.Commit()
+	})
+})
@@ -259,15 +259,30 @@ func evaluateMultiplicityConstraints(constrainedConcept core.Concept, notificati
 	return nil
 }
 
+// CrlConstraintDomainVersion is the version of the CRL Constraint domain
+var CrlConstraintDomainVersion = "1.0"
+
+// NewCrlConstraintDomainProvider returns the DomainProvider for the CRL Constraint domain
+func NewCrlConstraintDomainProvider() core.DomainProvider {
+	return core.NewDomainProvider(CrlConstraintDomainURI, CrlConstraintDomainVersion, []string{crldatatypesdomain.CrlDataTypesDomainURI},
+		BuildCrlConstraintDomain)
+}
+
 // BuildCrlConstraintDomain constructs the concept space for CRL Constraints
-func BuildCrlConstraintDomain(uOfD *core.UniverseOfDiscourse, trans *core.Transaction) {
+func BuildCrlConstraintDomain(uOfD *core.UniverseOfDiscourse, trans *core.Transaction) error {
 	if uOfD.GetElementWithURI(crldatatypesdomain.CrlDataTypesDomainURI) == nil {
 		crldatatypesdomain.BuildCrlDataTypesDomain(uOfD, trans)
 	}
-	crlConstraintDomain, _ := uOfD.NewElement(trans, CrlConstraintDomainURI)
+	crlConstraintDomain, err := uOfD.NewElement(trans, CrlConstraintDomainURI)
+	if err != nil {
+		return errors.Wrap(err, "BuildCrlConstraintDomain failed")
+	}
 	crlConstraintDomain.SetLabel("CrlConstraintDomain", trans)
 
-	crlConstraintCompliance, _ := uOfD.NewElement(trans, CrlConstraintComplianceURI)
+	crlConstraintCompliance, err := uOfD.NewElement(trans, CrlConstraintComplianceURI)
+	if err != nil {
+		return errors.Wrap(err, "BuildCrlConstraintDomain failed")
+	}
 	crlConstraintCompliance.SetLabel("ConstraintCompliance", trans)
 	crldatatypesdomain.NewOwnedBoolean(crlConstraintCompliance, "Satisfied", trans, CrlConstraintSatisfiedURI)
 	uOfD.NewOwnedReference(crlConstraintCompliance, "ConstraintSpecificationReference", trans, CrlConstraintSpecificationReferenceURI)
@@ -279,5 +294,16 @@ func BuildCrlConstraintDomain(uOfD *core.UniverseOfDiscourse, trans *core.Transa
 	crlMultiplicityConstraintSpecification, _ := uOfD.CreateOwnedRefinementOfConcept(crlConstraintSpecification, crlConstraintDomain, "MultiplicityConstraintSpecification", trans, CrlMultiplicityConstraintSpecificationURI)
 	uOfD.CreateOwnedRefinementOfConceptURI(core.LiteralURI, crlMultiplicityConstraintSpecification, "Multiplicity", trans, CrlMultiplicityConstraintMultiplicityURI)
 	uOfD.CreateOwnedRefinementOfConceptURI(core.ReferenceURI, crlMultiplicityConstraintSpecification, "ConstrainedConceptReference", trans, CrlMultiplicityConstraintConstrainedConceptURI)
+	for _, root := range []core.Concept{crlConstraintDomain, crlConstraintCompliance} {
+		err = root.SetReadOnlyRecursively(true, trans)
+		if err != nil {
+			return errors.Wrap(err, "BuildCrlConstraintDomain failed")
+		}
+		err = root.SetIsCoreRecursively(trans)
+		if err != nil {
+			return errors.Wrap(err, "BuildCrlConstraintDomain failed")
+		}
+	}
 	uOfD.AddFunction(CrlMultiplicityConstrainedURI, evaluateMultiplicityConstraints)
+	return nil
 }
@@ -44,7 +44,14 @@ var _ = Describe("ConstraintSpecification functionality testing", func() {
 	BeforeEach(func() {
 		uOfD = core.NewUniverseOfDiscourse()
 		trans = uOfD.NewTransaction()
-		BuildCrlConstraintDomain(uOfD, trans)
+		Expect(BuildCrlConstraintDomain(uOfD, trans)).To(Succeed())
+	})
+	Specify("The domain and the compliance concept should be core and read-only", func() {
+		for _, uri := range []string{CrlConstraintDomainURI, CrlConstraintComplianceURI, CrlConstraintSatisfiedURI} {
+			el := uOfD.GetElementWithURI(uri)
+			Expect(el.GetIsCore(trans)).To(BeTrue())
+			Expect(el.IsReadOnly(trans)).To(BeTrue())
+		}
 	})
 	Specify("NewMultiplicityConstraintSpecification is properly executed", func() {
 		owner, _ := uOfD.NewElement(trans)
@@ -119,7 +126,7 @@ var _ = Describe("ConstraintCompliance functionality testing", func() {
 	BeforeEach(func() {
 		uOfD = core.NewUniverseOfDiscourse()
 		trans = uOfD.NewTransaction()
-		BuildCrlConstraintDomain(uOfD, trans)
+		Expect(BuildCrlConstraintDomain(uOfD, trans)).To(Succeed())
 		abstractConcept, _ = uOfD.NewElement(trans)
 		reference, _ = uOfD.NewOwnedReference(abstractConcept, "Reference", trans)
 		constraintSpecification, _ = NewMultiplicityConstraintSpecification(abstractConcept, reference, "Reference Constraint", "*", trans)
@@ -142,7 +149,7 @@ var _ = Describe("Multiplicity constrant compliance testing", func() {
 	BeforeEach(func() {
 		uOfD = core.NewUniverseOfDiscourse()
 		trans = uOfD.NewTransaction()
-		BuildCrlConstraintDomain(uOfD, trans)
+		Expect(BuildCrlConstraintDomain(uOfD, trans)).To(Succeed())
 		owner, _ = uOfD.NewElement(trans)
 		owner.SetLabel("Owner", trans)
 		reference, _ = uOfD.NewOwnedReference(owner, "Reference", trans)
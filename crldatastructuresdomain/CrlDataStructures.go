@@ -7,6 +7,18 @@ import (
 // CrlDataStructuresDomainURI is the uri for the concept space that defines the Crl Data Structures
 var CrlDataStructuresDomainURI = "http://activeCRL.com/crldatastructuresdomain/CrlDataStructuresDomain"
 
+// CrlDataStructuresDomainVersion is the version of the CRL Data Structures domain
+var CrlDataStructuresDomainVersion = "1.0"
+
+// NewCrlDataStructuresDomainProvider returns the DomainProvider for the CRL Data Structures domain
+func NewCrlDataStructuresDomainProvider() core.DomainProvider {
+	return core.NewDomainProvider(CrlDataStructuresDomainURI, CrlDataStructuresDomainVersion, nil,
+		func(uOfD *core.UniverseOfDiscourse, trans *core.Transaction) error {
+			BuildCrlDataStructuresDomain(uOfD, trans)
+			return nil
+		})
+}
+
 // BuildCrlDataStructuresDomain constructs the concept space for CRL data structures
 func BuildCrlDataStructuresDomain(uOfD *core.UniverseOfDiscourse, trans *core.Transaction) {
 	crlDataStructures, _ := uOfD.NewElement(trans, CrlDataStructuresDomainURI)
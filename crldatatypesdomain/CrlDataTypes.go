@@ -7,6 +7,18 @@ import (
 // CrlDataTypesDomainURI is the URI for the concpet space that defines the CRL Data Types
 var CrlDataTypesDomainURI = "http://activeCRL.com/crldatastructuresdomain/CrlDataTypes"
 
+// CrlDataTypesDomainVersion is the version of the CRL Data Types domain
+var CrlDataTypesDomainVersion = "1.0"
+
+// NewCrlDataTypesDomainProvider returns the DomainProvider for the CRL Data Types domain
+func NewCrlDataTypesDomainProvider() core.DomainProvider {
+	return core.NewDomainProvider(CrlDataTypesDomainURI, CrlDataTypesDomainVersion, nil,
+		func(uOfD *core.UniverseOfDiscourse, trans *core.Transaction) error {
+			BuildCrlDataTypesDomain(uOfD, trans)
+			return nil
+		})
+}
+
 // BuildCrlDataTypesDomain constructs the concept space for CRL data structures
 func BuildCrlDataTypesDomain(uOfD *core.UniverseOfDiscourse, trans *core.Transaction) {
 	crlDataTypes, _ := uOfD.NewElement(trans, CrlDataTypesDomainURI)
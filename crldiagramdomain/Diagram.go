@@ -51,6 +51,7 @@ const NodePadWidth = 1.0
 
 var goRegularFont *truetype.Font
 var goBoldFont *truetype.Font
+var goItalicFont *truetype.Font
 
 var go12PtRegularFace font.Face
 var go12PtBoldFace font.Face
@@ -561,7 +562,7 @@ func init() {
 		log.Print(err.Error())
 	}
 
-	goItalicFont, err := truetype.Parse(goitalic.TTF)
+	goItalicFont, err = truetype.Parse(goitalic.TTF)
 	if err != nil {
 		log.Print(err.Error())
 	}
@@ -877,6 +878,18 @@ func SetReferencedModelConcept(diagramElement core.Concept, el core.Concept, tra
 	updateDiagramElementForModelElementChange(diagramElement, el, trans)
 }
 
+// CrlDiagramDomainVersion is the version of the CrlDiagram domain
+var CrlDiagramDomainVersion = "1.0"
+
+// NewCrlDiagramDomainProvider returns the DomainProvider for the CrlDiagram domain
+func NewCrlDiagramDomainProvider() core.DomainProvider {
+	return core.NewDomainProvider(CrlDiagramDomainURI, CrlDiagramDomainVersion, []string{crldatatypesdomain.CrlDataTypesDomainURI},
+		func(uOfD *core.UniverseOfDiscourse, trans *core.Transaction) error {
+			BuildCrlDiagramDomain(uOfD, trans)
+			return nil
+		})
+}
+
 // BuildCrlDiagramDomain builds the CrlDiagram concept space and adds it to the uOfD
 func BuildCrlDiagramDomain(uOfD *core.UniverseOfDiscourse, trans *core.Transaction) core.Concept {
 	if uOfD.GetElementWithURI(crldatatypesdomain.CrlDataTypesDomainURI) == nil {
@@ -958,7 +971,10 @@ func BuildCrlDiagramDomain(uOfD *core.UniverseOfDiscourse, trans *core.Transacti
 // updateDiagramElement updates the diagram element
 func updateDiagramElement(diagramElement core.Concept, notification *core.ChangeNotification, trans *core.Transaction) error {
 	uOfD := trans.GetUniverseOfDiscourse()
-	trans.WriteLockElement(diagramElement)
+	err := trans.WriteLockElement(diagramElement)
+	if err != nil {
+		return errors.Wrap(err, "updateDiagramElement failed")
+	}
 	// core Elements should always be ignored
 	if diagramElement.GetIsCore(trans) {
 		return nil
@@ -1219,7 +1235,10 @@ func updateDiagramElement(diagramElement core.Concept, notification *core.Change
 func updateDiagramOwnerPointer(diagramPointer core.Concept, notification *core.ChangeNotification, trans *core.Transaction) error {
 	// There is one change of interest here: the model element's owner has changed
 	uOfD := trans.GetUniverseOfDiscourse()
-	trans.WriteLockElement(diagramPointer)
+	err := trans.WriteLockElement(diagramPointer)
+	if err != nil {
+		return errors.Wrap(err, "updateDiagramOwnerPointer failed")
+	}
 	reportingElement := uOfD.GetElement(notification.GetReportingElementID())
 	diagram := diagramPointer.GetOwningConcept(trans)
 	modelElement := GetReferencedModelConcept(diagramPointer, trans)
@@ -0,0 +1,394 @@
+package crldiagramdomain
+
+import (
+	"image/color"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/pbrown12303/activeCRL/core"
+	"github.com/pbrown12303/activeCRL/images"
+	"github.com/pkg/errors"
+	"golang.org/x/image/font"
+)
+
+// DiagramMargin is the margin left around the diagram content when a diagram is exported
+const DiagramMargin = 10.0
+
+// diagramPoint is a point in diagram coordinates
+type diagramPoint struct {
+	X float64
+	Y float64
+}
+
+// diagramText is a string positioned by the top left corner of its bounding box as measured with its face
+type diagramText struct {
+	text   string
+	face   font.Face
+	left   float64
+	top    float64
+	width  float64
+	height float64
+	// baselineOffset is the distance from the top of the bounding box to the baseline
+	baselineOffset float64
+	// xOffset is the distance from the left of the bounding box to the origin of the first glyph
+	xOffset float64
+}
+
+// diagramNodeLayout is the geometry of a node as rendered by the exporters
+type diagramNodeLayout struct {
+	node             core.Concept
+	x                float64
+	y                float64
+	width            float64
+	height           float64
+	lineColor        color.NRGBA
+	bgColor          color.NRGBA
+	icon             []byte
+	iconX            float64
+	iconY            float64
+	abstractionLabel *diagramText
+	displayLabel     *diagramText
+}
+
+// diagramDecoration is a polygon drawn at an end or at the midpoint of a link, in diagram coordinates
+type diagramDecoration struct {
+	points []diagramPoint
+	solid  bool
+}
+
+// diagramLinkLayout is the geometry of a link as rendered by the exporters
+type diagramLinkLayout struct {
+	link         core.Concept
+	start        diagramPoint
+	end          diagramPoint
+	lineColor    color.NRGBA
+	decorations  []diagramDecoration
+	displayLabel *diagramText
+}
+
+// diagramLayout is the geometry of an entire diagram. The bounds enclose all nodes, links, and labels.
+type diagramLayout struct {
+	nodes []*diagramNodeLayout
+	links []*diagramLinkLayout
+	minX  float64
+	minY  float64
+	maxX  float64
+	maxY  float64
+}
+
+// The decoration polygons are the ones drawn by the Fyne diagram manager. Each is given in a frame whose origin is at
+// the link end (or midpoint) and whose X axis points along the link: toward the target for source and midpoint
+// decorations and toward the source for target decorations.
+
+var referenceArrowheadPoints = []diagramPoint{{X: 0, Y: 0}, {X: 8, Y: 5}, {X: 8, Y: -5}}
+
+var diamondPoints = []diagramPoint{{X: 0, Y: 0}, {X: 8, Y: 4}, {X: 16, Y: 0}, {X: 8, Y: -4}}
+
+var refinementTrianglePoints = []diagramPoint{{X: 0, Y: 8}, {X: 16, Y: 0}, {X: 0, Y: -8}}
+
+var mirrorRefinementTrianglePoints = []diagramPoint{{X: 0, Y: 0}, {X: 16, Y: 8}, {X: 16, Y: -8}}
+
+// black and grey are the default line colors of links and pointers
+var black = color.NRGBA{0, 0, 0, 255}
+var grey = color.NRGBA{153, 153, 153, 255}
+
+// parseCrlColor converts a CRL color string, a single prefix character followed by hexadecimal red, green, blue, and
+// optional alpha values, to a color. The default color is returned for an empty or malformed string.
+func parseCrlColor(crlColor string, defaultColor color.NRGBA) color.NRGBA {
+	if len(crlColor) != 7 && len(crlColor) != 9 {
+		return defaultColor
+	}
+	components := []uint8{255, 255, 255, 255}
+	for i := 0; 1+2*i < len(crlColor); i++ {
+		value, err := strconv.ParseUint(crlColor[1+2*i:3+2*i], 16, 8)
+		if err != nil {
+			return defaultColor
+		}
+		components[i] = uint8(value)
+	}
+	return color.NRGBA{components[0], components[1], components[2], components[3]}
+}
+
+// measureText returns the text measured with the face and positioned with the top left corner of its bounding box at
+// the given location. The measurement is the one used by updateNodeSize.
+func measureText(text string, face font.Face, left float64, top float64) *diagramText {
+	bounds, _ := font.BoundString(face, text)
+	return &diagramText{
+		text:           text,
+		face:           face,
+		left:           left,
+		top:            top,
+		width:          Int26_6ToFloat(bounds.Max.X) - Int26_6ToFloat(bounds.Min.X),
+		height:         Int26_6ToFloat(bounds.Max.Y) - Int26_6ToFloat(bounds.Min.Y),
+		baselineOffset: -Int26_6ToFloat(bounds.Min.Y),
+		xOffset:        -Int26_6ToFloat(bounds.Min.X)}
+}
+
+// getIconPNG returns the PNG image of the icon shown in a node for the model concept
+func getIconPNG(modelConcept core.Concept, trans *core.Transaction) []byte {
+	if modelConcept == nil {
+		return nil
+	}
+	switch modelConcept.GetConceptType() {
+	case core.Reference:
+		return images.ResourceReferenceIconPng.StaticContent
+	case core.Literal:
+		return images.ResourceLiteralIconPng.StaticContent
+	case core.Refinement:
+		return images.ResourceRefinementIconPng.StaticContent
+	case core.Element:
+		if IsDiagram(modelConcept, trans) {
+			return images.ResourceDiagramIconPng.StaticContent
+		}
+		return images.ResourceElementIconPng.StaticContent
+	}
+	return nil
+}
+
+// getAnchoredTextOffset returns the offset of the anchored text, which is zero if it has not been set
+func getAnchoredTextOffset(anchoredText core.Concept, trans *core.Transaction) diagramPoint {
+	var offset diagramPoint
+	if anchoredText == nil {
+		return offset
+	}
+	if literal := anchoredText.GetFirstOwnedLiteralRefinementOfURI(CrlDiagramAnchoredTextOffsetXURI, trans); literal != nil {
+		offset.X, _ = strconv.ParseFloat(literal.GetLiteralValue(trans), 64)
+	}
+	if literal := anchoredText.GetFirstOwnedLiteralRefinementOfURI(CrlDiagramAnchoredTextOffsetYURI, trans); literal != nil {
+		offset.Y, _ = strconv.ParseFloat(literal.GetLiteralValue(trans), 64)
+	}
+	return offset
+}
+
+// sortedDiagramElements returns the diagram's elements that are refinements of the URI, sorted by ConceptID so that
+// exports are repeatable
+func sortedDiagramElements(diagram core.Concept, uri string, trans *core.Transaction) []core.Concept {
+	var elements []core.Concept
+	for _, element := range diagram.GetOwnedConceptsRefinedFromURI(uri, trans) {
+		elements = append(elements, element)
+	}
+	sort.Slice(elements, func(i, j int) bool {
+		return elements[i].GetConceptID(trans) < elements[j].GetConceptID(trans)
+	})
+	return elements
+}
+
+// layoutNode computes the geometry of a node. The icon and the abstraction label form the top row, and the display
+// label is placed beneath them, as in updateNodeSize.
+func layoutNode(node core.Concept, trans *core.Transaction) *diagramNodeLayout {
+	nodeLayout := &diagramNodeLayout{
+		node:      node,
+		x:         GetNodeX(node, trans),
+		y:         GetNodeY(node, trans),
+		width:     GetNodeWidth(node, trans),
+		height:    GetNodeHeight(node, trans),
+		lineColor: parseCrlColor(GetLineColor(node, trans), black),
+		bgColor:   parseCrlColor(GetBGColor(node, trans), color.NRGBA{})}
+	nodeLayout.icon = getIconPNG(GetReferencedModelConcept(node, trans), trans)
+	left := nodeLayout.x + NodeLineWidth + NodePadWidth
+	top := nodeLayout.y + NodeLineWidth + NodePadWidth
+	nodeLayout.iconX = left
+	nodeLayout.iconY = top
+	nodeLayout.abstractionLabel = measureText(GetAbstractionDisplayLabel(node, trans), go10PtItalicFace, left+IconSize+NodePadWidth, top)
+	topHeight := math.Max(IconSize, nodeLayout.abstractionLabel.height)
+	nodeLayout.displayLabel = measureText(GetDisplayLabel(node, trans), go12PtBoldFace, left, top+topHeight+NodePadWidth)
+	return nodeLayout
+}
+
+// layoutDiagram computes the geometry of the diagram's nodes and links. Links whose source or target is not shown in
+// the diagram are omitted.
+func layoutDiagram(diagram core.Concept, trans *core.Transaction) (*diagramLayout, error) {
+	if diagram == nil || !IsDiagram(diagram, trans) {
+		return nil, errors.New("crldiagramdomain.layoutDiagram called with a concept that is not a diagram")
+	}
+	layout := &diagramLayout{}
+	nodeLayouts := make(map[string]*diagramNodeLayout)
+	for _, node := range sortedDiagramElements(diagram, CrlDiagramNodeURI, trans) {
+		nodeLayout := layoutNode(node, trans)
+		layout.nodes = append(layout.nodes, nodeLayout)
+		nodeLayouts[node.GetConceptID(trans)] = nodeLayout
+	}
+	links := sortedDiagramElements(diagram, CrlDiagramLinkURI, trans)
+	linkIDs := make(map[string]bool)
+	for _, link := range links {
+		linkIDs[link.GetConceptID(trans)] = true
+	}
+	// A link may end at the midpoint of another link, so the link geometry is computed recursively
+	linkLayouts := make(map[string]*diagramLinkLayout)
+	visiting := make(map[string]bool)
+	var layoutLink func(link core.Concept) *diagramLinkLayout
+	var center func(element core.Concept) (diagramPoint, bool)
+	center = func(element core.Concept) (diagramPoint, bool) {
+		if element == nil {
+			return diagramPoint{}, false
+		}
+		if nodeLayout, found := nodeLayouts[element.GetConceptID(trans)]; found {
+			return diagramPoint{X: nodeLayout.x + nodeLayout.width/2, Y: nodeLayout.y + nodeLayout.height/2}, true
+		}
+		if !linkIDs[element.GetConceptID(trans)] {
+			return diagramPoint{}, false
+		}
+		linkLayout := layoutLink(element)
+		if linkLayout == nil {
+			return diagramPoint{}, false
+		}
+		return midpoint(linkLayout.start, linkLayout.end), true
+	}
+	layoutLink = func(link core.Concept) *diagramLinkLayout {
+		linkID := link.GetConceptID(trans)
+		if linkLayout, found := linkLayouts[linkID]; found || visiting[linkID] {
+			return linkLayout
+		}
+		visiting[linkID] = true
+		defer delete(visiting, linkID)
+		source := GetLinkSource(link, trans)
+		target := GetLinkTarget(link, trans)
+		sourceCenter, sourceFound := center(source)
+		targetCenter, targetFound := center(target)
+		if !sourceFound || !targetFound {
+			return nil
+		}
+		linkLayout := &diagramLinkLayout{link: link, start: sourceCenter, end: targetCenter}
+		if nodeLayout, found := nodeLayouts[source.GetConceptID(trans)]; found {
+			linkLayout.start = clipToNode(nodeLayout, targetCenter)
+		}
+		if nodeLayout, found := nodeLayouts[target.GetConceptID(trans)]; found {
+			linkLayout.end = clipToNode(nodeLayout, sourceCenter)
+		}
+		defaultColor := black
+		if IsDiagramPointer(link, trans) {
+			defaultColor = grey
+		}
+		linkLayout.lineColor = parseCrlColor(GetLineColor(link, trans), defaultColor)
+		forward := direction(linkLayout.start, linkLayout.end)
+		backward := diagramPoint{X: -forward.X, Y: -forward.Y}
+		mid := midpoint(linkLayout.start, linkLayout.end)
+		switch {
+		case IsDiagramReferenceLink(link, trans):
+			linkLayout.addDecoration(referenceArrowheadPoints, linkLayout.end, backward, true)
+			linkLayout.addDecoration(diamondPoints, linkLayout.start, forward, true)
+		case IsDiagramAbstractPointer(link, trans):
+			linkLayout.addDecoration(refinementTrianglePoints, linkLayout.start, forward, false)
+		case IsDiagramElementPointer(link, trans):
+			linkLayout.addDecoration(referenceArrowheadPoints, linkLayout.end, backward, true)
+		case IsDiagramOwnerPointer(link, trans):
+			linkLayout.addDecoration(diamondPoints, linkLayout.end, backward, true)
+		case IsDiagramRefinedPointer(link, trans):
+			linkLayout.addDecoration(mirrorRefinementTrianglePoints, linkLayout.start, forward, false)
+		case IsDiagramRefinementLink(link, trans):
+			linkLayout.addDecoration(refinementTrianglePoints, mid, forward, false)
+		}
+		// Display labels are not shown for pointers
+		if !IsDiagramPointer(link, trans) {
+			label := GetDisplayLabel(link, trans)
+			if label != "" {
+				offset := getAnchoredTextOffset(link.GetFirstOwnedConceptRefinedFromURI(CrlDiagramLinkDisplayLabelURI, trans), trans)
+				text := measureText(label, go12PtRegularFace, 0, 0)
+				text.left = mid.X + offset.X - text.width/2
+				text.top = mid.Y + offset.Y - text.height/2
+				linkLayout.displayLabel = text
+			}
+		}
+		linkLayouts[linkID] = linkLayout
+		return linkLayout
+	}
+	for _, link := range links {
+		linkLayout := layoutLink(link)
+		if linkLayout != nil {
+			layout.links = append(layout.links, linkLayout)
+		}
+	}
+	layout.computeBounds()
+	return layout, nil
+}
+
+// addDecoration places the polygon with its origin at the given point and its X axis along the given direction
+func (linkLayout *diagramLinkLayout) addDecoration(polygon []diagramPoint, origin diagramPoint, xAxis diagramPoint, solid bool) {
+	decoration := diagramDecoration{solid: solid}
+	for _, point := range polygon {
+		decoration.points = append(decoration.points, diagramPoint{
+			X: origin.X + point.X*xAxis.X - point.Y*xAxis.Y,
+			Y: origin.Y + point.X*xAxis.Y + point.Y*xAxis.X})
+	}
+	linkLayout.decorations = append(linkLayout.decorations, decoration)
+}
+
+// computeBounds sets the bounds of the layout to enclose all of its content
+func (layout *diagramLayout) computeBounds() {
+	first := true
+	include := func(x float64, y float64) {
+		if first {
+			layout.minX, layout.maxX, layout.minY, layout.maxY = x, x, y, y
+			first = false
+			return
+		}
+		layout.minX = math.Min(layout.minX, x)
+		layout.maxX = math.Max(layout.maxX, x)
+		layout.minY = math.Min(layout.minY, y)
+		layout.maxY = math.Max(layout.maxY, y)
+	}
+	includeText := func(text *diagramText) {
+		if text != nil && text.text != "" {
+			include(text.left, text.top)
+			include(text.left+text.width, text.top+text.height)
+		}
+	}
+	for _, nodeLayout := range layout.nodes {
+		include(nodeLayout.x, nodeLayout.y)
+		include(nodeLayout.x+nodeLayout.width, nodeLayout.y+nodeLayout.height)
+		includeText(nodeLayout.abstractionLabel)
+		includeText(nodeLayout.displayLabel)
+	}
+	for _, linkLayout := range layout.links {
+		include(linkLayout.start.X, linkLayout.start.Y)
+		include(linkLayout.end.X, linkLayout.end.Y)
+		for _, decoration := range linkLayout.decorations {
+			for _, point := range decoration.points {
+				include(point.X, point.Y)
+			}
+		}
+		includeText(linkLayout.displayLabel)
+	}
+	layout.minX -= DiagramMargin
+	layout.minY -= DiagramMargin
+	layout.maxX += DiagramMargin
+	layout.maxY += DiagramMargin
+}
+
+// clipToNode returns the point at which the line from the center of the node toward the given point crosses the
+// node's border
+func clipToNode(nodeLayout *diagramNodeLayout, toward diagramPoint) diagramPoint {
+	center := diagramPoint{X: nodeLayout.x + nodeLayout.width/2, Y: nodeLayout.y + nodeLayout.height/2}
+	dx := toward.X - center.X
+	dy := toward.Y - center.Y
+	if dx == 0 && dy == 0 {
+		return center
+	}
+	scale := math.Inf(1)
+	if dx != 0 {
+		scale = math.Min(scale, nodeLayout.width/2/math.Abs(dx))
+	}
+	if dy != 0 {
+		scale = math.Min(scale, nodeLayout.height/2/math.Abs(dy))
+	}
+	if scale > 1 {
+		scale = 1
+	}
+	return diagramPoint{X: center.X + dx*scale, Y: center.Y + dy*scale}
+}
+
+// direction returns the unit vector pointing from one point to another, or the X axis if the points coincide
+func direction(from diagramPoint, to diagramPoint) diagramPoint {
+	dx := to.X - from.X
+	dy := to.Y - from.Y
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return diagramPoint{X: 1, Y: 0}
+	}
+	return diagramPoint{X: dx / length, Y: dy / length}
+}
+
+func midpoint(a diagramPoint, b diagramPoint) diagramPoint {
+	return diagramPoint{X: (a.X + b.X) / 2, Y: (a.Y + b.Y) / 2}
+}
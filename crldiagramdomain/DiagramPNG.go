@@ -0,0 +1,195 @@
+package crldiagramdomain
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/pbrown12303/activeCRL/core"
+	"github.com/pkg/errors"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// ExportDiagramPNG writes the diagram as a PNG image on a white background. Each diagram unit is drawn as scale
+// pixels. The diagram is drawn as by ExportDiagramSVG, with text rendered in the faces used by updateNodeSize so that
+// at a scale of 1 the rendered text has exactly the measured extent; at other scales the faces are rebuilt at the
+// scaled resolution. Glyphs are drawn on whole-pixel baselines, so text may be shifted by up to half a pixel.
+// Rendering uses only golang.org/x/image and freetype, so no display is required.
+func ExportDiagramPNG(diagram core.Concept, writer io.Writer, scale float64, trans *core.Transaction) error {
+	if scale <= 0 || math.IsNaN(scale) || math.IsInf(scale, 0) {
+		return errors.New("crldiagramdomain.ExportDiagramPNG called with invalid scale")
+	}
+	layout, err := layoutDiagram(diagram, trans)
+	if err != nil {
+		return errors.Wrap(err, "crldiagramdomain.ExportDiagramPNG failed")
+	}
+	raster := newDiagramRaster(layout, scale)
+	for _, nodeLayout := range layout.nodes {
+		err = raster.drawNode(nodeLayout)
+		if err != nil {
+			return errors.Wrap(err, "crldiagramdomain.ExportDiagramPNG failed")
+		}
+	}
+	for _, linkLayout := range layout.links {
+		raster.drawLink(linkLayout)
+	}
+	err = png.Encode(writer, raster.img)
+	if err != nil {
+		return errors.Wrap(err, "crldiagramdomain.ExportDiagramPNG failed")
+	}
+	return nil
+}
+
+// diagramRaster draws a diagram layout into an image, mapping diagram coordinates to pixels
+type diagramRaster struct {
+	img   *image.RGBA
+	minX  float64
+	minY  float64
+	scale float64
+	faces map[font.Face]font.Face
+}
+
+func newDiagramRaster(layout *diagramLayout, scale float64) *diagramRaster {
+	width := int(math.Ceil((layout.maxX - layout.minX) * scale))
+	height := int(math.Ceil((layout.maxY - layout.minY) * scale))
+	raster := &diagramRaster{
+		img:   image.NewRGBA(image.Rect(0, 0, width, height)),
+		minX:  layout.minX,
+		minY:  layout.minY,
+		scale: scale,
+		faces: make(map[font.Face]font.Face)}
+	draw.Draw(raster.img, raster.img.Bounds(), image.White, image.Point{}, draw.Src)
+	return raster
+}
+
+// toPixel converts a point in diagram coordinates to image coordinates
+func (raster *diagramRaster) toPixel(point diagramPoint) diagramPoint {
+	return diagramPoint{X: (point.X - raster.minX) * raster.scale, Y: (point.Y - raster.minY) * raster.scale}
+}
+
+// scaledFace returns the face to use in place of the given face at the raster's scale
+func (raster *diagramRaster) scaledFace(face font.Face) font.Face {
+	if raster.scale == 1 {
+		return face
+	}
+	if scaled, found := raster.faces[face]; found {
+		return scaled
+	}
+	scaled := face
+	switch face {
+	case go12PtRegularFace:
+		scaled = truetype.NewFace(goRegularFont, &truetype.Options{Size: 12.0, DPI: 72 * raster.scale})
+	case go12PtBoldFace:
+		scaled = truetype.NewFace(goBoldFont, &truetype.Options{Size: 12.0, DPI: 72 * raster.scale})
+	case go10PtRegularFace:
+		scaled = truetype.NewFace(goRegularFont, &truetype.Options{Size: 10.0, DPI: 72 * raster.scale})
+	case go10PtItalicFace:
+		scaled = truetype.NewFace(goItalicFont, &truetype.Options{Size: 10.0, DPI: 72 * raster.scale})
+	}
+	raster.faces[face] = scaled
+	return scaled
+}
+
+// fillPolygon fills the polygon, given in image coordinates. Each additional contour is filled with the non-zero
+// winding rule, so a contour wound opposite to the first cuts a hole in it.
+func (raster *diagramRaster) fillPolygon(fillColor color.NRGBA, contours ...[]diagramPoint) {
+	if fillColor.A == 0 {
+		return
+	}
+	bounds := raster.img.Bounds()
+	rasterizer := vector.NewRasterizer(bounds.Dx(), bounds.Dy())
+	for _, contour := range contours {
+		if len(contour) < 3 {
+			continue
+		}
+		rasterizer.MoveTo(float32(contour[0].X), float32(contour[0].Y))
+		for _, point := range contour[1:] {
+			rasterizer.LineTo(float32(point.X), float32(point.Y))
+		}
+		rasterizer.ClosePath()
+	}
+	rasterizer.Draw(raster.img, bounds, image.NewUniform(fillColor), image.Point{})
+}
+
+// strokeSegment draws a line of the given width, in image coordinates, between two points
+func (raster *diagramRaster) strokeSegment(from diagramPoint, to diagramPoint, width float64, strokeColor color.NRGBA) {
+	along := direction(from, to)
+	across := diagramPoint{X: -along.Y * width / 2, Y: along.X * width / 2}
+	raster.fillPolygon(strokeColor, []diagramPoint{
+		{X: from.X + across.X, Y: from.Y + across.Y},
+		{X: to.X + across.X, Y: to.Y + across.Y},
+		{X: to.X - across.X, Y: to.Y - across.Y},
+		{X: from.X - across.X, Y: from.Y - across.Y}})
+}
+
+// drawText draws the text so that its bounding box, as measured with its face, has its top left corner at the
+// text's position
+func (raster *diagramRaster) drawText(text *diagramText, textColor color.NRGBA) {
+	if text == nil || text.text == "" {
+		return
+	}
+	origin := raster.toPixel(diagramPoint{X: text.left + text.xOffset, Y: text.top + text.baselineOffset})
+	drawer := font.Drawer{
+		Dst:  raster.img,
+		Src:  image.NewUniform(textColor),
+		Face: raster.scaledFace(text.face),
+		Dot:  fixed.Point26_6{X: fixed.Int26_6(math.Round(origin.X * 64)), Y: fixed.Int26_6(math.Round(origin.Y * 64))}}
+	drawer.DrawString(text.text)
+}
+
+func (raster *diagramRaster) drawNode(nodeLayout *diagramNodeLayout) error {
+	topLeft := raster.toPixel(diagramPoint{X: nodeLayout.x, Y: nodeLayout.y})
+	bottomRight := raster.toPixel(diagramPoint{X: nodeLayout.x + nodeLayout.width, Y: nodeLayout.y + nodeLayout.height})
+	outer := []diagramPoint{topLeft, {X: bottomRight.X, Y: topLeft.Y}, bottomRight, {X: topLeft.X, Y: bottomRight.Y}}
+	raster.fillPolygon(nodeLayout.bgColor, outer)
+	// The border is centered on the node's edges, as in the SVG rendering
+	halfLine := NodeLineWidth * raster.scale / 2
+	borderOuter := []diagramPoint{
+		{X: topLeft.X - halfLine, Y: topLeft.Y - halfLine},
+		{X: bottomRight.X + halfLine, Y: topLeft.Y - halfLine},
+		{X: bottomRight.X + halfLine, Y: bottomRight.Y + halfLine},
+		{X: topLeft.X - halfLine, Y: bottomRight.Y + halfLine}}
+	borderInner := []diagramPoint{
+		{X: topLeft.X + halfLine, Y: topLeft.Y + halfLine},
+		{X: topLeft.X + halfLine, Y: bottomRight.Y - halfLine},
+		{X: bottomRight.X - halfLine, Y: bottomRight.Y - halfLine},
+		{X: bottomRight.X - halfLine, Y: topLeft.Y + halfLine}}
+	raster.fillPolygon(nodeLayout.lineColor, borderOuter, borderInner)
+	if nodeLayout.icon != nil {
+		icon, err := png.Decode(bytes.NewReader(nodeLayout.icon))
+		if err != nil {
+			return errors.Wrap(err, "diagramRaster.drawNode failed to decode icon")
+		}
+		iconTopLeft := raster.toPixel(diagramPoint{X: nodeLayout.iconX, Y: nodeLayout.iconY})
+		iconBottomRight := raster.toPixel(diagramPoint{X: nodeLayout.iconX + IconSize, Y: nodeLayout.iconY + IconSize})
+		iconRect := image.Rect(int(math.Round(iconTopLeft.X)), int(math.Round(iconTopLeft.Y)), int(math.Round(iconBottomRight.X)), int(math.Round(iconBottomRight.Y)))
+		draw.CatmullRom.Scale(raster.img, iconRect, icon, icon.Bounds(), draw.Over, nil)
+	}
+	raster.drawText(nodeLayout.abstractionLabel, black)
+	raster.drawText(nodeLayout.displayLabel, black)
+	return nil
+}
+
+func (raster *diagramRaster) drawLink(linkLayout *diagramLinkLayout) {
+	raster.strokeSegment(raster.toPixel(linkLayout.start), raster.toPixel(linkLayout.end), raster.scale, linkLayout.lineColor)
+	for _, decoration := range linkLayout.decorations {
+		var points []diagramPoint
+		for _, point := range decoration.points {
+			points = append(points, raster.toPixel(point))
+		}
+		if decoration.solid {
+			raster.fillPolygon(linkLayout.lineColor, points)
+		}
+		for i := range points {
+			raster.strokeSegment(points[i], points[(i+1)%len(points)], raster.scale, linkLayout.lineColor)
+		}
+	}
+	raster.drawText(linkLayout.displayLabel, linkLayout.lineColor)
+}
@@ -0,0 +1,101 @@
+package crldiagramdomain
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+	"github.com/pbrown12303/activeCRL/core"
+)
+
+// inkBounds returns the bounds of the pixels in the image that are not white
+func inkBounds(img image.Image) image.Rectangle {
+	var ink image.Rectangle
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if color.NRGBAModel.Convert(img.At(x, y)) != (color.NRGBA{255, 255, 255, 255}) {
+				ink = ink.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return ink
+}
+
+var _ = Describe("Diagram PNG export", func() {
+	var uOfD *core.UniverseOfDiscourse
+	var trans *core.Transaction
+	var diagram core.Concept
+
+	BeforeEach(func() {
+		uOfD = core.NewUniverseOfDiscourse()
+		trans = uOfD.NewTransaction()
+		BuildCrlDiagramDomain(uOfD, trans)
+		diagram = buildExportTestDiagram(uOfD, trans)
+	})
+
+	AfterEach(func() {
+		trans.ReleaseLocks()
+	})
+
+	Specify("ExportDiagramPNG should write an image of the scaled diagram bounds", func() {
+		layout, err := layoutDiagram(diagram, trans)
+		Expect(err).ToNot(HaveOccurred())
+		for _, scale := range []float64{1, 2.5} {
+			var buffer bytes.Buffer
+			Expect(ExportDiagramPNG(diagram, &buffer, scale, trans)).To(Succeed())
+			img, err := png.Decode(&buffer)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(img.Bounds().Dx()).To(Equal(int(math.Ceil((layout.maxX - layout.minX) * scale))))
+			Expect(img.Bounds().Dy()).To(Equal(int(math.Ceil((layout.maxY - layout.minY) * scale))))
+			Expect(inkBounds(img).Empty()).To(BeFalse())
+		}
+	})
+
+	Specify("Rendered labels should fill the space measured by updateNodeSize", func() {
+		layout, err := layoutDiagram(diagram, trans)
+		Expect(err).ToNot(HaveOccurred())
+		for _, nodeLayout := range layout.nodes {
+			for _, text := range []*diagramText{nodeLayout.displayLabel, nodeLayout.abstractionLabel} {
+				if text.text == "" {
+					continue
+				}
+				raster := newDiagramRaster(layout, 1)
+				raster.drawText(text, black)
+				ink := inkBounds(raster.img)
+				// The faces place glyphs on whole-pixel baselines, so the ink may lie up to a pixel outside the pixels
+				// covered by the measured box, but its extent is that of the measured box
+				topLeft := raster.toPixel(diagramPoint{X: text.left, Y: text.top})
+				bottomRight := raster.toPixel(diagramPoint{X: text.left + text.width, Y: text.top + text.height})
+				measured := image.Rect(int(math.Floor(topLeft.X)), int(math.Floor(topLeft.Y)), int(math.Ceil(bottomRight.X)), int(math.Ceil(bottomRight.Y)))
+				Expect(ink.In(measured.Inset(-1))).To(BeTrue(), text.text)
+				Expect(float64(ink.Dx())).To(BeNumerically("~", math.Ceil(text.width), 1), text.text)
+				Expect(float64(ink.Dy())).To(BeNumerically("~", math.Ceil(text.height), 1), text.text)
+			}
+		}
+	})
+
+	Specify("Node backgrounds and borders should be drawn in the diagram colors", func() {
+		var buffer bytes.Buffer
+		Expect(ExportDiagramPNG(diagram, &buffer, 1, trans)).To(Succeed())
+		img, err := png.Decode(&buffer)
+		Expect(err).ToNot(HaveOccurred())
+		layout, _ := layoutDiagram(diagram, trans)
+		nodeLayout := layout.nodes[0]
+		border := color.NRGBAModel.Convert(img.At(int(nodeLayout.x-layout.minX+nodeLayout.width/2), int(nodeLayout.y-layout.minY))).(color.NRGBA)
+		Expect(border).To(Equal(color.NRGBA{0, 0, 0, 255}))
+		// The background is half-transparent #ffffcc over white
+		background := color.NRGBAModel.Convert(img.At(int(nodeLayout.x-layout.minX+nodeLayout.width-4), int(nodeLayout.y-layout.minY+4))).(color.NRGBA)
+		Expect(background.R).To(Equal(uint8(255)))
+		Expect(background.B).To(BeNumerically("~", 229, 2))
+	})
+
+	Specify("ExportDiagramPNG should reject an invalid scale", func() {
+		Expect(ExportDiagramPNG(diagram, &bytes.Buffer{}, 0, trans)).ToNot(Succeed())
+		Expect(ExportDiagramPNG(diagram, &bytes.Buffer{}, math.NaN(), trans)).ToNot(Succeed())
+	})
+})
@@ -0,0 +1,165 @@
+package crldiagramdomain
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pbrown12303/activeCRL/core"
+	"github.com/pkg/errors"
+)
+
+// ExportDiagramSVG writes the diagram as an SVG document. Nodes are drawn with their icons, abstraction labels, and
+// display labels using the positions, sizes, and colors recorded in the diagram. Links are drawn with the decorations
+// shown by the editor: reference arrowheads, owner diamonds, and refinement triangles. Text is drawn in the Go fonts
+// with its length fixed to the length measured when the node was sized, so that it fits the node whatever font the
+// viewer substitutes. No display is required.
+func ExportDiagramSVG(diagram core.Concept, writer io.Writer, trans *core.Transaction) error {
+	layout, err := layoutDiagram(diagram, trans)
+	if err != nil {
+		return errors.Wrap(err, "crldiagramdomain.ExportDiagramSVG failed")
+	}
+	bufferedWriter := bufio.NewWriter(writer)
+	svg := &textWriter{writer: bufferedWriter}
+	width := layout.maxX - layout.minX
+	height := layout.maxY - layout.minY
+	svg.printf("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	svg.printf("<svg xmlns=\"http://www.w3.org/2000/svg\" xmlns:xlink=\"http://www.w3.org/1999/xlink\" width=\"%s\" height=\"%s\" viewBox=\"%s %s %s %s\">\n",
+		svgNumber(width), svgNumber(height), svgNumber(layout.minX), svgNumber(layout.minY), svgNumber(width), svgNumber(height))
+	svg.printf("  <title>%s</title>\n", svgEscape(diagram.GetLabel(trans)))
+	for _, nodeLayout := range layout.nodes {
+		svg.writeNode(nodeLayout, trans)
+	}
+	for _, linkLayout := range layout.links {
+		svg.writeLink(linkLayout, trans)
+	}
+	svg.printf("</svg>\n")
+	if svg.err != nil {
+		return errors.Wrap(svg.err, "crldiagramdomain.ExportDiagramSVG failed")
+	}
+	err = bufferedWriter.Flush()
+	if err != nil {
+		return errors.Wrap(err, "crldiagramdomain.ExportDiagramSVG failed")
+	}
+	return nil
+}
+
+// textWriter writes formatted text, retaining the first error encountered
+type textWriter struct {
+	writer io.Writer
+	err    error
+}
+
+func (svg *textWriter) printf(format string, args ...interface{}) {
+	if svg.err != nil {
+		return
+	}
+	_, svg.err = fmt.Fprintf(svg.writer, format, args...)
+}
+
+func (svg *textWriter) writeNode(nodeLayout *diagramNodeLayout, trans *core.Transaction) {
+	svg.printf("  <g id=\"%s\" class=\"crl-node\">\n", svgEscape(nodeLayout.node.GetConceptID(trans)))
+	svg.printf("    <rect x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\" %s %s stroke-width=\"%s\"/>\n",
+		svgNumber(nodeLayout.x), svgNumber(nodeLayout.y), svgNumber(nodeLayout.width), svgNumber(nodeLayout.height),
+		svgPaint("fill", nodeLayout.bgColor), svgPaint("stroke", nodeLayout.lineColor), svgNumber(NodeLineWidth))
+	if nodeLayout.icon != nil {
+		svg.printf("    <image x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\" xlink:href=\"data:image/png;base64,%s\"/>\n",
+			svgNumber(nodeLayout.iconX), svgNumber(nodeLayout.iconY), svgNumber(IconSize), svgNumber(IconSize),
+			base64.StdEncoding.EncodeToString(nodeLayout.icon))
+	}
+	svg.writeText(nodeLayout.abstractionLabel, black)
+	svg.writeText(nodeLayout.displayLabel, black)
+	svg.printf("  </g>\n")
+}
+
+func (svg *textWriter) writeLink(linkLayout *diagramLinkLayout, trans *core.Transaction) {
+	svg.printf("  <g id=\"%s\" class=\"crl-link %s\">\n", svgEscape(linkLayout.link.GetConceptID(trans)), svgLinkClass(linkLayout.link, trans))
+	svg.printf("    <line x1=\"%s\" y1=\"%s\" x2=\"%s\" y2=\"%s\" %s stroke-width=\"1\"/>\n",
+		svgNumber(linkLayout.start.X), svgNumber(linkLayout.start.Y), svgNumber(linkLayout.end.X), svgNumber(linkLayout.end.Y),
+		svgPaint("stroke", linkLayout.lineColor))
+	for _, decoration := range linkLayout.decorations {
+		var points []string
+		for _, point := range decoration.points {
+			points = append(points, svgNumber(point.X)+","+svgNumber(point.Y))
+		}
+		fill := "fill=\"none\""
+		if decoration.solid {
+			fill = svgPaint("fill", linkLayout.lineColor)
+		}
+		svg.printf("    <polygon points=\"%s\" %s %s stroke-width=\"1\"/>\n", strings.Join(points, " "), fill, svgPaint("stroke", linkLayout.lineColor))
+	}
+	svg.writeText(linkLayout.displayLabel, linkLayout.lineColor)
+	svg.printf("  </g>\n")
+}
+
+// writeText writes the text with its baseline and length set from its measurement
+func (svg *textWriter) writeText(text *diagramText, textColor color.NRGBA) {
+	if text == nil || text.text == "" {
+		return
+	}
+	style := "font-family=\"Go, sans-serif\" font-size=\"12\""
+	switch text.face {
+	case go12PtBoldFace:
+		style = "font-family=\"Go, sans-serif\" font-size=\"12\" font-weight=\"bold\""
+	case go10PtItalicFace:
+		style = "font-family=\"Go, sans-serif\" font-size=\"10\" font-style=\"italic\""
+	case go10PtRegularFace:
+		style = "font-family=\"Go, sans-serif\" font-size=\"10\""
+	}
+	svg.printf("    <text x=\"%s\" y=\"%s\" %s textLength=\"%s\" lengthAdjust=\"spacingAndGlyphs\" %s xml:space=\"preserve\">%s</text>\n",
+		svgNumber(text.left+text.xOffset), svgNumber(text.top+text.baselineOffset), style, svgNumber(text.width),
+		svgPaint("fill", textColor), svgEscape(text.text))
+}
+
+// svgLinkClass returns the class identifying the kind of link
+func svgLinkClass(link core.Concept, trans *core.Transaction) string {
+	switch {
+	case IsDiagramReferenceLink(link, trans):
+		return "crl-reference-link"
+	case IsDiagramRefinementLink(link, trans):
+		return "crl-refinement-link"
+	case IsDiagramAbstractPointer(link, trans):
+		return "crl-abstract-pointer"
+	case IsDiagramElementPointer(link, trans):
+		return "crl-element-pointer"
+	case IsDiagramOwnerPointer(link, trans):
+		return "crl-owner-pointer"
+	case IsDiagramRefinedPointer(link, trans):
+		return "crl-refined-pointer"
+	}
+	return "crl-link"
+}
+
+// svgPaint returns the fill or stroke attributes for the color
+func svgPaint(attribute string, paint color.NRGBA) string {
+	if paint.A == 0 {
+		return attribute + "=\"none\""
+	}
+	value := fmt.Sprintf("%s=\"#%02x%02x%02x\"", attribute, paint.R, paint.G, paint.B)
+	if paint.A != 255 {
+		value += fmt.Sprintf(" %s-opacity=\"%s\"", attribute, svgNumber(float64(paint.A)/255))
+	}
+	return value
+}
+
+// svgNumber formats the number with at most three decimal places
+func svgNumber(value float64) string {
+	formatted := strconv.FormatFloat(value, 'f', 3, 64)
+	formatted = strings.TrimRight(strings.TrimRight(formatted, "0"), ".")
+	if formatted == "-0" {
+		return "0"
+	}
+	return formatted
+}
+
+func svgEscape(text string) string {
+	var buffer bytes.Buffer
+	xml.EscapeText(&buffer, []byte(text))
+	return buffer.String()
+}
@@ -0,0 +1,126 @@
+package crldiagramdomain
+
+import (
+	"bytes"
+	"encoding/xml"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+	"github.com/pbrown12303/activeCRL/core"
+)
+
+// buildExportTestDiagram builds a diagram showing two elements, a reference between them, a refinement of one by the
+// other, and pointers of each kind
+func buildExportTestDiagram(uOfD *core.UniverseOfDiscourse, trans *core.Transaction) core.Concept {
+	domain, _ := uOfD.NewElement(trans)
+	domain.SetLabel("Domain", trans)
+	abstract, _ := uOfD.NewOwnedElement(domain, "Abstract", trans)
+	refined, _ := uOfD.NewOwnedElement(domain, "Refined & <Special>", trans)
+	reference, _ := uOfD.NewOwnedReference(refined, "Reference", trans)
+	reference.SetReferencedConcept(abstract, core.NoAttribute, trans)
+	refinement, _ := uOfD.NewOwnedRefinement(domain, "Refinement", abstract, refined, trans)
+
+	diagram, _ := NewDiagram(trans)
+	diagram.SetOwningConcept(domain, trans)
+	diagram.SetLabel("Export Diagram", trans)
+	newNode := func(modelConcept core.Concept, x float64, y float64) core.Concept {
+		node, _ := NewDiagramNode(trans)
+		node.SetOwningConcept(diagram, trans)
+		SetReferencedModelConcept(node, modelConcept, trans)
+		SetNodeX(node, x, trans)
+		SetNodeY(node, y, trans)
+		SetLineColor(node, "#000000ff", trans)
+		SetBGColor(node, "#ffffcc80", trans)
+		return node
+	}
+	abstractNode := newNode(abstract, 20, 20)
+	refinedNode := newNode(refined, 20, 200)
+	newLink := func(link core.Concept, modelConcept core.Concept, source core.Concept, target core.Concept) core.Concept {
+		link.SetOwningConcept(diagram, trans)
+		SetReferencedModelConcept(link, modelConcept, trans)
+		SetLinkSource(link, source, trans)
+		SetLinkTarget(link, target, trans)
+		return link
+	}
+	referenceLink, _ := NewDiagramReferenceLink(trans)
+	newLink(referenceLink, reference, refinedNode, abstractNode)
+	refinementLink, _ := NewDiagramRefinementLink(trans)
+	newLink(refinementLink, refinement, refinedNode, abstractNode)
+	ownerPointer, _ := NewDiagramOwnerPointer(trans)
+	newLink(ownerPointer, reference, referenceLink, refinedNode)
+	elementPointer, _ := NewDiagramElementPointer(trans)
+	newLink(elementPointer, reference, referenceLink, abstractNode)
+	abstractPointer, _ := NewDiagramAbstractPointer(trans)
+	newLink(abstractPointer, refinement, refinementLink, abstractNode)
+	refinedPointer, _ := NewDiagramRefinedPointer(trans)
+	newLink(refinedPointer, refinement, refinementLink, refinedNode)
+	return diagram
+}
+
+var _ = Describe("Diagram SVG export", func() {
+	var uOfD *core.UniverseOfDiscourse
+	var trans *core.Transaction
+	var diagram core.Concept
+
+	BeforeEach(func() {
+		uOfD = core.NewUniverseOfDiscourse()
+		trans = uOfD.NewTransaction()
+		BuildCrlDiagramDomain(uOfD, trans)
+		diagram = buildExportTestDiagram(uOfD, trans)
+	})
+
+	AfterEach(func() {
+		trans.ReleaseLocks()
+	})
+
+	Specify("ExportDiagramSVG should write well-formed SVG", func() {
+		var buffer bytes.Buffer
+		Expect(ExportDiagramSVG(diagram, &buffer, trans)).To(Succeed())
+		decoder := xml.NewDecoder(bytes.NewReader(buffer.Bytes()))
+		elementCounts := make(map[string]int)
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				break
+			}
+			if start, ok := token.(xml.StartElement); ok {
+				elementCounts[start.Name.Local]++
+			}
+		}
+		Expect(elementCounts["svg"]).To(Equal(1))
+		Expect(elementCounts["rect"]).To(Equal(2))
+		Expect(elementCounts["image"]).To(Equal(2))
+		Expect(elementCounts["line"]).To(Equal(6))
+		// Reference links have an arrowhead and a diamond; each of the other links has one decoration
+		Expect(elementCounts["polygon"]).To(Equal(7))
+	})
+
+	Specify("ExportDiagramSVG should render labels, colors, and link kinds", func() {
+		var buffer bytes.Buffer
+		Expect(ExportDiagramSVG(diagram, &buffer, trans)).To(Succeed())
+		svg := buffer.String()
+		Expect(svg).To(ContainSubstring("<title>Export Diagram</title>"))
+		Expect(svg).To(ContainSubstring(">Refined &amp; &lt;Special&gt;</text>"))
+		Expect(svg).To(ContainSubstring(">Abstract</text>"))
+		Expect(svg).To(ContainSubstring(">Reference</text>"))
+		Expect(svg).To(ContainSubstring(`fill="#ffffcc" fill-opacity="0.502"`))
+		Expect(svg).To(ContainSubstring("data:image/png;base64,"))
+		for _, class := range []string{"crl-reference-link", "crl-refinement-link", "crl-owner-pointer", "crl-element-pointer", "crl-abstract-pointer", "crl-refined-pointer"} {
+			Expect(svg).To(ContainSubstring(`class="crl-link ` + class + `"`))
+		}
+	})
+
+	Specify("ExportDiagramSVG should size text to the node measurements", func() {
+		layout, err := layoutDiagram(diagram, trans)
+		Expect(err).ToNot(HaveOccurred())
+		for _, nodeLayout := range layout.nodes {
+			Expect(nodeLayout.displayLabel.left + nodeLayout.displayLabel.width).To(BeNumerically("<=", nodeLayout.x+nodeLayout.width))
+			Expect(nodeLayout.displayLabel.top + nodeLayout.displayLabel.height).To(BeNumerically("<=", nodeLayout.y+nodeLayout.height))
+		}
+	})
+
+	Specify("ExportDiagramSVG should reject a concept that is not a diagram", func() {
+		element, _ := uOfD.NewElement(trans)
+		Expect(ExportDiagramSVG(element, &bytes.Buffer{}, trans)).ToNot(Succeed())
+	})
+})
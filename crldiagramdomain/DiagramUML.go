@@ -0,0 +1,345 @@
+package crldiagramdomain
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pbrown12303/activeCRL/core"
+	"github.com/pkg/errors"
+)
+
+// classRelationKind identifies the UML relationship drawn for a link or a model relationship
+type classRelationKind int
+
+const (
+	classAssociation classRelationKind = iota
+	classGeneralization
+	classComposition
+)
+
+// classDiagram is a UML class diagram view of a CRL diagram or domain, independent of the text format it is written in
+type classDiagram struct {
+	title     string
+	classes   []*classDiagramClass
+	relations []*classDiagramRelation
+}
+
+// classDiagramClass is a class shown in a classDiagram. The stereotypes are the labels of the class's abstractions.
+type classDiagramClass struct {
+	id          string
+	name        string
+	stereotypes []string
+}
+
+// classDiagramRelation is a relationship between two classes. For generalizations, from is the refined class and to is
+// the abstract class; for compositions, from is the owner and to is the owned class.
+type classDiagramRelation struct {
+	kind  classRelationKind
+	from  *classDiagramClass
+	to    *classDiagramClass
+	label string
+}
+
+// addClass adds a class to the diagram, assigning it the next identifier
+func (cd *classDiagram) addClass(name string, abstractionLabel string) *classDiagramClass {
+	class := &classDiagramClass{id: "C" + strconv.Itoa(len(cd.classes)+1), name: name}
+	for _, stereotype := range strings.Split(abstractionLabel, "\n") {
+		if stereotype != "" {
+			class.stereotypes = append(class.stereotypes, stereotype)
+		}
+	}
+	sort.Strings(class.stereotypes)
+	cd.classes = append(cd.classes, class)
+	return class
+}
+
+func (cd *classDiagram) addRelation(kind classRelationKind, from *classDiagramClass, to *classDiagramClass, label string) {
+	cd.relations = append(cd.relations, &classDiagramRelation{kind: kind, from: from, to: to, label: label})
+}
+
+// ExportDiagramPlantUML writes the diagram as a PlantUML class diagram. Nodes become classes stereotyped with their
+// abstractions, reference links become associations, refinement links become generalizations, and owner pointers
+// between nodes become compositions. Nodes showing the same model concept are written as a single class. Other
+// pointers, and links that do not connect two nodes, are omitted.
+func ExportDiagramPlantUML(diagram core.Concept, writer io.Writer, trans *core.Transaction) error {
+	cd, err := newClassDiagramFromDiagram(diagram, trans)
+	if err != nil {
+		return errors.Wrap(err, "crldiagramdomain.ExportDiagramPlantUML failed")
+	}
+	err = writePlantUML(cd, writer)
+	if err != nil {
+		return errors.Wrap(err, "crldiagramdomain.ExportDiagramPlantUML failed")
+	}
+	return nil
+}
+
+// ExportDiagramMermaid writes the diagram as a Mermaid class diagram, mapping the diagram as ExportDiagramPlantUML does
+func ExportDiagramMermaid(diagram core.Concept, writer io.Writer, trans *core.Transaction) error {
+	cd, err := newClassDiagramFromDiagram(diagram, trans)
+	if err != nil {
+		return errors.Wrap(err, "crldiagramdomain.ExportDiagramMermaid failed")
+	}
+	err = writeMermaid(cd, writer)
+	if err != nil {
+		return errors.Wrap(err, "crldiagramdomain.ExportDiagramMermaid failed")
+	}
+	return nil
+}
+
+// ExportDomainPlantUML writes a PlantUML class diagram of the root concept and the concepts it owns, directly or
+// indirectly, without requiring a crldiagramdomain diagram. Elements and literals become classes stereotyped with their
+// abstractions and ownership becomes composition. A reference whose owner and referenced concept are both shown
+// becomes an association; any other reference is shown as a class. A refinement whose abstract and refined concepts
+// are both shown becomes a generalization. Diagrams and their contents are omitted.
+func ExportDomainPlantUML(root core.Concept, writer io.Writer, trans *core.Transaction) error {
+	cd, err := newClassDiagramFromDomain(root, trans)
+	if err != nil {
+		return errors.Wrap(err, "crldiagramdomain.ExportDomainPlantUML failed")
+	}
+	err = writePlantUML(cd, writer)
+	if err != nil {
+		return errors.Wrap(err, "crldiagramdomain.ExportDomainPlantUML failed")
+	}
+	return nil
+}
+
+// ExportDomainMermaid writes a Mermaid class diagram of the root concept and the concepts it owns, mapping the
+// concepts as ExportDomainPlantUML does
+func ExportDomainMermaid(root core.Concept, writer io.Writer, trans *core.Transaction) error {
+	cd, err := newClassDiagramFromDomain(root, trans)
+	if err != nil {
+		return errors.Wrap(err, "crldiagramdomain.ExportDomainMermaid failed")
+	}
+	err = writeMermaid(cd, writer)
+	if err != nil {
+		return errors.Wrap(err, "crldiagramdomain.ExportDomainMermaid failed")
+	}
+	return nil
+}
+
+// newClassDiagramFromDiagram builds the class diagram view of a crldiagramdomain diagram
+func newClassDiagramFromDiagram(diagram core.Concept, trans *core.Transaction) (*classDiagram, error) {
+	if diagram == nil || !IsDiagram(diagram, trans) {
+		return nil, errors.New("crldiagramdomain.newClassDiagramFromDiagram called with a concept that is not a diagram")
+	}
+	cd := &classDiagram{title: diagram.GetLabel(trans)}
+	// Nodes are keyed by the ID of the model concept they show so that a concept shown twice yields one class
+	classesByModelConceptID := make(map[string]*classDiagramClass)
+	classesByNodeID := make(map[string]*classDiagramClass)
+	for _, node := range sortedDiagramElements(diagram, CrlDiagramNodeURI, trans) {
+		key := node.GetConceptID(trans)
+		if modelConcept := GetReferencedModelConcept(node, trans); modelConcept != nil {
+			key = modelConcept.GetConceptID(trans)
+		}
+		class, found := classesByModelConceptID[key]
+		if !found {
+			class = cd.addClass(GetDisplayLabel(node, trans), GetAbstractionDisplayLabel(node, trans))
+			classesByModelConceptID[key] = class
+		}
+		classesByNodeID[node.GetConceptID(trans)] = class
+	}
+	for _, link := range sortedDiagramElements(diagram, CrlDiagramLinkURI, trans) {
+		source := GetLinkSource(link, trans)
+		target := GetLinkTarget(link, trans)
+		if source == nil || target == nil {
+			continue
+		}
+		sourceClass := classesByNodeID[source.GetConceptID(trans)]
+		targetClass := classesByNodeID[target.GetConceptID(trans)]
+		if sourceClass == nil || targetClass == nil {
+			continue
+		}
+		switch {
+		case IsDiagramReferenceLink(link, trans):
+			cd.addRelation(classAssociation, sourceClass, targetClass, GetDisplayLabel(link, trans))
+		case IsDiagramRefinementLink(link, trans):
+			cd.addRelation(classGeneralization, sourceClass, targetClass, "")
+		case IsDiagramOwnerPointer(link, trans):
+			cd.addRelation(classComposition, targetClass, sourceClass, "")
+		}
+	}
+	return cd, nil
+}
+
+// newClassDiagramFromDomain builds the class diagram view of a concept and its owned descendants
+func newClassDiagramFromDomain(root core.Concept, trans *core.Transaction) (*classDiagram, error) {
+	if root == nil {
+		return nil, errors.New("crldiagramdomain.newClassDiagramFromDomain called with nil root")
+	}
+	cd := &classDiagram{title: root.GetLabel(trans)}
+	// Collect the concepts shown, in label order within each owner
+	var concepts []core.Concept
+	shown := make(map[string]bool)
+	var collect func(concept core.Concept)
+	collect = func(concept core.Concept) {
+		if IsDiagram(concept, trans) {
+			return
+		}
+		concepts = append(concepts, concept)
+		shown[concept.GetConceptID(trans)] = true
+		for _, child := range sortedOwnedConcepts(concept, trans) {
+			collect(child)
+		}
+	}
+	collect(root)
+	isShown := func(concept core.Concept) bool {
+		return concept != nil && shown[concept.GetConceptID(trans)]
+	}
+	// A reference is drawn as an association when its owner and referenced concept are both elements or literals
+	// drawn as classes
+	isClassEnd := func(concept core.Concept) bool {
+		return isShown(concept) && (concept.GetConceptType() == core.Element || concept.GetConceptType() == core.Literal)
+	}
+	isAssociation := func(concept core.Concept) bool {
+		return concept.GetConceptType() == core.Reference && isClassEnd(concept.GetOwningConcept(trans)) &&
+			isClassEnd(concept.GetReferencedConcept(trans))
+	}
+	classes := make(map[string]*classDiagramClass)
+	for _, concept := range concepts {
+		if concept.GetConceptType() == core.Refinement || isAssociation(concept) {
+			continue
+		}
+		abstractions := make(map[string]core.Concept)
+		concept.FindImmediateAbstractions(abstractions, trans)
+		var abstractionLabels []string
+		for _, abstraction := range abstractions {
+			abstractionLabels = append(abstractionLabels, abstraction.GetLabel(trans))
+		}
+		classes[concept.GetConceptID(trans)] = cd.addClass(concept.GetLabel(trans), strings.Join(abstractionLabels, "\n"))
+	}
+	for _, concept := range concepts {
+		class := classes[concept.GetConceptID(trans)]
+		owner := concept.GetOwningConcept(trans)
+		if class != nil && owner != nil && classes[owner.GetConceptID(trans)] != nil {
+			cd.addRelation(classComposition, classes[owner.GetConceptID(trans)], class, "")
+		}
+		switch {
+		case isAssociation(concept):
+			cd.addRelation(classAssociation, classes[owner.GetConceptID(trans)], classes[concept.GetReferencedConcept(trans).GetConceptID(trans)], concept.GetLabel(trans))
+		case concept.GetConceptType() == core.Refinement:
+			abstract := concept.GetAbstractConcept(trans)
+			refined := concept.GetRefinedConcept(trans)
+			if abstract != nil && refined != nil && classes[abstract.GetConceptID(trans)] != nil && classes[refined.GetConceptID(trans)] != nil {
+				cd.addRelation(classGeneralization, classes[refined.GetConceptID(trans)], classes[abstract.GetConceptID(trans)], "")
+			}
+		}
+	}
+	return cd, nil
+}
+
+// sortedOwnedConcepts returns the concepts owned by the owner sorted by label and then by ConceptID
+func sortedOwnedConcepts(owner core.Concept, trans *core.Transaction) []core.Concept {
+	var concepts []core.Concept
+	for _, child := range owner.GetOwnedConcepts(trans) {
+		concepts = append(concepts, child)
+	}
+	sort.Slice(concepts, func(i, j int) bool {
+		labelI := concepts[i].GetLabel(trans)
+		labelJ := concepts[j].GetLabel(trans)
+		if labelI != labelJ {
+			return labelI < labelJ
+		}
+		return concepts[i].GetConceptID(trans) < concepts[j].GetConceptID(trans)
+	})
+	return concepts
+}
+
+// writePlantUML writes the class diagram in PlantUML syntax
+func writePlantUML(cd *classDiagram, writer io.Writer) error {
+	bufferedWriter := bufio.NewWriter(writer)
+	text := &textWriter{writer: bufferedWriter}
+	text.printf("@startuml\n")
+	if cd.title != "" {
+		text.printf("title %s\n", plantUMLText(cd.title))
+	}
+	for _, class := range cd.classes {
+		text.printf("class \"%s\" as %s", plantUMLText(class.name), class.id)
+		for _, stereotype := range class.stereotypes {
+			text.printf(" <<%s>>", plantUMLStereotype(stereotype))
+		}
+		text.printf("\n")
+	}
+	for _, relation := range cd.relations {
+		switch relation.kind {
+		case classAssociation:
+			text.printf("%s --> %s", relation.from.id, relation.to.id)
+		case classGeneralization:
+			text.printf("%s <|-- %s", relation.to.id, relation.from.id)
+		case classComposition:
+			text.printf("%s *-- %s", relation.from.id, relation.to.id)
+		}
+		if relation.label != "" {
+			text.printf(" : %s", plantUMLText(relation.label))
+		}
+		text.printf("\n")
+	}
+	text.printf("@enduml\n")
+	if text.err != nil {
+		return text.err
+	}
+	return bufferedWriter.Flush()
+}
+
+// writeMermaid writes the class diagram in Mermaid syntax
+func writeMermaid(cd *classDiagram, writer io.Writer) error {
+	bufferedWriter := bufio.NewWriter(writer)
+	text := &textWriter{writer: bufferedWriter}
+	if cd.title != "" {
+		text.printf("---\ntitle: %s\n---\n", strconv.Quote(cd.title))
+	}
+	text.printf("classDiagram\n")
+	for _, class := range cd.classes {
+		text.printf("  class %s[\"%s\"]\n", class.id, mermaidText(class.name))
+		for _, stereotype := range class.stereotypes {
+			text.printf("  <<%s>> %s\n", mermaidText(stereotype), class.id)
+		}
+	}
+	for _, relation := range cd.relations {
+		switch relation.kind {
+		case classAssociation:
+			text.printf("  %s --> %s", relation.from.id, relation.to.id)
+		case classGeneralization:
+			text.printf("  %s <|-- %s", relation.to.id, relation.from.id)
+		case classComposition:
+			text.printf("  %s *-- %s", relation.from.id, relation.to.id)
+		}
+		if relation.label != "" {
+			text.printf(" : %s", mermaidText(relation.label))
+		}
+		text.printf("\n")
+	}
+	if text.err != nil {
+		return text.err
+	}
+	return bufferedWriter.Flush()
+}
+
+// plantUMLText makes the text safe for use in a quoted PlantUML name or a label: PlantUML has no escape for double
+// quotes, so they are replaced by single quotes, and line breaks are written as \n
+var plantUMLTextReplacer = strings.NewReplacer("\"", "'", "\r", "", "\n", "\\n")
+
+func plantUMLText(text string) string {
+	return plantUMLTextReplacer.Replace(text)
+}
+
+var plantUMLStereotypeReplacer = strings.NewReplacer("<", "(", ">", ")", "\r", "", "\n", " ")
+
+func plantUMLStereotype(text string) string {
+	return plantUMLStereotypeReplacer.Replace(text)
+}
+
+// mermaidText replaces the characters that Mermaid would interpret with Mermaid entity codes
+var mermaidTextReplacer = strings.NewReplacer(
+	"\"", "#quot;",
+	"<", "#lt;",
+	">", "#gt;",
+	"#", "#35;",
+	"\r", "",
+	"\n", " ")
+
+func mermaidText(text string) string {
+	return mermaidTextReplacer.Replace(text)
+}
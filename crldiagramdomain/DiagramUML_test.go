@@ -0,0 +1,143 @@
+package crldiagramdomain
+
+import (
+	"bytes"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+	"github.com/pbrown12303/activeCRL/core"
+)
+
+// classID returns the identifier given to the class with the given PlantUML declaration prefix
+func classID(text string, declaration string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, declaration) {
+			fields := strings.Fields(strings.TrimPrefix(line, declaration))
+			if len(fields) > 1 && fields[0] == "as" {
+				return fields[1]
+			}
+		}
+	}
+	return ""
+}
+
+var _ = Describe("Diagram PlantUML and Mermaid export", func() {
+	var uOfD *core.UniverseOfDiscourse
+	var trans *core.Transaction
+	var diagram core.Concept
+
+	BeforeEach(func() {
+		uOfD = core.NewUniverseOfDiscourse()
+		trans = uOfD.NewTransaction()
+		BuildCrlDiagramDomain(uOfD, trans)
+		diagram = buildExportTestDiagram(uOfD, trans)
+	})
+
+	AfterEach(func() {
+		trans.ReleaseLocks()
+	})
+
+	Specify("ExportDiagramPlantUML should write nodes as classes and links as relationships", func() {
+		// Show the ownership of the refined element by the domain
+		domain := diagram.GetOwningConcept(trans)
+		var refined core.Concept
+		for _, child := range domain.GetOwnedConcepts(trans) {
+			if child.GetLabel(trans) == "Refined & <Special>" {
+				refined = child
+			}
+		}
+		domainNode, _ := NewDiagramNode(trans)
+		domainNode.SetOwningConcept(diagram, trans)
+		SetReferencedModelConcept(domainNode, domain, trans)
+		ownerPointer, _ := NewDiagramOwnerPointer(trans)
+		ownerPointer.SetOwningConcept(diagram, trans)
+		SetReferencedModelConcept(ownerPointer, refined, trans)
+		SetLinkSource(ownerPointer, GetFirstElementRepresentingConcept(diagram, refined, trans), trans)
+		SetLinkTarget(ownerPointer, domainNode, trans)
+
+		var buffer bytes.Buffer
+		Expect(ExportDiagramPlantUML(diagram, &buffer, trans)).To(Succeed())
+		text := buffer.String()
+		Expect(text).To(HavePrefix("@startuml\ntitle Export Diagram\n"))
+		Expect(text).To(HaveSuffix("@enduml\n"))
+		abstractID := classID(text, "class \"Abstract\"")
+		refinedID := classID(text, "class \"Refined & <Special>\"")
+		domainID := classID(text, "class \"Domain\"")
+		Expect(abstractID).ToNot(BeEmpty())
+		Expect(refinedID).ToNot(BeEmpty())
+		Expect(domainID).ToNot(BeEmpty())
+		Expect(text).To(ContainSubstring("class \"Abstract\" as " + abstractID + "\n"))
+		Expect(text).To(ContainSubstring("class \"Refined & <Special>\" as " + refinedID + " <<Abstract>>\n"))
+		Expect(text).To(ContainSubstring(refinedID + " --> " + abstractID + " : Reference\n"))
+		Expect(text).To(ContainSubstring(abstractID + " <|-- " + refinedID + "\n"))
+		Expect(text).To(ContainSubstring(domainID + " *-- " + refinedID + "\n"))
+		// The pointers attached to links are omitted
+		Expect(strings.Count(text, "--")).To(Equal(3))
+	})
+
+	Specify("ExportDiagramMermaid should write nodes as classes and links as relationships", func() {
+		var buffer bytes.Buffer
+		Expect(ExportDiagramMermaid(diagram, &buffer, trans)).To(Succeed())
+		text := buffer.String()
+		Expect(text).To(HavePrefix("---\ntitle: \"Export Diagram\"\n---\nclassDiagram\n"))
+		Expect(text).To(ContainSubstring("[\"Abstract\"]\n"))
+		Expect(text).To(ContainSubstring("[\"Refined & #lt;Special#gt;\"]\n"))
+		Expect(text).To(ContainSubstring(" --> "))
+		Expect(text).To(ContainSubstring(" : Reference\n"))
+		Expect(text).To(ContainSubstring(" <|-- "))
+		Expect(text).To(ContainSubstring("  <<Abstract>> "))
+	})
+
+	Specify("Diagram exports should reject a concept that is not a diagram", func() {
+		element, _ := uOfD.NewElement(trans)
+		Expect(ExportDiagramPlantUML(element, &bytes.Buffer{}, trans)).ToNot(Succeed())
+		Expect(ExportDiagramMermaid(element, &bytes.Buffer{}, trans)).ToNot(Succeed())
+	})
+
+	Specify("ExportDomainPlantUML should write a domain subtree without a diagram", func() {
+		domain := diagram.GetOwningConcept(trans)
+		var refined core.Concept
+		for _, child := range domain.GetOwnedConcepts(trans) {
+			if child.GetLabel(trans) == "Refined & <Special>" {
+				refined = child
+			}
+		}
+		// A reference to a concept outside the domain is shown as a class
+		outside, _ := uOfD.NewElement(trans)
+		outside.SetLabel("Outside", trans)
+		dangling, _ := uOfD.NewOwnedReference(refined, "Dangling", trans)
+		dangling.SetReferencedConcept(outside, core.NoAttribute, trans)
+
+		var buffer bytes.Buffer
+		Expect(ExportDomainPlantUML(domain, &buffer, trans)).To(Succeed())
+		text := buffer.String()
+		domainID := classID(text, "class \"Domain\"")
+		abstractID := classID(text, "class \"Abstract\"")
+		refinedID := classID(text, "class \"Refined & <Special>\"")
+		danglingID := classID(text, "class \"Dangling\"")
+		Expect(domainID).To(Equal("C1"))
+		Expect(abstractID).ToNot(BeEmpty())
+		Expect(refinedID).ToNot(BeEmpty())
+		Expect(danglingID).ToNot(BeEmpty())
+		Expect(text).ToNot(ContainSubstring("Outside"))
+		Expect(text).ToNot(ContainSubstring("Export Diagram"))
+		Expect(text).ToNot(ContainSubstring("class \"Reference\""))
+		Expect(text).ToNot(ContainSubstring("class \"Refinement\""))
+		Expect(text).To(ContainSubstring(domainID + " *-- " + abstractID + "\n"))
+		Expect(text).To(ContainSubstring(domainID + " *-- " + refinedID + "\n"))
+		Expect(text).To(ContainSubstring(refinedID + " *-- " + danglingID + "\n"))
+		Expect(text).To(ContainSubstring(refinedID + " --> " + abstractID + " : Reference\n"))
+		Expect(text).To(ContainSubstring(abstractID + " <|-- " + refinedID + "\n"))
+	})
+
+	Specify("ExportDomainMermaid should write a domain subtree without a diagram", func() {
+		var buffer bytes.Buffer
+		Expect(ExportDomainMermaid(diagram.GetOwningConcept(trans), &buffer, trans)).To(Succeed())
+		text := buffer.String()
+		Expect(text).To(ContainSubstring("  class C1[\"Domain\"]\n"))
+		Expect(strings.Count(text, " *-- ")).To(Equal(2))
+		Expect(strings.Count(text, " <|-- ")).To(Equal(1))
+		Expect(strings.Count(text, " --> ")).To(Equal(1))
+	})
+})
@@ -0,0 +1,242 @@
+// Package crldiff compares trees of CRL concepts, which may lie in different UniverseOfDiscourses, and reports their
+// differences as structured changes
+package crldiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/pbrown12303/activeCRL/core"
+	"github.com/pkg/errors"
+)
+
+// ChangeKind identifies the nature of a Change
+type ChangeKind string
+
+// Added indicates that a concept is present only in the second tree
+// Removed indicates that a concept is present only in the first tree
+// Moved indicates that the owner of a concept differs between the trees
+// AttributeChanged indicates that an attribute of a concept differs between the trees
+const (
+	Added            ChangeKind = "added"
+	Removed          ChangeKind = "removed"
+	Moved            ChangeKind = "moved"
+	AttributeChanged ChangeKind = "attributeChanged"
+)
+
+// URIAttribute is the name used in a Change for the URI attribute, which has no AttributeName
+const URIAttribute = "URI"
+
+// ReferencedAttributeNameAttribute is the name used in a Change for the ReferencedAttributeName attribute
+const ReferencedAttributeNameAttribute = "ReferencedAttributeName"
+
+// ConceptTypeAttribute is the name used in a Change for the type of a concept
+const ConceptTypeAttribute = "ConceptType"
+
+// Change is a single difference between two trees of concepts. Added and removed changes carry the state of the
+// concept in the tree in which it is present. Moved changes carry the old and new OwningConceptIDs, and attribute
+// changes carry the name of the attribute and its old and new values.
+type Change struct {
+	Kind      ChangeKind         `json:"kind"`
+	ConceptID string             `json:"conceptID"`
+	Label     string             `json:"label"`
+	Attribute string             `json:"attribute,omitempty"`
+	OldValue  string             `json:"oldValue,omitempty"`
+	NewValue  string             `json:"newValue,omitempty"`
+	State     *core.ConceptState `json:"state,omitempty"`
+}
+
+// conceptAttribute is an attribute of a ConceptState compared by Diff and merged by Merge
+type conceptAttribute struct {
+	name     string
+	value    func(state *core.ConceptState) string
+	setValue func(state *core.ConceptState, value string)
+}
+
+// diffAttributes are the attributes compared by Diff, in the order in which their changes are reported
+var diffAttributes = []conceptAttribute{
+	{ConceptTypeAttribute,
+		func(state *core.ConceptState) string { return state.ConceptType },
+		func(state *core.ConceptState, value string) { state.ConceptType = value }},
+	{core.Label.String(),
+		func(state *core.ConceptState) string { return state.Label },
+		func(state *core.ConceptState, value string) { state.Label = value }},
+	{core.Definition.String(),
+		func(state *core.ConceptState) string { return state.Definition },
+		func(state *core.ConceptState, value string) { state.Definition = value }},
+	{URIAttribute,
+		func(state *core.ConceptState) string { return state.URI },
+		func(state *core.ConceptState, value string) { state.URI = value }},
+	{core.LiteralValue.String(),
+		func(state *core.ConceptState) string { return state.LiteralValue },
+		func(state *core.ConceptState, value string) { state.LiteralValue = value }},
+	{core.ReferencedConceptID.String(),
+		func(state *core.ConceptState) string { return state.ReferencedConceptID },
+		func(state *core.ConceptState, value string) { state.ReferencedConceptID = value }},
+	{ReferencedAttributeNameAttribute,
+		func(state *core.ConceptState) string { return state.ReferencedAttributeName },
+		func(state *core.ConceptState, value string) { state.ReferencedAttributeName = value }},
+	{core.AbstractConceptID.String(),
+		func(state *core.ConceptState) string { return state.AbstractConceptID },
+		func(state *core.ConceptState, value string) { state.AbstractConceptID = value }},
+	{core.RefinedConceptID.String(),
+		func(state *core.ConceptState) string { return state.RefinedConceptID },
+		func(state *core.ConceptState, value string) { state.RefinedConceptID = value }},
+}
+
+// ownerAttribute is the OwningConceptID, whose changes Diff reports as moves
+var ownerAttribute = conceptAttribute{core.OwningConceptID.String(),
+	func(state *core.ConceptState) string { return state.OwningConceptID },
+	func(state *core.ConceptState, value string) { state.OwningConceptID = value }}
+
+// Diff returns the changes that turn the tree rooted at a, read with transA, into the tree rooted at b, read with
+// transB. The trees may be in different UniverseOfDiscourses, e.g. a workspace and a saved file. Concepts are matched
+// by ConceptID: a concept in only one tree is added or removed, a concept whose owner differs is moved, and each
+// differing label, definition, literal value, URI, or pointer is an attribute change. Either root may be nil. The
+// changes are ordered by ConceptID, with the changes to each concept in a fixed order. An error is returned if a
+// concept of either tree cannot be read.
+func Diff(a core.Concept, transA *core.Transaction, b core.Concept, transB *core.Transaction) ([]Change, error) {
+	statesA, err := treeConceptStates(a, transA)
+	if err != nil {
+		return nil, errors.Wrap(err, "crldiff.Diff failed")
+	}
+	statesB, err := treeConceptStates(b, transB)
+	if err != nil {
+		return nil, errors.Wrap(err, "crldiff.Diff failed")
+	}
+	return diffConceptStates(statesA, statesB), nil
+}
+
+// treeConceptStates returns the states of the root and its descendants keyed by ConceptID
+func treeConceptStates(root core.Concept, trans *core.Transaction) (map[string]*core.ConceptState, error) {
+	states := make(map[string]*core.ConceptState)
+	if root == nil {
+		return states, nil
+	}
+	var addStates func(concept core.Concept) error
+	addStates = func(concept core.Concept) error {
+		err := trans.ReadLockElement(concept)
+		if err != nil {
+			return err
+		}
+		state, err := core.NewConceptState(concept)
+		if err != nil {
+			return err
+		}
+		states[state.ConceptID] = state
+		for _, child := range concept.GetOwnedConcepts(trans) {
+			err = addStates(child)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err := addStates(root)
+	if err != nil {
+		return nil, errors.Wrap(err, "crldiff.treeConceptStates failed")
+	}
+	return states, nil
+}
+
+// diffConceptStates returns the changes that turn the concepts with the first states into those with the second
+func diffConceptStates(statesA map[string]*core.ConceptState, statesB map[string]*core.ConceptState) []Change {
+	var ids []string
+	for id := range statesA {
+		ids = append(ids, id)
+	}
+	for id := range statesB {
+		if statesA[id] == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	var changes []Change
+	for _, id := range ids {
+		stateA := statesA[id]
+		stateB := statesB[id]
+		switch {
+		case stateB == nil:
+			changes = append(changes, Change{Kind: Removed, ConceptID: id, Label: stateA.Label, State: stateA})
+		case stateA == nil:
+			changes = append(changes, Change{Kind: Added, ConceptID: id, Label: stateB.Label, State: stateB})
+		default:
+			if stateA.OwningConceptID != stateB.OwningConceptID {
+				changes = append(changes, Change{Kind: Moved, ConceptID: id, Label: stateB.Label, Attribute: core.OwningConceptID.String(),
+					OldValue: stateA.OwningConceptID, NewValue: stateB.OwningConceptID})
+			}
+			for _, attribute := range diffAttributes {
+				oldValue := attribute.value(stateA)
+				newValue := attribute.value(stateB)
+				if oldValue != newValue {
+					changes = append(changes, Change{Kind: AttributeChanged, ConceptID: id, Label: stateB.Label, Attribute: attribute.name,
+						OldValue: oldValue, NewValue: newValue})
+				}
+			}
+		}
+	}
+	return changes
+}
+
+// String returns a human-readable description of the change
+func (change Change) String() string {
+	concept := strconv.Quote(change.Label) + " (" + change.ConceptID + ")"
+	switch change.Kind {
+	case Added, Removed:
+		conceptType := ""
+		if change.State != nil {
+			conceptType = " " + change.State.ConceptType
+		}
+		return fmt.Sprintf("%s%s %s", change.Kind, conceptType, concept)
+	case Moved:
+		return fmt.Sprintf("moved %s from owner %s to owner %s", concept, diffIDText(change.OldValue), diffIDText(change.NewValue))
+	case AttributeChanged:
+		return fmt.Sprintf("changed %s %s from %s to %s", concept, change.Attribute, strconv.Quote(change.OldValue), strconv.Quote(change.NewValue))
+	}
+	return fmt.Sprintf("%s %s", change.Kind, concept)
+}
+
+func diffIDText(id string) string {
+	if id == "" {
+		return "none"
+	}
+	return id
+}
+
+// WriteChangesText writes the changes to the writer as human-readable text, one change per line
+func WriteChangesText(writer io.Writer, changes []Change) error {
+	for _, change := range changes {
+		_, err := io.WriteString(writer, change.String()+"\n")
+		if err != nil {
+			return errors.Wrap(err, "WriteChangesText failed")
+		}
+	}
+	return nil
+}
+
+// WriteChangesJSON writes the changes to the writer as an indented JSON array
+func WriteChangesJSON(writer io.Writer, changes []Change) error {
+	if changes == nil {
+		changes = []Change{}
+	}
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(changes)
+	if err != nil {
+		return errors.Wrap(err, "WriteChangesJSON failed")
+	}
+	return nil
+}
+
+// ReadChangesJSON reads changes written by WriteChangesJSON
+func ReadChangesJSON(reader io.Reader) ([]Change, error) {
+	var changes []Change
+	err := json.NewDecoder(reader).Decode(&changes)
+	if err != nil {
+		return nil, errors.Wrap(err, "ReadChangesJSON failed")
+	}
+	return changes, nil
+}
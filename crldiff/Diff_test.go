@@ -0,0 +1,166 @@
+package crldiff
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+	"github.com/pbrown12303/activeCRL/core"
+)
+
+var _ = Describe("Diff", func() {
+	var uOfD1, uOfD2 *core.UniverseOfDiscourse
+	var trans1, trans2 *core.Transaction
+	var domain1, domain2 core.Concept
+	var a, b, literal, reference, refinement core.Concept
+
+	BeforeEach(func() {
+		uOfD1 = core.NewUniverseOfDiscourse()
+		trans1 = uOfD1.NewTransaction()
+		domain1, _ = uOfD1.NewElement(trans1, "http://difftest/domain")
+		domain1.SetLabel("Domain", trans1)
+		a, _ = uOfD1.NewOwnedElement(domain1, "A", trans1)
+		b, _ = uOfD1.NewOwnedElement(domain1, "B", trans1)
+		literal, _ = uOfD1.NewOwnedLiteral(a, "L", trans1)
+		literal.SetLiteralValue("value", trans1)
+		reference, _ = uOfD1.NewOwnedReference(a, "R", trans1)
+		reference.SetReferencedConcept(b, core.NoAttribute, trans1)
+		refinement, _ = uOfD1.NewOwnedRefinement(b, "B refines A", a, b, trans1)
+		// Copy the domain into a second uOfD
+		data, err := uOfD1.MarshalDomain(domain1, trans1)
+		Expect(err).ToNot(HaveOccurred())
+		uOfD2 = core.NewUniverseOfDiscourse()
+		trans2 = uOfD2.NewTransaction()
+		domain2, err = uOfD2.RecoverDomain(data, trans2)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		trans1.ReleaseLocks()
+		trans2.ReleaseLocks()
+	})
+
+	in2 := func(concept core.Concept) core.Concept {
+		return uOfD2.GetElement(concept.GetConceptID(trans1))
+	}
+
+	Specify("Identical trees in separate uOfDs should have no differences", func() {
+		Expect(Diff(domain1, trans1, domain2, trans2)).To(BeEmpty())
+	})
+
+	Specify("Diff should report added and removed concepts", func() {
+		added, _ := uOfD2.NewOwnedElement(in2(b), "Added", trans2)
+		Expect(uOfD2.DeleteElement(in2(literal), trans2)).To(Succeed())
+		changes, err := Diff(domain1, trans1, domain2, trans2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changes).To(ConsistOf(
+			Change{Kind: Added, ConceptID: added.GetConceptID(trans2), Label: "Added", State: changes[indexOfChange(changes, added.GetConceptID(trans2))].State},
+			Change{Kind: Removed, ConceptID: literal.GetConceptID(trans1), Label: "L", State: changes[indexOfChange(changes, literal.GetConceptID(trans1))].State}))
+		for _, change := range changes {
+			Expect(change.State).ToNot(BeNil())
+			Expect(change.State.ConceptID).To(Equal(change.ConceptID))
+		}
+	})
+
+	Specify("Diff should report attribute changes and moves", func() {
+		in2(a).SetLabel("A2", trans2)
+		in2(a).SetDefinition("defined", trans2)
+		in2(literal).SetLiteralValue("new value", trans2)
+		in2(b).SetURI("http://difftest/domain/B", trans2)
+		in2(reference).SetReferencedConcept(in2(a), core.LiteralValue, trans2)
+		in2(literal).SetOwningConcept(in2(b), trans2)
+		changes, err := Diff(domain1, trans1, domain2, trans2)
+		Expect(err).ToNot(HaveOccurred())
+		has := func(expected Change) bool {
+			for _, change := range changes {
+				if change.Kind == expected.Kind && change.ConceptID == expected.ConceptID && change.Attribute == expected.Attribute &&
+					change.OldValue == expected.OldValue && change.NewValue == expected.NewValue {
+					return true
+				}
+			}
+			return false
+		}
+		Expect(has(Change{Kind: AttributeChanged, ConceptID: a.GetConceptID(trans1), Attribute: "Label", OldValue: "A", NewValue: "A2"})).To(BeTrue())
+		Expect(has(Change{Kind: AttributeChanged, ConceptID: a.GetConceptID(trans1), Attribute: "Definition", NewValue: "defined"})).To(BeTrue())
+		Expect(has(Change{Kind: AttributeChanged, ConceptID: literal.GetConceptID(trans1), Attribute: "LiteralValue", OldValue: "value", NewValue: "new value"})).To(BeTrue())
+		Expect(has(Change{Kind: AttributeChanged, ConceptID: b.GetConceptID(trans1), Attribute: URIAttribute, NewValue: "http://difftest/domain/B"})).To(BeTrue())
+		Expect(has(Change{Kind: AttributeChanged, ConceptID: reference.GetConceptID(trans1), Attribute: "ReferencedConceptID",
+			OldValue: b.GetConceptID(trans1), NewValue: a.GetConceptID(trans1)})).To(BeTrue())
+		Expect(has(Change{Kind: AttributeChanged, ConceptID: reference.GetConceptID(trans1), Attribute: ReferencedAttributeNameAttribute,
+			OldValue: "NoAttribute", NewValue: "LiteralValue"})).To(BeTrue())
+		Expect(has(Change{Kind: Moved, ConceptID: literal.GetConceptID(trans1), Attribute: "OwningConceptID",
+			OldValue: a.GetConceptID(trans1), NewValue: b.GetConceptID(trans1)})).To(BeTrue())
+		Expect(changes).To(HaveLen(7))
+		// Changes are ordered by ConceptID
+		for i := 1; i < len(changes); i++ {
+			Expect(changes[i-1].ConceptID <= changes[i].ConceptID).To(BeTrue())
+		}
+	})
+
+	Specify("Diff should report pointer changes of refinements", func() {
+		c, _ := uOfD2.NewOwnedElement(domain2, "C", trans2)
+		in2(refinement).SetAbstractConcept(c, trans2)
+		changes, err := Diff(domain1, trans1, domain2, trans2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changes).To(HaveLen(2))
+		Expect(changes[indexOfChange(changes, refinement.GetConceptID(trans1))].Attribute).To(Equal("AbstractConceptID"))
+	})
+
+	Specify("Diff should treat a nil root as an empty tree", func() {
+		changes, err := Diff(nil, trans1, domain2, trans2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changes).To(HaveLen(6))
+		for _, change := range changes {
+			Expect(change.Kind).To(Equal(Added))
+		}
+	})
+
+	Specify("Diff should fail when a concept cannot be read", func() {
+		trans1.Commit()
+		holder := uOfD1.NewTransaction()
+		defer holder.ReleaseLocks()
+		Expect(holder.WriteLockElement(literal)).To(Succeed())
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		cancelledTrans := uOfD1.NewTransactionWithContext(ctx)
+		defer cancelledTrans.ReleaseLocks()
+		changes, err := Diff(domain1, cancelledTrans, domain2, trans2)
+		Expect(err).To(HaveOccurred())
+		Expect(changes).To(BeNil())
+		_, err = Merge(nil, trans2, domain1, cancelledTrans, domain2, trans2)
+		Expect(err).To(HaveOccurred())
+	})
+
+	Specify("Changes should be written as text and as JSON", func() {
+		in2(a).SetLabel("A2", trans2)
+		in2(literal).SetOwningConcept(in2(b), trans2)
+		Expect(uOfD2.DeleteElement(in2(reference), trans2)).To(Succeed())
+		changes, err := Diff(domain1, trans1, domain2, trans2)
+		Expect(err).ToNot(HaveOccurred())
+		var text bytes.Buffer
+		Expect(WriteChangesText(&text, changes)).To(Succeed())
+		lines := strings.Split(strings.TrimSpace(text.String()), "\n")
+		Expect(lines).To(HaveLen(3))
+		Expect(lines).To(ContainElement("changed \"A2\" (" + a.GetConceptID(trans1) + ") Label from \"A\" to \"A2\""))
+		Expect(lines).To(ContainElement("moved \"L\" (" + literal.GetConceptID(trans1) + ") from owner " + a.GetConceptID(trans1) + " to owner " + b.GetConceptID(trans1)))
+		Expect(lines).To(ContainElement("removed Reference \"R\" (" + reference.GetConceptID(trans1) + ")"))
+		var jsonBuffer bytes.Buffer
+		Expect(WriteChangesJSON(&jsonBuffer, changes)).To(Succeed())
+		Expect(jsonBuffer.String()).To(ContainSubstring("\"kind\": \"moved\""))
+		readChanges, err := ReadChangesJSON(&jsonBuffer)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readChanges).To(Equal(changes))
+	})
+})
+
+// indexOfChange returns the index of the first change to the concept, or -1
+func indexOfChange(changes []Change, conceptID string) int {
+	for i, change := range changes {
+		if change.ConceptID == conceptID {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,407 @@
+package crldiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+
+	"github.com/pbrown12303/activeCRL/core"
+	"github.com/pkg/errors"
+)
+
+// ConflictKind identifies the nature of a Conflict
+type ConflictKind string
+
+// AttributeConflict indicates that both sides changed an attribute, or added a concept, with different values
+// DeleteModifyConflict indicates that one side deleted a concept that the other side changed
+// RestoredConflict indicates that a concept deleted by one side is still the owner or target of a concept in the
+// merge and has been restored
+// OwnershipCycleConflict indicates that the owners taken from ours and theirs together form an ownership cycle, as
+// when ours moves A under B and theirs moves B under A, and that the concept keeps the owner it has in ours
+const (
+	AttributeConflict      ConflictKind = "attribute"
+	DeleteModifyConflict   ConflictKind = "deleteModify"
+	RestoredConflict       ConflictKind = "restored"
+	OwnershipCycleConflict ConflictKind = "ownershipCycle"
+)
+
+// Conflict is an edit made by ours and theirs that Merge could not resolve. Attribute conflicts carry the base, ours,
+// and theirs values of the attribute, and the merge keeps ours. Delete-modify conflicts name the side that deleted the
+// concept, and the merge keeps the modified concept. Restored conflicts name the attribute of the concept that
+// required the restoration. Ownership cycle conflicts carry the base, ours, and theirs owners, and the merge keeps
+// ours.
+type Conflict struct {
+	Kind      ConflictKind `json:"kind"`
+	ConceptID string       `json:"conceptID"`
+	Label     string       `json:"label"`
+	Attribute string       `json:"attribute,omitempty"`
+	Base      string       `json:"base,omitempty"`
+	Ours      string       `json:"ours,omitempty"`
+	Theirs    string       `json:"theirs,omitempty"`
+	DeletedIn string       `json:"deletedIn,omitempty"`
+}
+
+// MergeResult is the outcome of a three-way merge: the states of the merged concepts keyed by ConceptID and the
+// conflicts found, ordered by ConceptID
+type MergeResult struct {
+	States    map[string]*core.ConceptState
+	Conflicts []Conflict
+}
+
+// Merge performs a three-way merge of the trees rooted at base, ours, and theirs, each read with its own transaction.
+// The trees are merged per concept, keyed by ConceptID, and per attribute, including the owner. An edit made on only
+// one side is taken, as is an identical edit made on both sides; concepts added on either side are kept, and concepts
+// deleted on one side and unchanged on the other are deleted. The remaining edits are reported as conflicts. Base may
+// be nil for trees with no common ancestor. An error is returned if a concept of any of the trees cannot be read.
+func Merge(base core.Concept, baseTrans *core.Transaction, ours core.Concept, oursTrans *core.Transaction, theirs core.Concept, theirsTrans *core.Transaction) (*MergeResult, error) {
+	baseStates, err := treeConceptStates(base, baseTrans)
+	if err != nil {
+		return nil, errors.Wrap(err, "crldiff.Merge failed")
+	}
+	ourStates, err := treeConceptStates(ours, oursTrans)
+	if err != nil {
+		return nil, errors.Wrap(err, "crldiff.Merge failed")
+	}
+	theirStates, err := treeConceptStates(theirs, theirsTrans)
+	if err != nil {
+		return nil, errors.Wrap(err, "crldiff.Merge failed")
+	}
+	return mergeConceptStates(baseStates, ourStates, theirStates), nil
+}
+
+// mergeConceptStates merges the states of the concepts of three trees keyed by ConceptID
+func mergeConceptStates(baseStates map[string]*core.ConceptState, ourStates map[string]*core.ConceptState, theirStates map[string]*core.ConceptState) *MergeResult {
+	result := &MergeResult{States: make(map[string]*core.ConceptState)}
+	idSet := make(map[string]bool)
+	for _, states := range []map[string]*core.ConceptState{baseStates, ourStates, theirStates} {
+		for id := range states {
+			idSet[id] = true
+		}
+	}
+	var ids []string
+	for id := range idSet {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	attributes := append([]conceptAttribute{ownerAttribute}, diffAttributes...)
+	for _, id := range ids {
+		baseState := baseStates[id]
+		ourState := ourStates[id]
+		theirState := theirStates[id]
+		switch {
+		case ourState == nil && theirState == nil:
+		case ourState == nil || theirState == nil:
+			present := ourState
+			deletedIn := "theirs"
+			if present == nil {
+				present = theirState
+				deletedIn = "ours"
+			}
+			if baseState == nil {
+				// Added on one side only
+				result.States[id] = copyConceptState(present)
+			} else if conceptStatesDiffer(baseState, present, attributes) {
+				result.Conflicts = append(result.Conflicts, Conflict{Kind: DeleteModifyConflict, ConceptID: id, Label: present.Label, DeletedIn: deletedIn})
+				result.States[id] = copyConceptState(present)
+			}
+		default:
+			merged := copyConceptState(ourState)
+			for _, attribute := range attributes {
+				ourValue := attribute.value(ourState)
+				theirValue := attribute.value(theirState)
+				if ourValue == theirValue {
+					continue
+				}
+				baseValue := ""
+				if baseState != nil {
+					baseValue = attribute.value(baseState)
+				}
+				switch {
+				case baseState != nil && ourValue == baseValue:
+					attribute.setValue(merged, theirValue)
+				case baseState != nil && theirValue == baseValue:
+				default:
+					result.Conflicts = append(result.Conflicts, Conflict{Kind: AttributeConflict, ConceptID: id, Label: merged.Label, Attribute: attribute.name,
+						Base: baseValue, Ours: ourValue, Theirs: theirValue})
+				}
+			}
+			result.States[id] = merged
+		}
+	}
+	result.breakOwnershipCycles(baseStates, ourStates, theirStates)
+	result.restoreDeletedConcepts([]map[string]*core.ConceptState{ourStates, theirStates, baseStates})
+	sort.SliceStable(result.Conflicts, func(i, j int) bool {
+		return result.Conflicts[i].ConceptID < result.Conflicts[j].ConceptID
+	})
+	return result
+}
+
+// breakOwnershipCycles breaks each ownership cycle among the merged concepts by restoring the owner that one of its
+// concepts has in ours. Ours and theirs are each free of cycles, so a cycle contains an owner taken from theirs; the
+// one reverted is that of the concept with the last ConceptID. A cycle with no such owner is left for Build to report.
+func (result *MergeResult) breakOwnershipCycles(baseStates map[string]*core.ConceptState, ourStates map[string]*core.ConceptState, theirStates map[string]*core.ConceptState) {
+	for cycle := result.findOwnershipCycle(); cycle != nil; cycle = result.findOwnershipCycle() {
+		reverted := ""
+		for _, id := range cycle {
+			ourState := ourStates[id]
+			if ourState != nil && ourState.OwningConceptID != result.States[id].OwningConceptID && id > reverted {
+				reverted = id
+			}
+		}
+		if reverted == "" {
+			return
+		}
+		state := result.States[reverted]
+		conflict := Conflict{Kind: OwnershipCycleConflict, ConceptID: reverted, Label: state.Label, Attribute: ownerAttribute.name,
+			Ours: ourStates[reverted].OwningConceptID, Theirs: state.OwningConceptID}
+		if baseState := baseStates[reverted]; baseState != nil {
+			conflict.Base = baseState.OwningConceptID
+		}
+		if theirState := theirStates[reverted]; theirState != nil {
+			conflict.Theirs = theirState.OwningConceptID
+		}
+		state.OwningConceptID = conflict.Ours
+		result.Conflicts = append(result.Conflicts, conflict)
+	}
+}
+
+// findOwnershipCycle returns the IDs of the concepts on an ownership cycle among the merged concepts, or nil if there
+// is none
+func (result *MergeResult) findOwnershipCycle() []string {
+	var ids []string
+	for id := range result.States {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	checked := make(map[string]bool)
+	for _, id := range ids {
+		var path []string
+		onPath := make(map[string]int)
+		for currentID := id; result.States[currentID] != nil && !checked[currentID]; currentID = result.States[currentID].OwningConceptID {
+			if index, found := onPath[currentID]; found {
+				return path[index:]
+			}
+			onPath[currentID] = len(path)
+			path = append(path, currentID)
+		}
+		for _, pathID := range path {
+			checked[pathID] = true
+		}
+	}
+	return nil
+}
+
+// restoreDeletedConcepts restores the concepts that were deleted by the merge but that remain the owner or a pointer
+// target of a merged concept, taking the state of each from the first of the versions that has it
+func (result *MergeResult) restoreDeletedConcepts(versions []map[string]*core.ConceptState) {
+	pointers := []conceptAttribute{ownerAttribute}
+	for _, attribute := range diffAttributes {
+		switch attribute.name {
+		case core.ReferencedConceptID.String(), core.AbstractConceptID.String(), core.RefinedConceptID.String():
+			pointers = append(pointers, attribute)
+		}
+	}
+	for restored := true; restored; {
+		restored = false
+		var ids []string
+		for id := range result.States {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			state := result.States[id]
+			for _, pointer := range pointers {
+				targetID := pointer.value(state)
+				if targetID == "" || result.States[targetID] != nil {
+					continue
+				}
+				for _, version := range versions {
+					if target := version[targetID]; target != nil {
+						result.States[targetID] = copyConceptState(target)
+						result.Conflicts = append(result.Conflicts, Conflict{Kind: RestoredConflict, ConceptID: targetID, Label: target.Label, Attribute: pointer.name})
+						restored = true
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+// conceptStatesDiffer returns true if any of the attributes of the two states differ
+func conceptStatesDiffer(state1 *core.ConceptState, state2 *core.ConceptState, attributes []conceptAttribute) bool {
+	for _, attribute := range attributes {
+		if attribute.value(state1) != attribute.value(state2) {
+			return true
+		}
+	}
+	return false
+}
+
+func copyConceptState(state *core.ConceptState) *core.ConceptState {
+	stateCopy := *state
+	return &stateCopy
+}
+
+// Build adds the merged concepts to the uOfD and returns the root of the merged tree: the merged concept whose owner
+// is not part of the merge. An error is returned if any of the merged concepts is not in the tree, as when the merged
+// owners form a cycle.
+func (result *MergeResult) Build(uOfD *core.UniverseOfDiscourse, trans *core.Transaction) (core.Concept, error) {
+	var roots []string
+	for id, state := range result.States {
+		if result.States[state.OwningConceptID] == nil {
+			roots = append(roots, id)
+		}
+	}
+	if len(roots) != 1 {
+		return nil, errors.New("MergeResult.Build found " + strconv.Itoa(len(roots)) + " root concepts in the merge")
+	}
+	// Owners are recovered before the concepts they own
+	children := make(map[string][]string)
+	for id, state := range result.States {
+		children[state.OwningConceptID] = append(children[state.OwningConceptID], id)
+	}
+	recovered := 0
+	var recoverTree func(id string) (core.Concept, error)
+	recoverTree = func(id string) (core.Concept, error) {
+		data, err := json.Marshal(result.States[id])
+		if err != nil {
+			return nil, err
+		}
+		concept, err := uOfD.RecoverElement(data, trans)
+		if err != nil {
+			return nil, err
+		}
+		recovered++
+		sort.Strings(children[id])
+		for _, childID := range children[id] {
+			_, err = recoverTree(childID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return concept, nil
+	}
+	root, err := recoverTree(roots[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "MergeResult.Build failed")
+	}
+	if recovered != len(result.States) {
+		return nil, errors.New("MergeResult.Build recovered " + strconv.Itoa(recovered) + " of the " + strconv.Itoa(len(result.States)) +
+			" merged concepts: the owners of the others form a cycle")
+	}
+	return root, nil
+}
+
+// String returns a human-readable description of the conflict
+func (conflict Conflict) String() string {
+	concept := strconv.Quote(conflict.Label) + " (" + conflict.ConceptID + ")"
+	switch conflict.Kind {
+	case AttributeConflict:
+		return fmt.Sprintf("conflict in %s %s: base %s, ours %s, theirs %s", concept, conflict.Attribute,
+			strconv.Quote(conflict.Base), strconv.Quote(conflict.Ours), strconv.Quote(conflict.Theirs))
+	case DeleteModifyConflict:
+		return fmt.Sprintf("conflict in %s: deleted in %s and modified in the other version", concept, conflict.DeletedIn)
+	case RestoredConflict:
+		return fmt.Sprintf("conflict in %s: deleted but restored because it is still the %s of a merged concept", concept, conflict.Attribute)
+	case OwnershipCycleConflict:
+		return fmt.Sprintf("conflict in %s: moving it to owner %s as in theirs would form an ownership cycle, so it keeps owner %s as in ours",
+			concept, diffIDText(conflict.Theirs), diffIDText(conflict.Ours))
+	}
+	return fmt.Sprintf("conflict in %s", concept)
+}
+
+// WriteConflictsText writes the conflicts to the writer as human-readable text, one conflict per line
+func WriteConflictsText(writer io.Writer, conflicts []Conflict) error {
+	for _, conflict := range conflicts {
+		_, err := io.WriteString(writer, conflict.String()+"\n")
+		if err != nil {
+			return errors.Wrap(err, "WriteConflictsText failed")
+		}
+	}
+	return nil
+}
+
+// WriteConflictsJSON writes the conflicts to the writer as an indented JSON array
+func WriteConflictsJSON(writer io.Writer, conflicts []Conflict) error {
+	if conflicts == nil {
+		conflicts = []Conflict{}
+	}
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(conflicts)
+	if err != nil {
+		return errors.Wrap(err, "WriteConflictsJSON failed")
+	}
+	return nil
+}
+
+// MergeDomainFiles merges three serialized versions of a domain, as saved in .acrl files, and writes the canonical
+// serialization of the merged domain to the writer. An empty base indicates that the versions have no common
+// ancestor. The returned conflicts are resolved in the written domain as described for Conflict. The header written
+// with the merged domain combines those of ours and theirs (see mergeDomainHeaders).
+func MergeDomainFiles(base io.Reader, ours io.Reader, theirs io.Reader, merged io.Writer) ([]Conflict, error) {
+	var roots [3]core.Concept
+	var transactions [3]*core.Transaction
+	var headers [3]*core.DomainHeader
+	for i, reader := range []io.Reader{base, ours, theirs} {
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return nil, errors.Wrap(err, "crldiff.MergeDomainFiles failed")
+		}
+		uOfD := core.NewUniverseOfDiscourse()
+		transactions[i] = uOfD.NewTransaction()
+		defer transactions[i].ReleaseLocks()
+		if i == 0 && len(bytes.TrimSpace(data)) == 0 {
+			continue
+		}
+		headers[i], err = core.ReadDomainHeader(bytes.NewReader(data))
+		if err != nil {
+			return nil, errors.Wrap(err, "crldiff.MergeDomainFiles failed")
+		}
+		roots[i], err = uOfD.RecoverDomain(data, transactions[i])
+		if err != nil {
+			return nil, errors.Wrap(err, "crldiff.MergeDomainFiles failed")
+		}
+	}
+	result, err := Merge(roots[0], transactions[0], roots[1], transactions[1], roots[2], transactions[2])
+	if err != nil {
+		return nil, errors.Wrap(err, "crldiff.MergeDomainFiles failed")
+	}
+	uOfD := core.NewUniverseOfDiscourse()
+	trans := uOfD.NewTransaction()
+	defer trans.ReleaseLocks()
+	root, err := result.Build(uOfD, trans)
+	if err != nil {
+		return nil, errors.Wrap(err, "crldiff.MergeDomainFiles failed")
+	}
+	err = uOfD.EncodeDomainCanonicallyWithHeader(merged, root, mergeDomainHeaders(headers[1], headers[2]), trans)
+	if err != nil {
+		return nil, errors.Wrap(err, "crldiff.MergeDomainFiles failed")
+	}
+	return result.Conflicts, nil
+}
+
+// mergeDomainHeaders returns the header of the merged domain. It has the domain versions of ours together with those
+// of theirs for the domains ours does not record, and the dependencies of both.
+func mergeDomainHeaders(ours *core.DomainHeader, theirs *core.DomainHeader) *core.DomainHeader {
+	merged := &core.DomainHeader{DomainVersions: make(map[string]string)}
+	dependencies := make(map[string]bool)
+	for _, header := range []*core.DomainHeader{theirs, ours} {
+		for domainURI, version := range header.DomainVersions {
+			merged.DomainVersions[domainURI] = version
+		}
+		for _, dependency := range header.Dependencies {
+			dependencies[dependency] = true
+		}
+	}
+	for dependency := range dependencies {
+		merged.Dependencies = append(merged.Dependencies, dependency)
+	}
+	sort.Strings(merged.Dependencies)
+	return merged
+}
@@ -0,0 +1,230 @@
+package crldiff
+
+import (
+	"bytes"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+	"github.com/pbrown12303/activeCRL/core"
+)
+
+var _ = Describe("Merge", func() {
+	var baseUofD, ourUofD, theirUofD *core.UniverseOfDiscourse
+	var baseTrans, ourTrans, theirTrans *core.Transaction
+	var base, ours, theirs core.Concept
+	var a, b, literal, reference core.Concept
+
+	BeforeEach(func() {
+		baseUofD = core.NewUniverseOfDiscourse()
+		baseTrans = baseUofD.NewTransaction()
+		base, _ = baseUofD.NewElement(baseTrans, "http://mergetest/domain")
+		base.SetLabel("Domain", baseTrans)
+		a, _ = baseUofD.NewOwnedElement(base, "A", baseTrans)
+		b, _ = baseUofD.NewOwnedElement(base, "B", baseTrans)
+		literal, _ = baseUofD.NewOwnedLiteral(a, "L", baseTrans)
+		literal.SetLiteralValue("value", baseTrans)
+		reference, _ = baseUofD.NewOwnedReference(a, "R", baseTrans)
+		reference.SetReferencedConcept(b, core.NoAttribute, baseTrans)
+		data, err := baseUofD.MarshalDomain(base, baseTrans)
+		Expect(err).ToNot(HaveOccurred())
+		ourUofD = core.NewUniverseOfDiscourse()
+		ourTrans = ourUofD.NewTransaction()
+		ours, err = ourUofD.RecoverDomain(data, ourTrans)
+		Expect(err).ToNot(HaveOccurred())
+		theirUofD = core.NewUniverseOfDiscourse()
+		theirTrans = theirUofD.NewTransaction()
+		theirs, err = theirUofD.RecoverDomain(data, theirTrans)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		baseTrans.ReleaseLocks()
+		ourTrans.ReleaseLocks()
+		theirTrans.ReleaseLocks()
+	})
+
+	our := func(concept core.Concept) core.Concept {
+		return ourUofD.GetElement(concept.GetConceptID(baseTrans))
+	}
+	their := func(concept core.Concept) core.Concept {
+		return theirUofD.GetElement(concept.GetConceptID(baseTrans))
+	}
+	merge := func() *MergeResult {
+		result, err := Merge(base, baseTrans, ours, ourTrans, theirs, theirTrans)
+		Expect(err).ToNot(HaveOccurred())
+		return result
+	}
+	mergedState := func(result *MergeResult, concept core.Concept) *core.ConceptState {
+		return result.States[concept.GetConceptID(baseTrans)]
+	}
+
+	Specify("Non-overlapping edits should be merged without conflicts", func() {
+		our(a).SetLabel("Our A", ourTrans)
+		ourAdded, _ := ourUofD.NewOwnedElement(our(b), "Our Added", ourTrans)
+		our(literal).SetOwningConcept(our(b), ourTrans)
+		their(literal).SetLiteralValue("their value", theirTrans)
+		their(literal).SetLabel("Their L", theirTrans)
+		Expect(theirUofD.DeleteElement(their(reference), theirTrans)).To(Succeed())
+		result := merge()
+		Expect(result.Conflicts).To(BeEmpty())
+		Expect(mergedState(result, a).Label).To(Equal("Our A"))
+		Expect(mergedState(result, literal).OwningConceptID).To(Equal(b.GetConceptID(baseTrans)))
+		Expect(mergedState(result, literal).LiteralValue).To(Equal("their value"))
+		Expect(mergedState(result, literal).Label).To(Equal("Their L"))
+		Expect(mergedState(result, reference)).To(BeNil())
+		Expect(result.States[ourAdded.GetConceptID(ourTrans)]).ToNot(BeNil())
+		Expect(result.States).To(HaveLen(5))
+	})
+
+	Specify("Identical edits on both sides should not conflict", func() {
+		our(a).SetLabel("New A", ourTrans)
+		their(a).SetLabel("New A", theirTrans)
+		Expect(ourUofD.DeleteElement(our(reference), ourTrans)).To(Succeed())
+		Expect(theirUofD.DeleteElement(their(reference), theirTrans)).To(Succeed())
+		result := merge()
+		Expect(result.Conflicts).To(BeEmpty())
+		Expect(mergedState(result, a).Label).To(Equal("New A"))
+		Expect(mergedState(result, reference)).To(BeNil())
+	})
+
+	Specify("Different edits to the same attribute should conflict and keep ours", func() {
+		our(literal).SetLiteralValue("ours", ourTrans)
+		their(literal).SetLiteralValue("theirs", theirTrans)
+		result := merge()
+		Expect(result.Conflicts).To(Equal([]Conflict{{Kind: AttributeConflict, ConceptID: literal.GetConceptID(baseTrans), Label: "L",
+			Attribute: "LiteralValue", Base: "value", Ours: "ours", Theirs: "theirs"}}))
+		Expect(mergedState(result, literal).LiteralValue).To(Equal("ours"))
+	})
+
+	Specify("Deleting a concept modified on the other side should conflict and keep the concept", func() {
+		Expect(ourUofD.DeleteElement(our(reference), ourTrans)).To(Succeed())
+		their(reference).SetLabel("Their R", theirTrans)
+		result := merge()
+		Expect(result.Conflicts).To(HaveLen(1))
+		Expect(result.Conflicts[0].Kind).To(Equal(DeleteModifyConflict))
+		Expect(result.Conflicts[0].DeletedIn).To(Equal("ours"))
+		Expect(mergedState(result, reference).Label).To(Equal("Their R"))
+	})
+
+	Specify("A deleted owner of a concept added on the other side should be restored", func() {
+		Expect(ourUofD.DeleteElement(our(b), ourTrans)).To(Succeed())
+		Expect(ourUofD.DeleteElement(our(reference), ourTrans)).To(Succeed())
+		theirAdded, _ := theirUofD.NewOwnedElement(their(b), "Their Added", theirTrans)
+		result := merge()
+		Expect(result.Conflicts).To(HaveLen(1))
+		Expect(result.Conflicts[0].Kind).To(Equal(RestoredConflict))
+		Expect(result.Conflicts[0].ConceptID).To(Equal(b.GetConceptID(baseTrans)))
+		Expect(result.Conflicts[0].Attribute).To(Equal("OwningConceptID"))
+		Expect(result.States[theirAdded.GetConceptID(theirTrans)]).ToNot(BeNil())
+		Expect(mergedState(result, b)).ToNot(BeNil())
+	})
+
+	Specify("Build should create the merged domain", func() {
+		our(a).SetLabel("Our A", ourTrans)
+		their(literal).SetLiteralValue("their value", theirTrans)
+		result := merge()
+		uOfD := core.NewUniverseOfDiscourse()
+		trans := uOfD.NewTransaction()
+		defer trans.ReleaseLocks()
+		root, err := result.Build(uOfD, trans)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(root.GetConceptID(trans)).To(Equal(base.GetConceptID(baseTrans)))
+		Expect(uOfD.GetElement(a.GetConceptID(baseTrans)).GetLabel(trans)).To(Equal("Our A"))
+		mergedLiteral := uOfD.GetElement(literal.GetConceptID(baseTrans))
+		Expect(mergedLiteral.GetLiteralValue(trans)).To(Equal("their value"))
+		Expect(mergedLiteral.GetOwningConcept(trans).GetConceptID(trans)).To(Equal(a.GetConceptID(baseTrans)))
+		Expect(uOfD.GetElement(reference.GetConceptID(baseTrans)).GetReferencedConceptID(trans)).To(Equal(b.GetConceptID(baseTrans)))
+	})
+
+	Specify("Moves that together form an ownership cycle should conflict and keep ours", func() {
+		Expect(our(a).SetOwningConcept(our(b), ourTrans)).To(Succeed())
+		Expect(their(b).SetOwningConcept(their(a), theirTrans)).To(Succeed())
+		result := merge()
+		Expect(result.Conflicts).To(Equal([]Conflict{{Kind: OwnershipCycleConflict, ConceptID: b.GetConceptID(baseTrans), Label: "B",
+			Attribute: "OwningConceptID", Base: base.GetConceptID(baseTrans), Ours: base.GetConceptID(baseTrans), Theirs: a.GetConceptID(baseTrans)}}))
+		Expect(mergedState(result, a).OwningConceptID).To(Equal(b.GetConceptID(baseTrans)))
+		Expect(mergedState(result, b).OwningConceptID).To(Equal(base.GetConceptID(baseTrans)))
+		uOfD := core.NewUniverseOfDiscourse()
+		trans := uOfD.NewTransaction()
+		defer trans.ReleaseLocks()
+		_, err := result.Build(uOfD, trans)
+		Expect(err).ToNot(HaveOccurred())
+		for id := range result.States {
+			Expect(uOfD.GetElement(id)).ToNot(BeNil())
+		}
+	})
+
+	Specify("Build should fail when merged concepts form an ownership cycle", func() {
+		result := merge()
+		mergedState(result, a).OwningConceptID = b.GetConceptID(baseTrans)
+		mergedState(result, b).OwningConceptID = a.GetConceptID(baseTrans)
+		uOfD := core.NewUniverseOfDiscourse()
+		trans := uOfD.NewTransaction()
+		defer trans.ReleaseLocks()
+		_, err := result.Build(uOfD, trans)
+		Expect(err).To(HaveOccurred())
+	})
+
+	Specify("MergeDomainFiles should merge serialized domains", func() {
+		our(a).SetLabel("Our A", ourTrans)
+		their(b).SetLabel("Their B", theirTrans)
+		their(literal).SetLiteralValue("theirs", theirTrans)
+		our(literal).SetLiteralValue("ours", ourTrans)
+		encode := func(uOfD *core.UniverseOfDiscourse, root core.Concept, trans *core.Transaction) *bytes.Buffer {
+			var buffer bytes.Buffer
+			Expect(uOfD.EncodeDomain(&buffer, root, trans)).To(Succeed())
+			return &buffer
+		}
+		var merged bytes.Buffer
+		conflicts, err := MergeDomainFiles(encode(baseUofD, base, baseTrans), encode(ourUofD, ours, ourTrans), encode(theirUofD, theirs, theirTrans), &merged)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(conflicts).To(HaveLen(1))
+		var text bytes.Buffer
+		Expect(WriteConflictsText(&text, conflicts)).To(Succeed())
+		Expect(text.String()).To(Equal("conflict in \"L\" (" + literal.GetConceptID(baseTrans) + ") LiteralValue: base \"value\", ours \"ours\", theirs \"theirs\"\n"))
+		var conflictsJSON bytes.Buffer
+		Expect(WriteConflictsJSON(&conflictsJSON, conflicts)).To(Succeed())
+		Expect(conflictsJSON.String()).To(ContainSubstring("\"kind\": \"attribute\""))
+
+		uOfD := core.NewUniverseOfDiscourse()
+		trans := uOfD.NewTransaction()
+		defer trans.ReleaseLocks()
+		root, err := uOfD.RecoverDomain(merged.Bytes(), trans)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(root.GetLabel(trans)).To(Equal("Domain"))
+		Expect(uOfD.GetElement(a.GetConceptID(baseTrans)).GetLabel(trans)).To(Equal("Our A"))
+		Expect(uOfD.GetElement(b.GetConceptID(baseTrans)).GetLabel(trans)).To(Equal("Their B"))
+		Expect(uOfD.GetElement(literal.GetConceptID(baseTrans)).GetLiteralValue(trans)).To(Equal("ours"))
+	})
+
+	Specify("MergeDomainFiles should write the domain versions and dependencies of ours and theirs", func() {
+		ourUofD.SetDomainVersion("http://mergetest/ourVersioned", "2.0")
+		theirUofD.SetDomainVersion("http://mergetest/theirVersioned", "3.0")
+		external, _ := ourUofD.NewElement(ourTrans, "http://mergetest/external")
+		externalConcept, _ := ourUofD.NewOwnedElement(external, "External", ourTrans)
+		Expect(our(reference).SetReferencedConcept(externalConcept, core.NoAttribute, ourTrans)).To(Succeed())
+		var baseData, ourData, theirData, merged bytes.Buffer
+		Expect(baseUofD.EncodeDomain(&baseData, base, baseTrans)).To(Succeed())
+		Expect(ourUofD.EncodeDomain(&ourData, ours, ourTrans)).To(Succeed())
+		Expect(theirUofD.EncodeDomain(&theirData, theirs, theirTrans)).To(Succeed())
+		_, err := MergeDomainFiles(&baseData, &ourData, &theirData, &merged)
+		Expect(err).ToNot(HaveOccurred())
+		header, err := core.ReadDomainHeader(bytes.NewReader(merged.Bytes()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(header.DomainURI).To(Equal("http://mergetest/domain"))
+		Expect(header.DomainVersions).To(HaveKeyWithValue("http://mergetest/ourVersioned", "2.0"))
+		Expect(header.DomainVersions).To(HaveKeyWithValue("http://mergetest/theirVersioned", "3.0"))
+		Expect(header.Dependencies).To(Equal([]string{"http://mergetest/external"}))
+	})
+
+	Specify("MergeDomainFiles should accept an empty base", func() {
+		var ourData, theirData, merged bytes.Buffer
+		Expect(ourUofD.EncodeDomain(&ourData, ours, ourTrans)).To(Succeed())
+		Expect(theirUofD.EncodeDomain(&theirData, theirs, theirTrans)).To(Succeed())
+		conflicts, err := MergeDomainFiles(strings.NewReader(""), &ourData, &theirData, &merged)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(conflicts).To(BeEmpty())
+		Expect(merged.String()).To(ContainSubstring(literal.GetConceptID(baseTrans)))
+	})
+})
@@ -0,0 +1,264 @@
+package crldiff
+
+import (
+	"strconv"
+
+	"github.com/pbrown12303/activeCRL/core"
+	"github.com/pkg/errors"
+)
+
+// ApplyPatch applies the changes of a patch, such as one produced by Diff, to the concepts of the uOfD. The changes are
+// made with the normal mutators, so notifications are sent, functions are executed, and the changes can be undone.
+// Since Diff orders its changes by ConceptID rather than by dependency, the patch is applied in three passes: the
+// added concepts are created, then the attributes of the added concepts are set and the moves and attribute changes
+// are applied in patch order, and finally the removed concepts are deleted. The precondition of each change is checked
+// as it is applied: an added concept must not exist, a moved or changed concept must exist and have the OldValue, and
+// a removed concept must exist and match the state recorded in the change. If any change cannot be applied, the
+// changes already made by the patch are rolled back and an error is returned, leaving the uOfD as it was.
+func ApplyPatch(uOfD *core.UniverseOfDiscourse, patch []Change, trans *core.Transaction) error {
+	savepoint := trans.Savepoint()
+	err := applyChanges(uOfD, patch, trans)
+	if err != nil {
+		rollbackErr := trans.RollbackToSavepoint(savepoint)
+		if rollbackErr != nil {
+			return errors.Wrap(rollbackErr, "crldiff.ApplyPatch failed to roll back the patch")
+		}
+		return errors.Wrap(err, "crldiff.ApplyPatch failed")
+	}
+	return nil
+}
+
+// patchError returns an error stating why the change cannot be applied
+func patchError(change Change, reason string) error {
+	return errors.New("cannot apply change \"" + change.String() + "\": " + reason)
+}
+
+func applyChanges(uOfD *core.UniverseOfDiscourse, patch []Change, trans *core.Transaction) error {
+	// Added concepts are created first so that the other changes can refer to them
+	for _, change := range patch {
+		if change.Kind != Added {
+			continue
+		}
+		if change.State == nil || change.State.ConceptID != change.ConceptID {
+			return patchError(change, "the change has no state for the added concept")
+		}
+		if uOfD.GetElement(change.ConceptID) != nil {
+			return patchError(change, "the concept already exists")
+		}
+		conceptType, err := core.StringToConceptType(change.State.ConceptType)
+		if err != nil {
+			return errors.Wrap(err, patchError(change, "invalid concept type").Error())
+		}
+		_, err = uOfD.NewConceptWithID(conceptType, change.ConceptID, trans)
+		if err != nil {
+			return err
+		}
+	}
+	// The changes to the ReferencedConceptID and ReferencedAttributeName of a reference are applied together, as the
+	// new attribute name may not be valid for the old referenced concept and vice versa
+	referenceChanges := make(map[string][]int)
+	for i, change := range patch {
+		if change.Kind == AttributeChanged && (change.Attribute == core.ReferencedConceptID.String() || change.Attribute == ReferencedAttributeNameAttribute) {
+			referenceChanges[change.ConceptID] = append(referenceChanges[change.ConceptID], i)
+		}
+	}
+	applied := make(map[int]bool)
+	for i, change := range patch {
+		if applied[i] {
+			continue
+		}
+		switch change.Kind {
+		case Added:
+			err := initializeAddedConcept(uOfD, change, trans)
+			if err != nil {
+				return err
+			}
+		case Moved, AttributeChanged:
+			concept := uOfD.GetElement(change.ConceptID)
+			if concept == nil {
+				return patchError(change, "the concept does not exist")
+			}
+			attributeName := change.Attribute
+			if change.Kind == Moved {
+				attributeName = ownerAttribute.name
+			}
+			err := checkAttributeValue(concept, change, attributeName, trans)
+			if err != nil {
+				return err
+			}
+			switch attributeName {
+			case core.ReferencedConceptID.String(), ReferencedAttributeNameAttribute:
+				referencedConceptID := concept.GetReferencedConceptID(trans)
+				referencedAttributeName := concept.GetReferencedAttributeName(trans).String()
+				gathered := make(map[string]bool)
+				for _, j := range referenceChanges[change.ConceptID] {
+					if applied[j] || gathered[patch[j].Attribute] {
+						continue
+					}
+					err = checkAttributeValue(concept, patch[j], patch[j].Attribute, trans)
+					if err != nil {
+						return err
+					}
+					if patch[j].Attribute == core.ReferencedConceptID.String() {
+						referencedConceptID = patch[j].NewValue
+					} else {
+						referencedAttributeName = patch[j].NewValue
+					}
+					gathered[patch[j].Attribute] = true
+					applied[j] = true
+				}
+				err = setReferencedConcept(uOfD, concept, change, referencedConceptID, referencedAttributeName, trans)
+			default:
+				err = setConceptAttribute(uOfD, concept, change, attributeName, change.NewValue, trans)
+			}
+			if err != nil {
+				return err
+			}
+		case Removed:
+		default:
+			return patchError(change, "unknown kind of change")
+		}
+		applied[i] = true
+	}
+	// Removed concepts are deleted last. All of their preconditions are checked first, since deleting a concept also
+	// deletes its descendants.
+	var removed []core.Concept
+	attributes := append([]conceptAttribute{ownerAttribute}, diffAttributes...)
+	for _, change := range patch {
+		if change.Kind != Removed {
+			continue
+		}
+		concept := uOfD.GetElement(change.ConceptID)
+		if concept == nil {
+			return patchError(change, "the concept does not exist")
+		}
+		if change.State != nil {
+			state, err := core.NewConceptState(concept)
+			if err != nil {
+				return err
+			}
+			if conceptStatesDiffer(state, change.State, attributes) {
+				return patchError(change, "the concept has changed")
+			}
+		}
+		removed = append(removed, concept)
+	}
+	for _, concept := range removed {
+		// The concept may already have been deleted along with a removed owner
+		if concept.GetUniverseOfDiscourse(trans) != uOfD {
+			continue
+		}
+		err := uOfD.DeleteElement(concept, trans)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// initializeAddedConcept sets the attributes of a concept created for an added change to those of the change's state
+func initializeAddedConcept(uOfD *core.UniverseOfDiscourse, change Change, trans *core.Transaction) error {
+	concept := uOfD.GetElement(change.ConceptID)
+	for _, attribute := range append([]conceptAttribute{ownerAttribute}, diffAttributes...) {
+		value := attribute.value(change.State)
+		switch attribute.name {
+		case ConceptTypeAttribute, ReferencedAttributeNameAttribute:
+		case core.ReferencedConceptID.String():
+			referencedAttributeName := change.State.ReferencedAttributeName
+			if value != "" || (referencedAttributeName != "" && referencedAttributeName != core.NoAttribute.String()) {
+				err := setReferencedConcept(uOfD, concept, change, value, referencedAttributeName, trans)
+				if err != nil {
+					return err
+				}
+			}
+		default:
+			if value != "" {
+				err := setConceptAttribute(uOfD, concept, change, attribute.name, value, trans)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkAttributeValue returns an error if the current value of the concept's attribute is not the OldValue of the
+// change
+func checkAttributeValue(concept core.Concept, change Change, attributeName string, trans *core.Transaction) error {
+	err := trans.ReadLockElement(concept)
+	if err != nil {
+		return err
+	}
+	state, err := core.NewConceptState(concept)
+	if err != nil {
+		return err
+	}
+	for _, attribute := range append([]conceptAttribute{ownerAttribute}, diffAttributes...) {
+		if attribute.name != attributeName {
+			continue
+		}
+		value := attribute.value(state)
+		if value != change.OldValue {
+			return patchError(change, attributeName+" is "+strconv.Quote(value)+" rather than "+strconv.Quote(change.OldValue))
+		}
+		return nil
+	}
+	return patchError(change, "unknown attribute "+attributeName)
+}
+
+// setConceptAttribute sets the attribute of the concept with the attribute's mutator
+func setConceptAttribute(uOfD *core.UniverseOfDiscourse, concept core.Concept, change Change, attributeName string, value string, trans *core.Transaction) error {
+	conceptType := concept.GetConceptType()
+	switch attributeName {
+	case core.OwningConceptID.String():
+		if value != "" && uOfD.GetElement(value) == nil {
+			return patchError(change, "the owner "+value+" does not exist")
+		}
+		return concept.SetOwningConceptID(value, trans)
+	case core.Label.String():
+		return concept.SetLabel(value, trans)
+	case core.Definition.String():
+		return concept.SetDefinition(value, trans)
+	case URIAttribute:
+		return concept.SetURI(value, trans)
+	case core.LiteralValue.String():
+		if conceptType != core.Literal {
+			return patchError(change, "the concept is not a Literal")
+		}
+		return concept.SetLiteralValue(value, trans)
+	case core.AbstractConceptID.String(), core.RefinedConceptID.String():
+		if conceptType != core.Refinement {
+			return patchError(change, "the concept is not a Refinement")
+		}
+		if value != "" && uOfD.GetElement(value) == nil {
+			return patchError(change, "the concept "+value+" does not exist")
+		}
+		if attributeName == core.AbstractConceptID.String() {
+			return concept.SetAbstractConceptID(value, trans)
+		}
+		return concept.SetRefinedConceptID(value, trans)
+	case ConceptTypeAttribute:
+		return patchError(change, "the type of a concept cannot be changed")
+	}
+	return patchError(change, "unknown attribute "+attributeName)
+}
+
+// setReferencedConcept sets the ReferencedConceptID and ReferencedAttributeName of the reference
+func setReferencedConcept(uOfD *core.UniverseOfDiscourse, reference core.Concept, change Change, referencedConceptID string, referencedAttributeName string, trans *core.Transaction) error {
+	if reference.GetConceptType() != core.Reference {
+		return patchError(change, "the concept is not a Reference")
+	}
+	attributeName := core.NoAttribute
+	var err error
+	if referencedAttributeName != "" {
+		attributeName, err = core.FindAttributeName(referencedAttributeName)
+	}
+	if err != nil {
+		return errors.Wrap(err, patchError(change, "invalid ReferencedAttributeName").Error())
+	}
+	if referencedConceptID != "" && uOfD.GetElement(referencedConceptID) == nil {
+		return patchError(change, "the concept "+referencedConceptID+" does not exist")
+	}
+	return reference.SetReferencedConceptID(referencedConceptID, attributeName, trans)
+}
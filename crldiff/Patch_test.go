@@ -0,0 +1,169 @@
+package crldiff
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+	"github.com/pbrown12303/activeCRL/core"
+)
+
+// countingObserver counts the notifications it receives
+type countingObserver struct {
+	count int
+}
+
+func (observer *countingObserver) Update(notification *core.ChangeNotification, trans *core.Transaction) error {
+	observer.count++
+	return nil
+}
+
+var _ = Describe("ApplyPatch", func() {
+	var uOfD1, uOfD2 *core.UniverseOfDiscourse
+	var trans1, trans2 *core.Transaction
+	var domain1, domain2 core.Concept
+	var a, b, literal, reference, refinement core.Concept
+
+	BeforeEach(func() {
+		uOfD1 = core.NewUniverseOfDiscourse()
+		trans1 = uOfD1.NewTransaction()
+		domain1, _ = uOfD1.NewElement(trans1, "http://patchtest/domain")
+		domain1.SetLabel("Domain", trans1)
+		a, _ = uOfD1.NewOwnedElement(domain1, "A", trans1)
+		b, _ = uOfD1.NewOwnedElement(domain1, "B", trans1)
+		literal, _ = uOfD1.NewOwnedLiteral(a, "L", trans1)
+		literal.SetLiteralValue("value", trans1)
+		reference, _ = uOfD1.NewOwnedReference(a, "R", trans1)
+		reference.SetReferencedConcept(b, core.NoAttribute, trans1)
+		refinement, _ = uOfD1.NewOwnedRefinement(b, "B refines A", a, b, trans1)
+		// Copy the domain into a second uOfD to which the patches are applied
+		data, err := uOfD1.MarshalDomain(domain1, trans1)
+		Expect(err).ToNot(HaveOccurred())
+		uOfD2 = core.NewUniverseOfDiscourse()
+		trans2 = uOfD2.NewTransaction()
+		domain2, err = uOfD2.RecoverDomain(data, trans2)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		trans1.ReleaseLocks()
+		trans2.ReleaseLocks()
+	})
+
+	in2 := func(concept core.Concept) core.Concept {
+		return uOfD2.GetElement(concept.GetConceptID(trans1))
+	}
+
+	// diff returns the changes that turn the tree in uOfD2 into the tree in uOfD1
+	diff := func() []Change {
+		changes, err := Diff(domain2, trans2, domain1, trans1)
+		Expect(err).ToNot(HaveOccurred())
+		return changes
+	}
+
+	// editDomain1 makes changes of every kind to the first domain
+	editDomain1 := func() {
+		a.SetLabel("Renamed A", trans1)
+		literal.SetLiteralValue("new value", trans1)
+		literal.SetOwningConcept(b, trans1)
+		c, _ := uOfD1.NewOwnedElement(domain1, "C", trans1, "http://patchtest/domain/C")
+		cChild, _ := uOfD1.NewOwnedLiteral(c, "C Child", trans1)
+		cChild.SetLiteralValue("child value", trans1)
+		cReference, _ := uOfD1.NewOwnedReference(c, "C Reference", trans1)
+		cReference.SetReferencedConcept(literal, core.LiteralValue, trans1)
+		uOfD1.NewOwnedRefinement(c, "C refines B", b, c, trans1)
+		reference.SetReferencedConcept(refinement, core.AbstractConceptID, trans1)
+		Expect(uOfD1.DeleteElement(a, trans1)).To(Succeed())
+	}
+
+	Specify("Applying the diff between two trees should make the trees identical", func() {
+		editDomain1()
+		patch := diff()
+		Expect(patch).ToNot(BeEmpty())
+		Expect(ApplyPatch(uOfD2, patch, trans2)).To(Succeed())
+		Expect(diff()).To(BeEmpty())
+		Expect(uOfD2.GetElementWithURI("http://patchtest/domain/C")).ToNot(BeNil())
+	})
+
+	Specify("A patch read from JSON should apply in the same way", func() {
+		editDomain1()
+		var data bytes.Buffer
+		Expect(WriteChangesJSON(&data, diff())).To(Succeed())
+		patch, err := ReadChangesJSON(&data)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ApplyPatch(uOfD2, patch, trans2)).To(Succeed())
+		Expect(diff()).To(BeEmpty())
+	})
+
+	Specify("ApplyPatch should send notifications", func() {
+		observer := &countingObserver{}
+		Expect(in2(a).Register(observer)).To(Succeed())
+		patch := []Change{{Kind: AttributeChanged, ConceptID: a.GetConceptID(trans1), Attribute: "Label", OldValue: "A", NewValue: "New A"}}
+		Expect(ApplyPatch(uOfD2, patch, trans2)).To(Succeed())
+		Expect(in2(a).GetLabel(trans2)).To(Equal("New A"))
+		Expect(observer.count).To(BeNumerically(">", 0))
+	})
+
+	Specify("A patch should be undoable", func() {
+		uOfD2.SetRecordingUndo(true)
+		uOfD2.MarkUndoPoint()
+		editDomain1()
+		Expect(ApplyPatch(uOfD2, diff(), trans2)).To(Succeed())
+		uOfD2.Undo(trans2)
+		uOfD3 := core.NewUniverseOfDiscourse()
+		trans3 := uOfD3.NewTransaction()
+		defer trans3.ReleaseLocks()
+		data, err := uOfD2.MarshalDomain(domain2, trans2)
+		Expect(err).ToNot(HaveOccurred())
+		undone, err := uOfD3.RecoverDomain(data, trans3)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(in2(a)).ToNot(BeNil())
+		Expect(in2(a).GetLabel(trans2)).To(Equal("A"))
+		Expect(in2(literal).GetOwningConceptID(trans2)).To(Equal(a.GetConceptID(trans1)))
+		Expect(uOfD2.GetElementWithURI("http://patchtest/domain/C")).To(BeNil())
+		Expect(undone.GetLabel(trans3)).To(Equal("Domain"))
+	})
+
+	Specify("ApplyPatch should apply nothing if a precondition fails", func() {
+		newID := "b8e3a3c4-8c34-4a3e-9d29-4f7f2d0d9d51"
+		patch := []Change{
+			{Kind: AttributeChanged, ConceptID: a.GetConceptID(trans1), Attribute: "Label", OldValue: "A", NewValue: "New A"},
+			{Kind: Added, ConceptID: newID, Label: "New", State: &core.ConceptState{ConceptID: newID, ConceptType: "Element", OwningConceptID: domain1.GetConceptID(trans1), Label: "New"}},
+			{Kind: Moved, ConceptID: literal.GetConceptID(trans1), OldValue: a.GetConceptID(trans1), NewValue: b.GetConceptID(trans1)},
+			{Kind: AttributeChanged, ConceptID: literal.GetConceptID(trans1), Attribute: "LiteralValue", OldValue: "stale", NewValue: "new value"}}
+		err := ApplyPatch(uOfD2, patch, trans2)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("LiteralValue is \"value\" rather than \"stale\""))
+		Expect(diff()).To(BeEmpty())
+		Expect(uOfD2.GetElement(newID)).To(BeNil())
+		Expect(domain2.GetOwnedConceptIDs(trans2).Cardinality()).To(Equal(2))
+	})
+
+	Specify("ApplyPatch should check the preconditions of each kind of change", func() {
+		aID := a.GetConceptID(trans1)
+		state, _ := core.NewConceptState(in2(b))
+		for _, patch := range [][]Change{
+			{{Kind: Added, ConceptID: aID, State: state}},
+			{{Kind: Moved, ConceptID: "unknown", OldValue: "", NewValue: aID}},
+			{{Kind: Moved, ConceptID: aID, OldValue: b.GetConceptID(trans1), NewValue: ""}},
+			{{Kind: Moved, ConceptID: aID, OldValue: domain1.GetConceptID(trans1), NewValue: "unknown"}},
+			{{Kind: AttributeChanged, ConceptID: reference.GetConceptID(trans1), Attribute: "ReferencedConceptID", OldValue: b.GetConceptID(trans1), NewValue: "unknown"}},
+			{{Kind: AttributeChanged, ConceptID: aID, Attribute: "LiteralValue", OldValue: "", NewValue: "value"}},
+			{{Kind: AttributeChanged, ConceptID: aID, Attribute: "ConceptType", OldValue: "Element", NewValue: "Literal"}},
+			{{Kind: Removed, ConceptID: aID, State: state}},
+			{{Kind: Removed, ConceptID: "unknown"}},
+		} {
+			Expect(ApplyPatch(uOfD2, patch, trans2)).ToNot(Succeed())
+		}
+		Expect(diff()).To(BeEmpty())
+	})
+
+	Specify("ApplyPatch should change a reference's referenced concept and attribute together", func() {
+		patch := []Change{
+			{Kind: AttributeChanged, ConceptID: reference.GetConceptID(trans1), Attribute: ReferencedAttributeNameAttribute, OldValue: "NoAttribute", NewValue: "RefinedConceptID"},
+			{Kind: AttributeChanged, ConceptID: reference.GetConceptID(trans1), Attribute: "ReferencedConceptID", OldValue: b.GetConceptID(trans1), NewValue: refinement.GetConceptID(trans1)}}
+		Expect(ApplyPatch(uOfD2, patch, trans2)).To(Succeed())
+		Expect(in2(reference).GetReferencedConcept(trans2)).To(Equal(in2(refinement)))
+		Expect(in2(reference).GetReferencedAttributeName(trans2)).To(Equal(core.RefinedConceptID))
+	})
+})
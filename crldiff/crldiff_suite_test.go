@@ -0,0 +1,13 @@
+package crldiff
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+)
+
+func TestCrlDiff(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "CrlDiff Suite")
+}
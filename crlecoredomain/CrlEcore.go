@@ -0,0 +1,121 @@
+// Package crlecoredomain provides the CRL Ecore domain, whose concepts are the abstractions of Ecore metaclasses, along
+// with an importer for Ecore and UML2 XMI models and an exporter that writes Ecore from a CRL domain.
+//
+// Imported model elements are refinements of the CRL Ecore domain concepts: packages, classes, enumerations and data
+// types become Elements, attributes and enumeration literals become owned Literals, and references become owned
+// References. Each supertype of a class becomes a Refinement, owned by the class, whose abstract concept is the
+// supertype. Imported concepts are given URIs derived from their xmi:id or, lacking one, from their Ecore fragment
+// path, so that importing the same model again yields the same ConceptIDs.
+package crlecoredomain
+
+import (
+	"github.com/pbrown12303/activeCRL/core"
+	"github.com/pkg/errors"
+)
+
+// CrlEcoreDomainURI is the URI for the domain of Ecore metaclass abstractions
+var CrlEcoreDomainURI = "http://activeCRL.com/crlecoredomain/CrlEcoreDomain"
+
+// CrlEcoreDomainVersion is the version of the CRL Ecore domain
+var CrlEcoreDomainVersion = "1.0"
+
+// CrlEcoreEPackageURI is the URI for the abstraction of packages
+var CrlEcoreEPackageURI = CrlEcoreDomainURI + "/EPackage"
+
+// CrlEcoreNsURIURI is the URI for the abstraction of a package's namespace URI. The literal value is the namespace URI.
+var CrlEcoreNsURIURI = CrlEcoreEPackageURI + "/nsURI"
+
+// CrlEcoreNsPrefixURI is the URI for the abstraction of a package's namespace prefix. The literal value is the prefix.
+var CrlEcoreNsPrefixURI = CrlEcoreEPackageURI + "/nsPrefix"
+
+// CrlEcoreEClassURI is the URI for the abstraction of classes
+var CrlEcoreEClassURI = CrlEcoreDomainURI + "/EClass"
+
+// CrlEcoreEEnumURI is the URI for the abstraction of enumerations
+var CrlEcoreEEnumURI = CrlEcoreDomainURI + "/EEnum"
+
+// CrlEcoreEDataTypeURI is the URI for the abstraction of data types
+var CrlEcoreEDataTypeURI = CrlEcoreDomainURI + "/EDataType"
+
+// CrlEcoreEAttributeURI is the URI for the abstraction of attributes. The literal value of an attribute is the name
+// of its data type.
+var CrlEcoreEAttributeURI = CrlEcoreDomainURI + "/EAttribute"
+
+// CrlEcoreEReferenceURI is the URI for the abstraction of references. A reference indicates its target class.
+var CrlEcoreEReferenceURI = CrlEcoreDomainURI + "/EReference"
+
+// CrlEcoreEEnumLiteralURI is the URI for the abstraction of enumeration literals. The literal value of an
+// enumeration literal is its value.
+var CrlEcoreEEnumLiteralURI = CrlEcoreDomainURI + "/EEnumLiteral"
+
+// NewCrlEcoreDomainProvider returns the DomainProvider for the CRL Ecore domain
+func NewCrlEcoreDomainProvider() core.DomainProvider {
+	return core.NewDomainProvider(CrlEcoreDomainURI, CrlEcoreDomainVersion, nil, BuildCrlEcoreDomain)
+}
+
+// BuildCrlEcoreDomain constructs the domain of Ecore metaclass abstractions
+func BuildCrlEcoreDomain(uOfD *core.UniverseOfDiscourse, trans *core.Transaction) error {
+	crlEcoreDomain, err := uOfD.NewOwnedElement(nil, "CrlEcoreDomain", trans, CrlEcoreDomainURI)
+	if err != nil {
+		return errors.Wrap(err, "crlecoredomain.BuildCrlEcoreDomain failed")
+	}
+	ePackage, err := uOfD.NewOwnedElement(crlEcoreDomain, "EPackage", trans, CrlEcoreEPackageURI)
+	if err != nil {
+		return errors.Wrap(err, "crlecoredomain.BuildCrlEcoreDomain failed")
+	}
+	_, err = uOfD.NewOwnedLiteral(ePackage, "nsURI", trans, CrlEcoreNsURIURI)
+	if err != nil {
+		return errors.Wrap(err, "crlecoredomain.BuildCrlEcoreDomain failed")
+	}
+	_, err = uOfD.NewOwnedLiteral(ePackage, "nsPrefix", trans, CrlEcoreNsPrefixURI)
+	if err != nil {
+		return errors.Wrap(err, "crlecoredomain.BuildCrlEcoreDomain failed")
+	}
+	_, err = uOfD.NewOwnedElement(crlEcoreDomain, "EClass", trans, CrlEcoreEClassURI)
+	if err != nil {
+		return errors.Wrap(err, "crlecoredomain.BuildCrlEcoreDomain failed")
+	}
+	_, err = uOfD.NewOwnedElement(crlEcoreDomain, "EEnum", trans, CrlEcoreEEnumURI)
+	if err != nil {
+		return errors.Wrap(err, "crlecoredomain.BuildCrlEcoreDomain failed")
+	}
+	_, err = uOfD.NewOwnedElement(crlEcoreDomain, "EDataType", trans, CrlEcoreEDataTypeURI)
+	if err != nil {
+		return errors.Wrap(err, "crlecoredomain.BuildCrlEcoreDomain failed")
+	}
+	_, err = uOfD.NewOwnedLiteral(crlEcoreDomain, "EAttribute", trans, CrlEcoreEAttributeURI)
+	if err != nil {
+		return errors.Wrap(err, "crlecoredomain.BuildCrlEcoreDomain failed")
+	}
+	_, err = uOfD.NewOwnedLiteral(crlEcoreDomain, "EEnumLiteral", trans, CrlEcoreEEnumLiteralURI)
+	if err != nil {
+		return errors.Wrap(err, "crlecoredomain.BuildCrlEcoreDomain failed")
+	}
+	_, err = uOfD.NewOwnedReference(crlEcoreDomain, "EReference", trans, CrlEcoreEReferenceURI)
+	if err != nil {
+		return errors.Wrap(err, "crlecoredomain.BuildCrlEcoreDomain failed")
+	}
+	err = crlEcoreDomain.SetReadOnlyRecursively(true, trans)
+	if err != nil {
+		return errors.Wrap(err, "crlecoredomain.BuildCrlEcoreDomain failed")
+	}
+	err = crlEcoreDomain.SetIsCoreRecursively(trans)
+	if err != nil {
+		return errors.Wrap(err, "crlecoredomain.BuildCrlEcoreDomain failed")
+	}
+	return nil
+}
+
+// ensureCrlEcoreDomain builds the CRL Ecore domain if it is not already present in the uOfD, as it will not be when
+// the uOfD is not managed by a UofDManager with the CRL Ecore domain provider registered
+func ensureCrlEcoreDomain(uOfD *core.UniverseOfDiscourse, trans *core.Transaction) error {
+	if uOfD.GetElementWithURI(CrlEcoreDomainURI) != nil {
+		return nil
+	}
+	err := BuildCrlEcoreDomain(uOfD, trans)
+	if err != nil {
+		return err
+	}
+	uOfD.SetDomainVersion(CrlEcoreDomainURI, CrlEcoreDomainVersion)
+	return nil
+}
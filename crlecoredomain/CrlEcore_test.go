@@ -0,0 +1,200 @@
+package crlecoredomain
+
+import (
+	"bytes"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+	"github.com/pbrown12303/activeCRL/core"
+	uuid "github.com/satori/go.uuid"
+)
+
+const libraryEcore = `<?xml version="1.0" encoding="UTF-8"?>
+<ecore:EPackage xmi:version="2.0" xmlns:xmi="http://www.omg.org/XMI" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"
+    xmlns:ecore="http://www.eclipse.org/emf/2002/Ecore" name="library" nsURI="http://example.com/library" nsPrefix="lib">
+  <eClassifiers xsi:type="ecore:EClass" name="Item" abstract="true">
+    <eStructuralFeatures xsi:type="ecore:EAttribute" name="title" eType="ecore:EDataType http://www.eclipse.org/emf/2002/Ecore#//EString"/>
+  </eClassifiers>
+  <eClassifiers xsi:type="ecore:EClass" name="Book" eSuperTypes="#//Item">
+    <eStructuralFeatures xsi:type="ecore:EReference" name="author" eType="#//Writer"/>
+    <eStructuralFeatures xsi:type="ecore:EAttribute" name="category" eType="#//Category"/>
+  </eClassifiers>
+  <eClassifiers xsi:type="ecore:EClass" name="Writer">
+    <eStructuralFeatures xsi:type="ecore:EAttribute" name="name" eType="ecore:EDataType http://www.eclipse.org/emf/2002/Ecore#//EString"/>
+  </eClassifiers>
+  <eClassifiers xsi:type="ecore:EEnum" name="Category">
+    <eLiterals name="Fiction"/>
+    <eLiterals name="Biography" value="1"/>
+  </eClassifiers>
+  <eSubpackages name="loans" nsURI="http://example.com/library/loans" nsPrefix="loans">
+    <eClassifiers xsi:type="ecore:EClass" name="Loan">
+      <eStructuralFeatures xsi:type="ecore:EReference" name="item" eType="#//Item"/>
+    </eClassifiers>
+  </eSubpackages>
+</ecore:EPackage>
+`
+
+const libraryUML = `<?xml version="1.0" encoding="UTF-8"?>
+<xmi:XMI xmi:version="2.1" xmlns:xmi="http://schema.omg.org/spec/XMI/2.1" xmlns:uml="http://www.eclipse.org/uml2/3.0.0/UML">
+  <uml:Model xmi:id="model" name="Library">
+    <packagedElement xmi:type="uml:Class" xmi:id="item" name="Item" isAbstract="true">
+      <ownedAttribute xmi:id="item.title" name="title">
+        <type xmi:type="uml:PrimitiveType" href="pathmap://UML_LIBRARIES/UMLPrimitiveTypes.library.uml#String"/>
+      </ownedAttribute>
+    </packagedElement>
+    <packagedElement xmi:type="uml:Class" xmi:id="book" name="Book">
+      <generalization xmi:id="book.generalization" general="item"/>
+      <ownedAttribute xmi:id="book.author" name="author" type="writer" association="authorship"/>
+      <ownedAttribute xmi:id="book.category" name="category" type="category"/>
+    </packagedElement>
+    <packagedElement xmi:type="uml:Class" xmi:id="writer" name="Writer"/>
+    <packagedElement xmi:type="uml:Enumeration" xmi:id="category" name="Category">
+      <ownedLiteral xmi:id="category.fiction" name="Fiction"/>
+    </packagedElement>
+    <packagedElement xmi:type="uml:Association" xmi:id="authorship" memberEnd="book.author"/>
+  </uml:Model>
+</xmi:XMI>
+`
+
+var _ = Describe("CrlEcore domain test", func() {
+	Specify("Domain generation should be idempotent", func() {
+		uOfD1 := core.NewUniverseOfDiscourse()
+		trans1 := uOfD1.NewTransaction()
+		Expect(BuildCrlEcoreDomain(uOfD1, trans1)).To(Succeed())
+		domain1 := uOfD1.GetElementWithURI(CrlEcoreDomainURI)
+		Expect(domain1).ToNot(BeNil())
+		uOfD2 := core.NewUniverseOfDiscourse()
+		trans2 := uOfD2.NewTransaction()
+		Expect(BuildCrlEcoreDomain(uOfD2, trans2)).To(Succeed())
+		domain2 := uOfD2.GetElementWithURI(CrlEcoreDomainURI)
+		Expect(core.RecursivelyEquivalent(domain1, trans1, domain2, trans2, true)).To(BeTrue())
+	})
+})
+
+var _ = Describe("Ecore import and export", func() {
+	var uOfD *core.UniverseOfDiscourse
+	var trans *core.Transaction
+
+	BeforeEach(func() {
+		uOfD = core.NewUniverseOfDiscourse()
+		trans = uOfD.NewTransaction()
+	})
+
+	AfterEach(func() {
+		trans.ReleaseLocks()
+	})
+
+	Specify("ImportEcore should create refinements of the CRL Ecore concepts", func() {
+		roots, err := ImportEcore(strings.NewReader(libraryEcore), "", uOfD, trans)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(roots).To(HaveLen(1))
+		library := roots[0]
+		Expect(library.GetLabel(trans)).To(Equal("library"))
+		Expect(library.IsRefinementOfURI(CrlEcoreEPackageURI, trans)).To(BeTrue())
+		Expect(library.GetFirstOwnedConceptRefinedFromURI(CrlEcoreNsURIURI, trans).GetLiteralValue(trans)).To(Equal("http://example.com/library"))
+		Expect(library.GetFirstOwnedConceptRefinedFromURI(CrlEcoreNsPrefixURI, trans).GetLiteralValue(trans)).To(Equal("lib"))
+
+		item := uOfD.GetElementWithURI("http://example.com/library/library/Item")
+		Expect(item).ToNot(BeNil())
+		Expect(item.GetConceptID(trans)).To(Equal(uuid.NewV5(uuid.NamespaceURL, "http://example.com/library/library/Item").String()))
+		Expect(item.IsRefinementOfURI(CrlEcoreEClassURI, trans)).To(BeTrue())
+		title := item.GetFirstOwnedConceptRefinedFromURI(CrlEcoreEAttributeURI, trans)
+		Expect(title.GetConceptType()).To(Equal(core.Literal))
+		Expect(title.GetLabel(trans)).To(Equal("title"))
+		Expect(title.GetLiteralValue(trans)).To(Equal("EString"))
+
+		book := uOfD.GetElementWithURI("http://example.com/library/library/Book")
+		writer := uOfD.GetElementWithURI("http://example.com/library/library/Writer")
+		Expect(book.IsRefinementOf(item, trans)).To(BeTrue())
+		author := uOfD.GetElementWithURI("http://example.com/library/library/Book/author")
+		Expect(author.GetConceptType()).To(Equal(core.Reference))
+		Expect(author.IsRefinementOfURI(CrlEcoreEReferenceURI, trans)).To(BeTrue())
+		Expect(author.GetReferencedConcept(trans)).To(Equal(writer))
+		category := uOfD.GetElementWithURI("http://example.com/library/library/Book/category")
+		Expect(category.GetLiteralValue(trans)).To(Equal("Category"))
+		biography := uOfD.GetElementWithURI("http://example.com/library/library/Category/Biography")
+		Expect(biography.IsRefinementOfURI(CrlEcoreEEnumLiteralURI, trans)).To(BeTrue())
+		Expect(biography.GetLiteralValue(trans)).To(Equal("1"))
+
+		loan := uOfD.GetElementWithURI("http://example.com/library/library/loans/Loan")
+		Expect(loan.GetOwningConcept(trans).GetLabel(trans)).To(Equal("loans"))
+		loanItem := loan.GetFirstOwnedConceptRefinedFromURI(CrlEcoreEReferenceURI, trans)
+		Expect(loanItem.GetReferencedConcept(trans)).To(Equal(item))
+	})
+
+	Specify("ImportEcore should produce the same ConceptIDs each time", func() {
+		roots, err := ImportEcore(strings.NewReader(libraryEcore), "http://example.com/models/library", uOfD, trans)
+		Expect(err).ToNot(HaveOccurred())
+		uOfD2 := core.NewUniverseOfDiscourse()
+		trans2 := uOfD2.NewTransaction()
+		defer trans2.ReleaseLocks()
+		roots2, err := ImportEcore(strings.NewReader(libraryEcore), "http://example.com/models/library", uOfD2, trans2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(roots2[0].GetConceptID(trans2)).To(Equal(roots[0].GetConceptID(trans)))
+		Expect(core.RecursivelyEquivalent(roots[0], trans, roots2[0], trans2, true)).To(BeTrue())
+	})
+
+	Specify("ImportEcore should leave the uOfD unchanged when a reference cannot be resolved", func() {
+		broken := strings.Replace(libraryEcore, `eType="#//Writer"`, `eType="#//Missing"`, 1)
+		_, err := ImportEcore(strings.NewReader(broken), "", uOfD, trans)
+		Expect(err).To(HaveOccurred())
+		Expect(uOfD.GetElementWithURI("http://example.com/library/library")).To(BeNil())
+	})
+
+	Specify("ImportEcore should reject a model that is already present", func() {
+		_, err := ImportEcore(strings.NewReader(libraryEcore), "", uOfD, trans)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = ImportEcore(strings.NewReader(libraryEcore), "", uOfD, trans)
+		Expect(err).To(HaveOccurred())
+	})
+
+	Specify("ImportUMLXMI should map UML classifiers, properties, and generalizations", func() {
+		roots, err := ImportUMLXMI(strings.NewReader(libraryUML), "http://example.com/uml/library", uOfD, trans)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(roots).To(HaveLen(1))
+		Expect(roots[0].GetLabel(trans)).To(Equal("Library"))
+		Expect(roots[0].GetConceptID(trans)).To(Equal(uuid.NewV5(uuid.NamespaceURL, "http://example.com/uml/library/model").String()))
+		item := uOfD.GetElementWithURI("http://example.com/uml/library/item")
+		book := uOfD.GetElementWithURI("http://example.com/uml/library/book")
+		writer := uOfD.GetElementWithURI("http://example.com/uml/library/writer")
+		Expect(book.IsRefinementOf(item, trans)).To(BeTrue())
+		Expect(uOfD.GetElementWithURI("http://example.com/uml/library/item.title").GetLiteralValue(trans)).To(Equal("EString"))
+		author := uOfD.GetElementWithURI("http://example.com/uml/library/book.author")
+		Expect(author.IsRefinementOfURI(CrlEcoreEReferenceURI, trans)).To(BeTrue())
+		Expect(author.GetReferencedConcept(trans)).To(Equal(writer))
+		category := uOfD.GetElementWithURI("http://example.com/uml/library/book.category")
+		Expect(category.IsRefinementOfURI(CrlEcoreEAttributeURI, trans)).To(BeTrue())
+		Expect(category.GetLiteralValue(trans)).To(Equal("Category"))
+		fiction := uOfD.GetElementWithURI("http://example.com/uml/library/category.fiction")
+		Expect(fiction.IsRefinementOfURI(CrlEcoreEEnumLiteralURI, trans)).To(BeTrue())
+		Expect(uOfD.GetElementWithURI("http://example.com/uml/library/authorship")).To(BeNil())
+	})
+
+	Specify("ExportEcore should write a document that imports to an equivalent domain", func() {
+		roots, err := ImportEcore(strings.NewReader(libraryEcore), "", uOfD, trans)
+		Expect(err).ToNot(HaveOccurred())
+		var buffer bytes.Buffer
+		Expect(ExportEcore(&buffer, roots[0], trans)).To(Succeed())
+		exported := buffer.String()
+		Expect(exported).To(ContainSubstring(`<ecore:EPackage xmi:version="2.0" xmlns:xmi="http://www.omg.org/XMI"`))
+		Expect(exported).To(ContainSubstring(`<eClassifiers xsi:type="ecore:EClass" name="Book" eSuperTypes="#//Item">`))
+		Expect(exported).To(ContainSubstring(`eType="ecore:EDataType http://www.eclipse.org/emf/2002/Ecore#//EString"`))
+		Expect(exported).To(ContainSubstring(`<eStructuralFeatures xsi:type="ecore:EReference" name="item" eType="#//Item">`))
+
+		uOfD2 := core.NewUniverseOfDiscourse()
+		trans2 := uOfD2.NewTransaction()
+		defer trans2.ReleaseLocks()
+		roots2, err := ImportEcore(strings.NewReader(exported), "", uOfD2, trans2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(core.RecursivelyEquivalent(roots[0], trans, roots2[0], trans2, true)).To(BeTrue())
+		var buffer2 bytes.Buffer
+		Expect(ExportEcore(&buffer2, roots2[0], trans2)).To(Succeed())
+		Expect(buffer2.String()).To(Equal(exported))
+	})
+
+	Specify("ExportEcore should reject a concept that is not an EPackage", func() {
+		Expect(BuildCrlEcoreDomain(uOfD, trans)).To(Succeed())
+		Expect(ExportEcore(&bytes.Buffer{}, uOfD.GetElementWithURI(CrlEcoreEClassURI), trans)).ToNot(Succeed())
+	})
+})
@@ -0,0 +1,235 @@
+package crlecoredomain
+
+import (
+	"encoding/xml"
+	"io"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/pbrown12303/activeCRL/core"
+	"github.com/pkg/errors"
+)
+
+// The ecore...XML types give the structure of the exported Ecore document. Element and attribute names carry their
+// prefixes literally since encoding/xml would otherwise declare a namespace on every element.
+
+type ecorePackageXML struct {
+	Name        string                `xml:"name,attr"`
+	NsURI       string                `xml:"nsURI,attr,omitempty"`
+	NsPrefix    string                `xml:"nsPrefix,attr,omitempty"`
+	Classifiers []*ecoreClassifierXML `xml:"eClassifiers"`
+	Subpackages []*ecorePackageXML    `xml:"eSubpackages"`
+}
+
+type ecoreClassifierXML struct {
+	Type       string             `xml:"xsi:type,attr"`
+	Name       string             `xml:"name,attr"`
+	SuperTypes string             `xml:"eSuperTypes,attr,omitempty"`
+	Literals   []*ecoreLiteralXML `xml:"eLiterals"`
+	Features   []*ecoreFeatureXML `xml:"eStructuralFeatures"`
+}
+
+type ecoreFeatureXML struct {
+	Type  string `xml:"xsi:type,attr"`
+	Name  string `xml:"name,attr"`
+	EType string `xml:"eType,attr,omitempty"`
+}
+
+type ecoreLiteralXML struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr,omitempty"`
+}
+
+// ecoreKindURIs are the CRL Ecore abstractions in the order in which an exported concept's kind is determined
+var ecoreKindURIs = []string{
+	CrlEcoreEPackageURI,
+	CrlEcoreEClassURI,
+	CrlEcoreEEnumURI,
+	CrlEcoreEDataTypeURI,
+	CrlEcoreEAttributeURI,
+	CrlEcoreEReferenceURI,
+	CrlEcoreEEnumLiteralURI}
+
+// ecoreExporter holds the state of a single Ecore export
+type ecoreExporter struct {
+	trans *core.Transaction
+	// fragments are the Ecore fragment paths of the exported classifiers keyed by ConceptID
+	fragments map[string]string
+	// dataTypeFragments are the Ecore fragment paths of the exported data types and enumerations keyed by name
+	dataTypeFragments map[string]string
+}
+
+// ExportEcore writes the package, which must be a refinement of the CRL Ecore EPackage, and its contents as an Ecore
+// document. The contents are written in label order. Attributes are typed by the exported data type or enumeration
+// with the name given by their literal value or, if there is none, by the built-in Ecore data type of that name.
+// References and supertypes that lie outside the package are logged and omitted.
+func ExportEcore(writer io.Writer, pkg core.Concept, trans *core.Transaction) error {
+	if pkg == nil || !pkg.IsRefinementOfURI(CrlEcoreEPackageURI, trans) {
+		return errors.New("crlecoredomain.ExportEcore called with a concept that is not an EPackage")
+	}
+	exporter := &ecoreExporter{trans: trans, fragments: make(map[string]string), dataTypeFragments: make(map[string]string)}
+	exporter.indexClassifiers(pkg, "//")
+	pkgXML := exporter.exportPackage(pkg)
+	_, err := io.WriteString(writer, xml.Header)
+	if err != nil {
+		return errors.Wrap(err, "crlecoredomain.ExportEcore failed")
+	}
+	encoder := xml.NewEncoder(writer)
+	encoder.Indent("", "  ")
+	start := xml.StartElement{
+		Name: xml.Name{Local: "ecore:EPackage"},
+		Attr: []xml.Attr{
+			{Name: xml.Name{Local: "xmi:version"}, Value: "2.0"},
+			{Name: xml.Name{Local: "xmlns:xmi"}, Value: "http://www.omg.org/XMI"},
+			{Name: xml.Name{Local: "xmlns:xsi"}, Value: "http://www.w3.org/2001/XMLSchema-instance"},
+			{Name: xml.Name{Local: "xmlns:ecore"}, Value: EcoreNsURI}}}
+	err = encoder.EncodeElement(pkgXML, start)
+	if err != nil {
+		return errors.Wrap(err, "crlecoredomain.ExportEcore failed")
+	}
+	_, err = io.WriteString(writer, "\n")
+	if err != nil {
+		return errors.Wrap(err, "crlecoredomain.ExportEcore failed")
+	}
+	return nil
+}
+
+// ecoreKind returns the URI of the CRL Ecore abstraction refined by the concept, or an empty string if there is none
+func ecoreKind(concept core.Concept, trans *core.Transaction) string {
+	for _, kindURI := range ecoreKindURIs {
+		if concept.IsRefinementOfURI(kindURI, trans) {
+			return kindURI
+		}
+	}
+	return ""
+}
+
+// ownedConceptsOfKind returns the concepts owned by the owner that have the given kind, sorted by label and then by
+// ConceptID
+func ownedConceptsOfKind(owner core.Concept, kindURI string, trans *core.Transaction) []core.Concept {
+	var concepts []core.Concept
+	for _, child := range owner.GetOwnedConcepts(trans) {
+		if ecoreKind(child, trans) == kindURI {
+			concepts = append(concepts, child)
+		}
+	}
+	sort.Slice(concepts, func(i, j int) bool {
+		labelI := concepts[i].GetLabel(trans)
+		labelJ := concepts[j].GetLabel(trans)
+		if labelI != labelJ {
+			return labelI < labelJ
+		}
+		return concepts[i].GetConceptID(trans) < concepts[j].GetConceptID(trans)
+	})
+	return concepts
+}
+
+// indexClassifiers records the fragment paths of the classifiers in the package and its subpackages
+func (exporter *ecoreExporter) indexClassifiers(pkg core.Concept, fragmentPrefix string) {
+	for _, kindURI := range []string{CrlEcoreEClassURI, CrlEcoreEEnumURI, CrlEcoreEDataTypeURI} {
+		for _, classifier := range ownedConceptsOfKind(pkg, kindURI, exporter.trans) {
+			fragment := fragmentPrefix + classifier.GetLabel(exporter.trans)
+			exporter.fragments[classifier.GetConceptID(exporter.trans)] = fragment
+			if kindURI != CrlEcoreEClassURI && exporter.dataTypeFragments[classifier.GetLabel(exporter.trans)] == "" {
+				exporter.dataTypeFragments[classifier.GetLabel(exporter.trans)] = fragment
+			}
+		}
+	}
+	for _, subpackage := range ownedConceptsOfKind(pkg, CrlEcoreEPackageURI, exporter.trans) {
+		exporter.indexClassifiers(subpackage, fragmentPrefix+subpackage.GetLabel(exporter.trans)+"/")
+	}
+}
+
+func (exporter *ecoreExporter) exportPackage(pkg core.Concept) *ecorePackageXML {
+	trans := exporter.trans
+	pkgXML := &ecorePackageXML{Name: pkg.GetLabel(trans)}
+	if nsURI := pkg.GetFirstOwnedConceptRefinedFromURI(CrlEcoreNsURIURI, trans); nsURI != nil {
+		pkgXML.NsURI = nsURI.GetLiteralValue(trans)
+	}
+	if nsPrefix := pkg.GetFirstOwnedConceptRefinedFromURI(CrlEcoreNsPrefixURI, trans); nsPrefix != nil {
+		pkgXML.NsPrefix = nsPrefix.GetLiteralValue(trans)
+	}
+	var classifiers []core.Concept
+	for _, kindURI := range []string{CrlEcoreEClassURI, CrlEcoreEEnumURI, CrlEcoreEDataTypeURI} {
+		classifiers = append(classifiers, ownedConceptsOfKind(pkg, kindURI, trans)...)
+	}
+	sort.SliceStable(classifiers, func(i, j int) bool {
+		return classifiers[i].GetLabel(trans) < classifiers[j].GetLabel(trans)
+	})
+	for _, classifier := range classifiers {
+		pkgXML.Classifiers = append(pkgXML.Classifiers, exporter.exportClassifier(classifier))
+	}
+	for _, subpackage := range ownedConceptsOfKind(pkg, CrlEcoreEPackageURI, trans) {
+		pkgXML.Subpackages = append(pkgXML.Subpackages, exporter.exportPackage(subpackage))
+	}
+	return pkgXML
+}
+
+func (exporter *ecoreExporter) exportClassifier(classifier core.Concept) *ecoreClassifierXML {
+	trans := exporter.trans
+	classifierXML := &ecoreClassifierXML{Name: classifier.GetLabel(trans)}
+	switch ecoreKind(classifier, trans) {
+	case CrlEcoreEClassURI:
+		classifierXML.Type = "ecore:EClass"
+		var superTypes []string
+		for _, refinement := range classifier.GetOwnedConcepts(trans) {
+			if refinement.GetConceptType() != core.Refinement || refinement.GetRefinedConcept(trans) != classifier {
+				continue
+			}
+			superType := refinement.GetAbstractConcept(trans)
+			if superType == nil || !superType.IsRefinementOfURI(CrlEcoreEClassURI, trans) {
+				continue
+			}
+			fragment, found := exporter.fragments[superType.GetConceptID(trans)]
+			if !found {
+				log.Printf("crlecoredomain.ExportEcore omitted supertype %s of %s that is not in the exported package", superType.GetLabel(trans), classifierXML.Name)
+				continue
+			}
+			superTypes = append(superTypes, "#"+fragment)
+		}
+		sort.Strings(superTypes)
+		classifierXML.SuperTypes = strings.Join(superTypes, " ")
+		features := append(ownedConceptsOfKind(classifier, CrlEcoreEAttributeURI, trans), ownedConceptsOfKind(classifier, CrlEcoreEReferenceURI, trans)...)
+		sort.SliceStable(features, func(i, j int) bool {
+			return features[i].GetLabel(trans) < features[j].GetLabel(trans)
+		})
+		for _, feature := range features {
+			classifierXML.Features = append(classifierXML.Features, exporter.exportFeature(feature))
+		}
+	case CrlEcoreEEnumURI:
+		classifierXML.Type = "ecore:EEnum"
+		for _, literal := range ownedConceptsOfKind(classifier, CrlEcoreEEnumLiteralURI, trans) {
+			classifierXML.Literals = append(classifierXML.Literals, &ecoreLiteralXML{Name: literal.GetLabel(trans), Value: literal.GetLiteralValue(trans)})
+		}
+	case CrlEcoreEDataTypeURI:
+		classifierXML.Type = "ecore:EDataType"
+	}
+	return classifierXML
+}
+
+func (exporter *ecoreExporter) exportFeature(feature core.Concept) *ecoreFeatureXML {
+	trans := exporter.trans
+	featureXML := &ecoreFeatureXML{Name: feature.GetLabel(trans)}
+	if ecoreKind(feature, trans) == CrlEcoreEAttributeURI {
+		featureXML.Type = "ecore:EAttribute"
+		typeName := feature.GetLiteralValue(trans)
+		if fragment, found := exporter.dataTypeFragments[typeName]; found {
+			featureXML.EType = "#" + fragment
+		} else if typeName != "" {
+			featureXML.EType = "ecore:EDataType " + EcoreNsURI + "#//" + typeName
+		}
+		return featureXML
+	}
+	featureXML.Type = "ecore:EReference"
+	target := feature.GetReferencedConcept(trans)
+	if target != nil {
+		fragment, found := exporter.fragments[target.GetConceptID(trans)]
+		if found {
+			featureXML.EType = "#" + fragment
+		} else {
+			log.Printf("crlecoredomain.ExportEcore omitted the type %s of reference %s that is not in the exported package", target.GetLabel(trans), featureXML.Name)
+		}
+	}
+	return featureXML
+}
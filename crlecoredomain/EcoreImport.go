@@ -0,0 +1,241 @@
+package crlecoredomain
+
+import (
+	"io"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pbrown12303/activeCRL/core"
+	"github.com/pkg/errors"
+)
+
+// EcoreNsURI is the namespace URI of the Ecore metamodel. References into this namespace identify the built-in Ecore
+// data types.
+const EcoreNsURI = "http://www.eclipse.org/emf/2002/Ecore"
+
+// ecoreImporter holds the state of a single Ecore import
+type ecoreImporter struct {
+	baseURI   string
+	fragments map[string]*importedElement
+	pending   []func() error
+}
+
+// ImportEcore reads an Ecore model and creates a CRL domain for each of its root packages, returning the root package
+// concepts. The document may be a single EPackage or an XMI element containing several. Concept URIs are formed from
+// the base URI; if the base URI is empty, the nsURI of the first root package is used. References to other resources
+// are logged and left unresolved; references to the built-in Ecore data types are recorded by name. The CRL Ecore
+// domain is built if it is not already present.
+func ImportEcore(reader io.Reader, baseURI string, uOfD *core.UniverseOfDiscourse, trans *core.Transaction) ([]core.Concept, error) {
+	root, err := parseXMI(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "crlecoredomain.ImportEcore failed")
+	}
+	var packageNodes []*xmiNode
+	switch root.XMLName.Local {
+	case "EPackage":
+		packageNodes = append(packageNodes, root)
+	case "XMI":
+		for _, child := range root.Children {
+			if child.XMLName.Local == "EPackage" {
+				packageNodes = append(packageNodes, child)
+			}
+		}
+	default:
+		return nil, errors.New("crlecoredomain.ImportEcore found unexpected root element " + root.XMLName.Local)
+	}
+	if len(packageNodes) == 0 {
+		return nil, errors.New("crlecoredomain.ImportEcore found no EPackage")
+	}
+	if baseURI == "" {
+		baseURI = packageNodes[0].attr("nsURI")
+	}
+	_, err = url.ParseRequestURI(baseURI)
+	if err != nil {
+		return nil, errors.New("crlecoredomain.ImportEcore requires a base URI or a root package nsURI that is a valid URI")
+	}
+	importer := &ecoreImporter{baseURI: baseURI, fragments: make(map[string]*importedElement)}
+	var packages []*importedElement
+	for i, packageNode := range packageNodes {
+		fragmentPrefix := "//"
+		if i > 0 {
+			fragmentPrefix = "/" + strconv.Itoa(i) + "/"
+		}
+		packages = append(packages, importer.readPackage(packageNode, nil, fragmentPrefix))
+	}
+	for _, resolve := range importer.pending {
+		err = resolve()
+		if err != nil {
+			return nil, errors.Wrap(err, "crlecoredomain.ImportEcore failed")
+		}
+	}
+	roots, err := buildImportedElements(packages, uOfD, trans)
+	if err != nil {
+		return nil, errors.Wrap(err, "crlecoredomain.ImportEcore failed")
+	}
+	return roots, nil
+}
+
+// readPackage translates an EPackage node. The fragment prefix is the Ecore fragment path of the package's contents.
+func (importer *ecoreImporter) readPackage(node *xmiNode, path []string, fragmentPrefix string) *importedElement {
+	name := node.attr("name")
+	path = append(append([]string{}, path...), name)
+	pkg := &importedElement{
+		kindURI:  CrlEcoreEPackageURI,
+		name:     name,
+		uri:      elementURI(importer.baseURI, node.xmiAttr("id"), path),
+		nsURI:    node.attr("nsURI"),
+		nsPrefix: node.attr("nsPrefix")}
+	for _, child := range node.Children {
+		switch child.XMLName.Local {
+		case "eClassifiers":
+			classifier := importer.readClassifier(child, path, fragmentPrefix)
+			if classifier != nil {
+				pkg.children = append(pkg.children, classifier)
+			}
+		case "eSubpackages":
+			pkg.children = append(pkg.children, importer.readPackage(child, path, fragmentPrefix+child.attr("name")+"/"))
+		}
+	}
+	return pkg
+}
+
+// readClassifier translates an EClass, EEnum, or EDataType node, returning nil for other kinds of classifier
+func (importer *ecoreImporter) readClassifier(node *xmiNode, path []string, fragmentPrefix string) *importedElement {
+	name := node.attr("name")
+	path = append(append([]string{}, path...), name)
+	classifier := &importedElement{name: name, uri: elementURI(importer.baseURI, node.xmiAttr("id"), path)}
+	fragment := fragmentPrefix + name
+	switch node.typeName() {
+	case "EClass":
+		classifier.kindURI = CrlEcoreEClassURI
+		superTypeHrefs := splitHrefs(node.attr("eSuperTypes"))
+		for _, child := range node.Children {
+			switch child.XMLName.Local {
+			case "eStructuralFeatures":
+				feature := importer.readFeature(child, path, fragment)
+				if feature != nil {
+					classifier.children = append(classifier.children, feature)
+				}
+			case "eGenericSuperTypes":
+				superTypeHrefs = append(superTypeHrefs, splitHrefs(child.attr("eClassifier"))...)
+			}
+		}
+		importer.pending = append(importer.pending, func() error {
+			for _, href := range superTypeHrefs {
+				superType, _, err := importer.resolve(href)
+				if err != nil {
+					return err
+				}
+				if superType == nil || superType.kindURI != CrlEcoreEClassURI {
+					log.Printf("crlecoredomain.ImportEcore ignored supertype %s of %s", href, name)
+					continue
+				}
+				classifier.superTypes = append(classifier.superTypes, superType)
+			}
+			return nil
+		})
+	case "EEnum":
+		classifier.kindURI = CrlEcoreEEnumURI
+		for _, child := range node.Children {
+			if child.XMLName.Local == "eLiterals" {
+				literalName := child.attr("name")
+				classifier.children = append(classifier.children, &importedElement{
+					kindURI: CrlEcoreEEnumLiteralURI,
+					name:    literalName,
+					uri:     elementURI(importer.baseURI, child.xmiAttr("id"), append(append([]string{}, path...), literalName)),
+					value:   child.attr("value")})
+			}
+		}
+	case "EDataType":
+		classifier.kindURI = CrlEcoreEDataTypeURI
+	default:
+		log.Printf("crlecoredomain.ImportEcore ignored classifier %s of type %s", name, node.typeName())
+		return nil
+	}
+	importer.fragments[fragment] = classifier
+	return classifier
+}
+
+// readFeature translates an EAttribute or EReference node, returning nil for other kinds of feature
+func (importer *ecoreImporter) readFeature(node *xmiNode, path []string, classFragment string) *importedElement {
+	name := node.attr("name")
+	feature := &importedElement{name: name, uri: elementURI(importer.baseURI, node.xmiAttr("id"), append(append([]string{}, path...), name))}
+	switch node.typeName() {
+	case "EAttribute":
+		feature.kindURI = CrlEcoreEAttributeURI
+	case "EReference":
+		feature.kindURI = CrlEcoreEReferenceURI
+	default:
+		log.Printf("crlecoredomain.ImportEcore ignored feature %s of type %s", name, node.typeName())
+		return nil
+	}
+	typeHrefs := splitHrefs(node.attr("eType"))
+	for _, child := range node.Children {
+		if child.XMLName.Local == "eGenericType" {
+			typeHrefs = append(typeHrefs, splitHrefs(child.attr("eClassifier"))...)
+		}
+	}
+	importer.pending = append(importer.pending, func() error {
+		if len(typeHrefs) == 0 {
+			return nil
+		}
+		typeElement, typeName, err := importer.resolve(typeHrefs[0])
+		if err != nil {
+			return err
+		}
+		switch {
+		case feature.kindURI == CrlEcoreEAttributeURI:
+			feature.value = typeName
+			feature.typeRef = typeElement
+		case typeElement != nil && typeElement.kindURI == CrlEcoreEClassURI:
+			feature.typeRef = typeElement
+		default:
+			log.Printf("crlecoredomain.ImportEcore left the type %s of reference %s unresolved", typeHrefs[0], name)
+		}
+		return nil
+	})
+	importer.fragments[classFragment+"/"+name] = feature
+	return feature
+}
+
+// resolve returns the element identified by an Ecore reference along with the name of the referenced classifier.
+// References to the built-in Ecore types and to other resources return a nil element; an unresolvable reference to
+// the model being imported is an error.
+func (importer *ecoreImporter) resolve(href string) (*importedElement, string, error) {
+	document := ""
+	fragment := href
+	if hashIndex := strings.Index(href, "#"); hashIndex >= 0 {
+		document = href[:hashIndex]
+		fragment = href[hashIndex+1:]
+	}
+	typeName := fragment[strings.LastIndex(fragment, "/")+1:]
+	if document != "" {
+		if document != EcoreNsURI {
+			log.Printf("crlecoredomain.ImportEcore found reference to another resource: %s", href)
+		}
+		return nil, typeName, nil
+	}
+	if strings.HasPrefix(fragment, "/0/") {
+		fragment = "//" + strings.TrimPrefix(fragment, "/0/")
+	}
+	element := importer.fragments[fragment]
+	if element == nil {
+		return nil, "", errors.New("crlecoredomain.ImportEcore could not resolve reference " + href)
+	}
+	return element, element.name, nil
+}
+
+// splitHrefs splits a space-separated list of Ecore references, dropping the type prefixes, such as
+// "ecore:EDataType", that may precede references to other resources
+func splitHrefs(value string) []string {
+	var hrefs []string
+	for _, token := range strings.Fields(value) {
+		if strings.Contains(token, ":") && !strings.Contains(token, "#") && !strings.HasPrefix(token, "/") {
+			continue
+		}
+		hrefs = append(hrefs, token)
+	}
+	return hrefs
+}
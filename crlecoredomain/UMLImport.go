@@ -0,0 +1,186 @@
+package crlecoredomain
+
+import (
+	"io"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/pbrown12303/activeCRL/core"
+	"github.com/pkg/errors"
+)
+
+// umlPrimitiveTypes maps the names of the UML primitive types to the corresponding built-in Ecore data types
+var umlPrimitiveTypes = map[string]string{
+	"Boolean":          "EBoolean",
+	"Integer":          "EInt",
+	"Real":             "EDouble",
+	"String":           "EString",
+	"UnlimitedNatural": "EInt"}
+
+// umlImporter holds the state of a single UML XMI import
+type umlImporter struct {
+	baseURI string
+	ids     map[string]*importedElement
+	pending []func() error
+}
+
+// ImportUMLXMI reads a UML2 model serialized as XMI and creates a CRL domain for each of its root models or
+// packages, returning the root concepts. Packages become EPackages, classes and interfaces become EClasses,
+// enumerations become EEnums, and data types and primitive types become EDataTypes. A property typed by a class or
+// interface becomes an EReference; any other property becomes an EAttribute whose value is the name of its type, with
+// the UML primitive types mapped to the corresponding Ecore data types. Generalizations become supertype refinements.
+// Concept URIs are formed from the base URI and the xmi:ids. Other UML elements and references to other resources are
+// ignored. The CRL Ecore domain is built if it is not already present.
+func ImportUMLXMI(reader io.Reader, baseURI string, uOfD *core.UniverseOfDiscourse, trans *core.Transaction) ([]core.Concept, error) {
+	root, err := parseXMI(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "crlecoredomain.ImportUMLXMI failed")
+	}
+	_, err = url.ParseRequestURI(baseURI)
+	if err != nil {
+		return nil, errors.New("crlecoredomain.ImportUMLXMI requires a valid base URI")
+	}
+	var packageNodes []*xmiNode
+	if root.XMLName.Local == "XMI" {
+		for _, child := range root.Children {
+			if child.XMLName.Local == "Model" || child.XMLName.Local == "Package" {
+				packageNodes = append(packageNodes, child)
+			}
+		}
+	} else if root.XMLName.Local == "Model" || root.XMLName.Local == "Package" {
+		packageNodes = append(packageNodes, root)
+	}
+	if len(packageNodes) == 0 {
+		return nil, errors.New("crlecoredomain.ImportUMLXMI found no UML Model or Package")
+	}
+	importer := &umlImporter{baseURI: baseURI, ids: make(map[string]*importedElement)}
+	var packages []*importedElement
+	for _, packageNode := range packageNodes {
+		packages = append(packages, importer.readPackage(packageNode, nil))
+	}
+	for _, resolve := range importer.pending {
+		err = resolve()
+		if err != nil {
+			return nil, errors.Wrap(err, "crlecoredomain.ImportUMLXMI failed")
+		}
+	}
+	roots, err := buildImportedElements(packages, uOfD, trans)
+	if err != nil {
+		return nil, errors.Wrap(err, "crlecoredomain.ImportUMLXMI failed")
+	}
+	return roots, nil
+}
+
+// newElement creates an importedElement for the node and indexes it by its xmi:id
+func (importer *umlImporter) newElement(node *xmiNode, kindURI string, path []string) *importedElement {
+	element := &importedElement{
+		kindURI: kindURI,
+		name:    node.attr("name"),
+		uri:     elementURI(importer.baseURI, node.xmiAttr("id"), path)}
+	if id := node.xmiAttr("id"); id != "" {
+		importer.ids[id] = element
+	}
+	return element
+}
+
+// readPackage translates a Model or Package node along with its packaged elements
+func (importer *umlImporter) readPackage(node *xmiNode, path []string) *importedElement {
+	path = append(append([]string{}, path...), node.attr("name"))
+	pkg := importer.newElement(node, CrlEcoreEPackageURI, path)
+	pkg.nsURI = node.attr("URI")
+	for _, child := range node.Children {
+		if child.XMLName.Local != "packagedElement" {
+			continue
+		}
+		childPath := append(append([]string{}, path...), child.attr("name"))
+		switch child.typeName() {
+		case "Model", "Package":
+			pkg.children = append(pkg.children, importer.readPackage(child, path))
+		case "Class", "Interface":
+			pkg.children = append(pkg.children, importer.readClass(child, childPath))
+		case "Enumeration":
+			enum := importer.newElement(child, CrlEcoreEEnumURI, childPath)
+			for _, literalNode := range child.Children {
+				if literalNode.XMLName.Local == "ownedLiteral" {
+					literalPath := append(append([]string{}, childPath...), literalNode.attr("name"))
+					enum.children = append(enum.children, importer.newElement(literalNode, CrlEcoreEEnumLiteralURI, literalPath))
+				}
+			}
+			pkg.children = append(pkg.children, enum)
+		case "DataType", "PrimitiveType":
+			pkg.children = append(pkg.children, importer.newElement(child, CrlEcoreEDataTypeURI, childPath))
+		default:
+			log.Printf("crlecoredomain.ImportUMLXMI ignored %s %s", child.typeName(), child.attr("name"))
+		}
+	}
+	return pkg
+}
+
+// readClass translates a Class or Interface node along with its owned attributes and generalizations
+func (importer *umlImporter) readClass(node *xmiNode, path []string) *importedElement {
+	class := importer.newElement(node, CrlEcoreEClassURI, path)
+	var generalIDs []string
+	for _, child := range node.Children {
+		switch child.XMLName.Local {
+		case "ownedAttribute":
+			propertyPath := append(append([]string{}, path...), child.attr("name"))
+			class.children = append(class.children, importer.readProperty(child, propertyPath))
+		case "generalization":
+			if general := child.attr("general"); general != "" {
+				generalIDs = append(generalIDs, general)
+			} else {
+				log.Printf("crlecoredomain.ImportUMLXMI ignored generalization of %s to another resource", class.name)
+			}
+		}
+	}
+	importer.pending = append(importer.pending, func() error {
+		for _, generalID := range generalIDs {
+			general := importer.ids[generalID]
+			if general == nil || general.kindURI != CrlEcoreEClassURI {
+				return errors.New("crlecoredomain.ImportUMLXMI could not resolve general " + generalID + " of " + class.name)
+			}
+			class.superTypes = append(class.superTypes, general)
+		}
+		return nil
+	})
+	return class
+}
+
+// readProperty translates a Property node into an EReference if it is typed by a class and an EAttribute otherwise.
+// The kind is decided once all of the model's elements have been read.
+func (importer *umlImporter) readProperty(node *xmiNode, path []string) *importedElement {
+	property := importer.newElement(node, CrlEcoreEAttributeURI, path)
+	typeID := node.attr("type")
+	typeHref := ""
+	for _, child := range node.Children {
+		if child.XMLName.Local == "type" {
+			typeID = child.xmiAttr("idref")
+			typeHref = child.attr("href")
+		}
+	}
+	importer.pending = append(importer.pending, func() error {
+		switch {
+		case typeID != "":
+			typeElement := importer.ids[typeID]
+			if typeElement == nil {
+				log.Printf("crlecoredomain.ImportUMLXMI left the type %s of property %s unresolved", typeID, property.name)
+				return nil
+			}
+			if typeElement.kindURI == CrlEcoreEClassURI {
+				property.kindURI = CrlEcoreEReferenceURI
+			} else {
+				property.value = typeElement.name
+			}
+			property.typeRef = typeElement
+		case typeHref != "":
+			typeName := typeHref[strings.LastIndex(typeHref, "#")+1:]
+			if ecoreName, found := umlPrimitiveTypes[typeName]; found {
+				typeName = ecoreName
+			}
+			property.value = typeName
+		}
+		return nil
+	})
+	return property
+}
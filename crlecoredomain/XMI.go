@@ -0,0 +1,209 @@
+package crlecoredomain
+
+import (
+	"encoding/xml"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pbrown12303/activeCRL/core"
+	"github.com/pkg/errors"
+)
+
+// xmiNode is a generic XML element. Ecore and UML2 XMI are read into trees of xmiNodes rather than into fixed structs
+// because the element names depend on the containing feature and the element kinds are given by xsi:type or
+// xmi:type attributes.
+type xmiNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Children []*xmiNode `xml:",any"`
+}
+
+// parseXMI reads the XML document into a tree of xmiNodes
+func parseXMI(reader io.Reader) (*xmiNode, error) {
+	var root xmiNode
+	err := xml.NewDecoder(reader).Decode(&root)
+	if err != nil {
+		return nil, errors.Wrap(err, "crlecoredomain.parseXMI failed")
+	}
+	return &root, nil
+}
+
+// attr returns the value of the node's unqualified attribute with the given name
+func (node *xmiNode) attr(name string) string {
+	for _, attr := range node.Attrs {
+		if attr.Name.Space == "" && attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// xmiAttr returns the value of the node's attribute with the given name in the XMI namespace
+func (node *xmiNode) xmiAttr(name string) string {
+	for _, attr := range node.Attrs {
+		if attr.Name.Local == name && (attr.Name.Space == "xmi" || strings.Contains(attr.Name.Space, "XMI")) {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// typeName returns the unprefixed metaclass name given by the node's xsi:type or xmi:type attribute
+func (node *xmiNode) typeName() string {
+	typeValue := ""
+	for _, attr := range node.Attrs {
+		if attr.Name.Local == "type" && (attr.Name.Space == "xsi" || strings.Contains(attr.Name.Space, "XMLSchema-instance")) {
+			typeValue = attr.Value
+		}
+	}
+	if typeValue == "" {
+		typeValue = node.xmiAttr("type")
+	}
+	return typeValue[strings.LastIndex(typeValue, ":")+1:]
+}
+
+// importedElement is a model element read from Ecore or UML XMI. The importers translate their input into a tree of
+// importedElements, resolve the references between them, and only then create the corresponding concepts, so that a
+// model that cannot be read or resolved leaves the uOfD unchanged.
+type importedElement struct {
+	kindURI    string
+	name       string
+	uri        string
+	value      string
+	nsURI      string
+	nsPrefix   string
+	children   []*importedElement
+	typeRef    *importedElement
+	superTypes []*importedElement
+	concept    core.Concept
+}
+
+// elementURI returns the URI for an element: the base URI extended with the escaped xmi:id when there is one and
+// with the escaped names of the element and its containers otherwise
+func elementURI(baseURI string, xmiID string, path []string) string {
+	if xmiID != "" {
+		return strings.TrimSuffix(baseURI, "/") + "/" + url.PathEscape(xmiID)
+	}
+	uri := strings.TrimSuffix(baseURI, "/")
+	for _, name := range path {
+		uri = uri + "/" + url.PathEscape(name)
+	}
+	return uri
+}
+
+// buildImportedElements creates the concepts for the imported packages and their contents. Every URI is checked
+// before any concept is created.
+func buildImportedElements(packages []*importedElement, uOfD *core.UniverseOfDiscourse, trans *core.Transaction) ([]core.Concept, error) {
+	err := ensureCrlEcoreDomain(uOfD, trans)
+	if err != nil {
+		return nil, errors.Wrap(err, "crlecoredomain.buildImportedElements failed")
+	}
+	uris := make(map[string]bool)
+	var checkURIs func(element *importedElement) error
+	checkURIs = func(element *importedElement) error {
+		elementURIs := []string{element.uri}
+		if element.kindURI == CrlEcoreEPackageURI {
+			elementURIs = append(elementURIs, element.uri+"/nsURI", element.uri+"/nsPrefix")
+		}
+		for _, uri := range elementURIs {
+			if uris[uri] {
+				return errors.New("crlecoredomain.buildImportedElements found more than one element with URI " + uri)
+			}
+			uris[uri] = true
+			if uOfD.GetElementWithURI(uri) != nil {
+				return errors.New("crlecoredomain.buildImportedElements found concept already present in the uOfD with URI " + uri)
+			}
+		}
+		for _, child := range element.children {
+			err := checkURIs(child)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, pkg := range packages {
+		err = checkURIs(pkg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var create func(element *importedElement, owner core.Concept) error
+	create = func(element *importedElement, owner core.Concept) error {
+		abstraction := uOfD.GetElementWithURI(element.kindURI)
+		concept, err := uOfD.CreateOwnedRefinementOfConcept(abstraction, owner, element.name, trans, element.uri)
+		if err != nil {
+			return err
+		}
+		element.concept = concept
+		if element.kindURI == CrlEcoreEAttributeURI || element.kindURI == CrlEcoreEEnumLiteralURI {
+			err = concept.SetLiteralValue(element.value, trans)
+			if err != nil {
+				return err
+			}
+		}
+		if element.kindURI == CrlEcoreEPackageURI {
+			for i, literalURI := range []string{CrlEcoreNsURIURI, CrlEcoreNsPrefixURI} {
+				value := []string{element.nsURI, element.nsPrefix}[i]
+				if value == "" {
+					continue
+				}
+				literalAbstraction := uOfD.GetElementWithURI(literalURI)
+				literal, err := uOfD.CreateOwnedRefinementOfConcept(literalAbstraction, concept, literalAbstraction.GetLabel(trans), trans, element.uri+"/"+literalAbstraction.GetLabel(trans))
+				if err != nil {
+					return err
+				}
+				err = literal.SetLiteralValue(value, trans)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		for _, child := range element.children {
+			err = create(child, concept)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var link func(element *importedElement) error
+	link = func(element *importedElement) error {
+		if element.kindURI == CrlEcoreEReferenceURI && element.typeRef != nil {
+			err := element.concept.SetReferencedConcept(element.typeRef.concept, core.NoAttribute, trans)
+			if err != nil {
+				return err
+			}
+		}
+		for i, superType := range element.superTypes {
+			_, err := uOfD.NewOwnedRefinement(element.concept, "Refines "+superType.name, superType.concept, element.concept, trans, element.uri+"/eSuperTypes/"+strconv.Itoa(i))
+			if err != nil {
+				return err
+			}
+		}
+		for _, child := range element.children {
+			err := link(child)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var roots []core.Concept
+	for _, pkg := range packages {
+		err = create(pkg, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "crlecoredomain.buildImportedElements failed")
+		}
+		roots = append(roots, pkg.concept)
+	}
+	for _, pkg := range packages {
+		err = link(pkg)
+		if err != nil {
+			return nil, errors.Wrap(err, "crlecoredomain.buildImportedElements failed")
+		}
+	}
+	return roots, nil
+}
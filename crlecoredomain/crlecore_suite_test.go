@@ -0,0 +1,13 @@
+package crlecoredomain
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+)
+
+func TestCrlEcore(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "CrlEcore Suite")
+}
@@ -10,9 +10,11 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/pbrown12303/activeCRL/core"
+	"github.com/pbrown12303/activeCRL/crlconstraintdomain"
 	"github.com/pbrown12303/activeCRL/crldatastructuresdomain"
 	"github.com/pbrown12303/activeCRL/crldatatypesdomain"
 	"github.com/pbrown12303/activeCRL/crldiagramdomain"
+	"github.com/pbrown12303/activeCRL/crlecoredomain"
 	"github.com/pbrown12303/activeCRL/crlmapsdomain"
 
 	"github.com/sqweek/dialog"
@@ -25,6 +27,9 @@ type UserPreferences struct {
 	DropDiagramRefinementAsLink bool
 	HorizontalLayoutSpacing     float64
 	VerticalLayoutSpacing       float64
+	// CanonicalSerialization, when true, saves workspace files in the canonical serialization so that they can be
+	// meaningfully compared under version control
+	CanonicalSerialization bool
 }
 
 // Settings reflect the current status of the editing session
@@ -80,6 +85,12 @@ func NewEditor(userFolderArg string) *Editor {
 		editor.userFolder = userFolderArg
 	}
 	editor.uOfDManager = &core.UofDManager{}
+	editor.RegisterDomainProvider(crldatatypesdomain.NewCrlDataTypesDomainProvider())
+	editor.RegisterDomainProvider(crldatastructuresdomain.NewCrlDataStructuresDomainProvider())
+	editor.RegisterDomainProvider(crldiagramdomain.NewCrlDiagramDomainProvider())
+	editor.RegisterDomainProvider(crlmapsdomain.NewCrlMapsDomainProvider())
+	editor.RegisterDomainProvider(crlconstraintdomain.NewCrlConstraintDomainProvider())
+	editor.RegisterDomainProvider(crlecoredomain.NewCrlEcoreDomainProvider())
 	editor.workspaceManager = NewCrlWorkspaceManager(editor)
 	editor.diagramManager = NewDiagramManager(editor)
 	return editor
@@ -106,6 +117,11 @@ func (editor *Editor) AddEditorGUI(editorGUI EditorGUI) error {
 	return nil
 }
 
+// CheckIntegrity returns the referential integrity issues found in the editor's uOfD
+func (editor *Editor) CheckIntegrity(trans *core.Transaction) []core.Issue {
+	return core.CheckIntegrity(editor.GetUofD(), trans)
+}
+
 // ClearWorkspace clears all files in the current workspace that correspond to uOfD root elements
 // and then reinitializes all editorGUIs.
 func (editor *Editor) ClearWorkspace(trans *core.Transaction) error {
@@ -293,6 +309,11 @@ func (editor *Editor) GetDefaultRefinementLabel() string {
 	return "Refinement" + countString
 }
 
+// GetCanonicalSerialization returns true if workspace files are saved in the canonical serialization
+func (editor *Editor) GetCanonicalSerialization() bool {
+	return editor.userPreferences.CanonicalSerialization
+}
+
 // GetDiagramManager returns the diagram manager
 func (editor *Editor) GetDiagramManager() *DiagramManager {
 	return editor.diagramManager
@@ -336,6 +357,11 @@ func (editor *Editor) GetTransaction() (*core.Transaction, bool) {
 	return editor.inProgressTransaction, true
 }
 
+// GetUnresolvedPointers returns the pointers in the editor's uOfD to concepts that have not been loaded
+func (editor *Editor) GetUnresolvedPointers(trans *core.Transaction) []core.UnresolvedPointer {
+	return editor.GetUofD().GetUnresolvedPointers(trans)
+}
+
 // GetUofD returns the current UniverseOfDiscourse
 func (editor *Editor) GetUofD() *core.UniverseOfDiscourse {
 	return editor.uOfDManager.UofD
@@ -366,18 +392,17 @@ func (editor *Editor) Initialize(workspacePath string, promptWorkspaceSelection
 	editor.settings = &Settings{}
 	editor.settings.OpenDiagrams = []string{}
 	editor.inProgressTransaction = nil
-	editor.uOfDManager.Initialize()
+	err := editor.uOfDManager.Initialize()
+	if err != nil {
+		return errors.Wrap(err, "Editor.Initialize failed")
+	}
+	for _, domain := range editor.uOfDManager.GetLoadedDomains() {
+		log.Printf("Loaded domain %s version %s", domain.URI, domain.Version)
+	}
 	trans, isNew := editor.GetTransaction()
 	if isNew {
 		defer editor.EndTransaction()
 	}
-	crldatatypesdomain.BuildCrlDataTypesDomain(editor.GetUofD(), trans)
-	crldatastructuresdomain.BuildCrlDataStructuresDomain(editor.GetUofD(), trans)
-	crldiagramdomain.BuildCrlDiagramDomain(editor.GetUofD(), trans)
-	err := crlmapsdomain.BuildCrlMapsDomain(editor.GetUofD(), trans)
-	if err != nil {
-		return errors.Wrap(err, "Editor.Initialize failed")
-	}
 	uOfD := trans.GetUniverseOfDiscourse()
 	editor.transientCurrentDiagram, _ = uOfD.NewOwnedLiteral(core.Transient, "TransientCurrentDiagram", trans)
 	editor.transientDisplayedDiagrams, _ = uOfD.NewOwnedLiteral(core.Transient, "TransientDisplayedDiagrams", trans)
@@ -425,6 +450,15 @@ func (editor *Editor) Initialize(workspacePath string, promptWorkspaceSelection
 	return nil
 }
 
+// RegisterDomainProvider registers a provider whose domain is built each time the editor initializes its uOfD
+func (editor *Editor) RegisterDomainProvider(provider core.DomainProvider) error {
+	err := editor.uOfDManager.RegisterDomainProvider(provider)
+	if err != nil {
+		return errors.Wrap(err, "Editor.RegisterDomainProvider failed")
+	}
+	return nil
+}
+
 // RefreshGUI tells all GUIs to initialize their state
 func (editor *Editor) RefreshGUI(trans *core.Transaction) error {
 	for _, gui := range editor.editorGUIs {
@@ -504,6 +538,28 @@ func (editor *Editor) RemoveDiagramFromDisplayedList(diagramID string, trans *co
 	}
 }
 
+// RepairIntegrity repairs the referential integrity issues found in the editor's uOfD using the strategy and
+// refreshes the interface. The repair can be undone.
+func (editor *Editor) RepairIntegrity(strategy core.RepairStrategy, trans *core.Transaction) error {
+	uOfD := editor.GetUofD()
+	issues := core.CheckIntegrity(uOfD, trans)
+	// CheckIntegrity finds no issues once the transaction has failed
+	err := trans.Err()
+	if err != nil {
+		return errors.Wrap(err, "Editor.RepairIntegrity failed")
+	}
+	uOfD.MarkUndoPoint()
+	err = core.RepairIntegrity(uOfD, issues, strategy, trans)
+	if err != nil {
+		return errors.Wrap(err, "Editor.RepairIntegrity failed")
+	}
+	err = editor.RefreshGUI(trans)
+	if err != nil {
+		return errors.Wrap(err, "Editor.RepairIntegrity failed")
+	}
+	return nil
+}
+
 // SaveSettings saves the settings to the workspace
 func (editor *Editor) SaveSettings() error {
 	f, err := os.OpenFile(editor.getSettingsPath(), os.O_RDWR|os.O_CREATE, 0755)
@@ -602,6 +658,11 @@ func (editor *Editor) SelectWorkspace() (string, error) {
 	return dialog.Directory().Title("Select a directory for your workspace").Browse()
 }
 
+// SetCanonicalSerialization determines whether workspace files are saved in the canonical serialization
+func (editor *Editor) SetCanonicalSerialization(value bool) {
+	editor.userPreferences.CanonicalSerialization = value
+}
+
 // SetDropDiagramReferenceAsLink returns true if dropped references are shown as links
 func (editor *Editor) SetDropDiagramReferenceAsLink(value bool, trans *core.Transaction) {
 	editor.userPreferences.DropDiagramReferenceAsLink = value
@@ -1,8 +1,11 @@
 package crleditor
 
 import (
+	"bufio"
 	"encoding/json"
+	"io"
 	"io/ioutil"
+	"log"
 	"os"
 	"strings"
 
@@ -10,6 +13,12 @@ import (
 	"github.com/pkg/errors"
 )
 
+// journalFilename is the name of the change journal kept in the workspace directory
+const journalFilename = "changes.journal"
+
+// failedJournalSuffix is appended to the name of a change journal that could not be replayed when it is set aside
+const failedJournalSuffix = ".failed"
+
 type workspaceFile struct {
 	filename      string
 	File          *os.File
@@ -22,6 +31,7 @@ type workspaceFile struct {
 type CrlWorkspaceManager struct {
 	editor         *Editor
 	workspaceFiles map[string]*workspaceFile
+	journal        *core.ChangeJournal
 }
 
 // NewCrlWorkspaceManager returns a configured CrlWorkspaceManager
@@ -66,6 +76,14 @@ func (mgr *CrlWorkspaceManager) CloseWorkspace(trans *core.Transaction) error {
 			return errors.Wrap(err, "CrlWorkspaceManager.CloseWorkspace failed")
 		}
 	}
+	if mgr.journal != nil {
+		mgr.GetUofD().SetChangeJournal(nil)
+		err = mgr.journal.Close()
+		mgr.journal = nil
+		if err != nil {
+			return errors.Wrap(err, "CrlWorkspaceManager.CloseWorkspace failed")
+		}
+	}
 	return nil
 }
 
@@ -114,6 +132,16 @@ func (mgr *CrlWorkspaceManager) newFile(el core.Concept, trans *core.Transaction
 	return &wf, nil
 }
 
+// readHeader reads the DomainHeader of the file
+func (mgr *CrlWorkspaceManager) readHeader(fileInfo os.FileInfo) (*core.DomainHeader, error) {
+	file, err := os.Open(mgr.editor.userPreferences.WorkspacePath + "/" + fileInfo.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return core.ReadDomainHeader(bufio.NewReader(file))
+}
+
 // openFile opens the file and returns a workspaceFile struct
 func (mgr *CrlWorkspaceManager) openFile(fileInfo os.FileInfo, trans *core.Transaction) (*workspaceFile, error) {
 	writable := (fileInfo.Mode().Perm() & 0200) > 0
@@ -126,12 +154,7 @@ func (mgr *CrlWorkspaceManager) openFile(fileInfo os.FileInfo, trans *core.Trans
 	if err != nil {
 		return nil, err
 	}
-	fileContent := make([]byte, fileInfo.Size())
-	_, err = file.Read(fileContent)
-	if err != nil {
-		return nil, err
-	}
-	element, err2 := mgr.GetUofD().RecoverDomain(fileContent, trans)
+	element, err2 := mgr.GetUofD().DecodeDomain(bufio.NewReader(file), trans)
 	if err2 != nil {
 		return nil, err2
 	}
@@ -195,37 +218,124 @@ func (mgr *CrlWorkspaceManager) LoadWorkspace(trans *core.Transaction) error {
 	if err != nil {
 		return errors.Wrap(err, "CrlWorkspaceManager.LoadWorkspace failed")
 	}
+	// Domains are loaded after the domains on which they depend, so that their pointers resolve as they are loaded
+	var domainFiles []os.FileInfo
+	var headers []*core.DomainHeader
 	for _, f := range files {
 		if strings.HasSuffix(f.Name(), ".acrl") {
-			workspaceFile, err := mgr.openFile(f, trans)
+			header, err := mgr.readHeader(f)
 			if err != nil {
-				return errors.Wrap(err, "CrlWorkspaceManager.LoadWorkspace failed loading "+f.Name())
+				return errors.Wrap(err, "CrlWorkspaceManager.LoadWorkspace failed reading "+f.Name())
+			}
+			domainFiles = append(domainFiles, f)
+			headers = append(headers, header)
+		}
+	}
+	// The structural invariants are verified with the rest of the integrity once all of the files have been loaded
+	mgr.GetUofD().SetBulkLoading(true)
+	for _, i := range core.OrderDomainsByDependencies(headers) {
+		f := domainFiles[i]
+		workspaceFile, err := mgr.openFile(f, trans)
+		if err != nil {
+			mgr.GetUofD().SetBulkLoading(false)
+			return errors.Wrap(err, "CrlWorkspaceManager.LoadWorkspace failed loading "+f.Name())
+		}
+		mgr.workspaceFiles[workspaceFile.Domain.GetConceptID(trans)] = workspaceFile
+	}
+	mgr.GetUofD().SetBulkLoading(false)
+	for i, header := range headers {
+		for _, dependency := range header.Dependencies {
+			if mgr.GetUofD().GetElementWithURI(dependency) == nil {
+				log.Printf("CrlWorkspaceManager.LoadWorkspace: %s depends on domain %s, which is not in the workspace", domainFiles[i].Name(), dependency)
 			}
-			mgr.workspaceFiles[workspaceFile.Domain.GetConceptID(trans)] = workspaceFile
 		}
 	}
+	err = mgr.openJournal(trans)
+	if err != nil {
+		return errors.Wrap(err, "CrlWorkspaceManager.LoadWorkspace failed")
+	}
+	// Pointers and structure spanning files can only be checked once all of the files have been loaded
+	for _, issue := range core.CheckIntegrity(mgr.GetUofD(), trans) {
+		log.Printf("CrlWorkspaceManager.LoadWorkspace found integrity issue: %s", issue.String())
+	}
 	mgr.LoadSettings(trans)
 	mgr.editor.SelectElementUsingIDString(mgr.editor.settings.Selection, trans)
 	mgr.editor.diagramManager.DisplayDiagram(mgr.editor.settings.CurrentDiagram, trans)
 	return nil
 }
 
+// openJournal replays any changes journaled since the workspace was last saved and then opens the journal to
+// record subsequent changes. If the journal cannot be replayed, the changes replayed from it are rolled back and the
+// journal is renamed with the failedJournalSuffix, so the workspace opens as it was last saved and the journal is
+// kept for inspection.
+func (mgr *CrlWorkspaceManager) openJournal(trans *core.Transaction) error {
+	if mgr.journal != nil {
+		mgr.GetUofD().SetChangeJournal(nil)
+		err := mgr.journal.Close()
+		mgr.journal = nil
+		if err != nil {
+			return errors.Wrap(err, "CrlWorkspaceManager.openJournal failed")
+		}
+	}
+	journalPath := mgr.editor.userPreferences.WorkspacePath + "/" + journalFilename
+	journalFile, err := os.Open(journalPath)
+	if err == nil {
+		savepoint := trans.Savepoint()
+		err = mgr.GetUofD().ReplayJournal(journalFile, trans)
+		journalFile.Close()
+		if err != nil {
+			log.Printf("CrlWorkspaceManager.openJournal failed to replay the change journal, which is renamed %s: %s", journalFilename+failedJournalSuffix, err.Error())
+			err = trans.RollbackToSavepoint(savepoint)
+			if err != nil {
+				return errors.Wrap(err, "CrlWorkspaceManager.openJournal failed")
+			}
+			err = os.Rename(journalPath, journalPath+failedJournalSuffix)
+			if err != nil {
+				return errors.Wrap(err, "CrlWorkspaceManager.openJournal failed")
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return errors.Wrap(err, "CrlWorkspaceManager.openJournal failed")
+	}
+	mgr.journal, err = core.OpenChangeJournal(journalPath)
+	if err != nil {
+		return errors.Wrap(err, "CrlWorkspaceManager.openJournal failed")
+	}
+	// The domains that are not saved are rebuilt each session, so changes to them could not be replayed
+	for id := range mgr.editor.getNoSaveDomains(trans) {
+		mgr.journal.ExcludeRoot(id)
+	}
+	mgr.GetUofD().SetChangeJournal(mgr.journal)
+	return nil
+}
+
 // saveFile saves the file and updates the fileInfo
 func (mgr *CrlWorkspaceManager) saveFile(wf *workspaceFile, trans *core.Transaction) error {
-	trans.ReadLockElement(wf.Domain)
+	err := trans.ReadLockElement(wf.Domain)
+	if err != nil {
+		return errors.Wrap(err, "CrlBrowserEditor.saveFile failed")
+	}
 	if wf.File == nil {
 		return errors.New("CrlBrowserEditor.SaveFile called with nil file")
 	}
-	byteArray, err := mgr.GetUofD().MarshalDomain(wf.Domain, trans)
+	err = wf.File.Truncate(0)
+	if err != nil {
+		return errors.Wrap(err, "CrlBrowserEditor.saveFile failed")
+	}
+	_, err = wf.File.Seek(0, io.SeekStart)
 	if err != nil {
 		return errors.Wrap(err, "CrlBrowserEditor.saveFile failed")
 	}
-	var length int
-	length, err = wf.File.WriteAt(byteArray, 0)
+	writer := bufio.NewWriter(wf.File)
+	if mgr.editor.GetCanonicalSerialization() {
+		err = mgr.GetUofD().EncodeDomainCanonically(writer, wf.Domain, trans)
+	} else {
+		err = mgr.GetUofD().EncodeDomain(writer, wf.Domain, trans)
+	}
 	if err != nil {
 		return errors.Wrap(err, "CrlBrowserEditor.saveFile failed")
 	}
-	err = wf.File.Truncate(int64(length))
+	err = writer.Flush()
 	if err != nil {
 		return errors.Wrap(err, "CrlBrowserEditor.saveFile failed")
 	}
@@ -292,5 +402,12 @@ func (mgr *CrlWorkspaceManager) SaveWorkspace(trans *core.Transaction) error {
 			delete(mgr.workspaceFiles, id)
 		}
 	}
+	// The saved files now contain all of the journaled changes
+	if mgr.journal != nil {
+		err = mgr.journal.Truncate()
+		if err != nil {
+			return errors.Wrap(err, "CrlWorkspaceManager.SaveWorkspace failed")
+		}
+	}
 	return nil
 }
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"runtime/pprof"
+	"strings"
 	"time"
 
 	"fyne.io/fyne/v2"
@@ -48,14 +49,17 @@ type CrlEditorFyneGUI struct {
 	openWorkspaceItem       *fyne.MenuItem
 	userPreferencesItem     *fyne.MenuItem
 	// Edit Menu Items
-	undoItem *fyne.MenuItem
-	redoItem *fyne.MenuItem
+	undoItem                 *fyne.MenuItem
+	redoItem                 *fyne.MenuItem
+	checkIntegrityItem       *fyne.MenuItem
+	unresolvedReferencesItem *fyne.MenuItem
 	// Debug Menu Items
 	traceSettingsItem  *fyne.MenuItem
 	startProfileItem   *fyne.MenuItem
 	stopProfileItem    *fyne.MenuItem
 	startDebugUndoItem *fyne.MenuItem
 	stopDebugUndoItem  *fyne.MenuItem
+	showFunctionsItem  *fyne.MenuItem
 	// Help Menu Items
 	helpItem *fyne.MenuItem
 	// Main Menu Items
@@ -314,7 +318,12 @@ func (gui *CrlEditorFyneGUI) buildCrlFyneEditorMenus() {
 		})
 		vSpacingBinding.AddListener(vSpacingListener)
 
-		vBox := container.NewVBox(referenceChoice, refinementChoice, hSpacing, vSpacing)
+		canonicalCheck := widget.NewCheck("Save Workspace Files in Canonical Form", func(value bool) {
+			preferences.CanonicalSerialization = value
+		})
+		canonicalCheck.SetChecked(preferences.CanonicalSerialization)
+
+		vBox := container.NewVBox(referenceChoice, refinementChoice, hSpacing, vSpacing, canonicalCheck)
 		dialog.ShowCustomConfirm("User Preferences", "Save", "Cancel", vBox, func(b bool) {
 			if b {
 				*gui.editor.GetUserPreferences() = preferences
@@ -331,6 +340,12 @@ func (gui *CrlEditorFyneGUI) buildCrlFyneEditorMenus() {
 	gui.redoItem = fyne.NewMenuItem("Redo", func() {
 		FyneGUISingleton.redo()
 	})
+	gui.checkIntegrityItem = fyne.NewMenuItem("Check Integrity", func() {
+		gui.checkIntegrity()
+	})
+	gui.unresolvedReferencesItem = fyne.NewMenuItem("Unresolved References", func() {
+		gui.showUnresolvedReferences()
+	})
 
 	// Debug Menu Items
 	gui.traceSettingsItem = fyne.NewMenuItem("Debug Settings", func() {
@@ -388,18 +403,104 @@ func (gui *CrlEditorFyneGUI) buildCrlFyneEditorMenus() {
 	gui.stopDebugUndoItem = fyne.NewMenuItem("Stop debug logging of Undo", func() {
 		crleditor.CrlEditorSingleton.GetUofD().StopDebugUndo()
 	})
+	gui.showFunctionsItem = fyne.NewMenuItem("Show Functions for Selection", func() {
+		selection := gui.editor.GetCurrentSelection()
+		if selection == nil {
+			dialog.ShowInformation("Functions", "No concept is selected", gui.window)
+			return
+		}
+		trans, isNew := gui.editor.GetTransaction()
+		if isNew {
+			defer gui.editor.EndTransaction()
+		}
+		uOfD := gui.editor.GetUofD()
+		var lines []string
+		for _, registration := range uOfD.GetFunctionsForConcept(selection, trans) {
+			lines = append(lines, fmt.Sprintf("%s (priority %d): %s", registration.Name, registration.Priority, registration.URI))
+		}
+		message := "No functions will be executed for " + selection.GetLabel(trans)
+		if len(lines) > 0 {
+			message = "Functions executed for " + selection.GetLabel(trans) + ":\n" + strings.Join(lines, "\n")
+		}
+		dialog.ShowInformation("Functions", message, gui.window)
+	})
 	// Help Menu Items
 	gui.helpItem = fyne.NewMenuItem("Help", func() { fmt.Println("Help Menu") })
 
 	// Main Menu
 	gui.fileMenu = fyne.NewMenu("File", gui.newDomainItem, fyne.NewMenuItemSeparator(), gui.saveWorkspaceItem, gui.closeWorkspaceItem, gui.clearWorkspaceItem, gui.openWorkspaceItem, fyne.NewMenuItemSeparator(), gui.userPreferencesItem)
-	gui.editMenu = fyne.NewMenu("Edit", gui.selectConceptWithIDItem, gui.undoItem, gui.redoItem)
-	gui.debugMenu = fyne.NewMenu("Debug", gui.traceSettingsItem, gui.startProfileItem, gui.stopProfileItem, gui.startDebugUndoItem, gui.stopDebugUndoItem)
+	gui.editMenu = fyne.NewMenu("Edit", gui.selectConceptWithIDItem, gui.undoItem, gui.redoItem, fyne.NewMenuItemSeparator(), gui.checkIntegrityItem, gui.unresolvedReferencesItem)
+	gui.debugMenu = fyne.NewMenu("Debug", gui.traceSettingsItem, gui.startProfileItem, gui.stopProfileItem, gui.startDebugUndoItem, gui.stopDebugUndoItem, gui.showFunctionsItem)
 	gui.helpMenu = fyne.NewMenu("Help", gui.helpItem)
 
 	gui.mainMenu = fyne.NewMainMenu(gui.fileMenu, gui.editMenu, gui.debugMenu, gui.helpMenu)
 }
 
+// checkIntegrity shows the referential integrity issues of the uOfD and offers to repair them
+func (gui *CrlEditorFyneGUI) checkIntegrity() {
+	trans, isNew := gui.editor.GetTransaction()
+	if isNew {
+		defer gui.editor.EndTransaction()
+	}
+	issues := gui.editor.CheckIntegrity(trans)
+	if len(issues) == 0 {
+		dialog.ShowInformation("Integrity", "No integrity issues were found", gui.window)
+		return
+	}
+	var lines []string
+	for _, issue := range issues {
+		lines = append(lines, issue.String())
+	}
+	issueList := widget.NewLabel(strings.Join(lines, "\n"))
+	issueScroll := container.NewScroll(issueList)
+	issueScroll.SetMinSize(fyne.NewSize(600, 200))
+	nullifyChoice := "Nullify dangling pointers and owners"
+	quarantineChoice := "Re-own orphans to the Quarantine domain"
+	strategies := map[string]core.RepairStrategy{nullifyChoice: core.NullifyRepair, quarantineChoice: core.QuarantineRepair}
+	strategyRadioGroup := widget.NewRadioGroup([]string{nullifyChoice, quarantineChoice}, func(s string) {})
+	strategyRadioGroup.SetSelected(nullifyChoice)
+	vBox := container.NewVBox(widget.NewLabel(fmt.Sprintf("%d integrity issues were found:", len(issues))), issueScroll, strategyRadioGroup)
+	dialog.ShowCustomConfirm("Integrity", "Repair", "Cancel", vBox, func(b bool) {
+		if b {
+			trans, isNew := gui.editor.GetTransaction()
+			if isNew {
+				defer gui.editor.EndTransaction()
+			}
+			err := gui.editor.RepairIntegrity(strategies[strategyRadioGroup.Selected], trans)
+			if err != nil {
+				dialog.ShowError(err, gui.window)
+			}
+		}
+	}, gui.window)
+}
+
+// showUnresolvedReferences shows the pointers of the concepts in the uOfD to concepts that have not been loaded. They
+// are resolved if the concepts are loaded.
+func (gui *CrlEditorFyneGUI) showUnresolvedReferences() {
+	trans, isNew := gui.editor.GetTransaction()
+	if isNew {
+		defer gui.editor.EndTransaction()
+	}
+	unresolvedPointers := gui.editor.GetUnresolvedPointers(trans)
+	if len(unresolvedPointers) == 0 {
+		dialog.ShowInformation("Unresolved References", "There are no unresolved references", gui.window)
+		return
+	}
+	var lines []string
+	for _, pointer := range unresolvedPointers {
+		label := ""
+		if el := gui.editor.GetUofD().GetElement(pointer.ConceptID); el != nil {
+			label = el.GetLabel(trans)
+		}
+		lines = append(lines, fmt.Sprintf("%q (%s): %s is the unresolved concept %s", label, pointer.ConceptID, pointer.Attribute.String(), pointer.TargetID))
+	}
+	pointerList := widget.NewLabel(strings.Join(lines, "\n"))
+	pointerScroll := container.NewScroll(pointerList)
+	pointerScroll.SetMinSize(fyne.NewSize(600, 200))
+	vBox := container.NewVBox(widget.NewLabel(fmt.Sprintf("%d references are to concepts that have not been loaded:", len(unresolvedPointers))), pointerScroll)
+	dialog.ShowCustom("Unresolved References", "OK", vBox, gui.window)
+}
+
 // CloseDiagramView closes the view of the diagram
 func (gui *CrlEditorFyneGUI) CloseDiagramView(diagramID string, trans *core.Transaction) error {
 	gui.diagramManager.closeDiagram(diagramID)
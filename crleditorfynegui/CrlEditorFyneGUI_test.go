@@ -3,6 +3,8 @@ package crleditorfynegui
 import (
 	//	"fmt"
 
+	"encoding/json"
+	"os"
 	"time"
 
 	"fyne.io/fyne/v2"
@@ -87,6 +89,45 @@ var _ = Describe("Basic CRLEditorFyneGUI testing", func() {
 			FyneGUISingleton.redo()
 			Expect(uOfD.IsEquivalent(trans, afterUofD, afterTrans, true)).To(BeTrue())
 		})
+		Specify("A change journal that cannot be replayed should be set aside when the workspace is loaded", func() {
+			journalPath := testWorkspaceDir + "/changes.journal"
+			failedJournalPath := journalPath + ".failed"
+			defer os.Remove(failedJournalPath)
+			corruptJournal := []byte("{\"NatureOfChange\":\"ConceptChanged\",")
+			Expect(os.WriteFile(journalPath, corruptJournal, 0644)).To(Succeed())
+			beforeUofD := uOfD.Clone(trans)
+			beforeTrans := beforeUofD.NewTransaction()
+			Expect(crleditor.CrlEditorSingleton.LoadWorkspace(trans)).To(Succeed())
+			Expect(uOfD.IsEquivalent(trans, beforeUofD, beforeTrans, true)).To(BeTrue())
+			Expect(os.ReadFile(failedJournalPath)).To(Equal(corruptJournal))
+			Expect(os.ReadFile(journalPath)).To(BeEmpty())
+		})
+		Specify("A workspace loaded again in a new session without saving should replay its change journal", func() {
+			failedJournalPath := testWorkspaceDir + "/changes.journal.failed"
+			defer os.Remove(failedJournalPath)
+			// Each initialization starts a new session, whose transient concepts have new IDs
+			crleditor.CrlEditorSingleton.EndTransaction()
+			Expect(crleditor.CrlEditorSingleton.Initialize(testWorkspaceDir, false)).To(Succeed())
+			crleditor.CrlEditorSingleton.EndTransaction()
+			Expect(crleditor.CrlEditorSingleton.Initialize(testWorkspaceDir, false)).To(Succeed())
+			_, err := os.Stat(failedJournalPath)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+		Specify("RepairIntegrity should repair the issues found by CheckIntegrity", func() {
+			state := &core.ConceptState{ConceptID: "danglingReference", ConceptType: "Reference", ReferencedConceptID: "missingConcept",
+				ReferencedAttributeName: "NoAttribute"}
+			data, err := json.Marshal(state)
+			Expect(err).ToNot(HaveOccurred())
+			uOfD.SetBulkLoading(true)
+			_, err = uOfD.RecoverElement(data, trans)
+			uOfD.SetBulkLoading(false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(crleditor.CrlEditorSingleton.CheckIntegrity(trans)).To(ContainElement(core.Issue{Kind: core.DanglingPointer,
+				ConceptID: "danglingReference", Attribute: core.ReferencedConceptID, TargetID: "missingConcept"}))
+			Expect(crleditor.CrlEditorSingleton.RepairIntegrity(core.NullifyRepair, trans)).To(Succeed())
+			Expect(uOfD.GetElement("danglingReference").GetReferencedConceptID(trans)).To(Equal(""))
+			Expect(crleditor.CrlEditorSingleton.CheckIntegrity(trans)).To(BeEmpty())
+		})
 	})
 
 	Describe("Single Diagram Tests", func() {
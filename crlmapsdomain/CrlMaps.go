@@ -89,6 +89,14 @@ func NewOneToOneMap(uOfD *core.UniverseOfDiscourse, trans *core.Transaction) (co
 	return newMap, nil
 }
 
+// CrlMapsDomainVersion is the version of the CRL Maps domain
+var CrlMapsDomainVersion = "1.0"
+
+// NewCrlMapsDomainProvider returns the DomainProvider for the CRL Maps domain
+func NewCrlMapsDomainProvider() core.DomainProvider {
+	return core.NewDomainProvider(CrlMapsDomainURI, CrlMapsDomainVersion, nil, BuildCrlMapsDomain)
+}
+
 // BuildCrlMapsDomain constructs the domain for CRL maps
 func BuildCrlMapsDomain(uOfD *core.UniverseOfDiscourse, trans *core.Transaction) error {
 	crlMapsDomain, err1 := uOfD.NewOwnedElement(nil, "CrlMapsDomain", trans, CrlMapsDomainURI)
@@ -129,8 +137,10 @@ func BuildCrlMapsDomain(uOfD *core.UniverseOfDiscourse, trans *core.Transaction)
 // executeOneToOneMap performs the mapping function
 func executeOneToOneMap(mapInstance core.Concept, notification *core.ChangeNotification, trans *core.Transaction) error {
 	uOfD := trans.GetUniverseOfDiscourse()
-	var err error = nil
-	trans.WriteLockElement(mapInstance)
+	err := trans.WriteLockElement(mapInstance)
+	if err != nil {
+		return errors.Wrap(err, "executeOneToOneMap failed")
+	}
 
 	// As an initial assumption, it probably doesn't matter what kind of notification has been received.
 
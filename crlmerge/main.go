@@ -0,0 +1,79 @@
+// Command crlmerge is a git merge driver for CRL domain (.acrl) files. It performs a three-way merge of the domain per
+// concept and per attribute, keyed by ConceptID, and writes the merged domain in its canonical serialization. To use it,
+// add
+//
+//	*.acrl merge=acrl
+//
+// to .gitattributes and configure the driver with
+//
+//	git config merge.acrl.name "CRL domain merge"
+//	git config merge.acrl.driver "crlmerge %O %A %B"
+//
+// The merged domain replaces the ours file. Conflicts that the merge could not resolve are resolved as described for
+// crldiff.Conflict, listed on standard error, and optionally written as JSON to the file named by the -conflicts flag;
+// the command then exits with status 1 so that git reports the file as conflicted. If the merge fails, the ours file
+// is left unchanged and the command exits with status 2.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/pbrown12303/activeCRL/crldiff"
+)
+
+func main() {
+	conflictsArg := flag.String("conflicts", "", "Path of a file to which conflicts are written as JSON (optional)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-conflicts path] base ours theirs\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 3 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	basePath, oursPath, theirsPath := flag.Arg(0), flag.Arg(1), flag.Arg(2)
+	var files [3]*os.File
+	for i, path := range []string{basePath, oursPath, theirsPath} {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Print(err)
+			os.Exit(2)
+		}
+		defer file.Close()
+		files[i] = file
+	}
+	var merged bytes.Buffer
+	conflicts, err := crldiff.MergeDomainFiles(files[0], files[1], files[2], &merged)
+	if err != nil {
+		log.Printf("crlmerge failed to merge %s: %s", oursPath, err)
+		os.Exit(2)
+	}
+	err = ioutil.WriteFile(oursPath, merged.Bytes(), 0644)
+	if err != nil {
+		log.Print(err)
+		os.Exit(2)
+	}
+	if *conflictsArg != "" {
+		conflictsFile, err := os.Create(*conflictsArg)
+		if err != nil {
+			log.Print(err)
+			os.Exit(2)
+		}
+		err = crldiff.WriteConflictsJSON(conflictsFile, conflicts)
+		conflictsFile.Close()
+		if err != nil {
+			log.Print(err)
+			os.Exit(2)
+		}
+	}
+	if len(conflicts) > 0 {
+		crldiff.WriteConflictsText(os.Stderr, conflicts)
+		os.Exit(1)
+	}
+}
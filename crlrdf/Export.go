@@ -0,0 +1,281 @@
+package crlrdf
+
+import (
+	"bufio"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+
+	mapset "github.com/deckarep/golang-set"
+	"github.com/pbrown12303/activeCRL/core"
+	"github.com/pkg/errors"
+)
+
+// ConceptIRI returns the IRI of the concept's resource: its URI if that is an absolute IRI, and urn:uuid:<ConceptID>
+// otherwise
+func ConceptIRI(el core.Concept, trans *core.Transaction) string {
+	uri := el.GetURI(trans)
+	if isAbsoluteIRI(uri) {
+		return uri
+	}
+	return uuidIRI(el.GetConceptID(trans))
+}
+
+// uuidIRI returns the urn:uuid IRI for a ConceptID
+func uuidIRI(conceptID string) string {
+	return "urn:uuid:" + conceptID
+}
+
+// isAbsoluteIRI determines whether the string can be used as an IRI without escaping
+func isAbsoluteIRI(value string) bool {
+	if value == "" || strings.ContainsAny(value, "<>\"{}|^`\\ \t\n\r") {
+		return false
+	}
+	parsed, err := url.Parse(value)
+	return err == nil && parsed.IsAbs()
+}
+
+// pointerIRI returns the IRI of the concept with the given ID. Concepts that are not in the uOfD are identified by
+// their urn:uuid IRI.
+func pointerIRI(uOfD *core.UniverseOfDiscourse, conceptID string, trans *core.Transaction) string {
+	target := uOfD.GetElement(conceptID)
+	if target == nil {
+		return uuidIRI(conceptID)
+	}
+	return ConceptIRI(target, trans)
+}
+
+// GetDomainConcepts returns the root and all of its descendants, the root first and the descendants ordered by
+// ConceptID
+func GetDomainConcepts(root core.Concept, trans *core.Transaction) ([]core.Concept, error) {
+	if root == nil {
+		return nil, errors.New("crlrdf.GetDomainConcepts called with nil root")
+	}
+	uOfD := root.GetUniverseOfDiscourse(trans)
+	if uOfD == nil {
+		return nil, errors.New("crlrdf.GetDomainConcepts called with root that is not in a UniverseOfDiscourse")
+	}
+	descendantIDs := mapset.NewSet()
+	uOfD.GetConceptsOwnedConceptIDsRecursively(root.GetConceptID(trans), descendantIDs, trans)
+	var ids []string
+	for _, id := range descendantIDs.ToSlice() {
+		ids = append(ids, id.(string))
+	}
+	sort.Strings(ids)
+	concepts := []core.Concept{root}
+	for _, id := range ids {
+		descendant := uOfD.GetElement(id)
+		if descendant != nil {
+			concepts = append(concepts, descendant)
+		}
+	}
+	return concepts, nil
+}
+
+// GetConceptTriples returns the triples describing a single concept
+func GetConceptTriples(el core.Concept, trans *core.Transaction) ([]Triple, error) {
+	if el == nil {
+		return nil, errors.New("crlrdf.GetConceptTriples called with nil concept")
+	}
+	uOfD := el.GetUniverseOfDiscourse(trans)
+	if uOfD == nil {
+		return nil, errors.New("crlrdf.GetConceptTriples called with concept that is not in a UniverseOfDiscourse")
+	}
+	subject := NewIRI(ConceptIRI(el, trans))
+	var triples []Triple
+	add := func(predicate string, object Term) {
+		triples = append(triples, Triple{Subject: subject, Predicate: NewIRI(predicate), Object: object})
+	}
+	switch el.GetConceptType() {
+	case core.Element:
+		add(RdfType, NewIRI(CrlElementClass))
+	case core.Literal:
+		add(RdfType, NewIRI(CrlLiteralClass))
+	case core.Reference:
+		add(RdfType, NewIRI(CrlReferenceClass))
+	case core.Refinement:
+		add(RdfType, NewIRI(CrlRefinementClass))
+	default:
+		return nil, errors.New("crlrdf.GetConceptTriples called with concept of unknown type: " + el.GetConceptID(trans))
+	}
+	add(CrlConceptIDProperty, NewLiteral(el.GetConceptID(trans), XsdString))
+	if uri := el.GetURI(trans); uri != "" {
+		add(CrlURIProperty, NewLiteral(uri, XsdAnyURI))
+	}
+	if label := el.GetLabel(trans); label != "" {
+		add(RdfsLabel, NewLiteral(label, XsdString))
+	}
+	if definition := el.GetDefinition(trans); definition != "" {
+		add(CrlDefinitionProperty, NewLiteral(definition, XsdString))
+	}
+	if ownerID := el.GetOwningConceptID(trans); ownerID != "" {
+		add(CrlOwnerProperty, NewIRI(pointerIRI(uOfD, ownerID, trans)))
+	}
+	switch el.GetConceptType() {
+	case core.Literal:
+		add(CrlLiteralValueProperty, NewLiteral(el.GetLiteralValue(trans), XsdString))
+	case core.Reference:
+		if referencedID := el.GetReferencedConceptID(trans); referencedID != "" {
+			add(CrlReferencedConceptProperty, NewIRI(pointerIRI(uOfD, referencedID, trans)))
+		}
+		if attributeName := el.GetReferencedAttributeName(trans); attributeName != core.NoAttribute {
+			add(CrlReferencedAttributeNameProperty, NewLiteral(attributeName.String(), XsdString))
+		}
+	case core.Refinement:
+		abstractID := el.GetAbstractConceptID(trans)
+		refinedID := el.GetRefinedConceptID(trans)
+		if abstractID != "" {
+			add(CrlAbstractConceptProperty, NewIRI(pointerIRI(uOfD, abstractID, trans)))
+		}
+		if refinedID != "" {
+			add(CrlRefinedConceptProperty, NewIRI(pointerIRI(uOfD, refinedID, trans)))
+		}
+		if abstractID != "" && refinedID != "" {
+			triples = append(triples, Triple{
+				Subject:   NewIRI(pointerIRI(uOfD, refinedID, trans)),
+				Predicate: NewIRI(CrlAbstractionProperty),
+				Object:    NewIRI(pointerIRI(uOfD, abstractID, trans))})
+		}
+	}
+	if el.GetIsCore(trans) {
+		add(CrlIsCoreProperty, NewLiteral("true", XsdBoolean))
+	}
+	if el.IsReadOnly(trans) {
+		add(CrlReadOnlyProperty, NewLiteral("true", XsdBoolean))
+	}
+	return triples, nil
+}
+
+// GetDomainTriples returns the triples describing the root and all of its descendants
+func GetDomainTriples(root core.Concept, trans *core.Transaction) ([]Triple, error) {
+	concepts, err := GetDomainConcepts(root, trans)
+	if err != nil {
+		return nil, errors.Wrap(err, "crlrdf.GetDomainTriples failed")
+	}
+	var triples []Triple
+	for _, el := range concepts {
+		conceptTriples, err := GetConceptTriples(el, trans)
+		if err != nil {
+			return nil, errors.Wrap(err, "crlrdf.GetDomainTriples failed")
+		}
+		triples = append(triples, conceptTriples...)
+	}
+	return triples, nil
+}
+
+// ExportNTriples writes the root and all of its descendants to the writer as N-Triples. The triples for each concept
+// are generated and written one concept at a time.
+func ExportNTriples(writer io.Writer, root core.Concept, trans *core.Transaction) error {
+	concepts, err := GetDomainConcepts(root, trans)
+	if err != nil {
+		return errors.Wrap(err, "crlrdf.ExportNTriples failed")
+	}
+	bufferedWriter := bufio.NewWriter(writer)
+	for _, el := range concepts {
+		triples, err := GetConceptTriples(el, trans)
+		if err != nil {
+			return errors.Wrap(err, "crlrdf.ExportNTriples failed")
+		}
+		for _, triple := range triples {
+			_, err = bufferedWriter.WriteString(triple.String() + "\n")
+			if err != nil {
+				return errors.Wrap(err, "crlrdf.ExportNTriples failed")
+			}
+		}
+	}
+	err = bufferedWriter.Flush()
+	if err != nil {
+		return errors.Wrap(err, "crlrdf.ExportNTriples failed")
+	}
+	return nil
+}
+
+// ExportTurtle writes the root and all of its descendants to the writer as Turtle. The statements about each concept
+// are grouped under its subject and the CRL, RDF, RDFS and XSD namespaces are abbreviated with prefixes.
+func ExportTurtle(writer io.Writer, root core.Concept, trans *core.Transaction) error {
+	concepts, err := GetDomainConcepts(root, trans)
+	if err != nil {
+		return errors.Wrap(err, "crlrdf.ExportTurtle failed")
+	}
+	bufferedWriter := bufio.NewWriter(writer)
+	for _, declaration := range turtlePrefixes {
+		bufferedWriter.WriteString("@prefix " + declaration.prefix + ": <" + declaration.namespace + "> .\n")
+	}
+	for _, el := range concepts {
+		triples, err := GetConceptTriples(el, trans)
+		if err != nil {
+			return errors.Wrap(err, "crlrdf.ExportTurtle failed")
+		}
+		writeTurtleStatements(bufferedWriter, triples)
+	}
+	err = bufferedWriter.Flush()
+	if err != nil {
+		return errors.Wrap(err, "crlrdf.ExportTurtle failed")
+	}
+	return nil
+}
+
+// writeTurtleStatements writes the triples, grouping consecutive triples with the same subject
+func writeTurtleStatements(writer *bufio.Writer, triples []Triple) {
+	for i, triple := range triples {
+		if i == 0 || triple.Subject != triples[i-1].Subject {
+			if i > 0 {
+				writer.WriteString(" .\n")
+			}
+			writer.WriteString("\n" + turtleTerm(triple.Subject) + "\n")
+		} else {
+			writer.WriteString(" ;\n")
+		}
+		predicate := turtleTerm(triple.Predicate)
+		if triple.Predicate.Value == RdfType {
+			predicate = "a"
+		}
+		writer.WriteString("    " + predicate + " " + turtleTerm(triple.Object))
+	}
+	if len(triples) > 0 {
+		writer.WriteString(" .\n")
+	}
+}
+
+// turtleTerm returns the Turtle representation of the term, abbreviating IRIs and datatypes in the declared
+// namespaces
+func turtleTerm(term Term) string {
+	switch term.Kind {
+	case IRI:
+		return turtleIRI(term.Value)
+	case Literal:
+		if term.Language == "" && term.Datatype != "" && term.Datatype != XsdString {
+			return "\"" + escapeString(term.Value) + "\"^^" + turtleIRI(term.Datatype)
+		}
+	}
+	return term.String()
+}
+
+// turtleIRI abbreviates the IRI with a declared prefix when the remainder is a simple local name
+func turtleIRI(iri string) string {
+	for _, declaration := range turtlePrefixes {
+		if strings.HasPrefix(iri, declaration.namespace) {
+			local := strings.TrimPrefix(iri, declaration.namespace)
+			if isSimpleLocalName(local) {
+				return declaration.prefix + ":" + local
+			}
+		}
+	}
+	return "<" + escapeIRI(iri) + ">"
+}
+
+// isSimpleLocalName determines whether the string can be written as the local part of a prefixed name without escapes
+func isSimpleLocalName(local string) bool {
+	if local == "" {
+		return false
+	}
+	for i, r := range local {
+		isLetter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		isDigit := r >= '0' && r <= '9'
+		if !isLetter && !(i > 0 && (isDigit || r == '_')) {
+			return false
+		}
+	}
+	return true
+}
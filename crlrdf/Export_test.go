@@ -0,0 +1,84 @@
+package crlrdf
+
+import (
+	"bytes"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+	"github.com/pbrown12303/activeCRL/core"
+)
+
+var _ = Describe("RDF export tests", func() {
+	var uOfD *core.UniverseOfDiscourse
+	var trans *core.Transaction
+	var domain core.Concept
+	var abstraction core.Concept
+	var literal core.Concept
+	var reference core.Concept
+	var refinement core.Concept
+	domainURI := "http://activeCrl.com/test/RdfDomain"
+
+	BeforeEach(func() {
+		uOfD = core.NewUniverseOfDiscourse()
+		trans = uOfD.NewTransaction()
+		domain, _ = uOfD.NewElement(trans, domainURI)
+		domain.SetLabel("Domain", trans)
+		abstraction, _ = uOfD.NewOwnedElement(domain, "Abstraction", trans)
+		abstraction.SetDefinition("A \"quoted\"\nmulti-line definition", trans)
+		literal, _ = uOfD.NewOwnedLiteral(domain, "Literal", trans)
+		literal.SetLiteralValue("value\t1", trans)
+		reference, _ = uOfD.NewOwnedReference(domain, "Reference", trans)
+		reference.SetReferencedConcept(literal, core.LiteralValue, trans)
+		refinement, _ = uOfD.NewOwnedRefinement(domain, "Refinement", abstraction, literal, trans)
+	})
+
+	AfterEach(func() {
+		trans.ReleaseLocks()
+	})
+
+	Specify("Concepts should be identified by their URI or by their ConceptID", func() {
+		Expect(ConceptIRI(domain, trans)).To(Equal(domainURI))
+		Expect(ConceptIRI(literal, trans)).To(Equal("urn:uuid:" + literal.GetConceptID(trans)))
+	})
+	Specify("The triples should describe ownership, references, refinements and literal values", func() {
+		triples, err := GetDomainTriples(domain, trans)
+		Expect(err).To(BeNil())
+		literalIRI := NewIRI(ConceptIRI(literal, trans))
+		abstractionIRI := NewIRI(ConceptIRI(abstraction, trans))
+		Expect(triples).To(ContainElement(Triple{NewIRI(ConceptIRI(literal, trans)), NewIRI(CrlOwnerProperty), NewIRI(domainURI)}))
+		Expect(triples).To(ContainElement(Triple{literalIRI, NewIRI(CrlLiteralValueProperty), NewLiteral("value\t1", XsdString)}))
+		referenceIRI := NewIRI(ConceptIRI(reference, trans))
+		Expect(triples).To(ContainElement(Triple{referenceIRI, NewIRI(RdfType), NewIRI(CrlReferenceClass)}))
+		Expect(triples).To(ContainElement(Triple{referenceIRI, NewIRI(CrlReferencedConceptProperty), literalIRI}))
+		Expect(triples).To(ContainElement(Triple{referenceIRI, NewIRI(CrlReferencedAttributeNameProperty), NewLiteral("LiteralValue", XsdString)}))
+		refinementIRI := NewIRI(ConceptIRI(refinement, trans))
+		Expect(triples).To(ContainElement(Triple{refinementIRI, NewIRI(CrlAbstractConceptProperty), abstractionIRI}))
+		Expect(triples).To(ContainElement(Triple{refinementIRI, NewIRI(CrlRefinedConceptProperty), literalIRI}))
+		Expect(triples).To(ContainElement(Triple{literalIRI, NewIRI(CrlAbstractionProperty), abstractionIRI}))
+		Expect(triples).To(ContainElement(Triple{NewIRI(domainURI), NewIRI(CrlURIProperty), NewLiteral(domainURI, XsdAnyURI)}))
+	})
+	Specify("ExportNTriples should write one escaped triple per line", func() {
+		var buffer bytes.Buffer
+		Expect(ExportNTriples(&buffer, domain, trans)).To(Succeed())
+		lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+		triples, err := GetDomainTriples(domain, trans)
+		Expect(err).To(BeNil())
+		Expect(lines).To(HaveLen(len(triples)))
+		Expect(buffer.String()).To(ContainSubstring(`"A \"quoted\"\nmulti-line definition"`))
+		Expect(buffer.String()).To(ContainSubstring(`<` + domainURI + `> <` + CrlURIProperty + `> "` + domainURI + `"^^<` + XsdAnyURI + `> .`))
+	})
+	Specify("ExportTurtle should group statements by subject and abbreviate the vocabulary", func() {
+		var buffer bytes.Buffer
+		Expect(ExportTurtle(&buffer, domain, trans)).To(Succeed())
+		turtle := buffer.String()
+		Expect(turtle).To(HavePrefix("@prefix crl: <" + CrlRdfNamespace + "> .\n"))
+		Expect(turtle).To(ContainSubstring("<" + domainURI + ">\n    a crl:Element ;\n"))
+		Expect(turtle).To(ContainSubstring("crl:uri \"" + domainURI + "\"^^xsd:anyURI"))
+		parsed, err := ParseTurtle(strings.NewReader(turtle))
+		Expect(err).To(BeNil())
+		triples, err := GetDomainTriples(domain, trans)
+		Expect(err).To(BeNil())
+		Expect(parsed).To(Equal(triples))
+	})
+})
@@ -0,0 +1,234 @@
+package crlrdf
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/pbrown12303/activeCRL/core"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// ImportTurtle reads Turtle expressed in the CRL RDF vocabulary and rebuilds the described concepts in the uOfD. It
+// returns the imported concepts that are not owned by other imported concepts.
+func ImportTurtle(reader io.Reader, uOfD *core.UniverseOfDiscourse, trans *core.Transaction) ([]core.Concept, error) {
+	triples, err := ParseTurtle(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "crlrdf.ImportTurtle failed")
+	}
+	roots, err := ImportTriples(triples, uOfD, trans)
+	if err != nil {
+		return nil, errors.Wrap(err, "crlrdf.ImportTurtle failed")
+	}
+	return roots, nil
+}
+
+// ImportNTriples reads N-Triples expressed in the CRL RDF vocabulary and rebuilds the described concepts in the uOfD.
+// It returns the imported concepts that are not owned by other imported concepts.
+func ImportNTriples(reader io.Reader, uOfD *core.UniverseOfDiscourse, trans *core.Transaction) ([]core.Concept, error) {
+	triples, err := ParseTurtle(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "crlrdf.ImportNTriples failed")
+	}
+	roots, err := ImportTriples(triples, uOfD, trans)
+	if err != nil {
+		return nil, errors.Wrap(err, "crlrdf.ImportNTriples failed")
+	}
+	return roots, nil
+}
+
+// importedResource accumulates the statements about a resource that is typed as a CRL concept
+type importedResource struct {
+	subject    Term
+	properties map[string][]Term
+}
+
+func (resource *importedResource) value(predicate string) (Term, bool) {
+	values := resource.properties[predicate]
+	if len(values) == 0 {
+		return Term{}, false
+	}
+	return values[0], true
+}
+
+// ImportTriples rebuilds the concepts described by the triples in the uOfD. Every resource whose rdf:type is one of
+// the CRL concept classes becomes a concept; all other statements are ignored. Resources without a crl:conceptID are
+// given the ConceptID in their urn:uuid IRI or, failing that, the ID that CRL derives from their IRI. Pointers are
+// resolved against the imported resources first and then against the concepts already in the uOfD. The imported
+// concepts that are not owned by other imported concepts are returned in the order in which they were described.
+func ImportTriples(triples []Triple, uOfD *core.UniverseOfDiscourse, trans *core.Transaction) ([]core.Concept, error) {
+	if uOfD == nil {
+		return nil, errors.New("crlrdf.ImportTriples called with nil uOfD")
+	}
+	resources := make(map[string]*importedResource)
+	var subjectOrder []string
+	for _, triple := range triples {
+		key := triple.Subject.key()
+		resource := resources[key]
+		if resource == nil {
+			resource = &importedResource{subject: triple.Subject, properties: make(map[string][]Term)}
+			resources[key] = resource
+			subjectOrder = append(subjectOrder, key)
+		}
+		resource.properties[triple.Predicate.Value] = append(resource.properties[triple.Predicate.Value], triple.Object)
+	}
+	// Assign the ConceptIDs of the imported resources
+	var conceptKeys []string
+	conceptTypes := make(map[string]core.ConceptType)
+	conceptIDs := make(map[string]string)
+	for _, key := range subjectOrder {
+		resource := resources[key]
+		conceptType, isConcept, err := resourceConceptType(resource)
+		if err != nil {
+			return nil, errors.Wrap(err, "crlrdf.ImportTriples failed")
+		}
+		if !isConcept {
+			continue
+		}
+		conceptID := ""
+		if idTerm, found := resource.value(CrlConceptIDProperty); found {
+			conceptID = idTerm.Value
+		} else if resource.subject.Kind == IRI && strings.HasPrefix(resource.subject.Value, "urn:uuid:") {
+			conceptID = strings.TrimPrefix(resource.subject.Value, "urn:uuid:")
+		} else if resource.subject.Kind == IRI {
+			conceptID = uuid.NewV5(uuid.NamespaceURL, resource.subject.Value).String()
+		} else {
+			return nil, errors.New("crlrdf.ImportTriples found blank node concept without a crl:conceptID: " + key)
+		}
+		if uOfD.GetElement(conceptID) != nil {
+			return nil, errors.New("crlrdf.ImportTriples found concept already present in the uOfD: " + conceptID)
+		}
+		conceptKeys = append(conceptKeys, key)
+		conceptTypes[key] = conceptType
+		conceptIDs[key] = conceptID
+	}
+	resolve := func(resource *importedResource, predicate string) (string, error) {
+		term, found := resource.value(predicate)
+		if !found {
+			return "", nil
+		}
+		if term.Kind == Literal {
+			return "", errors.New("crlrdf.ImportTriples found literal value for " + predicate + " of " + resource.subject.key())
+		}
+		if conceptID, found := conceptIDs[term.key()]; found {
+			return conceptID, nil
+		}
+		if term.Kind == IRI && strings.HasPrefix(term.Value, "urn:uuid:") {
+			return strings.TrimPrefix(term.Value, "urn:uuid:"), nil
+		}
+		if term.Kind == IRI {
+			existing := uOfD.GetElementWithURI(term.Value)
+			if existing != nil {
+				return existing.GetConceptID(trans), nil
+			}
+		}
+		return "", errors.New("crlrdf.ImportTriples could not resolve " + term.key() + " as the " + predicate + " of " + resource.subject.key())
+	}
+	// Build the concept states before changing the uOfD so that an unresolvable resource leaves the uOfD unchanged
+	var states []*core.ConceptState
+	isImported := make(map[string]bool)
+	for _, key := range conceptKeys {
+		resource := resources[key]
+		var state core.ConceptState
+		var err error
+		state.ConceptID = conceptIDs[key]
+		state.ConceptType = core.ConceptTypeToString(conceptTypes[key])
+		state.Version = "1"
+		state.IsCore = "false"
+		state.ReadOnly = "false"
+		state.ReferencedAttributeName = core.NoAttribute.String()
+		state.URI = stringValue(resource, CrlURIProperty)
+		state.Label = stringValue(resource, RdfsLabel)
+		state.Definition = stringValue(resource, CrlDefinitionProperty)
+		state.LiteralValue = stringValue(resource, CrlLiteralValueProperty)
+		if booleanValue(resource, CrlIsCoreProperty) {
+			state.IsCore = "true"
+		}
+		if booleanValue(resource, CrlReadOnlyProperty) {
+			state.ReadOnly = "true"
+		}
+		if attributeName := stringValue(resource, CrlReferencedAttributeNameProperty); attributeName != "" {
+			_, err = core.FindAttributeName(attributeName)
+			if err != nil {
+				return nil, errors.Wrap(err, "crlrdf.ImportTriples failed")
+			}
+			state.ReferencedAttributeName = attributeName
+		}
+		state.OwningConceptID, err = resolve(resource, CrlOwnerProperty)
+		if err != nil {
+			return nil, err
+		}
+		state.ReferencedConceptID, err = resolve(resource, CrlReferencedConceptProperty)
+		if err != nil {
+			return nil, err
+		}
+		state.AbstractConceptID, err = resolve(resource, CrlAbstractConceptProperty)
+		if err != nil {
+			return nil, err
+		}
+		state.RefinedConceptID, err = resolve(resource, CrlRefinedConceptProperty)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, &state)
+		isImported[state.ConceptID] = true
+	}
+	var roots []core.Concept
+	for _, state := range states {
+		data, err := json.Marshal(state)
+		if err != nil {
+			return nil, errors.Wrap(err, "crlrdf.ImportTriples failed")
+		}
+		el, err := uOfD.RecoverElement(data, trans)
+		if err != nil {
+			return nil, errors.Wrap(err, "crlrdf.ImportTriples failed")
+		}
+		if !isImported[state.OwningConceptID] {
+			roots = append(roots, el)
+		}
+	}
+	return roots, nil
+}
+
+// resourceConceptType returns the ConceptType of the resource and whether it is a CRL concept at all
+func resourceConceptType(resource *importedResource) (core.ConceptType, bool, error) {
+	var conceptType core.ConceptType
+	found := false
+	for _, typeTerm := range resource.properties[RdfType] {
+		var candidate core.ConceptType
+		switch typeTerm.Value {
+		case CrlElementClass:
+			candidate = core.Element
+		case CrlLiteralClass:
+			candidate = core.Literal
+		case CrlReferenceClass:
+			candidate = core.Reference
+		case CrlRefinementClass:
+			candidate = core.Refinement
+		default:
+			continue
+		}
+		if found && candidate != conceptType {
+			return conceptType, false, errors.New("crlrdf.resourceConceptType found more than one CRL class for " + resource.subject.key())
+		}
+		conceptType = candidate
+		found = true
+	}
+	return conceptType, found, nil
+}
+
+// stringValue returns the lexical form of the resource's value for the predicate, or an empty string if it has none
+func stringValue(resource *importedResource, predicate string) string {
+	term, found := resource.value(predicate)
+	if !found {
+		return ""
+	}
+	return term.Value
+}
+
+// booleanValue returns true if the resource's value for the predicate is the boolean true
+func booleanValue(resource *importedResource, predicate string) bool {
+	value := stringValue(resource, predicate)
+	return value == "true" || value == "1"
+}
@@ -0,0 +1,111 @@
+package crlrdf
+
+import (
+	"bytes"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+	"github.com/pbrown12303/activeCRL/core"
+)
+
+var _ = Describe("RDF import tests", func() {
+	var uOfD *core.UniverseOfDiscourse
+	var trans *core.Transaction
+	var domain core.Concept
+	var literal core.Concept
+	var reference core.Concept
+	var refinement core.Concept
+	var uOfD2 *core.UniverseOfDiscourse
+	var trans2 *core.Transaction
+
+	BeforeEach(func() {
+		uOfD = core.NewUniverseOfDiscourse()
+		trans = uOfD.NewTransaction()
+		domain, _ = uOfD.NewElement(trans, "http://activeCrl.com/test/RdfImportDomain")
+		domain.SetLabel("Domain", trans)
+		abstraction, _ := uOfD.NewOwnedElement(domain, "Abstraction", trans)
+		literal, _ = uOfD.NewOwnedLiteral(domain, "Literal", trans)
+		literal.SetLiteralValue("line 1\nline 2", trans)
+		reference, _ = uOfD.NewOwnedReference(domain, "Reference", trans)
+		reference.SetReferencedConcept(literal, core.LiteralValue, trans)
+		refinement, _ = uOfD.NewOwnedRefinement(domain, "Refinement", abstraction, literal, trans)
+		coreReference, _ := uOfD.NewOwnedReference(domain, "Core Reference", trans)
+		coreReference.SetReferencedConcept(uOfD.GetElementWithURI(core.ElementURI), core.NoAttribute, trans)
+		uOfD2 = core.NewUniverseOfDiscourse()
+		trans2 = uOfD2.NewTransaction()
+	})
+
+	AfterEach(func() {
+		trans.ReleaseLocks()
+		trans2.ReleaseLocks()
+	})
+
+	Specify("A domain exported as Turtle should be rebuilt", func() {
+		var buffer bytes.Buffer
+		Expect(ExportTurtle(&buffer, domain, trans)).To(Succeed())
+		roots, err := ImportTurtle(&buffer, uOfD2, trans2)
+		Expect(err).To(BeNil())
+		Expect(roots).To(HaveLen(1))
+		Expect(roots[0].GetConceptID(trans2)).To(Equal(domain.GetConceptID(trans)))
+		// Versions are not part of the vocabulary
+		concepts, err := GetDomainConcepts(domain, trans)
+		Expect(err).To(BeNil())
+		Expect(uOfD2.GetConceptsOwnedConceptIDs(domain.GetConceptID(trans)).Cardinality()).To(Equal(len(concepts) - 1))
+		for _, original := range concepts {
+			originalState, err := core.NewConceptState(original)
+			Expect(err).To(BeNil())
+			recoveredState, err := core.NewConceptState(uOfD2.GetElement(original.GetConceptID(trans)))
+			Expect(err).To(BeNil())
+			originalState.Version = ""
+			recoveredState.Version = ""
+			Expect(recoveredState).To(Equal(originalState))
+		}
+	})
+	Specify("A domain exported as N-Triples should be rebuilt", func() {
+		var buffer bytes.Buffer
+		Expect(ExportNTriples(&buffer, domain, trans)).To(Succeed())
+		roots, err := ImportNTriples(&buffer, uOfD2, trans2)
+		Expect(err).To(BeNil())
+		Expect(roots).To(HaveLen(1))
+		recoveredReference := uOfD2.GetReference(reference.GetConceptID(trans))
+		Expect(recoveredReference.GetReferencedConceptID(trans2)).To(Equal(literal.GetConceptID(trans)))
+		Expect(recoveredReference.GetReferencedAttributeName(trans2)).To(Equal(core.LiteralValue))
+		recoveredRefinement := uOfD2.GetRefinement(refinement.GetConceptID(trans))
+		Expect(recoveredRefinement.GetRefinedConceptID(trans2)).To(Equal(literal.GetConceptID(trans)))
+		Expect(uOfD2.GetLiteral(literal.GetConceptID(trans)).GetLiteralValue(trans2)).To(Equal("line 1\nline 2"))
+	})
+	Specify("Hand-written Turtle should be imported", func() {
+		roots, err := ImportTurtle(strings.NewReader(`@prefix crl: <http://activeCRL.com/crlrdf#> .
+@prefix rdfs: <http://www.w3.org/2000/01/rdf-schema#> .
+<http://example.com/Model> a crl:Element ; rdfs:label "Model" ; crl:uri "http://example.com/Model" .
+<urn:uuid:5c2e6c55-1a4f-4a39-8d43-1a3e7a0e4a11> a crl:Reference ;
+    rdfs:label "To core" ;
+    crl:owner <http://example.com/Model> ;
+    crl:referencedConcept <http://activeCrl.com/core/Element> .
+<http://example.com/Other> rdfs:label "Not a concept" .
+`), uOfD2, trans2)
+		Expect(err).To(BeNil())
+		Expect(roots).To(HaveLen(1))
+		Expect(uOfD2.GetElementWithURI("http://example.com/Model")).To(Equal(roots[0]))
+		imported := uOfD2.GetReference("5c2e6c55-1a4f-4a39-8d43-1a3e7a0e4a11")
+		Expect(imported).ToNot(BeNil())
+		Expect(imported.GetOwningConceptID(trans2)).To(Equal(roots[0].GetConceptID(trans2)))
+		Expect(imported.GetReferencedConcept(trans2)).To(Equal(uOfD2.GetElementWithURI(core.ElementURI)))
+	})
+	Specify("Unresolvable pointers should be reported without changing the uOfD", func() {
+		_, err := ImportTurtle(strings.NewReader(`@prefix crl: <http://activeCRL.com/crlrdf#> .
+<http://example.com/Model> a crl:Element .
+<http://example.com/Ref> a crl:Reference ; crl:referencedConcept <http://example.com/Missing> .
+`), uOfD2, trans2)
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("could not resolve http://example.com/Missing"))
+		Expect(uOfD2.GetElementWithURI("http://example.com/Model")).To(BeNil())
+	})
+	Specify("Concepts already in the uOfD should not be imported again", func() {
+		var buffer bytes.Buffer
+		Expect(ExportTurtle(&buffer, domain, trans)).To(Succeed())
+		_, err := ImportTurtle(&buffer, uOfD, trans)
+		Expect(err).ToNot(BeNil())
+	})
+})
@@ -0,0 +1,545 @@
+package crlrdf
+
+import (
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// ParseTurtle parses Turtle, returning the triples in the order in which they appear. Since N-Triples is a subset of
+// Turtle, it parses N-Triples as well. Collections and blank node property lists are not supported.
+func ParseTurtle(reader io.Reader) ([]Triple, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "crlrdf.ParseTurtle failed")
+	}
+	parser := newTurtleParser(string(data))
+	triples, err := parser.parse()
+	if err != nil {
+		return nil, errors.Wrap(err, "crlrdf.ParseTurtle failed")
+	}
+	return triples, nil
+}
+
+// turtleParser is a recursive descent parser for Turtle
+type turtleParser struct {
+	input    []rune
+	pos      int
+	line     int
+	prefixes map[string]string
+	base     *url.URL
+	triples  []Triple
+}
+
+func newTurtleParser(input string) *turtleParser {
+	var parser turtleParser
+	parser.input = []rune(input)
+	parser.line = 1
+	parser.prefixes = make(map[string]string)
+	return &parser
+}
+
+// errorf returns an error identifying the line being parsed
+func (p *turtleParser) errorf(format string, args ...interface{}) error {
+	return errors.Errorf("line %d: "+format, append([]interface{}{p.line}, args...)...)
+}
+
+// peekAt returns the rune at the given offset from the current position, or -1 beyond the end of the input
+func (p *turtleParser) peekAt(offset int) rune {
+	if p.pos+offset >= len(p.input) {
+		return -1
+	}
+	return p.input[p.pos+offset]
+}
+
+func (p *turtleParser) peek() rune {
+	return p.peekAt(0)
+}
+
+func (p *turtleParser) next() rune {
+	r := p.peek()
+	if r == '\n' {
+		p.line++
+	}
+	if r != -1 {
+		p.pos++
+	}
+	return r
+}
+
+func (p *turtleParser) atEnd() bool {
+	return p.pos >= len(p.input)
+}
+
+// hasPrefix determines whether the remaining input starts with the string, ignoring case if requested
+func (p *turtleParser) hasPrefix(value string, ignoreCase bool) bool {
+	valueRunes := []rune(value)
+	if p.pos+len(valueRunes) > len(p.input) {
+		return false
+	}
+	candidate := string(p.input[p.pos : p.pos+len(valueRunes)])
+	if ignoreCase {
+		return strings.EqualFold(candidate, value)
+	}
+	return candidate == value
+}
+
+// skipWhitespace skips whitespace and comments
+func (p *turtleParser) skipWhitespace() {
+	for !p.atEnd() {
+		r := p.peek()
+		switch {
+		case r == '#':
+			for !p.atEnd() && p.peek() != '\n' {
+				p.next()
+			}
+		case unicode.IsSpace(r):
+			p.next()
+		default:
+			return
+		}
+	}
+}
+
+func (p *turtleParser) expect(r rune) error {
+	if p.peek() != r {
+		return p.errorf("expected '%c'", r)
+	}
+	p.next()
+	return nil
+}
+
+func (p *turtleParser) parse() ([]Triple, error) {
+	for {
+		p.skipWhitespace()
+		if p.atEnd() {
+			return p.triples, nil
+		}
+		var err error
+		switch {
+		case p.hasPrefix("@prefix", false):
+			err = p.parsePrefix(len("@prefix"), true)
+		case p.hasPrefix("@base", false):
+			err = p.parseBase(len("@base"), true)
+		case p.hasPrefix("PREFIX", true) && unicode.IsSpace(p.peekAt(len("PREFIX"))):
+			err = p.parsePrefix(len("PREFIX"), false)
+		case p.hasPrefix("BASE", true) && unicode.IsSpace(p.peekAt(len("BASE"))):
+			err = p.parseBase(len("BASE"), false)
+		default:
+			err = p.parseTriples()
+			if err == nil {
+				p.skipWhitespace()
+				err = p.expect('.')
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parsePrefix parses a prefix directive, the keyword of which has the given length
+func (p *turtleParser) parsePrefix(keywordLength int, terminated bool) error {
+	p.pos += keywordLength
+	p.skipWhitespace()
+	var prefix strings.Builder
+	for isNameRune(p.peek()) {
+		prefix.WriteRune(p.next())
+	}
+	err := p.expect(':')
+	if err != nil {
+		return err
+	}
+	p.skipWhitespace()
+	iri, err := p.parseIRIRef()
+	if err != nil {
+		return err
+	}
+	p.prefixes[prefix.String()] = iri
+	if terminated {
+		p.skipWhitespace()
+		return p.expect('.')
+	}
+	return nil
+}
+
+// parseBase parses a base directive, the keyword of which has the given length
+func (p *turtleParser) parseBase(keywordLength int, terminated bool) error {
+	p.pos += keywordLength
+	p.skipWhitespace()
+	iri, err := p.parseIRIRef()
+	if err != nil {
+		return err
+	}
+	p.base, err = url.Parse(iri)
+	if err != nil {
+		return p.errorf("invalid base IRI %s", iri)
+	}
+	if terminated {
+		p.skipWhitespace()
+		return p.expect('.')
+	}
+	return nil
+}
+
+// parseTriples parses a subject and its predicate-object list
+func (p *turtleParser) parseTriples() error {
+	subject, err := p.parseSubject()
+	if err != nil {
+		return err
+	}
+	for {
+		p.skipWhitespace()
+		predicate, err := p.parseVerb()
+		if err != nil {
+			return err
+		}
+		for {
+			p.skipWhitespace()
+			object, err := p.parseObject()
+			if err != nil {
+				return err
+			}
+			p.triples = append(p.triples, Triple{Subject: subject, Predicate: predicate, Object: object})
+			p.skipWhitespace()
+			if p.peek() != ',' {
+				break
+			}
+			p.next()
+		}
+		if p.peek() != ';' {
+			return nil
+		}
+		for p.peek() == ';' {
+			p.next()
+			p.skipWhitespace()
+		}
+		if p.peek() == '.' || p.atEnd() {
+			return nil
+		}
+	}
+}
+
+func (p *turtleParser) parseSubject() (Term, error) {
+	switch p.peek() {
+	case '[', '(':
+		return Term{}, p.errorf("blank node property lists and collections are not supported")
+	case '_':
+		return p.parseBlankNode()
+	}
+	iri, err := p.parseIRI()
+	if err != nil {
+		return Term{}, err
+	}
+	return NewIRI(iri), nil
+}
+
+func (p *turtleParser) parseVerb() (Term, error) {
+	if p.peek() == 'a' && (unicode.IsSpace(p.peekAt(1)) || p.peekAt(1) == '<' || p.peekAt(1) == '_') {
+		p.next()
+		return NewIRI(RdfType), nil
+	}
+	iri, err := p.parseIRI()
+	if err != nil {
+		return Term{}, err
+	}
+	return NewIRI(iri), nil
+}
+
+func (p *turtleParser) parseObject() (Term, error) {
+	r := p.peek()
+	switch {
+	case r == '[' || r == '(':
+		return Term{}, p.errorf("blank node property lists and collections are not supported")
+	case r == '_' && p.peekAt(1) == ':':
+		return p.parseBlankNode()
+	case r == '"' || r == '\'':
+		return p.parseLiteral()
+	case r == '+' || r == '-' || (r >= '0' && r <= '9') || (r == '.' && p.peekAt(1) >= '0' && p.peekAt(1) <= '9'):
+		return p.parseNumber()
+	case p.isKeyword("true") || p.isKeyword("false"):
+		value := "true"
+		if p.isKeyword("false") {
+			value = "false"
+		}
+		p.pos += len(value)
+		return NewLiteral(value, XsdBoolean), nil
+	}
+	iri, err := p.parseIRI()
+	if err != nil {
+		return Term{}, err
+	}
+	return NewIRI(iri), nil
+}
+
+// isKeyword determines whether the input continues with the keyword as a complete token rather than as the start of a
+// prefixed name
+func (p *turtleParser) isKeyword(keyword string) bool {
+	if !p.hasPrefix(keyword, false) {
+		return false
+	}
+	following := p.peekAt(len(keyword))
+	return following == -1 || !(isNameRune(following) || following == ':')
+}
+
+func (p *turtleParser) parseBlankNode() (Term, error) {
+	if !p.hasPrefix("_:", false) {
+		return Term{}, p.errorf("expected blank node")
+	}
+	p.pos += 2
+	label := p.readName()
+	if label == "" {
+		return Term{}, p.errorf("blank node has no label")
+	}
+	return NewBlankNode(label), nil
+}
+
+// parseIRI parses either an IRI reference or a prefixed name, returning the absolute IRI
+func (p *turtleParser) parseIRI() (string, error) {
+	if p.peek() == '<' {
+		return p.parseIRIRef()
+	}
+	return p.parsePrefixedName()
+}
+
+func (p *turtleParser) parseIRIRef() (string, error) {
+	err := p.expect('<')
+	if err != nil {
+		return "", err
+	}
+	var iri strings.Builder
+	for {
+		r := p.next()
+		switch {
+		case r == -1:
+			return "", p.errorf("unterminated IRI")
+		case r == '>':
+			return p.resolve(iri.String())
+		case r == '\\':
+			decoded, err := p.parseUnicodeEscape()
+			if err != nil {
+				return "", err
+			}
+			iri.WriteRune(decoded)
+		case r <= 0x20:
+			return "", p.errorf("invalid character in IRI")
+		default:
+			iri.WriteRune(r)
+		}
+	}
+}
+
+// resolve resolves a relative IRI against the base, if any
+func (p *turtleParser) resolve(iri string) (string, error) {
+	if p.base == nil {
+		return iri, nil
+	}
+	reference, err := url.Parse(iri)
+	if err != nil {
+		return "", p.errorf("invalid IRI %s", iri)
+	}
+	if reference.IsAbs() {
+		return iri, nil
+	}
+	return p.base.ResolveReference(reference).String(), nil
+}
+
+func (p *turtleParser) parsePrefixedName() (string, error) {
+	var prefix strings.Builder
+	for isNameRune(p.peek()) {
+		prefix.WriteRune(p.next())
+	}
+	if p.peek() != ':' {
+		return "", p.errorf("expected IRI or prefixed name")
+	}
+	p.next()
+	namespace, found := p.prefixes[prefix.String()]
+	if !found {
+		return "", p.errorf("undeclared prefix %s", prefix.String())
+	}
+	var local strings.Builder
+	for {
+		r := p.peek()
+		if r == '\\' && p.peekAt(1) != -1 && strings.ContainsRune("_~.-!$&'()*+,;=/?#@%", p.peekAt(1)) {
+			p.next()
+			local.WriteRune(p.next())
+			continue
+		}
+		if !(isNameRune(r) || r == ':' || r == '%') {
+			break
+		}
+		local.WriteRune(p.next())
+	}
+	localName := local.String()
+	// A trailing '.' terminates the statement rather than belonging to the name
+	for strings.HasSuffix(localName, ".") {
+		localName = strings.TrimSuffix(localName, ".")
+		p.pos--
+	}
+	return namespace + localName, nil
+}
+
+// readName reads a blank node label, leaving any trailing '.' unread
+func (p *turtleParser) readName() string {
+	var name strings.Builder
+	for isNameRune(p.peek()) {
+		name.WriteRune(p.next())
+	}
+	result := name.String()
+	for strings.HasSuffix(result, ".") {
+		result = strings.TrimSuffix(result, ".")
+		p.pos--
+	}
+	return result
+}
+
+func (p *turtleParser) parseLiteral() (Term, error) {
+	quote := p.next()
+	long := p.peek() == quote && p.peekAt(1) == quote
+	if long {
+		p.pos += 2
+	}
+	var value strings.Builder
+	for {
+		r := p.next()
+		switch {
+		case r == -1:
+			return Term{}, p.errorf("unterminated string")
+		case r == quote && !long:
+			return p.parseLiteralSuffix(value.String())
+		case r == quote && p.peek() == quote && p.peekAt(1) == quote:
+			p.pos += 2
+			return p.parseLiteralSuffix(value.String())
+		case (r == '\n' || r == '\r') && !long:
+			return Term{}, p.errorf("unterminated string")
+		case r == '\\':
+			decoded, err := p.parseStringEscape()
+			if err != nil {
+				return Term{}, err
+			}
+			value.WriteRune(decoded)
+		default:
+			value.WriteRune(r)
+		}
+	}
+}
+
+// parseLiteralSuffix parses the language tag or datatype, if any, that follows a string
+func (p *turtleParser) parseLiteralSuffix(value string) (Term, error) {
+	if p.peek() == '@' {
+		p.next()
+		var language strings.Builder
+		for r := p.peek(); (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-'; r = p.peek() {
+			language.WriteRune(p.next())
+		}
+		if language.Len() == 0 {
+			return Term{}, p.errorf("empty language tag")
+		}
+		return NewLanguageLiteral(value, language.String()), nil
+	}
+	if p.hasPrefix("^^", false) {
+		p.pos += 2
+		datatype, err := p.parseIRI()
+		if err != nil {
+			return Term{}, err
+		}
+		return NewLiteral(value, datatype), nil
+	}
+	return NewLiteral(value, XsdString), nil
+}
+
+func (p *turtleParser) parseStringEscape() (rune, error) {
+	r := p.peek()
+	switch r {
+	case 't':
+		p.next()
+		return '\t', nil
+	case 'b':
+		p.next()
+		return '\b', nil
+	case 'n':
+		p.next()
+		return '\n', nil
+	case 'r':
+		p.next()
+		return '\r', nil
+	case 'f':
+		p.next()
+		return '\f', nil
+	case '"', '\'', '\\':
+		p.next()
+		return r, nil
+	}
+	return p.parseUnicodeEscape()
+}
+
+// parseUnicodeEscape parses the \uXXXX or \UXXXXXXXX escape following a backslash
+func (p *turtleParser) parseUnicodeEscape() (rune, error) {
+	length := 0
+	switch p.peek() {
+	case 'u':
+		length = 4
+	case 'U':
+		length = 8
+	default:
+		return 0, p.errorf("invalid escape sequence")
+	}
+	p.next()
+	if p.pos+length > len(p.input) {
+		return 0, p.errorf("truncated escape sequence")
+	}
+	code, err := strconv.ParseUint(string(p.input[p.pos:p.pos+length]), 16, 32)
+	if err != nil {
+		return 0, p.errorf("invalid escape sequence")
+	}
+	p.pos += length
+	return rune(code), nil
+}
+
+func (p *turtleParser) parseNumber() (Term, error) {
+	var number strings.Builder
+	isDigit := func(r rune) bool { return r >= '0' && r <= '9' }
+	if p.peek() == '+' || p.peek() == '-' {
+		number.WriteRune(p.next())
+	}
+	for isDigit(p.peek()) {
+		number.WriteRune(p.next())
+	}
+	datatype := XsdInteger
+	if p.peek() == '.' && isDigit(p.peekAt(1)) {
+		datatype = XsdDecimal
+		number.WriteRune(p.next())
+		for isDigit(p.peek()) {
+			number.WriteRune(p.next())
+		}
+	}
+	if p.peek() == 'e' || p.peek() == 'E' {
+		datatype = XsdDouble
+		number.WriteRune(p.next())
+		if p.peek() == '+' || p.peek() == '-' {
+			number.WriteRune(p.next())
+		}
+		if !isDigit(p.peek()) {
+			return Term{}, p.errorf("invalid exponent")
+		}
+		for isDigit(p.peek()) {
+			number.WriteRune(p.next())
+		}
+	}
+	value := number.String()
+	if value == "" || value == "+" || value == "-" {
+		return Term{}, p.errorf("invalid number")
+	}
+	return NewLiteral(value, datatype), nil
+}
+
+// isNameRune determines whether the rune may appear in a prefix, the local part of a prefixed name, or a blank node
+// label
+func isNameRune(r rune) bool {
+	return r == '_' || r == '-' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
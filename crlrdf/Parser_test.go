@@ -0,0 +1,50 @@
+package crlrdf
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Turtle parser tests", func() {
+	Specify("N-Triples should be parsed", func() {
+		triples, err := ParseTurtle(strings.NewReader(`# comment
+<http://example.com/s> <http://example.com/p> "a \"b\"\né" .
+_:b1 <http://example.com/p> <http://example.com/o> .
+<http://example.com/s> <http://example.com/q> "chat"@fr .
+`))
+		Expect(err).To(BeNil())
+		Expect(triples).To(HaveLen(3))
+		Expect(triples[0].Object).To(Equal(NewLiteral("a \"b\"\né", XsdString)))
+		Expect(triples[1].Subject).To(Equal(NewBlankNode("b1")))
+		Expect(triples[2].Object).To(Equal(NewLanguageLiteral("chat", "fr")))
+	})
+	Specify("Turtle abbreviations should be expanded", func() {
+		triples, err := ParseTurtle(strings.NewReader(`@prefix ex: <http://example.com/> .
+PREFIX xsd: <http://www.w3.org/2001/XMLSchema#>
+@base <http://example.com/base/> .
+ex:s a ex:Thing ;
+    ex:p ex:o1, <relative> ;
+    ex:n 42, -1.5, 2e3, true ;
+    ex:t """long
+string"""^^xsd:string ;
+    .
+`))
+		Expect(err).To(BeNil())
+		Expect(triples).To(HaveLen(8))
+		Expect(triples[0]).To(Equal(Triple{NewIRI("http://example.com/s"), NewIRI(RdfType), NewIRI("http://example.com/Thing")}))
+		Expect(triples[2].Object).To(Equal(NewIRI("http://example.com/base/relative")))
+		Expect(triples[3].Object).To(Equal(NewLiteral("42", XsdInteger)))
+		Expect(triples[4].Object).To(Equal(NewLiteral("-1.5", XsdDecimal)))
+		Expect(triples[5].Object).To(Equal(NewLiteral("2e3", XsdDouble)))
+		Expect(triples[6].Object).To(Equal(NewLiteral("true", XsdBoolean)))
+		Expect(triples[7].Object).To(Equal(NewLiteral("long\nstring", XsdString)))
+	})
+	Specify("Errors should identify the line", func() {
+		_, err := ParseTurtle(strings.NewReader("<http://example.com/s>\n  undeclared:p <http://example.com/o> ."))
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("line 2"))
+		Expect(err.Error()).To(ContainSubstring("undeclared prefix undeclared"))
+	})
+})
@@ -0,0 +1,125 @@
+package crlrdf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TermKind identifies the kind of an RDF term
+type TermKind int
+
+// The kinds of RDF terms
+const (
+	IRI TermKind = iota
+	BlankNode
+	Literal
+)
+
+// Term is an RDF term. The Value of an IRI is the IRI, that of a blank node is its label, and that of a literal is
+// its lexical form. Literals have either a Datatype or a Language.
+type Term struct {
+	Kind     TermKind
+	Value    string
+	Datatype string
+	Language string
+}
+
+// NewIRI returns an IRI term
+func NewIRI(iri string) Term {
+	return Term{Kind: IRI, Value: iri}
+}
+
+// NewBlankNode returns a blank node term
+func NewBlankNode(label string) Term {
+	return Term{Kind: BlankNode, Value: label}
+}
+
+// NewLiteral returns a literal term with the given datatype. An empty datatype is xsd:string.
+func NewLiteral(value string, datatype string) Term {
+	if datatype == "" {
+		datatype = XsdString
+	}
+	return Term{Kind: Literal, Value: value, Datatype: datatype}
+}
+
+// NewLanguageLiteral returns a literal term with a language tag
+func NewLanguageLiteral(value string, language string) Term {
+	return Term{Kind: Literal, Value: value, Datatype: rdfLangString, Language: language}
+}
+
+// key returns a string that uniquely identifies the term among subjects
+func (term Term) key() string {
+	if term.Kind == BlankNode {
+		return "_:" + term.Value
+	}
+	return term.Value
+}
+
+// String returns the N-Triples representation of the term
+func (term Term) String() string {
+	switch term.Kind {
+	case IRI:
+		return "<" + escapeIRI(term.Value) + ">"
+	case BlankNode:
+		return "_:" + term.Value
+	}
+	literal := "\"" + escapeString(term.Value) + "\""
+	if term.Language != "" {
+		return literal + "@" + term.Language
+	}
+	if term.Datatype != "" && term.Datatype != XsdString {
+		return literal + "^^<" + escapeIRI(term.Datatype) + ">"
+	}
+	return literal
+}
+
+// Triple is an RDF statement
+type Triple struct {
+	Subject   Term
+	Predicate Term
+	Object    Term
+}
+
+// String returns the N-Triples representation of the triple, without the terminating newline
+func (triple Triple) String() string {
+	return triple.Subject.String() + " " + triple.Predicate.String() + " " + triple.Object.String() + " ."
+}
+
+// escapeString escapes a string for use in a quoted N-Triples or Turtle literal
+func escapeString(value string) string {
+	var builder strings.Builder
+	for _, r := range value {
+		switch r {
+		case '\\':
+			builder.WriteString("\\\\")
+		case '"':
+			builder.WriteString("\\\"")
+		case '\n':
+			builder.WriteString("\\n")
+		case '\r':
+			builder.WriteString("\\r")
+		case '\t':
+			builder.WriteString("\\t")
+		default:
+			if r < 0x20 || r == 0x7f {
+				builder.WriteString(fmt.Sprintf("\\u%04X", r))
+			} else {
+				builder.WriteRune(r)
+			}
+		}
+	}
+	return builder.String()
+}
+
+// escapeIRI escapes the characters that may not appear in an IRI reference
+func escapeIRI(iri string) string {
+	var builder strings.Builder
+	for _, r := range iri {
+		if r <= 0x20 || strings.ContainsRune("<>\"{}|^`\\", r) {
+			builder.WriteString(fmt.Sprintf("\\u%04X", r))
+		} else {
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
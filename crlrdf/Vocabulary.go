@@ -0,0 +1,81 @@
+// Package crlrdf exports CRL domains as RDF, serialized as Turtle or N-Triples, and rebuilds CRL concepts from RDF
+// expressed in the same vocabulary.
+//
+// Each concept is a resource. Its IRI is the concept's URI when the URI is an absolute IRI, and urn:uuid:<ConceptID>
+// otherwise. The vocabulary, whose namespace is CrlRdfNamespace (prefix "crl"), is:
+//
+//	rdf:type                     crl:Element, crl:Literal, crl:Reference or crl:Refinement
+//	crl:conceptID                the ConceptID (xsd:string)
+//	crl:uri                      the URI, if any (xsd:anyURI)
+//	rdfs:label                   the label, if any
+//	crl:definition               the definition, if any
+//	crl:owner                    the owning concept (ownership)
+//	crl:literalValue             the value of a literal
+//	crl:referencedConcept        the concept indicated by a reference
+//	crl:referencedAttributeName  the attribute of the referenced concept indicated by a reference, if any
+//	crl:abstractConcept          the abstract concept of a refinement
+//	crl:refinedConcept           the refined concept of a refinement
+//	crl:abstraction              the abstract concept of each refinement, attached to its refined concept
+//	crl:isCore                   true if the concept is a core concept (xsd:boolean, omitted when false)
+//	crl:readOnly                 true if the concept is read-only (xsd:boolean, omitted when false)
+//
+// crl:abstraction is derived from the refinements for the convenience of queries and is ignored on import.
+package crlrdf
+
+// CrlRdfNamespace is the namespace of the CRL RDF vocabulary
+const CrlRdfNamespace = "http://activeCRL.com/crlrdf#"
+
+// Namespaces of the standard vocabularies used by the CRL RDF vocabulary
+const (
+	RdfNamespace  = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	RdfsNamespace = "http://www.w3.org/2000/01/rdf-schema#"
+	XsdNamespace  = "http://www.w3.org/2001/XMLSchema#"
+)
+
+// The classes of the CRL RDF vocabulary
+const (
+	CrlElementClass    = CrlRdfNamespace + "Element"
+	CrlLiteralClass    = CrlRdfNamespace + "Literal"
+	CrlReferenceClass  = CrlRdfNamespace + "Reference"
+	CrlRefinementClass = CrlRdfNamespace + "Refinement"
+)
+
+// The properties of the CRL RDF vocabulary
+const (
+	CrlConceptIDProperty               = CrlRdfNamespace + "conceptID"
+	CrlURIProperty                     = CrlRdfNamespace + "uri"
+	CrlDefinitionProperty              = CrlRdfNamespace + "definition"
+	CrlOwnerProperty                   = CrlRdfNamespace + "owner"
+	CrlLiteralValueProperty            = CrlRdfNamespace + "literalValue"
+	CrlReferencedConceptProperty       = CrlRdfNamespace + "referencedConcept"
+	CrlReferencedAttributeNameProperty = CrlRdfNamespace + "referencedAttributeName"
+	CrlAbstractConceptProperty         = CrlRdfNamespace + "abstractConcept"
+	CrlRefinedConceptProperty          = CrlRdfNamespace + "refinedConcept"
+	CrlAbstractionProperty             = CrlRdfNamespace + "abstraction"
+	CrlIsCoreProperty                  = CrlRdfNamespace + "isCore"
+	CrlReadOnlyProperty                = CrlRdfNamespace + "readOnly"
+)
+
+// Terms from the standard vocabularies
+const (
+	RdfType       = RdfNamespace + "type"
+	RdfsLabel     = RdfsNamespace + "label"
+	XsdString     = XsdNamespace + "string"
+	XsdBoolean    = XsdNamespace + "boolean"
+	XsdAnyURI     = XsdNamespace + "anyURI"
+	XsdInteger    = XsdNamespace + "integer"
+	XsdDecimal    = XsdNamespace + "decimal"
+	XsdDouble     = XsdNamespace + "double"
+	rdfLangString = RdfNamespace + "langString"
+)
+
+// turtlePrefixes are the prefixes declared in exported Turtle, in the order in which they are declared
+var turtlePrefixes = []struct {
+	prefix    string
+	namespace string
+}{
+	{"crl", CrlRdfNamespace},
+	{"rdf", RdfNamespace},
+	{"rdfs", RdfsNamespace},
+	{"xsd", XsdNamespace},
+}
@@ -0,0 +1,13 @@
+package crlrdf
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+)
+
+func TestCrlRdf(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "CrlRdf Suite")
+}